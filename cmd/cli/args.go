@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var errUnterminatedQuote = errors.New("unterminated quote")
+
+// splitArgs splits a line into whitespace-separated arguments. An argument in
+// double quotes may hold spaces and Go escapes such as \n, \t or \x00, so keys
+// and values that the text protocol can not carry can be typed.
+func splitArgs(line string) ([][]byte, error) {
+	var args [][]byte
+	for {
+		line = strings.TrimLeftFunc(line, unicode.IsSpace)
+		if line == "" {
+			return args, nil
+		}
+
+		if line[0] != '"' {
+			end := strings.IndexFunc(line, unicode.IsSpace)
+			if end < 0 {
+				end = len(line)
+			}
+			args = append(args, []byte(line[:end]))
+			line = line[end:]
+
+			continue
+		}
+
+		end := quotedEnd(line)
+		if end < 0 {
+			return nil, errUnterminatedQuote
+		}
+
+		arg, err := strconv.Unquote(line[:end])
+		if err != nil {
+			return nil, fmt.Errorf("invalid quoted argument %s: %w", line[:end], err)
+		}
+		args = append(args, []byte(arg))
+		line = line[end:]
+	}
+}
+
+// quotedEnd returns the index just past the closing quote of the quoted
+// string line starts with, or -1 if it is not closed.
+func quotedEnd(line string) int {
+	for i := 1; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+
+	return -1
+}
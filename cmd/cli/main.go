@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/crunchydeer30/key-value-database/internal/database/compute"
 	"github.com/crunchydeer30/key-value-database/internal/network"
 	"github.com/peterh/liner"
 )
@@ -27,8 +28,10 @@ func main() {
 		fmt.Fprintf(os.Stderr, "Error connecting to server: %v\n", err)
 		return
 	}
-	//nolint:errcheck
-	defer client.Close()
+	defer func() {
+		//nolint:errcheck
+		client.Close()
+	}()
 
 	fmt.Println("Connected to server")
 
@@ -59,14 +62,50 @@ func main() {
 			line.AppendHistory(input)
 		}
 
-		result, err := client.Send([]byte(input))
+		args, err := splitArgs(input)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing input: %v\n", err)
+			continue
+		}
+		request := compute.EncodeRequest(args...)
+
+		result, err := client.Send(request)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error sending message: %v\n", err)
 			continue
 		}
-		result = append(result, '\n')
+
+		reply, err := compute.DecodeReply(result)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error decoding reply: %v\n", err)
+			continue
+		}
+
+		if reply.Kind == compute.ReplyRedirect {
+			fmt.Println("Redirected to leader at", reply.Text, "...")
+
+			redirected, err := network.NewTCPClient(reply.Text)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error connecting to leader: %v\n", err)
+				continue
+			}
+			//nolint:errcheck
+			client.Close()
+			client = redirected
+
+			result, err = client.Send(request)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error sending message: %v\n", err)
+				continue
+			}
+
+			if reply, err = compute.DecodeReply(result); err != nil {
+				fmt.Fprintf(os.Stderr, "Error decoding reply: %v\n", err)
+				continue
+			}
+		}
 
 		//nolint:forbidigo
-		fmt.Print(string(result))
+		fmt.Println(formatReply(reply))
 	}
 }
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/compute"
+)
+
+// formatReply renders a reply the way redis-cli does: arrays as numbered
+// elements, nested arrays indented under their number, and text quoted if it
+// could not be told apart otherwise.
+func formatReply(reply compute.Reply) string {
+	var b strings.Builder
+	writeReply(&b, reply, 0)
+
+	return b.String()
+}
+
+func writeReply(b *strings.Builder, reply compute.Reply, indent int) {
+	switch reply.Kind {
+	case compute.ReplyNil:
+		b.WriteString("(nil)")
+	case compute.ReplyRedirect:
+		b.WriteString("(redirect) " + reply.Text)
+	case compute.ReplyArray:
+		if len(reply.Elements) == 0 {
+			b.WriteString("(empty)")
+			return
+		}
+
+		for i, element := range reply.Elements {
+			prefix := strconv.Itoa(i+1) + ") "
+			if i > 0 {
+				b.WriteString("\n" + strings.Repeat(" ", indent))
+			}
+			b.WriteString(prefix)
+			writeReply(b, element, indent+len(prefix))
+		}
+	default:
+		b.WriteString(quoteIfNeeded(reply.Text))
+	}
+}
+
+// quoteIfNeeded quotes text that is empty, would read as (nil) or (empty), or
+// holds characters that do not print on one line, the way splitArgs takes it
+// back.
+func quoteIfNeeded(text string) string {
+	if text == "" || text == "(nil)" || text == "(empty)" || strings.HasPrefix(text, `"`) {
+		return strconv.Quote(text)
+	}
+
+	for _, r := range text {
+		if r != ' ' && !unicode.IsPrint(r) {
+			return strconv.Quote(text)
+		}
+	}
+
+	return text
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/crunchydeer30/key-value-database/internal/config"
 	"github.com/crunchydeer30/key-value-database/internal/database"
@@ -32,14 +34,14 @@ func main() {
 		os.Exit(1)
 	}
 
-	db, err := database.NewDatabase(logger)
+	db, err := database.NewDatabase(cfg, logger)
 	if err != nil {
 		logger.Fatal("failed to initialize database", zap.Error(err))
 	}
 
-	server, err := network.NewTCPServer(
+	server, err := network.NewSessionTCPServer(
 		cfg.Network.Address,
-		db.HandleQuery,
+		func() network.Handler { return db.NewSession().HandleQuery },
 		network.WithLogger(logger),
 		network.WithMaxConnections(cfg.Network.MaxConnections),
 	)
@@ -47,5 +49,19 @@ func main() {
 		logger.Fatal("failed to initialize network server", zap.Error(err))
 	}
 
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		<-signals
+
+		if err := server.Close(); err != nil {
+			logger.Error("failed to close network server", zap.Error(err))
+		}
+	}()
+
 	server.Serve()
+
+	if err := db.Close(); err != nil {
+		logger.Error("failed to close database", zap.Error(err))
+	}
 }
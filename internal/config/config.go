@@ -2,6 +2,8 @@ package config
 
 import (
 	"errors"
+	"fmt"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/spf13/viper"
@@ -14,13 +16,34 @@ var (
 )
 
 type Config struct {
-	Engine  EngineConfig  `mapstructure:"engine"`
-	Logger  LoggerConfig  `mapstructure:"logger"`
-	Network NetworkConfig `mapstructure:"network"`
+	Engine      EngineConfig       `mapstructure:"engine"`
+	Logger      LoggerConfig       `mapstructure:"logger"`
+	Network     NetworkConfig      `mapstructure:"network"`
+	WAL         *WALConfig         `mapstructure:"wal" validate:"required_with=Snapshot Replication"`
+	Snapshot    *SnapshotConfig    `mapstructure:"snapshot"`
+	Replication *ReplicationConfig `mapstructure:"replication"`
+	Cluster     *ClusterConfig     `mapstructure:"cluster" validate:"excluded_with=WAL Replication"`
+	// Databases is the number of logical databases clients pick from with
+	// SELECT.
+	Databases int `mapstructure:"databases" validate:"min=1"`
 }
 
+// EngineConfig selects the storage engine. The settings of each engine live
+// in a section named after it, which the engine decodes itself.
 type EngineConfig struct {
-	Type string `validate:"required,oneof=in_memory"`
+	Type           string         `validate:"required"`
+	MaxMemory      int64          `mapstructure:"max_memory" validate:"min=0"`
+	EvictionPolicy string         `mapstructure:"eviction_policy" validate:"omitempty,oneof=noeviction allkeys-lru allkeys-lfu volatile-ttl random"`
+	History        *HistoryConfig `mapstructure:"history"`
+	Sections       map[string]any `mapstructure:",remain"`
+}
+
+// HistoryConfig turns on the history of keys: the engine keeps the last
+// MaxVersions values of every key, and drops those older than MaxAge if it
+// is set.
+type HistoryConfig struct {
+	MaxVersions int           `mapstructure:"max_versions" validate:"min=1"`
+	MaxAge      time.Duration `mapstructure:"max_age" validate:"omitempty,min=1s"`
 }
 
 type LoggerConfig struct {
@@ -34,6 +57,44 @@ type NetworkConfig struct {
 	MaxMessageSize int    `mapstructure:"max_message_size" validate:"min=1"`
 }
 
+type WALConfig struct {
+	DataDirectory  string        `mapstructure:"data_directory" validate:"required"`
+	MaxSegmentSize int64         `mapstructure:"max_segment_size" validate:"omitempty,min=1"`
+	FlushPolicy    string        `mapstructure:"flush_policy" validate:"omitempty,oneof=always batch os"`
+	FlushInterval  time.Duration `mapstructure:"flush_interval" validate:"omitempty,min=1ms"`
+}
+
+type SnapshotConfig struct {
+	DataDirectory string        `mapstructure:"data_directory" validate:"required"`
+	Interval      time.Duration `mapstructure:"interval" validate:"omitempty,min=1s"`
+}
+
+type ReplicationConfig struct {
+	Address       string        `mapstructure:"address" validate:"required_without=LeaderAddress"`
+	LeaderAddress string        `mapstructure:"leader_address"`
+	ReplicaID     string        `mapstructure:"replica_id" validate:"required_with=LeaderAddress"`
+	SyncInterval  time.Duration `mapstructure:"sync_interval" validate:"omitempty,min=1ms"`
+	MaxLag        uint64        `mapstructure:"max_lag"`
+	WriteQuorum   int           `mapstructure:"write_quorum" validate:"min=0"`
+	QuorumTimeout time.Duration `mapstructure:"quorum_timeout" validate:"omitempty,min=1ms"`
+}
+
+type ClusterConfig struct {
+	NodeID            string        `mapstructure:"node_id" validate:"required"`
+	Address           string        `mapstructure:"address" validate:"required"`
+	DataDirectory     string        `mapstructure:"data_directory" validate:"required"`
+	ElectionTimeout   time.Duration `mapstructure:"election_timeout" validate:"omitempty,min=10ms"`
+	HeartbeatInterval time.Duration `mapstructure:"heartbeat_interval" validate:"omitempty,min=1ms"`
+	SnapshotThreshold uint64        `mapstructure:"snapshot_threshold"`
+	Peers             []PeerConfig  `mapstructure:"peers" validate:"dive"`
+}
+
+type PeerConfig struct {
+	ID            string `mapstructure:"id" validate:"required"`
+	Address       string `mapstructure:"address" validate:"required"`
+	ClientAddress string `mapstructure:"client_address" validate:"required"`
+}
+
 func Load(path string) (*Config, error) {
 	viper.SetConfigFile(path)
 
@@ -44,6 +105,7 @@ func Load(path string) (*Config, error) {
 	viper.SetDefault("network.address", "127.0.0.1:3223")
 	viper.SetDefault("network.max_connections", 100)
 	viper.SetDefault("network.max_message_size", 4096)
+	viper.SetDefault("databases", 1)
 
 	if err := viper.ReadInConfig(); err != nil {
 		return nil, errors.Join(ErrReadConfigFailed, err)
@@ -61,3 +123,31 @@ func Load(path string) (*Config, error) {
 
 	return &cfg, nil
 }
+
+// DecodeSection decodes a section of the config that only the code using it
+// knows the shape of, such as the settings of an engine, into target and
+// validates it. A nil section leaves target as it is before validation.
+func DecodeSection(section any, target any) error {
+	v := viper.New()
+
+	if section != nil {
+		values, ok := section.(map[string]any)
+		if !ok {
+			return errors.Join(ErrUnmarshalFailed, fmt.Errorf("expected a section, got %T", section))
+		}
+
+		if err := v.MergeConfigMap(values); err != nil {
+			return errors.Join(ErrUnmarshalFailed, err)
+		}
+	}
+
+	if err := v.Unmarshal(target); err != nil {
+		return errors.Join(ErrUnmarshalFailed, err)
+	}
+
+	if err := validator.New().Struct(target); err != nil {
+		return errors.Join(ErrValidationFailed, err)
+	}
+
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"os"
 	"testing"
+	"time"
 )
 
 func createTempConfigFile(t *testing.T, yml string) string {
@@ -83,3 +84,231 @@ func TestLoadConfigInvalidPath(t *testing.T) {
 		t.Errorf("expected error type %v, got %v", ErrReadConfigFailed, err)
 	}
 }
+
+func TestLoadWALConfig(t *testing.T) {
+	yml := createYmlConfig("in_memory", "debug", "stdout") +
+		"wal:\n" +
+		"  data_directory: /tmp/wal\n" +
+		"  flush_policy: always\n" +
+		"  flush_interval: 5ms\n"
+
+	cfg, err := Load(createTempConfigFile(t, yml))
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+
+	if cfg.WAL == nil {
+		t.Fatal("expected wal config, got nil")
+	}
+
+	if cfg.WAL.FlushPolicy != "always" {
+		t.Errorf("expected flush policy %v, got %v", "always", cfg.WAL.FlushPolicy)
+	}
+
+	if cfg.WAL.FlushInterval != 5*time.Millisecond {
+		t.Errorf("expected flush interval %v, got %v", 5*time.Millisecond, cfg.WAL.FlushInterval)
+	}
+}
+
+func TestLoadInvalidWALFlushPolicy(t *testing.T) {
+	yml := createYmlConfig("in_memory", "debug", "stdout") +
+		"wal:\n" +
+		"  data_directory: /tmp/wal\n" +
+		"  flush_policy: never\n"
+
+	_, err := Load(createTempConfigFile(t, yml))
+	if !errors.Is(err, ErrValidationFailed) {
+		t.Errorf("expected error type %v, got %v", ErrValidationFailed, err)
+	}
+}
+
+func TestLoadSnapshotConfigRequiresWAL(t *testing.T) {
+	yml := createYmlConfig("in_memory", "debug", "stdout") +
+		"snapshot:\n" +
+		"  data_directory: /tmp/snapshots\n"
+
+	_, err := Load(createTempConfigFile(t, yml))
+	if !errors.Is(err, ErrValidationFailed) {
+		t.Errorf("expected error type %v, got %v", ErrValidationFailed, err)
+	}
+}
+
+func TestLoadReplicaConfigRequiresReplicaID(t *testing.T) {
+	yml := createYmlConfig("in_memory", "debug", "stdout") +
+		"wal:\n" +
+		"  data_directory: /tmp/wal\n" +
+		"replication:\n" +
+		"  leader_address: 127.0.0.1:3224\n"
+
+	_, err := Load(createTempConfigFile(t, yml))
+	if !errors.Is(err, ErrValidationFailed) {
+		t.Errorf("expected error type %v, got %v", ErrValidationFailed, err)
+	}
+}
+
+func TestLoadClusterConfig(t *testing.T) {
+	yml := createYmlConfig("in_memory", "debug", "stdout") +
+		"cluster:\n" +
+		"  node_id: node-1\n" +
+		"  address: 127.0.0.1:4001\n" +
+		"  data_directory: /tmp/raft\n" +
+		"  election_timeout: 300ms\n" +
+		"  peers:\n" +
+		"    - id: node-1\n" +
+		"      address: 127.0.0.1:4001\n" +
+		"      client_address: 127.0.0.1:3223\n" +
+		"    - id: node-2\n" +
+		"      address: 127.0.0.1:4002\n" +
+		"      client_address: 127.0.0.1:3224\n"
+
+	cfg, err := Load(createTempConfigFile(t, yml))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.Cluster == nil || cfg.Cluster.ElectionTimeout != 300*time.Millisecond {
+		t.Fatalf("unexpected cluster config: %+v", cfg.Cluster)
+	}
+
+	if len(cfg.Cluster.Peers) != 2 || cfg.Cluster.Peers[1].ClientAddress != "127.0.0.1:3224" {
+		t.Errorf("unexpected peers: %+v", cfg.Cluster.Peers)
+	}
+}
+
+func TestLoadClusterConfigExcludesWAL(t *testing.T) {
+	yml := createYmlConfig("in_memory", "debug", "stdout") +
+		"wal:\n" +
+		"  data_directory: /tmp/wal\n" +
+		"cluster:\n" +
+		"  node_id: node-1\n" +
+		"  address: 127.0.0.1:4001\n" +
+		"  data_directory: /tmp/raft\n"
+
+	_, err := Load(createTempConfigFile(t, yml))
+	if !errors.Is(err, ErrValidationFailed) {
+		t.Errorf("expected error type %v, got %v", ErrValidationFailed, err)
+	}
+}
+
+func TestLoadDatabases(t *testing.T) {
+	cfg, err := Load(createTempConfigFile(t, createYmlConfig("in_memory", "debug", "stdout")))
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	if cfg.Databases != 1 {
+		t.Errorf("expected %d databases by default, got %d", 1, cfg.Databases)
+	}
+
+	cfg, err = Load(createTempConfigFile(t, createYmlConfig("in_memory", "debug", "stdout")+"databases: 16\n"))
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	if cfg.Databases != 16 {
+		t.Errorf("expected %d databases, got %d", 16, cfg.Databases)
+	}
+
+	_, err = Load(createTempConfigFile(t, createYmlConfig("in_memory", "debug", "stdout")+"databases: 0\n"))
+	if !errors.Is(err, ErrValidationFailed) {
+		t.Errorf("expected error type %v, got %v", ErrValidationFailed, err)
+	}
+}
+
+func TestLoadEngineHistory(t *testing.T) {
+	yml := "engine:\n" +
+		"  type: ordered\n" +
+		"  history:\n" +
+		"    max_versions: 10\n" +
+		"    max_age: 24h\n"
+
+	cfg, err := Load(createTempConfigFile(t, yml))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Engine.History == nil || cfg.Engine.History.MaxVersions != 10 || cfg.Engine.History.MaxAge != 24*time.Hour {
+		t.Errorf("unexpected history config: %+v", cfg.Engine.History)
+	}
+	if _, ok := cfg.Engine.Sections["history"]; ok {
+		t.Errorf("expected history not to be taken for an engine section: %+v", cfg.Engine.Sections)
+	}
+
+	_, err = Load(createTempConfigFile(t, "engine:\n  type: ordered\n  history:\n    max_versions: 0\n"))
+	if !errors.Is(err, ErrValidationFailed) {
+		t.Errorf("expected error type %v, got %v", ErrValidationFailed, err)
+	}
+}
+
+func TestLoadEngineSections(t *testing.T) {
+	yml := "engine:\n" +
+		"  type: sharded\n" +
+		"  sharded:\n" +
+		"    shards: 64\n"
+
+	cfg, err := Load(createTempConfigFile(t, yml))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	section, ok := cfg.Engine.Sections["sharded"].(map[string]any)
+	if cfg.Engine.Type != "sharded" || !ok || section["shards"] != 64 {
+		t.Errorf("unexpected engine config: %+v", cfg.Engine)
+	}
+}
+
+func TestLoadEvictionConfig(t *testing.T) {
+	yml := "engine:\n" +
+		"  type: in_memory\n" +
+		"  max_memory: 1048576\n" +
+		"  eviction_policy: allkeys-lru\n"
+
+	cfg, err := Load(createTempConfigFile(t, yml))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.Engine.MaxMemory != 1048576 || cfg.Engine.EvictionPolicy != "allkeys-lru" {
+		t.Errorf("unexpected engine config: %+v", cfg.Engine)
+	}
+}
+
+func TestLoadInvalidEvictionPolicy(t *testing.T) {
+	yml := "engine:\n" +
+		"  type: in_memory\n" +
+		"  max_memory: 1048576\n" +
+		"  eviction_policy: oldest-first\n"
+
+	_, err := Load(createTempConfigFile(t, yml))
+	if !errors.Is(err, ErrValidationFailed) {
+		t.Errorf("expected error type %v, got %v", ErrValidationFailed, err)
+	}
+}
+
+type testSection struct {
+	Path     string        `mapstructure:"path" validate:"required"`
+	Interval time.Duration `mapstructure:"interval"`
+	Size     int           `mapstructure:"size" validate:"min=1"`
+}
+
+func TestDecodeSection(t *testing.T) {
+	target := testSection{Size: 10}
+	section := map[string]any{"path": "./data", "interval": "5s"}
+
+	if err := DecodeSection(section, &target); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if target.Path != "./data" || target.Interval != 5*time.Second || target.Size != 10 {
+		t.Errorf("unexpected section: %+v", target)
+	}
+}
+
+func TestDecodeSectionValidates(t *testing.T) {
+	var target testSection
+
+	if err := DecodeSection(nil, &target); !errors.Is(err, ErrValidationFailed) {
+		t.Errorf("expected error type %v, got %v", ErrValidationFailed, err)
+	}
+
+	if err := DecodeSection("path", &target); !errors.Is(err, ErrUnmarshalFailed) {
+		t.Errorf("expected error type %v, got %v", ErrUnmarshalFailed, err)
+	}
+}
@@ -0,0 +1,203 @@
+package database
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/compute"
+	"github.com/crunchydeer30/key-value-database/internal/database/raft"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/wal"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrClusterDisabled = errors.New("cluster mode is disabled")
+	ErrNoLeader        = errors.New("no cluster leader elected")
+	ErrInvalidCommand  = errors.New("invalid cluster command")
+)
+
+// stateMachine applies committed cluster log entries to the engine through
+// storage, which keeps writes to several keys atomic for readers. Entries
+// carry the same operations as WAL records.
+type stateMachine struct {
+	engine  engine.Engine
+	storage *storage.Storage
+}
+
+func newStateMachine(e engine.Engine, s *storage.Storage) (*stateMachine, error) {
+	if _, ok := e.(engine.Snapshotter); !ok {
+		return nil, errors.New("engine does not support snapshots")
+	}
+
+	if _, ok := e.(engine.Clearer); !ok {
+		return nil, errors.New("engine does not support clearing")
+	}
+
+	return &stateMachine{engine: e, storage: s}, nil
+}
+
+func (m *stateMachine) Apply(data []byte) ([]byte, error) {
+	op, args, err := decodeCommand(data)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := m.storage.ApplyOperation(op, args)
+	return []byte(result), err
+}
+
+func (m *stateMachine) Snapshot() (engine.Snapshot, error) {
+	//nolint:forcetypeassert
+	return m.engine.(engine.Snapshotter).Snapshot()
+}
+
+func (m *stateMachine) Restore(load func(fn func(entry engine.Entry) error) error) error {
+	//nolint:forcetypeassert
+	if err := m.engine.(engine.Clearer).Clear(); err != nil {
+		return err
+	}
+
+	return load(func(entry engine.Entry) error {
+		return engine.Put(m.engine, entry)
+	})
+}
+
+func encodeCommand(op wal.Operation, args ...string) []byte {
+	size := 1 + binary.MaxVarintLen64
+	for _, arg := range args {
+		size += binary.MaxVarintLen64 + len(arg)
+	}
+
+	data := make([]byte, 0, size)
+	data = append(data, byte(op))
+	data = binary.AppendUvarint(data, uint64(len(args)))
+	for _, arg := range args {
+		data = binary.AppendUvarint(data, uint64(len(arg)))
+		data = append(data, arg...)
+	}
+
+	return data
+}
+
+func decodeCommand(data []byte) (wal.Operation, []string, error) {
+	if len(data) < 1 {
+		return 0, nil, fmt.Errorf("%w: empty command", ErrInvalidCommand)
+	}
+
+	op := wal.Operation(data[0])
+	data = data[1:]
+
+	count, n := binary.Uvarint(data)
+	if n <= 0 || count > uint64(len(data)) {
+		return 0, nil, fmt.Errorf("%w: invalid argument count", ErrInvalidCommand)
+	}
+	data = data[n:]
+
+	args := make([]string, 0, count)
+	for range count {
+		length, n := binary.Uvarint(data)
+		if n <= 0 || length > uint64(len(data)-n) {
+			return 0, nil, fmt.Errorf("%w: invalid argument length", ErrInvalidCommand)
+		}
+		data = data[n:]
+		args = append(args, string(data[:length]))
+		data = data[length:]
+	}
+
+	return op, args, nil
+}
+
+// clusterProposer lets storage propose the records of writes it prepares
+// from the state of the leader.
+type clusterProposer struct {
+	db *Database
+}
+
+func (p clusterProposer) Ready() error {
+	return p.db.cluster.Ready()
+}
+
+func (p clusterProposer) Propose(op wal.Operation, args ...string) (string, error) {
+	return p.db.proposeWithResult(op, args...)
+}
+
+// redirect tells the client where the leader can be reached. Followers never
+// accept writes themselves.
+func (d *Database) redirect() string {
+	leader, ok := d.cluster.Leader()
+	if !ok {
+		return fmt.Sprintf("error: %s", ErrNoLeader.Error())
+	}
+
+	return compute.RedirectReply(leader.ClientAddress)
+}
+
+func (d *Database) propose(op wal.Operation, args ...string) error {
+	_, err := d.proposeWithResult(op, args...)
+	return err
+}
+
+// proposeWithResult proposes an operation and returns its result, as applied
+// on this node.
+func (d *Database) proposeWithResult(op wal.Operation, args ...string) (string, error) {
+	result, err := d.cluster.Propose(encodeCommand(op, args...))
+	return string(result), err
+}
+
+func (d *Database) handleClusterQuery(query *compute.Query) string {
+	if d.cluster == nil {
+		return fmt.Sprintf("error: %s", ErrClusterDisabled.Error())
+	}
+
+	var err error
+	switch compute.SubcommandName(query.Args[0]) {
+	case compute.NODES:
+		return d.clusterNodes()
+	case compute.ADD:
+		err = d.cluster.AddMember(raft.Member{
+			ID:            query.Args[1],
+			Address:       query.Args[2],
+			ClientAddress: query.Args[3],
+		})
+	case compute.REMOVE:
+		err = d.cluster.RemoveMember(query.Args[1])
+	default:
+		return "internal error"
+	}
+
+	if errors.Is(err, raft.ErrNotLeader) {
+		return d.redirect()
+	}
+
+	if err != nil {
+		d.logger.Error("failed to change cluster membership", zap.Strings("args", query.Args), zap.Error(err))
+		return fmt.Sprintf("error: %s", err.Error())
+	}
+
+	return "ok"
+}
+
+// clusterNodes replies with one line per member: id, raft address, client
+// address and its role as far as this node knows.
+func (d *Database) clusterNodes() string {
+	status := d.cluster.Status()
+
+	lines := make([]string, 0, len(status.Configuration.Members))
+	for _, member := range status.Configuration.Members {
+		role := raft.Follower.String()
+		if member.ID == status.LeaderID {
+			role = raft.Leader.String()
+		}
+
+		line := fmt.Sprintf("%s %s %s %s", member.ID, member.Address, member.ClientAddress, role)
+		if member.ID == status.ID {
+			line += " self"
+		}
+		lines = append(lines, line)
+	}
+
+	return compute.ArrayReply(lines...)
+}
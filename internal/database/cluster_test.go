@@ -0,0 +1,220 @@
+//nolint:exhaustruct
+package database
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/config"
+	"github.com/crunchydeer30/key-value-database/internal/database/compute"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+	"go.uber.org/zap"
+)
+
+func freeAddress(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	//nolint:errcheck
+	defer listener.Close()
+
+	return listener.Addr().String()
+}
+
+func newTestCluster(t *testing.T, size int) []*Database {
+	t.Helper()
+
+	configs := make([]*config.Config, 0, size)
+	peers := make([]config.PeerConfig, 0, size)
+	for i := range size {
+		cfg := &config.Config{
+			Network: config.NetworkConfig{Address: "127.0.0.1:" + strconv.Itoa(3300+i)},
+			Cluster: &config.ClusterConfig{
+				NodeID:            "node-" + strconv.Itoa(i+1),
+				Address:           freeAddress(t),
+				DataDirectory:     t.TempDir(),
+				ElectionTimeout:   150 * time.Millisecond,
+				HeartbeatInterval: 20 * time.Millisecond,
+			},
+		}
+		configs = append(configs, cfg)
+		peers = append(peers, config.PeerConfig{
+			ID:            cfg.Cluster.NodeID,
+			Address:       cfg.Cluster.Address,
+			ClientAddress: cfg.Network.Address,
+		})
+	}
+
+	dbs := make([]*Database, 0, size)
+	for _, cfg := range configs {
+		cfg.Cluster.Peers = peers
+
+		db, err := NewDatabase(cfg, zap.NewNop())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			//nolint:errcheck
+			db.Close()
+		})
+
+		dbs = append(dbs, db)
+	}
+
+	return dbs
+}
+
+func TestDatabase_ClusterRedirectsWritesToLeader(t *testing.T) {
+	dbs := newTestCluster(t, 3)
+
+	var leader *Database
+	deadline := time.Now().Add(10 * time.Second)
+	for leader == nil {
+		for _, db := range dbs {
+			if db.cluster.IsLeader() {
+				leader = db
+			}
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("no leader elected")
+		}
+		<-time.After(10 * time.Millisecond)
+	}
+
+	if got := leader.HandleQueryString("SET key value"); got != "ok" {
+		t.Fatalf("expected ok, got %q", got)
+	}
+
+	leaderMember, _ := leader.cluster.Leader()
+	for _, db := range dbs {
+		if db == leader {
+			continue
+		}
+
+		for {
+			got := db.HandleQueryString("SET key other")
+			if got == compute.RedirectReply(leaderMember.ClientAddress) {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expected redirect to %s, got %q", leaderMember.ClientAddress, got)
+			}
+			<-time.After(10 * time.Millisecond)
+		}
+
+		for db.HandleQueryString("GET key") != "value" {
+			if time.Now().After(deadline) {
+				t.Fatalf("follower did not apply the write")
+			}
+			<-time.After(10 * time.Millisecond)
+		}
+	}
+
+	if got := leader.HandleQueryString("DEL key"); got != "1" {
+		t.Fatalf("expected 1, got %q", got)
+	}
+
+	if got := leader.HandleQueryString("SET session token EX 100"); got != "ok" {
+		t.Fatalf("expected ok, got %q", got)
+	}
+	if got := leader.HandleQueryString("TTL session"); got != "100" {
+		t.Fatalf("expected ttl 100, got %q", got)
+	}
+
+	for i, want := range []string{"1", "2", "12"} {
+		query := "INCR counter"
+		if i == 2 {
+			query = "INCRBY counter 10"
+		}
+		if got := leader.HandleQueryString(query); got != want {
+			t.Fatalf("%s: expected %s, got %q", query, want, got)
+		}
+	}
+	if got := leader.HandleQueryString("INCR session"); got != "error: "+storage.ErrNotInteger.Error() {
+		t.Fatalf("expected not an integer error, got %q", got)
+	}
+	for _, db := range dbs {
+		for db.HandleQueryString("GET counter") != "12" {
+			if time.Now().After(deadline) {
+				t.Fatalf("follower did not apply the increments")
+			}
+			<-time.After(10 * time.Millisecond)
+		}
+	}
+
+	steps := []struct {
+		query string
+		want  string
+	}{
+		{"RPUSH queue a b c", "3"},
+		{"LPOP queue 2", array("a", "b")},
+		{"LTRIM queue 0 0", "ok"},
+		{"RPOP queue", "c"},
+		{"RPOP queue", replyNil},
+		{"LPUSH counter x", "error: " + engine.ErrWrongType.Error()},
+		{"HSET user name alice age 30", "2"},
+		{"HINCRBY user age 1", "31"},
+		{"HDEL user name missing", "1"},
+		{"SADD flags a b", "2"},
+		{"SREM flags a", "1"},
+		{"ZADD board 1 alice 2 bob", "2"},
+		{"ZINCRBY board 2.5 alice", "3.5"},
+		{"ZREM board bob", "1"},
+		{"SET balance 10", "ok"},
+		{"CAS balance 5 0", "0"},
+		{"CAS balance 10 20", "1"},
+		{"GET balance", "20"},
+		{"MSET a 1 b 2", "ok"},
+		{"MSETNX b 3 c 4", "0"},
+		{"DEL a b c", "2"},
+		{"SET lock a NX", "ok"},
+		{"SET lock b NX GET", "a"},
+		{"SET lock b XX GET", "a"},
+		{"SET other b XX", replyNil},
+		{"GET lock", "b"},
+		{"EXPIRE lock 100", "1"},
+		{"EXPIRE missing 100", "0"},
+		{"PERSIST lock", "1"},
+		{"PERSIST lock", "0"},
+		{"PERSIST missing", "0"},
+		{"MULTI", "ok"},
+		{"SET total 1", "queued"},
+		{"INCRBY total 2", "queued"},
+		{"HSET order id 7", "queued"},
+		{"GET total", "queued"},
+		{"EXEC", compute.ArrayReply("ok", "3", "1", "3")},
+	}
+	session := leader.NewSession()
+	for _, step := range steps {
+		if got := session.HandleQueryString(step.query); got != step.want {
+			t.Fatalf("%s: expected %q, got %q", step.query, step.want, got)
+		}
+	}
+
+	for _, db := range dbs {
+		for db.HandleQueryString("GET total") != "3" || db.HandleQueryString("HGET order id") != "7" {
+			if time.Now().After(deadline) {
+				t.Fatalf("node did not apply the transaction")
+			}
+			<-time.After(10 * time.Millisecond)
+		}
+
+		if db == leader {
+			continue
+		}
+
+		follower := db.NewSession()
+		follower.HandleQueryString("MULTI")
+		follower.HandleQueryString("SET total 0")
+		if got := follower.HandleQueryString("EXEC"); got != compute.RedirectReply(leaderMember.ClientAddress) {
+			t.Fatalf("expected redirect to %s, got %q", leaderMember.ClientAddress, got)
+		}
+	}
+}
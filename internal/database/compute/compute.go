@@ -30,3 +30,7 @@ func NewCompute(logger *zap.Logger) (*Compute, error) {
 func (c *Compute) Parse(queryStr string) (*Query, error) {
 	return c.parser.Parse(queryStr)
 }
+
+func (c *Compute) ParseRequest(data []byte) (*Query, error) {
+	return c.parser.ParseRequest(data)
+}
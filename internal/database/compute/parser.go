@@ -13,10 +13,6 @@ type Parser struct {
 
 var ErrInvalidQuery = errors.New("invalid query")
 
-const (
-	maxArgs = 3
-)
-
 func NewParser(logger *zap.Logger) (*Parser, error) {
 	if logger == nil {
 		return nil, errors.New("no logger provided")
@@ -29,14 +25,27 @@ func NewParser(logger *zap.Logger) (*Parser, error) {
 
 func (p *Parser) Parse(queryStr string) (*Query, error) {
 	queryStr = strings.TrimSpace(queryStr)
-	parts := strings.Fields(queryStr)
+	return p.parse(strings.Fields(queryStr))
+}
 
-	if len(parts) == 0 {
-		return nil, ErrInvalidQuery
+// ParseRequest parses a request as received from a client, which is either a
+// text query or a binary one built by EncodeRequest.
+func (p *Parser) ParseRequest(data []byte) (*Query, error) {
+	if !IsBinaryRequest(data) {
+		return p.Parse(string(data))
 	}
 
-	if len(parts) > maxArgs {
-		return nil, ErrInvalidNumberOfArgs
+	parts, err := decodeRequest(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.parse(parts)
+}
+
+func (p *Parser) parse(parts []string) (*Query, error) {
+	if len(parts) == 0 {
+		return nil, ErrInvalidQuery
 	}
 
 	query := NewQuery(CommandName(parts[0]), parts[1:])
@@ -2,7 +2,9 @@
 package compute
 
 import (
+	"bytes"
 	"errors"
+	"slices"
 	"testing"
 
 	"go.uber.org/zap"
@@ -13,6 +15,7 @@ type parserTestCase struct {
 	input       string
 	wantCommand CommandName
 	wantArgs    []string
+	wantOptions map[OptionName]string
 	wantError   bool
 	errType     error
 }
@@ -100,6 +103,555 @@ func TestParser_Parse(t *testing.T) {
 			wantCommand: GET,
 			wantArgs:    []string{"key"},
 		},
+		{
+			name:        "SET with quorum options",
+			input:       "SET key value QUORUM 2 TIMEOUT 500",
+			wantCommand: SET,
+			wantArgs:    []string{"key", "value"},
+			wantOptions: map[OptionName]string{QUORUM: "2", TIMEOUT: "500"},
+		},
+		{
+			name:        "DEL with options in any order",
+			input:       "DEL key TIMEOUT 100 QUORUM 1",
+			wantCommand: DEL,
+			wantArgs:    []string{"key"},
+			wantOptions: map[OptionName]string{QUORUM: "1", TIMEOUT: "100"},
+		},
+		{
+			name:      "option without value",
+			input:     "SET key value QUORUM",
+			wantError: true,
+			errType:   ErrInvalidOption,
+		},
+		{
+			name:      "negative quorum",
+			input:     "SET key value QUORUM -1",
+			wantError: true,
+			errType:   ErrInvalidOption,
+		},
+		{
+			name:      "duplicate option",
+			input:     "DEL key QUORUM 1 QUORUM 2",
+			wantError: true,
+			errType:   ErrInvalidOption,
+		},
+		{
+			name:      "GET does not accept options",
+			input:     "GET key QUORUM 1",
+			wantError: true,
+			errType:   ErrInvalidNumberOfArgs,
+		},
+		{
+			name:        "SET with expiration",
+			input:       "SET session token EX 60 QUORUM 1",
+			wantCommand: SET,
+			wantArgs:    []string{"session", "token"},
+			wantOptions: map[OptionName]string{EX: "60", QUORUM: "1"},
+		},
+		{
+			name:      "SET with non-positive expiration",
+			input:     "SET session token EX 0",
+			wantError: true,
+			errType:   ErrInvalidOption,
+		},
+		{
+			name:        "SET with flags in any order",
+			input:       "SET lock owner GET NX EX 30",
+			wantCommand: SET,
+			wantArgs:    []string{"lock", "owner"},
+			wantOptions: map[OptionName]string{GETOLD: "", NX: "", EX: "30"},
+		},
+		{
+			name:      "SET with NX and XX",
+			input:     "SET lock owner XX NX",
+			wantError: true,
+			errType:   ErrInvalidOption,
+		},
+		{
+			name:      "SET with EX and KEEPTTL",
+			input:     "SET lock owner KEEPTTL EX 30",
+			wantError: true,
+			errType:   ErrInvalidOption,
+		},
+		{
+			name:      "SET with a repeated flag",
+			input:     "SET lock owner NX NX",
+			wantError: true,
+			errType:   ErrInvalidOption,
+		},
+		{
+			name:        "valid EXPIRE command",
+			input:       "EXPIRE session 30",
+			wantCommand: EXPIRE,
+			wantArgs:    []string{"session", "30"},
+		},
+		{
+			name:      "EXPIRE with non-integer seconds",
+			input:     "EXPIRE session soon",
+			wantError: true,
+			errType:   ErrInvalidArgument,
+		},
+		{
+			name:      "EXPIRE with seconds that overflow a deadline",
+			input:     "EXPIRE session 9300000000",
+			wantError: true,
+			errType:   ErrInvalidArgument,
+		},
+		{
+			name:      "SET with EX seconds that overflow a deadline",
+			input:     "SET session token EX 9300000000",
+			wantError: true,
+			errType:   ErrInvalidOption,
+		},
+		{
+			name:        "valid TTL command",
+			input:       "TTL session",
+			wantCommand: TTL,
+			wantArgs:    []string{"session"},
+		},
+		{
+			name:        "valid PERSIST command",
+			input:       "PERSIST session",
+			wantCommand: PERSIST,
+			wantArgs:    []string{"session"},
+		},
+		{
+			name:      "EXPIRE does not accept EX",
+			input:     "EXPIRE session 30 EX 10",
+			wantError: true,
+			errType:   ErrInvalidNumberOfArgs,
+		},
+		{
+			name:        "valid RANGE command",
+			input:       "RANGE 2024-01-01 2024-02-01 LIMIT 10",
+			wantCommand: RANGE,
+			wantArgs:    []string{"2024-01-01", "2024-02-01"},
+			wantOptions: map[OptionName]string{LIMIT: "10"},
+		},
+		{
+			name:        "valid REVPREFIX command",
+			input:       "REVPREFIX events:",
+			wantCommand: REVPREFIX,
+			wantArgs:    []string{"events:"},
+		},
+		{
+			name:      "RANGE without end",
+			input:     "RANGE 2024-01-01",
+			wantError: true,
+			errType:   ErrInvalidNumberOfArgs,
+		},
+		{
+			name:      "PREFIX with non-positive limit",
+			input:     "PREFIX events: LIMIT 0",
+			wantError: true,
+			errType:   ErrInvalidOption,
+		},
+		{
+			name:        "valid SCAN command",
+			input:       "SCAN 0 COUNT 100 MATCH user:*",
+			wantCommand: SCAN,
+			wantArgs:    []string{"0"},
+			wantOptions: map[OptionName]string{COUNT: "100", MATCH: "user:*"},
+		},
+		{
+			name:      "SCAN without cursor",
+			input:     "SCAN",
+			wantError: true,
+			errType:   ErrInvalidNumberOfArgs,
+		},
+		{
+			name:      "SCAN with non-numeric count",
+			input:     "SCAN 0 COUNT many",
+			wantError: true,
+			errType:   ErrInvalidOption,
+		},
+		{
+			name:        "valid INCRBY command",
+			input:       "INCRBY counter -5 QUORUM 1",
+			wantCommand: INCRBY,
+			wantArgs:    []string{"counter", "-5"},
+			wantOptions: map[OptionName]string{QUORUM: "1"},
+		},
+		{
+			name:        "valid INCRBYFLOAT command",
+			input:       "INCRBYFLOAT price 1.5e2",
+			wantCommand: INCRBYFLOAT,
+			wantArgs:    []string{"price", "1.5e2"},
+		},
+		{
+			name:      "INCR with an increment",
+			input:     "INCR counter 5",
+			wantError: true,
+			errType:   ErrInvalidNumberOfArgs,
+		},
+		{
+			name:      "INCRBY with a float increment",
+			input:     "INCRBY counter 1.5",
+			wantError: true,
+			errType:   ErrInvalidArgument,
+		},
+		{
+			name:      "INCRBYFLOAT with NaN",
+			input:     "INCRBYFLOAT price NaN",
+			wantError: true,
+			errType:   ErrInvalidArgument,
+		},
+		{
+			name:        "valid LPUSH command",
+			input:       "LPUSH queue a b QUORUM",
+			wantCommand: LPUSH,
+			wantArgs:    []string{"queue", "a", "b", "QUORUM"},
+		},
+		{
+			name:        "RPUSH with quorum",
+			input:       "RPUSH queue a QUORUM 1 TIMEOUT 100",
+			wantCommand: RPUSH,
+			wantArgs:    []string{"queue", "a"},
+			wantOptions: map[OptionName]string{QUORUM: "1", TIMEOUT: "100"},
+		},
+		{
+			name:      "RPUSH without values",
+			input:     "RPUSH queue",
+			wantError: true,
+			errType:   ErrInvalidNumberOfArgs,
+		},
+		{
+			name:        "valid LPOP command with count",
+			input:       "LPOP queue 3",
+			wantCommand: LPOP,
+			wantArgs:    []string{"queue", "3"},
+		},
+		{
+			name:        "LPOP with quorum",
+			input:       "LPOP queue QUORUM 1",
+			wantCommand: LPOP,
+			wantArgs:    []string{"queue"},
+			wantOptions: map[OptionName]string{QUORUM: "1"},
+		},
+		{
+			name:        "RPOP with count and quorum",
+			input:       "RPOP queue 2 QUORUM 1",
+			wantCommand: RPOP,
+			wantArgs:    []string{"queue", "2"},
+			wantOptions: map[OptionName]string{QUORUM: "1"},
+		},
+		{
+			name:      "RPOP with too many arguments",
+			input:     "RPOP queue 2 3",
+			wantError: true,
+			errType:   ErrInvalidNumberOfArgs,
+		},
+		{
+			name:      "RPOP with zero count",
+			input:     "RPOP queue 0",
+			wantError: true,
+			errType:   ErrInvalidArgument,
+		},
+		{
+			name:        "valid LRANGE command",
+			input:       "LRANGE queue 0 -1",
+			wantCommand: LRANGE,
+			wantArgs:    []string{"queue", "0", "-1"},
+		},
+		{
+			name:      "LINDEX with non-numeric index",
+			input:     "LINDEX queue first",
+			wantError: true,
+			errType:   ErrInvalidArgument,
+		},
+		{
+			name:        "valid LTRIM command",
+			input:       "LTRIM queue 1 -2 QUORUM 1",
+			wantCommand: LTRIM,
+			wantArgs:    []string{"queue", "1", "-2"},
+			wantOptions: map[OptionName]string{QUORUM: "1"},
+		},
+		{
+			name:        "valid HSET command",
+			input:       "HSET user name alice age 30",
+			wantCommand: HSET,
+			wantArgs:    []string{"user", "name", "alice", "age", "30"},
+		},
+		{
+			name:      "HSET with a field without value",
+			input:     "HSET user name alice age",
+			wantError: true,
+			errType:   ErrInvalidArgument,
+		},
+		{
+			name:        "HSET with quorum",
+			input:       "HSET user name alice QUORUM 1",
+			wantCommand: HSET,
+			wantArgs:    []string{"user", "name", "alice"},
+			wantOptions: map[OptionName]string{QUORUM: "1"},
+		},
+		{
+			name:        "valid HDEL command",
+			input:       "HDEL user name age",
+			wantCommand: HDEL,
+			wantArgs:    []string{"user", "name", "age"},
+		},
+		{
+			name:        "HDEL with quorum",
+			input:       "HDEL user name TIMEOUT 100 QUORUM 1",
+			wantCommand: HDEL,
+			wantArgs:    []string{"user", "name"},
+			wantOptions: map[OptionName]string{QUORUM: "1", TIMEOUT: "100"},
+		},
+		{
+			name:      "HGET with extra args",
+			input:     "HGET user name age",
+			wantError: true,
+			errType:   ErrInvalidNumberOfArgs,
+		},
+		{
+			name:        "valid HINCRBY command",
+			input:       "HINCRBY user age -1 TIMEOUT 100",
+			wantCommand: HINCRBY,
+			wantArgs:    []string{"user", "age", "-1"},
+			wantOptions: map[OptionName]string{TIMEOUT: "100"},
+		},
+		{
+			name:      "HINCRBY with a float increment",
+			input:     "HINCRBY user age 0.5",
+			wantError: true,
+			errType:   ErrInvalidArgument,
+		},
+		{
+			name:        "valid SINTER command",
+			input:       "SINTER flags enabled beta",
+			wantCommand: SINTER,
+			wantArgs:    []string{"flags", "enabled", "beta"},
+		},
+		{
+			name:      "SADD without members",
+			input:     "SADD flags",
+			wantError: true,
+			errType:   ErrInvalidNumberOfArgs,
+		},
+		{
+			name:        "SREM with quorum",
+			input:       "SREM flags beta QUORUM 1",
+			wantCommand: SREM,
+			wantArgs:    []string{"flags", "beta"},
+			wantOptions: map[OptionName]string{QUORUM: "1"},
+		},
+		{
+			name:        "valid ZADD command",
+			input:       "ZADD board 10 alice -2.5 bob",
+			wantCommand: ZADD,
+			wantArgs:    []string{"board", "10", "alice", "-2.5", "bob"},
+		},
+		{
+			name:        "ZADD with quorum",
+			input:       "ZADD board 10 alice QUORUM 1 TIMEOUT 100",
+			wantCommand: ZADD,
+			wantArgs:    []string{"board", "10", "alice"},
+			wantOptions: map[OptionName]string{QUORUM: "1", TIMEOUT: "100"},
+		},
+		{
+			name:      "ZADD with infinite score",
+			input:     "ZADD board inf alice",
+			wantError: true,
+			errType:   ErrInvalidArgument,
+		},
+		{
+			name:        "ZRANGE by score with scores",
+			input:       "ZRANGE board -inf 10 WITHSCORES BYSCORE",
+			wantCommand: ZRANGE,
+			wantArgs:    []string{"board", "-inf", "10"},
+			wantOptions: map[OptionName]string{BYSCORE: "", WITHSCORES: ""},
+		},
+		{
+			name:      "ZRANGE by rank with score bounds",
+			input:     "ZRANGE board 0 1.5",
+			wantError: true,
+			errType:   ErrInvalidArgument,
+		},
+		{
+			name:      "ZRANGE with repeated flag",
+			input:     "ZRANGE board 0 1 WITHSCORES WITHSCORES",
+			wantError: true,
+			errType:   ErrInvalidOption,
+		},
+		{
+			name:        "valid ZINCRBY command",
+			input:       "ZINCRBY board 2.5 alice",
+			wantCommand: ZINCRBY,
+			wantArgs:    []string{"board", "2.5", "alice"},
+		},
+		{
+			name:        "valid SELECT command",
+			input:       "SELECT 3",
+			wantCommand: SELECT,
+			wantArgs:    []string{"3"},
+		},
+		{
+			name:      "SELECT with negative index",
+			input:     "SELECT -1",
+			wantError: true,
+			errType:   ErrInvalidArgument,
+		},
+		{
+			name:        "valid MOVE command",
+			input:       "MOVE user 1",
+			wantCommand: MOVE,
+			wantArgs:    []string{"user", "1"},
+		},
+		{
+			name:      "MOVE with non-numeric index",
+			input:     "MOVE user one",
+			wantError: true,
+			errType:   ErrInvalidArgument,
+		},
+		{
+			name:        "valid SWAPDB command",
+			input:       "SWAPDB 0 1",
+			wantCommand: SWAPDB,
+			wantArgs:    []string{"0", "1"},
+		},
+		{
+			name:      "FLUSHDB with argument",
+			input:     "FLUSHDB now",
+			wantError: true,
+			errType:   ErrInvalidNumberOfArgs,
+		},
+		{
+			name:        "valid MULTI command",
+			input:       "MULTI",
+			wantCommand: MULTI,
+		},
+		{
+			name:      "EXEC with argument",
+			input:     "EXEC now",
+			wantError: true,
+			errType:   ErrInvalidNumberOfArgs,
+		},
+		{
+			name:        "DEL with several keys and options",
+			input:       "DEL a b QUORUM 1",
+			wantCommand: DEL,
+			wantArgs:    []string{"a", "b"},
+			wantOptions: map[OptionName]string{QUORUM: "1"},
+		},
+		{
+			name:        "DEL with a key named like an option",
+			input:       "DEL a QUORUM",
+			wantCommand: DEL,
+			wantArgs:    []string{"a", "QUORUM"},
+		},
+		{
+			name:        "DEL with keys named like options and options",
+			input:       "DEL QUORUM TIMEOUT QUORUM 1",
+			wantCommand: DEL,
+			wantArgs:    []string{"QUORUM", "TIMEOUT"},
+			wantOptions: map[OptionName]string{QUORUM: "1"},
+		},
+		{
+			name:      "DEL with an invalid quorum",
+			input:     "DEL a QUORUM x",
+			wantError: true,
+			errType:   ErrInvalidOption,
+		},
+		{
+			name:        "valid MGET command",
+			input:       "MGET a b c",
+			wantCommand: MGET,
+			wantArgs:    []string{"a", "b", "c"},
+		},
+		{
+			name:        "valid MSET command",
+			input:       "MSET a 1 b 2",
+			wantCommand: MSET,
+			wantArgs:    []string{"a", "1", "b", "2"},
+		},
+		{
+			name:        "MSET with quorum",
+			input:       "MSET a 1 b 2 QUORUM 1 TIMEOUT 100",
+			wantCommand: MSET,
+			wantArgs:    []string{"a", "1", "b", "2"},
+			wantOptions: map[OptionName]string{QUORUM: "1", TIMEOUT: "100"},
+		},
+		{
+			name:      "MSETNX with a key without value",
+			input:     "MSETNX a 1 b",
+			wantError: true,
+			errType:   ErrInvalidArgument,
+		},
+		{
+			name:      "EXISTS without keys",
+			input:     "EXISTS",
+			wantError: true,
+			errType:   ErrInvalidNumberOfArgs,
+		},
+		{
+			name:        "GET at a revision",
+			input:       "GET config AT 42",
+			wantCommand: GET,
+			wantArgs:    []string{"config"},
+			wantOptions: map[OptionName]string{AT: "42"},
+		},
+		{
+			name:      "GET at an invalid revision",
+			input:     "GET config AT latest",
+			wantError: true,
+			errType:   ErrInvalidOption,
+		},
+		{
+			name:        "HISTORY with limit",
+			input:       "HISTORY config LIMIT 5",
+			wantCommand: HISTORY,
+			wantArgs:    []string{"config"},
+			wantOptions: map[OptionName]string{LIMIT: "5"},
+		},
+		{
+			name:        "valid WATCH command",
+			input:       "WATCH a b",
+			wantCommand: WATCH,
+			wantArgs:    []string{"a", "b"},
+		},
+		{
+			name:      "WATCH without keys",
+			input:     "WATCH",
+			wantError: true,
+			errType:   ErrInvalidNumberOfArgs,
+		},
+		{
+			name:        "valid CAS command",
+			input:       "CAS balance 10 20",
+			wantCommand: CAS,
+			wantArgs:    []string{"balance", "10", "20"},
+		},
+		{
+			name:      "CAS without new value",
+			input:     "CAS balance 10",
+			wantError: true,
+			errType:   ErrInvalidNumberOfArgs,
+		},
+		{
+			name:        "CLUSTER NODES",
+			input:       "CLUSTER NODES",
+			wantCommand: CLUSTER,
+			wantArgs:    []string{"NODES"},
+		},
+		{
+			name:        "CLUSTER ADD",
+			input:       "CLUSTER ADD node-4 127.0.0.1:4004 127.0.0.1:3226",
+			wantCommand: CLUSTER,
+			wantArgs:    []string{"ADD", "node-4", "127.0.0.1:4004", "127.0.0.1:3226"},
+		},
+		{
+			name:      "CLUSTER REMOVE without id",
+			input:     "CLUSTER REMOVE",
+			wantError: true,
+			errType:   ErrInvalidNumberOfArgs,
+		},
+		{
+			name:      "CLUSTER with unknown subcommand",
+			input:     "CLUSTER MEET node-4",
+			wantError: true,
+			errType:   ErrUnknownSubcommand,
+		},
 		{
 			name:      "command without arguments",
 			input:     "GET",
@@ -138,6 +690,148 @@ func TestParser_Parse(t *testing.T) {
 					t.Errorf("arg: %d, expected %s, got %s", i, tt.wantArgs[i], q.Args[i])
 				}
 			}
+
+			if len(q.Options) != len(tt.wantOptions) {
+				t.Fatalf("expected options %v, got %v", tt.wantOptions, q.Options)
+			}
+
+			for name, value := range tt.wantOptions {
+				if q.Options[name] != value {
+					t.Errorf("option %s: expected %s, got %s", name, value, q.Options[name])
+				}
+			}
 		})
 	}
 }
+
+func TestQuery_Keys(t *testing.T) {
+	parser, _ := NewParser(zap.NewNop())
+
+	tests := []struct {
+		input    string
+		wantKeys []string
+		wantOK   bool
+	}{
+		{input: "SET name alice EX 10", wantKeys: []string{"name"}, wantOK: true},
+		{input: "HSET user name alice", wantKeys: []string{"user"}, wantOK: true},
+		{input: "SINTER a b c", wantKeys: []string{"a", "b", "c"}, wantOK: true},
+		{input: "WATCH a b", wantKeys: []string{"a", "b"}, wantOK: true},
+		{input: "MSET a 1 b 2", wantKeys: []string{"a", "b"}, wantOK: true},
+		{input: "DEL a b TIMEOUT 10", wantKeys: []string{"a", "b"}, wantOK: true},
+		{input: "SELECT 1", wantKeys: nil, wantOK: true},
+		{input: "PREFIX user:", wantKeys: nil, wantOK: false},
+		{input: "FLUSHDB", wantKeys: nil, wantOK: false},
+	}
+
+	for _, tt := range tests {
+		q, err := parser.Parse(tt.input)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.input, err)
+		}
+
+		keys, ok := q.Keys()
+		if ok != tt.wantOK || !slices.Equal(keys, tt.wantKeys) {
+			t.Errorf("%s: expected %v, %v, got %v, %v", tt.input, tt.wantKeys, tt.wantOK, keys, ok)
+		}
+	}
+}
+
+func TestParser_ParseRequest(t *testing.T) {
+	parser, _ := NewParser(zap.NewNop())
+
+	value := []byte("two\nlines with spaces\x00 and \xff")
+
+	q, err := parser.ParseRequest(EncodeRequest([]byte("SET"), []byte("key one"), value, []byte("EX"), []byte("60")))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if q.Command != SET {
+		t.Errorf("expected command %s, got %v", SET, q.Command)
+	}
+	if len(q.Args) != 2 || q.Args[0] != "key one" || !bytes.Equal([]byte(q.Args[1]), value) {
+		t.Errorf("expected args [%q %q], got %q", "key one", value, q.Args)
+	}
+	if q.Options[EX] != "60" {
+		t.Errorf("expected EX 60, got %v", q.Options)
+	}
+
+	q, err = parser.ParseRequest([]byte("GET key"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if q.Command != GET || len(q.Args) != 1 || q.Args[0] != "key" {
+		t.Errorf("expected GET key, got %v %q", q.Command, q.Args)
+	}
+
+	q, err = parser.ParseRequest(EncodeRequest([]byte("SET"), []byte("key"), []byte{}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(q.Args) != 2 || q.Args[1] != "" {
+		t.Errorf("expected empty value, got %q", q.Args)
+	}
+
+	invalid := map[string][]byte{
+		"empty":                   EncodeRequest(),
+		"truncated length":        {binaryRequestMarker, 0, 0},
+		"length past the payload": {binaryRequestMarker, 0, 0, 0, 4, 'G', 'E', 'T'},
+	}
+	for name, data := range invalid {
+		if _, err := parser.ParseRequest(data); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("%s: expected %v, got %v", name, ErrInvalidQuery, err)
+		}
+	}
+
+	if _, err := parser.ParseRequest(EncodeRequest([]byte("GET"), []byte("a"), []byte("b"))); !errors.Is(err, ErrInvalidNumberOfArgs) {
+		t.Errorf("expected %v, got %v", ErrInvalidNumberOfArgs, err)
+	}
+}
+
+func TestDecodeReply(t *testing.T) {
+	value := "two\nlines\x00"
+	marked := NilReply + " is a value"
+
+	reply := ArrayReply(ValueReply(value), NilReply, ValueReply(marked), ValuesReply([]string{"a", ""}), ArrayReply())
+
+	decoded, err := DecodeReply([]byte(reply))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if decoded.Kind != ReplyArray || len(decoded.Elements) != 5 {
+		t.Fatalf("expected an array of 5 elements, got %v", decoded)
+	}
+
+	elements := decoded.Elements
+	if elements[0].Kind != ReplyText || elements[0].Text != value {
+		t.Errorf("expected %q, got %v", value, elements[0])
+	}
+	if elements[1].Kind != ReplyNil {
+		t.Errorf("expected nil, got %v", elements[1])
+	}
+	if elements[2].Kind != ReplyText || elements[2].Text != marked {
+		t.Errorf("expected %q, got %v", marked, elements[2])
+	}
+	if nested := elements[3]; nested.Kind != ReplyArray || len(nested.Elements) != 2 || nested.Elements[0].Text != "a" || nested.Elements[1].Text != "" {
+		t.Errorf("expected [a \"\"], got %v", nested)
+	}
+	if empty := elements[4]; empty.Kind != ReplyArray || len(empty.Elements) != 0 {
+		t.Errorf("expected an empty array, got %v", empty)
+	}
+
+	if decoded, err := DecodeReply([]byte("ok")); err != nil || decoded.Kind != ReplyText || decoded.Text != "ok" {
+		t.Errorf("expected ok, got %v, %v", decoded, err)
+	}
+
+	invalid := map[string]string{
+		"missing kind":          string(rune(replyMarker)),
+		"unknown kind":          string([]byte{replyMarker, 'x'}),
+		"trailing bytes":        NilReply + "x",
+		"truncated length":      string([]byte{replyMarker, replyKindArray, 0, 0}),
+		"length past the reply": string([]byte{replyMarker, replyKindArray, 0, 0, 0, 4, 'o', 'k'}),
+	}
+	for name, data := range invalid {
+		if _, err := DecodeReply([]byte(data)); !errors.Is(err, ErrInvalidReply) {
+			t.Errorf("%s: expected %v, got %v", name, ErrInvalidReply, err)
+		}
+	}
+}
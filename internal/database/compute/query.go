@@ -2,55 +2,532 @@ package compute
 
 import (
 	"errors"
+	"fmt"
+	"math"
+	"strconv"
 )
 
 var (
 	ErrInvalidNumberOfArgs = errors.New("invalid number of args")
 	ErrUnknownCommand      = errors.New("unknown command")
+	ErrInvalidOption       = errors.New("invalid option")
+	ErrUnknownSubcommand   = errors.New("unknown subcommand")
+	ErrInvalidArgument     = errors.New("invalid argument")
 )
 
+// MaxExpireSeconds bounds the seconds given to EX and EXPIRE to 100 years,
+// which keeps deadlines within the int64 nanoseconds they are stored as.
+const MaxExpireSeconds = 100 * 365 * 24 * 60 * 60
+
 type CommandName string
 
 const (
 	GET CommandName = "GET"
 	SET CommandName = "SET"
 	DEL CommandName = "DEL"
+
+	MGET   CommandName = "MGET"
+	MSET   CommandName = "MSET"
+	MSETNX CommandName = "MSETNX"
+	EXISTS CommandName = "EXISTS"
+
+	EXPIRE  CommandName = "EXPIRE"
+	TTL     CommandName = "TTL"
+	PERSIST CommandName = "PERSIST"
+
+	RANGE     CommandName = "RANGE"
+	REVRANGE  CommandName = "REVRANGE"
+	PREFIX    CommandName = "PREFIX"
+	REVPREFIX CommandName = "REVPREFIX"
+
+	SCAN CommandName = "SCAN"
+
+	INCR        CommandName = "INCR"
+	DECR        CommandName = "DECR"
+	INCRBY      CommandName = "INCRBY"
+	INCRBYFLOAT CommandName = "INCRBYFLOAT"
+
+	LPUSH  CommandName = "LPUSH"
+	RPUSH  CommandName = "RPUSH"
+	LPOP   CommandName = "LPOP"
+	RPOP   CommandName = "RPOP"
+	LRANGE CommandName = "LRANGE"
+	LLEN   CommandName = "LLEN"
+	LINDEX CommandName = "LINDEX"
+	LTRIM  CommandName = "LTRIM"
+
+	HSET    CommandName = "HSET"
+	HGET    CommandName = "HGET"
+	HDEL    CommandName = "HDEL"
+	HGETALL CommandName = "HGETALL"
+	HEXISTS CommandName = "HEXISTS"
+	HLEN    CommandName = "HLEN"
+	HINCRBY CommandName = "HINCRBY"
+
+	SADD      CommandName = "SADD"
+	SREM      CommandName = "SREM"
+	SISMEMBER CommandName = "SISMEMBER"
+	SMEMBERS  CommandName = "SMEMBERS"
+	SCARD     CommandName = "SCARD"
+	SINTER    CommandName = "SINTER"
+	SUNION    CommandName = "SUNION"
+
+	ZADD    CommandName = "ZADD"
+	ZREM    CommandName = "ZREM"
+	ZSCORE  CommandName = "ZSCORE"
+	ZRANGE  CommandName = "ZRANGE"
+	ZRANK   CommandName = "ZRANK"
+	ZINCRBY CommandName = "ZINCRBY"
+
+	SELECT  CommandName = "SELECT"
+	MOVE    CommandName = "MOVE"
+	SWAPDB  CommandName = "SWAPDB"
+	FLUSHDB CommandName = "FLUSHDB"
+
+	MULTI   CommandName = "MULTI"
+	EXEC    CommandName = "EXEC"
+	DISCARD CommandName = "DISCARD"
+
+	WATCH   CommandName = "WATCH"
+	UNWATCH CommandName = "UNWATCH"
+	VERSION CommandName = "VERSION"
+	CAS     CommandName = "CAS"
+
+	HISTORY CommandName = "HISTORY"
+
+	CLUSTER CommandName = "CLUSTER"
+)
+
+type SubcommandName string
+
+const (
+	NODES  SubcommandName = "NODES"
+	ADD    SubcommandName = "ADD"
+	REMOVE SubcommandName = "REMOVE"
+)
+
+type OptionName string
+
+const (
+	QUORUM  OptionName = "QUORUM"
+	TIMEOUT OptionName = "TIMEOUT"
+	EX      OptionName = "EX"
+	LIMIT   OptionName = "LIMIT"
+	MATCH   OptionName = "MATCH"
+	COUNT   OptionName = "COUNT"
+
+	BYSCORE    OptionName = "BYSCORE"
+	WITHSCORES OptionName = "WITHSCORES"
+
+	NX      OptionName = "NX"
+	XX      OptionName = "XX"
+	KEEPTTL OptionName = "KEEPTTL"
+	// GETOLD is the GET flag of SET, named apart from the GET command.
+	GETOLD OptionName = "GET"
+
+	AT OptionName = "AT"
+)
+
+// flags are options that take no value. They are stored in Query.Options with
+// an empty value.
+var flags = []OptionName{BYSCORE, WITHSCORES, NX, XX, KEEPTTL, GETOLD}
+
+// variadic is the maximum of a command that takes any number of arguments.
+const variadic = -1
+
+// command describes the arguments a command takes: between minArgs and
+// maxArgs positional arguments, then any of options as "NAME value" pairs.
+// Past minArgs, positional arguments end where the rest of the arguments form
+// a group of options, so that "DEL a QUORUM" deletes a key named QUORUM while
+// "DEL a QUORUM 1" deletes a with a quorum of 1.
+type command struct {
+	minArgs int
+	maxArgs int
+	options []OptionName
+}
+
+var (
+	writeOptions  = []OptionName{QUORUM, TIMEOUT}
+	getOptions    = []OptionName{AT}
+	setOptions    = []OptionName{EX, NX, XX, GETOLD, KEEPTTL, QUORUM, TIMEOUT}
+	rangeOptions  = []OptionName{LIMIT}
+	scanOptions   = []OptionName{MATCH, COUNT}
+	zrangeOptions = []OptionName{BYSCORE, WITHSCORES}
 )
 
+var commands = map[CommandName]command{
+	GET: {minArgs: 1, maxArgs: 1, options: getOptions},
+	SET: {minArgs: 2, maxArgs: 2, options: setOptions},
+	DEL: {minArgs: 1, maxArgs: variadic, options: writeOptions},
+
+	MGET:   {minArgs: 1, maxArgs: variadic, options: nil},
+	MSET:   {minArgs: 2, maxArgs: variadic, options: writeOptions},
+	MSETNX: {minArgs: 2, maxArgs: variadic, options: writeOptions},
+	EXISTS: {minArgs: 1, maxArgs: variadic, options: nil},
+
+	EXPIRE:  {minArgs: 2, maxArgs: 2, options: writeOptions},
+	TTL:     {minArgs: 1, maxArgs: 1, options: nil},
+	PERSIST: {minArgs: 1, maxArgs: 1, options: writeOptions},
+
+	RANGE:     {minArgs: 2, maxArgs: 2, options: rangeOptions},
+	REVRANGE:  {minArgs: 2, maxArgs: 2, options: rangeOptions},
+	PREFIX:    {minArgs: 1, maxArgs: 1, options: rangeOptions},
+	REVPREFIX: {minArgs: 1, maxArgs: 1, options: rangeOptions},
+
+	SCAN: {minArgs: 1, maxArgs: 1, options: scanOptions},
+
+	INCR:        {minArgs: 1, maxArgs: 1, options: writeOptions},
+	DECR:        {minArgs: 1, maxArgs: 1, options: writeOptions},
+	INCRBY:      {minArgs: 2, maxArgs: 2, options: writeOptions},
+	INCRBYFLOAT: {minArgs: 2, maxArgs: 2, options: writeOptions},
+
+	LPUSH:  {minArgs: 2, maxArgs: variadic, options: writeOptions},
+	RPUSH:  {minArgs: 2, maxArgs: variadic, options: writeOptions},
+	LPOP:   {minArgs: 1, maxArgs: 2, options: writeOptions},
+	RPOP:   {minArgs: 1, maxArgs: 2, options: writeOptions},
+	LRANGE: {minArgs: 3, maxArgs: 3, options: nil},
+	LLEN:   {minArgs: 1, maxArgs: 1, options: nil},
+	LINDEX: {minArgs: 2, maxArgs: 2, options: nil},
+	LTRIM:  {minArgs: 3, maxArgs: 3, options: writeOptions},
+
+	HSET:    {minArgs: 3, maxArgs: variadic, options: writeOptions},
+	HGET:    {minArgs: 2, maxArgs: 2, options: nil},
+	HDEL:    {minArgs: 2, maxArgs: variadic, options: writeOptions},
+	HGETALL: {minArgs: 1, maxArgs: 1, options: nil},
+	HEXISTS: {minArgs: 2, maxArgs: 2, options: nil},
+	HLEN:    {minArgs: 1, maxArgs: 1, options: nil},
+	HINCRBY: {minArgs: 3, maxArgs: 3, options: writeOptions},
+
+	SADD:      {minArgs: 2, maxArgs: variadic, options: writeOptions},
+	SREM:      {minArgs: 2, maxArgs: variadic, options: writeOptions},
+	SISMEMBER: {minArgs: 2, maxArgs: 2, options: nil},
+	SMEMBERS:  {minArgs: 1, maxArgs: 1, options: nil},
+	SCARD:     {minArgs: 1, maxArgs: 1, options: nil},
+	SINTER:    {minArgs: 1, maxArgs: variadic, options: nil},
+	SUNION:    {minArgs: 1, maxArgs: variadic, options: nil},
+
+	ZADD:    {minArgs: 3, maxArgs: variadic, options: writeOptions},
+	ZREM:    {minArgs: 2, maxArgs: variadic, options: writeOptions},
+	ZSCORE:  {minArgs: 2, maxArgs: 2, options: nil},
+	ZRANGE:  {minArgs: 3, maxArgs: 3, options: zrangeOptions},
+	ZRANK:   {minArgs: 2, maxArgs: 2, options: nil},
+	ZINCRBY: {minArgs: 3, maxArgs: 3, options: writeOptions},
+
+	SELECT:  {minArgs: 1, maxArgs: 1, options: nil},
+	MOVE:    {minArgs: 2, maxArgs: 2, options: nil},
+	SWAPDB:  {minArgs: 2, maxArgs: 2, options: nil},
+	FLUSHDB: {minArgs: 0, maxArgs: 0, options: writeOptions},
+
+	MULTI:   {minArgs: 0, maxArgs: 0, options: nil},
+	EXEC:    {minArgs: 0, maxArgs: 0, options: nil},
+	DISCARD: {minArgs: 0, maxArgs: 0, options: nil},
+
+	WATCH:   {minArgs: 1, maxArgs: variadic, options: nil},
+	UNWATCH: {minArgs: 0, maxArgs: 0, options: nil},
+	VERSION: {minArgs: 1, maxArgs: 1, options: nil},
+	CAS:     {minArgs: 3, maxArgs: 3, options: writeOptions},
+
+	HISTORY: {minArgs: 1, maxArgs: 1, options: rangeOptions},
+}
+
 const (
-	getCommandArgsCount = 1
-	setCommandArgsCount = 2
-	delCommandArgsCount = 1
+	clusterNodesArgsCount  = 1
+	clusterAddArgsCount    = 4
+	clusterRemoveArgsCount = 2
 )
 
 type Query struct {
 	Command CommandName
 	Args    []string
+	Options map[OptionName]string
 }
 
 func NewQuery(command CommandName, args []string) *Query {
 	return &Query{
 		Command: command,
 		Args:    args,
+		Options: make(map[OptionName]string),
 	}
 }
 
-func (q *Query) validate() error {
+// Keys returns the keys the query reads or writes. It reports false for
+// queries that may touch any key, such as range queries and commands on whole
+// databases.
+func (q *Query) Keys() ([]string, bool) {
 	switch q.Command {
-	case GET:
-		if len(q.Args) != getCommandArgsCount {
-			return ErrInvalidNumberOfArgs
+	case SELECT, CLUSTER, MULTI, EXEC, DISCARD, UNWATCH:
+		return nil, true
+	case SINTER, SUNION, WATCH, MGET, DEL, EXISTS:
+		return q.Args, true
+	case MSET, MSETNX:
+		keys := make([]string, 0, len(q.Args)/2)
+		for i := 0; i < len(q.Args); i += 2 {
+			keys = append(keys, q.Args[i])
+		}
+		return keys, true
+	case RANGE, REVRANGE, PREFIX, REVPREFIX, SCAN, MOVE, SWAPDB, FLUSHDB:
+		return nil, false
+	default:
+		return q.Args[:1], true
+	}
+}
+
+func (q *Query) validate() error {
+	if q.Command == CLUSTER {
+		return q.validateCluster()
+	}
+
+	cmd, ok := commands[q.Command]
+	if !ok {
+		return ErrUnknownCommand
+	}
+
+	if cmd.options != nil {
+		if err := q.parseOptions(cmd.minArgs, cmd.maxArgs, cmd.options); err != nil {
+			return err
 		}
+	} else if len(q.Args) < cmd.minArgs || cmd.maxArgs != variadic && len(q.Args) > cmd.maxArgs {
+		return ErrInvalidNumberOfArgs
+	}
+
+	return q.validateArgs()
+}
+
+// validateArgs checks the values of arguments once their number is known to
+// be right.
+func (q *Query) validateArgs() error {
+	switch q.Command {
 	case SET:
-		if len(q.Args) != setCommandArgsCount {
-			return ErrInvalidNumberOfArgs
+		if q.hasOptions(NX, XX) {
+			return fmt.Errorf("%w: %s and %s can not be combined", ErrInvalidOption, NX, XX)
 		}
-	case DEL:
-		if len(q.Args) != delCommandArgsCount {
-			return ErrInvalidNumberOfArgs
+		if q.hasOptions(EX, KEEPTTL) {
+			return fmt.Errorf("%w: %s and %s can not be combined", ErrInvalidOption, EX, KEEPTTL)
+		}
+	case MSET, MSETNX:
+		if len(q.Args)%2 != 0 {
+			return fmt.Errorf("%w: keys and values must come in pairs", ErrInvalidArgument)
+		}
+	case EXPIRE:
+		if n, err := strconv.ParseInt(q.Args[1], 10, 64); err != nil || n < -MaxExpireSeconds || n > MaxExpireSeconds {
+			return fmt.Errorf("%w: seconds must be an integer of at most %d", ErrInvalidArgument, MaxExpireSeconds)
+		}
+	case INCRBY:
+		if _, err := strconv.ParseInt(q.Args[1], 10, 64); err != nil {
+			return fmt.Errorf("%w: increment must be an integer", ErrInvalidArgument)
+		}
+	case INCRBYFLOAT:
+		if !isFinite(q.Args[1]) {
+			return fmt.Errorf("%w: increment must be a finite number", ErrInvalidArgument)
 		}
+	case LPOP, RPOP:
+		if len(q.Args) > 1 {
+			if n, err := strconv.Atoi(q.Args[1]); err != nil || n <= 0 {
+				return fmt.Errorf("%w: count must be a positive integer", ErrInvalidArgument)
+			}
+		}
+	case LRANGE, LINDEX, LTRIM:
+		for _, arg := range q.Args[1:] {
+			if _, err := strconv.Atoi(arg); err != nil {
+				return fmt.Errorf("%w: index must be an integer", ErrInvalidArgument)
+			}
+		}
+	case HSET:
+		if len(q.Args)%2 == 0 {
+			return fmt.Errorf("%w: fields and values must come in pairs", ErrInvalidArgument)
+		}
+	case HINCRBY:
+		if _, err := strconv.ParseInt(q.Args[2], 10, 64); err != nil {
+			return fmt.Errorf("%w: increment must be an integer", ErrInvalidArgument)
+		}
+	case ZADD:
+		if len(q.Args)%2 == 0 {
+			return fmt.Errorf("%w: scores and members must come in pairs", ErrInvalidArgument)
+		}
+		for i := 1; i < len(q.Args); i += 2 {
+			if !isFinite(q.Args[i]) {
+				return fmt.Errorf("%w: score must be a finite number", ErrInvalidArgument)
+			}
+		}
+	case ZRANGE:
+		if _, ok := q.Options[BYSCORE]; !ok {
+			for _, arg := range q.Args[1:] {
+				if _, err := strconv.Atoi(arg); err != nil {
+					return fmt.Errorf("%w: rank must be an integer", ErrInvalidArgument)
+				}
+			}
+			break
+		}
+		for _, arg := range q.Args[1:] {
+			if f, err := strconv.ParseFloat(arg, 64); err != nil || math.IsNaN(f) {
+				return fmt.Errorf("%w: score must be a number", ErrInvalidArgument)
+			}
+		}
+	case ZINCRBY:
+		if !isFinite(q.Args[1]) {
+			return fmt.Errorf("%w: increment must be a finite number", ErrInvalidArgument)
+		}
+	case SELECT, MOVE, SWAPDB:
+		indexes := q.Args
+		if q.Command == MOVE {
+			indexes = q.Args[1:]
+		}
+		for _, arg := range indexes {
+			if n, err := strconv.Atoi(arg); err != nil || n < 0 {
+				return fmt.Errorf("%w: database index must be a non-negative integer", ErrInvalidArgument)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (q *Query) hasOptions(names ...OptionName) bool {
+	for _, name := range names {
+		if _, ok := q.Options[name]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isFinite(arg string) bool {
+	f, err := strconv.ParseFloat(arg, 64)
+	return err == nil && !math.IsInf(f, 0) && !math.IsNaN(f)
+}
+
+// validateCluster checks "CLUSTER NODES", "CLUSTER ADD id address
+// client_address" and "CLUSTER REMOVE id".
+func (q *Query) validateCluster() error {
+	if len(q.Args) == 0 {
+		return ErrInvalidNumberOfArgs
+	}
+
+	var count int
+	switch SubcommandName(q.Args[0]) {
+	case NODES:
+		count = clusterNodesArgsCount
+	case ADD:
+		count = clusterAddArgsCount
+	case REMOVE:
+		count = clusterRemoveArgsCount
 	default:
-		return ErrUnknownCommand
+		return fmt.Errorf("%w: %s", ErrUnknownSubcommand, q.Args[0])
+	}
+
+	if len(q.Args) != count {
+		return ErrInvalidNumberOfArgs
+	}
+
+	return nil
+}
+
+// parseOptions splits the arguments into positional arguments, as many as
+// command describes, and the tokens after them, which are parsed into
+// "NAME value" option pairs, or lone names for flags. Options may appear in
+// any order.
+func (q *Query) parseOptions(minArgs, maxArgs int, allowed []OptionName) error {
+	if len(q.Args) < minArgs {
+		return ErrInvalidNumberOfArgs
+	}
+
+	last := len(q.Args)
+	if maxArgs != variadic {
+		last = min(maxArgs, last)
+	}
+
+	positional := minArgs
+	for positional < last && !isOptionGroup(q.Args[positional:], allowed) {
+		positional++
+	}
+
+	tokens := q.Args[positional:]
+	q.Args = q.Args[:positional]
+
+	for len(tokens) > 0 {
+		name := OptionName(tokens[0])
+		if !isAllowed(name, allowed) {
+			return ErrInvalidNumberOfArgs
+		}
+
+		if _, ok := q.Options[name]; ok {
+			return fmt.Errorf("%w: %s specified more than once", ErrInvalidOption, name)
+		}
+
+		if isAllowed(name, flags) {
+			q.Options[name] = ""
+			tokens = tokens[1:]
+			continue
+		}
+
+		if len(tokens) < 2 {
+			return fmt.Errorf("%w: %s requires a value", ErrInvalidOption, name)
+		}
+
+		if err := validateOption(name, tokens[1]); err != nil {
+			return err
+		}
+
+		q.Options[name] = tokens[1]
+		tokens = tokens[2:]
+	}
+
+	return nil
+}
+
+// isOptionGroup reports whether tokens are names of allowed options, each
+// followed by a value unless it is a flag. The values are not validated.
+func isOptionGroup(tokens []string, allowed []OptionName) bool {
+	for len(tokens) > 0 {
+		name := OptionName(tokens[0])
+		switch {
+		case !isAllowed(name, allowed):
+			return false
+		case isAllowed(name, flags):
+			tokens = tokens[1:]
+		case len(tokens) < 2:
+			return false
+		default:
+			tokens = tokens[2:]
+		}
+	}
+
+	return true
+}
+
+func isAllowed(name OptionName, allowed []OptionName) bool {
+	for _, option := range allowed {
+		if option == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func validateOption(name OptionName, value string) error {
+	switch name {
+	case QUORUM:
+		if n, err := strconv.Atoi(value); err != nil || n < 0 {
+			return fmt.Errorf("%w: %s must be a non-negative integer", ErrInvalidOption, name)
+		}
+	case TIMEOUT:
+		if n, err := strconv.Atoi(value); err != nil || n <= 0 {
+			return fmt.Errorf("%w: %s must be a positive number of milliseconds", ErrInvalidOption, name)
+		}
+	case EX:
+		if n, err := strconv.ParseInt(value, 10, 64); err != nil || n <= 0 || n > MaxExpireSeconds {
+			return fmt.Errorf("%w: %s must be a positive number of seconds up to %d", ErrInvalidOption, name, MaxExpireSeconds)
+		}
+	case LIMIT, COUNT:
+		if n, err := strconv.Atoi(value); err != nil || n <= 0 {
+			return fmt.Errorf("%w: %s must be a positive integer", ErrInvalidOption, name)
+		}
+	case AT:
+		if _, err := strconv.ParseUint(value, 10, 64); err != nil {
+			return fmt.Errorf("%w: %s must be a revision", ErrInvalidOption, name)
+		}
 	}
 
 	return nil
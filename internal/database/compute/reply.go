@@ -0,0 +1,148 @@
+package compute
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidReply = errors.New("invalid reply")
+
+// A reply is text, such as ok, an error, a number or a single value, unless
+// it is nil or holds several values. Those start with replyMarker and a kind
+// byte. A nil reply ends there. An array reply goes on with every element,
+// itself a reply, as a big-endian uint32 length and that many bytes, so
+// elements may hold newlines or nested arrays. A value that would start with
+// replyMarker is sent as a value reply: replyMarker, replyKindValue and the
+// value. A redirect reply is replyMarker, replyKindRedirect and the address
+// of the leader, so that no value is taken for one. Other text replies never
+// start with a zero byte.
+const (
+	replyMarker = 0x00
+
+	replyKindNil      = 'n'
+	replyKindArray    = 'a'
+	replyKindValue    = 'v'
+	replyKindRedirect = 'r'
+)
+
+// NilReply stands for a missing value, as opposed to an empty one.
+const NilReply = string(rune(replyMarker)) + string(rune(replyKindNil))
+
+// ReplyKind tells the replies DecodeReply returns apart.
+type ReplyKind uint8
+
+const (
+	ReplyText ReplyKind = iota
+	ReplyNil
+	ReplyArray
+	// ReplyRedirect has the address of the node to send the query to instead
+	// as its text.
+	ReplyRedirect
+)
+
+// Reply is a decoded reply: its text, or its elements if it is an array.
+type Reply struct {
+	Kind     ReplyKind
+	Text     string
+	Elements []Reply
+}
+
+// ValueReply returns value as a reply, escaping it if it could be taken for
+// an encoded one.
+func ValueReply(value string) string {
+	if len(value) == 0 || value[0] != replyMarker {
+		return value
+	}
+
+	return string([]byte{replyMarker, replyKindValue}) + value
+}
+
+// RedirectReply tells the client to send its query to the node at address.
+func RedirectReply(address string) string {
+	return string([]byte{replyMarker, replyKindRedirect}) + address
+}
+
+// ArrayReply builds an array reply from replies, such as values passed
+// through ValueReply, NilReply or other arrays.
+func ArrayReply(elements ...string) string {
+	size := 2
+	for _, element := range elements {
+		size += binaryArgLengthSize + len(element)
+	}
+
+	var b strings.Builder
+	b.Grow(size)
+	b.WriteByte(replyMarker)
+	b.WriteByte(replyKindArray)
+	for _, element := range elements {
+		//nolint:gosec
+		b.Write(binary.BigEndian.AppendUint32(nil, uint32(len(element))))
+		b.WriteString(element)
+	}
+
+	return b.String()
+}
+
+// ValuesReply is ArrayReply for plain values.
+func ValuesReply(values []string) string {
+	elements := make([]string, 0, len(values))
+	for _, value := range values {
+		elements = append(elements, ValueReply(value))
+	}
+
+	return ArrayReply(elements...)
+}
+
+// DecodeReply decodes a reply as sent by the server.
+func DecodeReply(data []byte) (Reply, error) {
+	if len(data) == 0 || data[0] != replyMarker {
+		return Reply{Kind: ReplyText, Text: string(data), Elements: nil}, nil
+	}
+
+	if len(data) < 2 {
+		return Reply{}, fmt.Errorf("%w: missing kind", ErrInvalidReply)
+	}
+
+	kind, data := data[1], data[2:]
+	switch kind {
+	case replyKindNil:
+		if len(data) > 0 {
+			return Reply{}, fmt.Errorf("%w: trailing bytes after nil", ErrInvalidReply)
+		}
+		return Reply{Kind: ReplyNil, Text: "", Elements: nil}, nil
+	case replyKindValue:
+		return Reply{Kind: ReplyText, Text: string(data), Elements: nil}, nil
+	case replyKindRedirect:
+		return Reply{Kind: ReplyRedirect, Text: string(data), Elements: nil}, nil
+	case replyKindArray:
+		return decodeArray(data)
+	default:
+		return Reply{}, fmt.Errorf("%w: unknown kind %q", ErrInvalidReply, kind)
+	}
+}
+
+func decodeArray(data []byte) (Reply, error) {
+	elements := []Reply{}
+	for len(data) > 0 {
+		if len(data) < binaryArgLengthSize {
+			return Reply{}, fmt.Errorf("%w: truncated element length", ErrInvalidReply)
+		}
+
+		length := binary.BigEndian.Uint32(data)
+		data = data[binaryArgLengthSize:]
+		if uint64(length) > uint64(len(data)) {
+			return Reply{}, fmt.Errorf("%w: truncated element", ErrInvalidReply)
+		}
+
+		element, err := DecodeReply(data[:length])
+		if err != nil {
+			return Reply{}, err
+		}
+		elements = append(elements, element)
+		data = data[length:]
+	}
+
+	return Reply{Kind: ReplyArray, Text: "", Elements: elements}, nil
+}
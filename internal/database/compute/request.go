@@ -0,0 +1,60 @@
+package compute
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// A binary request starts with binaryRequestMarker, followed by every part of
+// the query, command name included, as a big-endian uint32 length and that
+// many bytes. Unlike the text form it can carry keys and values with spaces,
+// newlines or any other byte. Text queries never start with a zero byte.
+const binaryRequestMarker = 0x00
+
+const binaryArgLengthSize = 4
+
+// EncodeRequest builds a binary request from the parts of a query.
+func EncodeRequest(parts ...[]byte) []byte {
+	size := 1
+	for _, part := range parts {
+		size += binaryArgLengthSize + len(part)
+	}
+
+	request := make([]byte, 1, size)
+	request[0] = binaryRequestMarker
+	for _, part := range parts {
+		//nolint:gosec
+		request = binary.BigEndian.AppendUint32(request, uint32(len(part)))
+		request = append(request, part...)
+	}
+
+	return request
+}
+
+// IsBinaryRequest reports whether data is a binary request rather than a text
+// query.
+func IsBinaryRequest(data []byte) bool {
+	return len(data) > 0 && data[0] == binaryRequestMarker
+}
+
+func decodeRequest(data []byte) ([]string, error) {
+	data = data[1:]
+
+	var parts []string
+	for len(data) > 0 {
+		if len(data) < binaryArgLengthSize {
+			return nil, fmt.Errorf("%w: truncated argument length", ErrInvalidQuery)
+		}
+
+		length := binary.BigEndian.Uint32(data)
+		data = data[binaryArgLengthSize:]
+		if uint64(length) > uint64(len(data)) {
+			return nil, fmt.Errorf("%w: truncated argument", ErrInvalidQuery)
+		}
+
+		parts = append(parts, string(data[:length]))
+		data = data[length:]
+	}
+
+	return parts, nil
+}
@@ -3,21 +3,56 @@ package database
 import (
 	"errors"
 	"fmt"
+	"strconv"
+	"time"
 
+	"github.com/crunchydeer30/key-value-database/internal/config"
 	"github.com/crunchydeer30/key-value-database/internal/database/compute"
+	"github.com/crunchydeer30/key-value-database/internal/database/raft"
+	"github.com/crunchydeer30/key-value-database/internal/database/replication"
 	"github.com/crunchydeer30/key-value-database/internal/database/storage"
 	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+	_ "github.com/crunchydeer30/key-value-database/internal/database/storage/engine/btree"
 	inmemory "github.com/crunchydeer30/key-value-database/internal/database/storage/engine/in_memory"
+	_ "github.com/crunchydeer30/key-value-database/internal/database/storage/engine/lsm"
+	_ "github.com/crunchydeer30/key-value-database/internal/database/storage/engine/ordered"
+	_ "github.com/crunchydeer30/key-value-database/internal/database/storage/engine/sharded"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/snapshot"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/wal"
 	"go.uber.org/zap"
 )
 
+const (
+	defaultSnapshotInterval = 5 * time.Minute
+	keyLockStripes          = 1024
+)
+
+var ErrReadOnlyReplica = errors.New("read-only replica")
+
 type Database struct {
 	compute *compute.Compute
-	storage *storage.Storage
-	logger  *zap.Logger
+	// storage is the database queries work on. Every query runs on a copy of
+	// Database bound to the database its session has selected.
+	storage       *storage.Storage
+	dbs           *databases
+	locks         *engine.KeyLocks
+	leader        *replication.Leader
+	replica       *replication.Replica
+	cluster       *raft.Node
+	writeQuorum   int
+	quorumTimeout time.Duration
+	logger        *zap.Logger
+
+	// batches is set on the copy a query of a transaction runs on, which
+	// writes through the batches of the transaction.
+	batches *batches
 }
 
-func NewDatabase(logger *zap.Logger) (*Database, error) {
+func NewDatabase(cfg *config.Config, logger *zap.Logger) (*Database, error) {
+	if cfg == nil {
+		return nil, errors.New("config is nil")
+	}
+
 	if logger == nil {
 		logger = zap.NewNop()
 	}
@@ -28,35 +63,365 @@ func NewDatabase(logger *zap.Logger) (*Database, error) {
 		return nil, err
 	}
 
-	engine, err := inmemory.NewInMemoryEngine(logger)
-	if err != nil {
+	count := max(cfg.Databases, 1)
+	// Replicas and cluster nodes only ship the log of a single database.
+	if count > 1 && (cfg.Replication != nil || cfg.Cluster != nil) {
+		err := errors.New("multiple databases are not supported with replication or in cluster mode")
+		logger.Error("failed to initialize storage module", zap.Error(err))
+		return nil, err
+	}
+
+	// Evictions are not replicated through the raft log yet.
+	if cfg.Engine.MaxMemory > 0 && cfg.Cluster != nil {
+		err := errors.New("max_memory is not supported in cluster mode")
 		logger.Error("failed to initialize storage module", zap.Error(err))
 		return nil, err
 	}
 
-	storage, err := storage.NewStorage(engine, logger)
+	dbs, err := newDatabases(slotsPath(cfg), count)
 	if err != nil {
 		logger.Error("failed to initialize storage module", zap.Error(err))
 		return nil, err
 	}
 
-	return &Database{
+	first, err := newComponents(slotConfig(cfg, dbs.slots[0]), logger)
+	if err != nil {
+		return nil, err
+	}
+
+	//nolint:exhaustruct
+	db := &Database{
 		compute: compute,
-		storage: storage,
+		dbs:     dbs,
+		locks:   engine.NewKeyLocks(keyLockStripes),
 		logger:  logger,
-	}, nil
+	}
+
+	if cfg.Replication != nil {
+		if err := db.initReplication(cfg.Replication, first.wal, first.snapshots); err != nil {
+			logger.Error("failed to initialize replication", zap.Error(err))
+			return nil, err
+		}
+
+		if db.leader != nil {
+			first.opts = append(first.opts, storage.WithReplicator(db.leader))
+		}
+	}
+
+	if cfg.Cluster != nil {
+		first.opts = append(first.opts, storage.WithProposer(clusterProposer{db: db}))
+	}
+
+	storage, err := storage.NewStorage(first.engine, logger, first.opts...)
+	if err != nil {
+		logger.Error("failed to initialize storage module", zap.Error(err))
+		if db.leader != nil {
+			//nolint:errcheck
+			db.leader.Close()
+		}
+		return nil, err
+	}
+	db.storage = storage
+	dbs.storages[0] = storage
+
+	for index := 1; index < count; index++ {
+		dbs.storages[index], err = newSlotStorage(cfg, dbs.slots[index], logger)
+		if err != nil {
+			//nolint:errcheck
+			db.Close()
+			return nil, err
+		}
+	}
+
+	if err := db.startReplication(cfg.Replication, first.snapshots); err != nil {
+		logger.Error("failed to initialize replication", zap.Error(err))
+		//nolint:errcheck
+		db.Close()
+		return nil, err
+	}
+
+	if cfg.Cluster != nil {
+		if err := db.startCluster(cfg.Cluster, first.engine); err != nil {
+			logger.Error("failed to initialize cluster", zap.Error(err))
+			//nolint:errcheck
+			db.Close()
+			return nil, err
+		}
+	}
+
+	return db, nil
+}
+
+// components are what the storage of a database is made of.
+type components struct {
+	engine    engine.Engine
+	wal       *wal.WAL
+	snapshots *snapshot.Manager
+	opts      []storage.StorageOption
+}
+
+func newComponents(cfg *config.Config, logger *zap.Logger) (components, error) {
+	var c components
+
+	if cfg.Engine.MaxMemory > 0 {
+		policy := engine.EvictionPolicy(cfg.Engine.EvictionPolicy)
+		c.opts = append(c.opts, storage.WithMaxMemory(cfg.Engine.MaxMemory, policy))
+	}
+
+	if history := cfg.Engine.History; history != nil {
+		limits := engine.HistoryLimits{MaxVersions: history.MaxVersions, MaxAge: history.MaxAge}
+		c.opts = append(c.opts, storage.WithHistory(limits))
+	}
+
+	var err error
+	c.engine, err = newEngine(cfg.Engine, logger)
+	if err != nil {
+		logger.Error("failed to initialize storage module", zap.Error(err))
+		return c, err
+	}
+
+	if cfg.WAL != nil {
+		c.wal, err = wal.NewWAL(cfg.WAL, logger)
+		if err != nil {
+			logger.Error("failed to initialize wal", zap.Error(err))
+			return c, err
+		}
+		c.opts = append(c.opts, storage.WithWAL(c.wal))
+	}
+
+	if cfg.Snapshot != nil {
+		c.snapshots, err = snapshot.NewManager(cfg.Snapshot, logger)
+		if err != nil {
+			logger.Error("failed to initialize snapshots", zap.Error(err))
+			return c, err
+		}
+
+		interval := cfg.Snapshot.Interval
+		if interval == 0 {
+			interval = defaultSnapshotInterval
+		}
+		c.opts = append(c.opts, storage.WithSnapshots(c.snapshots, interval))
+	}
+
+	return c, nil
+}
+
+// newSlotStorage opens the storage of a database other than the first one,
+// which is never replicated.
+func newSlotStorage(cfg *config.Config, slot int, logger *zap.Logger) (*storage.Storage, error) {
+	c, err := newComponents(slotConfig(cfg, slot), logger)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := storage.NewStorage(c.engine, logger, c.opts...)
+	if err != nil {
+		logger.Error("failed to initialize storage module", zap.Error(err), zap.Int("slot", slot))
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// newEngine builds the engine selected by the config from the section named
+// after it. Engines register themselves when their package is imported.
+func newEngine(cfg config.EngineConfig, logger *zap.Logger) (engine.Engine, error) {
+	name := engineName(cfg)
+	return engine.New(name, cfg.Sections[name], logger)
+}
+
+func engineName(cfg config.EngineConfig) string {
+	if cfg.Type == "" {
+		return inmemory.Name
+	}
+
+	return cfg.Type
 }
 
+// startCluster replaces the local WAL with the replicated raft log: writes are
+// proposed to the cluster and committed entries drive the engine.
+func (d *Database) startCluster(cfg *config.ClusterConfig, e engine.Engine) error {
+	fsm, err := newStateMachine(e, d.storage)
+	if err != nil {
+		return err
+	}
+
+	node, err := raft.NewNode(cfg, fsm, d.logger)
+	if err != nil {
+		return err
+	}
+
+	d.cluster = node
+	d.cluster.Start()
+
+	return nil
+}
+
+// initReplication creates the leader before storage so that storage can wait
+// on replica acknowledgements. The replica needs storage and is created later.
+func (d *Database) initReplication(cfg *config.ReplicationConfig, w *wal.WAL, snapshots *snapshot.Manager) error {
+	if cfg.LeaderAddress != "" {
+		return nil
+	}
+
+	leader, err := replication.NewLeader(cfg, w, snapshots, func() (snapshot.Info, error) {
+		return d.storage.Snapshot()
+	}, d.logger)
+	if err != nil {
+		return err
+	}
+
+	d.leader = leader
+	d.writeQuorum = cfg.WriteQuorum
+	d.quorumTimeout = cfg.QuorumTimeout
+
+	return nil
+}
+
+func (d *Database) startReplication(cfg *config.ReplicationConfig, snapshots *snapshot.Manager) error {
+	if d.leader != nil {
+		d.leader.Start()
+		return nil
+	}
+
+	if cfg == nil || cfg.LeaderAddress == "" {
+		return nil
+	}
+
+	replica, err := replication.NewReplica(cfg, d.storage, snapshots, d.logger)
+	if err != nil {
+		return err
+	}
+
+	d.replica = replica
+	d.replica.Start()
+
+	return nil
+}
+
+// Session is the state a client connection keeps between its queries: the
+// database it has selected, the transaction it has open, if any, and the keys
+// it watches for that transaction. A session serves one connection and is not
+// safe for concurrent use.
+type Session struct {
+	db       *Database
+	selected int
+	tx       *transaction
+	watches  []watch
+	// batches is set while EXEC runs the queries of a transaction that
+	// writes.
+	batches *batches
+}
+
+// NewSession starts a session on database 0.
+func (d *Database) NewSession() *Session {
+	return &Session{db: d, selected: 0, tx: nil, watches: nil, batches: nil}
+}
+
+// HandleQuery handles a request received from a client, either a text query
+// or a binary one built by compute.EncodeRequest.
+func (s *Session) HandleQuery(data []byte) []byte {
+	query, err := s.db.compute.ParseRequest(data)
+	if err != nil {
+		return []byte(s.invalidQuery(err))
+	}
+
+	return []byte(s.handleQuery(query))
+}
+
+func (s *Session) HandleQueryString(queryStr string) string {
+	query, err := s.db.compute.Parse(queryStr)
+	if err != nil {
+		return s.invalidQuery(err)
+	}
+
+	return s.handleQuery(query)
+}
+
+// invalidQuery replies to a query that failed to parse. Inside a transaction
+// it also aborts the transaction.
+func (s *Session) invalidQuery(err error) string {
+	if s.tx != nil {
+		s.tx.aborted = true
+	}
+
+	return fmt.Sprintf("invalid query: %s", err.Error())
+}
+
+func (s *Session) handleQuery(query *compute.Query) string {
+	switch query.Command {
+	case compute.MULTI:
+		return s.handleMultiQuery()
+	case compute.EXEC:
+		return s.handleExecQuery(query)
+	case compute.DISCARD:
+		return s.handleDiscardQuery()
+	case compute.WATCH:
+		return s.handleWatchQuery(query)
+	}
+
+	if s.tx != nil {
+		s.tx.queries = append(s.tx.queries, query)
+		return replyQueued
+	}
+
+	// The leader of a cluster prepares writes from what it has applied, so
+	// a write must not start before the previous one to its keys is applied.
+	exclusive := isAtomic(query.Command) || s.db.cluster != nil && isWrite(query.Command)
+	unlock := s.db.lock([]*compute.Query{query}, nil, !exclusive)
+	defer unlock()
+
+	return s.execute(query)
+}
+
+// execute runs a query on the database the session has selected.
+func (s *Session) execute(query *compute.Query) string {
+	switch query.Command {
+	case compute.SELECT:
+		return s.handleSelectQuery(query)
+	case compute.UNWATCH:
+		s.watches = nil
+		return "ok"
+	}
+
+	selected, err := s.db.dbs.get(s.selected)
+	if err != nil {
+		return fmt.Sprintf("error: %s", err.Error())
+	}
+
+	bound := *s.db
+	bound.storage = selected
+
+	if s.batches != nil {
+		// Writes of a transaction are logged or proposed together once it
+		// is done, so its queries write to their batch directly.
+		bound.storage, err = s.batches.get(selected)
+		if err != nil {
+			return bound.writeFailure(err, "failed to begin transaction")
+		}
+		bound.cluster, bound.batches = nil, s.batches
+	}
+
+	return bound.handleQuery(query)
+}
+
+// HandleQuery handles a request on database 0, in a session of its own.
 func (d *Database) HandleQuery(data []byte) []byte {
-	queryStr := string(data)
-	result := d.HandleQueryString(queryStr)
-	return []byte(result)
+	return d.NewSession().HandleQuery(data)
 }
 
 func (d *Database) HandleQueryString(queryStr string) string {
-	query, err := d.compute.Parse(queryStr)
-	if err != nil {
-		return fmt.Sprintf("invalid query: %s", err.Error())
+	return d.NewSession().HandleQueryString(queryStr)
+}
+
+func (d *Database) handleQuery(query *compute.Query) string {
+	if isWrite(query.Command) {
+		if d.replica != nil {
+			return fmt.Sprintf("error: %s", ErrReadOnlyReplica.Error())
+		}
+		if d.cluster != nil && !d.cluster.IsLeader() {
+			return d.redirect()
+		}
 	}
 
 	switch query.Command {
@@ -66,12 +431,98 @@ func (d *Database) HandleQueryString(queryStr string) string {
 		return d.handleSetQuery(query)
 	case compute.DEL:
 		return d.handleDelQuery(query)
+	case compute.MGET:
+		return d.handleMGetQuery(query)
+	case compute.MSET:
+		return d.handleMSetQuery(query)
+	case compute.MSETNX:
+		return d.handleMSetNXQuery(query)
+	case compute.EXISTS:
+		return d.handleExistsQuery(query)
+	case compute.EXPIRE:
+		return d.handleExpireQuery(query)
+	case compute.TTL:
+		return d.handleTTLQuery(query)
+	case compute.PERSIST:
+		return d.handlePersistQuery(query)
+	case compute.RANGE, compute.REVRANGE, compute.PREFIX, compute.REVPREFIX:
+		return d.handleRangeQuery(query)
+	case compute.SCAN:
+		return d.handleScanQuery(query)
+	case compute.INCR, compute.DECR, compute.INCRBY:
+		return d.handleIncrQuery(query)
+	case compute.INCRBYFLOAT:
+		return d.handleIncrByFloatQuery(query)
+	case compute.LPUSH, compute.RPUSH:
+		return d.handlePushQuery(query)
+	case compute.LPOP, compute.RPOP:
+		return d.handlePopQuery(query)
+	case compute.LRANGE:
+		return d.handleLRangeQuery(query)
+	case compute.LLEN:
+		return d.handleLLenQuery(query)
+	case compute.LINDEX:
+		return d.handleLIndexQuery(query)
+	case compute.LTRIM:
+		return d.handleLTrimQuery(query)
+	case compute.HSET:
+		return d.handleHSetQuery(query)
+	case compute.HGET:
+		return d.handleHGetQuery(query)
+	case compute.HDEL:
+		return d.handleHDelQuery(query)
+	case compute.HGETALL:
+		return d.handleHGetAllQuery(query)
+	case compute.HEXISTS:
+		return d.handleHExistsQuery(query)
+	case compute.HLEN:
+		return d.handleHLenQuery(query)
+	case compute.HINCRBY:
+		return d.handleHIncrByQuery(query)
+	case compute.SADD, compute.SREM:
+		return d.handleSetUpdateQuery(query)
+	case compute.SISMEMBER:
+		return d.handleSIsMemberQuery(query)
+	case compute.SMEMBERS, compute.SINTER, compute.SUNION:
+		return d.handleSMembersQuery(query)
+	case compute.SCARD:
+		return d.handleSCardQuery(query)
+	case compute.ZADD:
+		return d.handleZAddQuery(query)
+	case compute.ZREM:
+		return d.handleZRemQuery(query)
+	case compute.ZINCRBY:
+		return d.handleZIncrByQuery(query)
+	case compute.ZSCORE:
+		return d.handleZScoreQuery(query)
+	case compute.ZRANK:
+		return d.handleZRankQuery(query)
+	case compute.ZRANGE:
+		return d.handleZRangeQuery(query)
+	case compute.MOVE:
+		return d.handleMoveQuery(query)
+	case compute.SWAPDB:
+		return d.handleSwapDBQuery(query)
+	case compute.FLUSHDB:
+		return d.handleFlushDBQuery(query)
+	case compute.VERSION:
+		return d.handleVersionQuery(query)
+	case compute.CAS:
+		return d.handleCASQuery(query)
+	case compute.HISTORY:
+		return d.handleHistoryQuery(query)
+	case compute.CLUSTER:
+		return d.handleClusterQuery(query)
 	default:
 		return "internal error"
 	}
 }
 
 func (d *Database) handleGetQuery(query *compute.Query) string {
+	if _, ok := query.Options[compute.AT]; ok {
+		return d.handleGetAtQuery(query)
+	}
+
 	val, err := d.storage.Get(query.Args[0])
 
 	if errors.Is(err, engine.ErrKeyNotFound) {
@@ -79,35 +530,155 @@ func (d *Database) handleGetQuery(query *compute.Query) string {
 	}
 
 	if err != nil {
-		d.logger.Error("failed to get value", zap.String("key", query.Args[0]), zap.Error(err))
-		return fmt.Sprintf("error: %s", err.Error())
+		return d.readFailure(err, "failed to get value", zap.String("key", query.Args[0]))
 	}
 
-	return val
+	return compute.ValueReply(val)
 }
 
 func (d *Database) handleSetQuery(query *compute.Query) string {
+	for _, name := range []compute.OptionName{compute.NX, compute.XX, compute.GETOLD, compute.KEEPTTL} {
+		if _, ok := query.Options[name]; ok {
+			return d.handleConditionalSetQuery(query)
+		}
+	}
+
 	args := query.Args
-	err := d.storage.Set(args[0], args[1])
-	if err != nil {
-		d.logger.Error(
-			"failed to set value",
-			zap.String("key", args[0]),
-			zap.String("value", args[1]),
-			zap.Error(err),
-		)
-		return fmt.Sprintf("error: %s", err.Error())
+
+	var err error
+	if seconds, ok := query.Options[compute.EX]; ok {
+		err = d.setWithDeadline(query, deadlineAfter(seconds))
+	} else if d.cluster != nil {
+		err = d.propose(wal.OperationSet, args[0], args[1])
+	} else {
+		err = d.storage.Set(args[0], args[1], d.writeOptions(query)...)
+	}
+
+	if err != nil {
+		return d.writeFailure(err, "failed to set value", zap.String("key", args[0]), zap.String("value", args[1]))
 	}
 
 	return "ok"
 }
 
-func (d *Database) handleDelQuery(query *compute.Query) string {
-	err := d.storage.Del(query.Args[0])
+// handleConditionalSetQuery handles SET with NX, XX, GET or KEEPTTL. It
+// replies nil if the condition was not met, and ok otherwise, or, with GET,
+// the value the key held before, nil if it had none.
+func (d *Database) handleConditionalSetQuery(query *compute.Query) string {
+	key, value := query.Args[0], query.Args[1]
+
+	//nolint:exhaustruct
+	o := storage.SetOptions{Condition: storage.SetAlways}
+	if _, ok := query.Options[compute.NX]; ok {
+		o.Condition = storage.SetIfMissing
+	}
+	if _, ok := query.Options[compute.XX]; ok {
+		o.Condition = storage.SetIfExists
+	}
+	if seconds, ok := query.Options[compute.EX]; ok {
+		o.Deadline = deadlineAfter(seconds)
+	}
+	_, o.KeepTTL = query.Options[compute.KEEPTTL]
+	_, o.Get = query.Options[compute.GETOLD]
+
+	result, err := d.storage.SetIf(key, value, o, d.writeOptions(query)...)
 	if err != nil {
-		d.logger.Error("failed to delete value", zap.String("key", query.Args[0]), zap.Error(err))
-		return fmt.Sprintf("error: %s", err.Error())
+		return d.writeFailure(err, "failed to set value", zap.String("key", key), zap.String("value", value))
 	}
 
-	return "ok"
+	switch {
+	case o.Get && result.Existed:
+		return compute.ValueReply(result.Old)
+	case o.Get, !result.Set:
+		return replyNil
+	default:
+		return "ok"
+	}
+}
+
+// expectedWriteErrors are reported to the client without being logged, as
+// they come from the data or the query rather than from the server.
+var expectedWriteErrors = []error{
+	storage.ErrOutOfMemory,
+	storage.ErrNotInteger,
+	storage.ErrNotFloat,
+	storage.ErrOverflow,
+	engine.ErrWrongType,
+	raft.ErrLeaderNotReady,
+}
+
+// writeFailure turns an error returned by a write into the response sent to
+// the client.
+func (d *Database) writeFailure(err error, msg string, fields ...zap.Field) string {
+	if errors.Is(err, replication.ErrQuorumTimeout) {
+		return quorumError(err)
+	}
+	if errors.Is(err, raft.ErrNotLeader) {
+		return d.redirect()
+	}
+	for _, expected := range expectedWriteErrors {
+		if errors.Is(err, expected) {
+			return fmt.Sprintf("error: %s", err.Error())
+		}
+	}
+
+	d.logger.Error(msg, append(fields, zap.Error(err))...)
+	return fmt.Sprintf("error: %s", err.Error())
+}
+
+// readFailure turns an error returned by a read into the response sent to the
+// client. Reading a key of the wrong type is the client's mistake and is not
+// logged.
+func (d *Database) readFailure(err error, msg string, fields ...zap.Field) string {
+	if !errors.Is(err, engine.ErrWrongType) {
+		d.logger.Error(msg, append(fields, zap.Error(err))...)
+	}
+
+	return fmt.Sprintf("error: %s", err.Error())
+}
+
+// writeOptions resolves the write quorum for a query. QUORUM and TIMEOUT
+// options override the configured defaults.
+func (d *Database) writeOptions(query *compute.Query) []storage.WriteOption {
+	quorum := d.writeQuorum
+	timeout := d.quorumTimeout
+
+	if value, ok := query.Options[compute.QUORUM]; ok {
+		//nolint:errcheck
+		quorum, _ = strconv.Atoi(value)
+	}
+
+	if value, ok := query.Options[compute.TIMEOUT]; ok {
+		//nolint:errcheck
+		ms, _ := strconv.Atoi(value)
+		timeout = time.Duration(ms) * time.Millisecond
+	}
+
+	if quorum == 0 {
+		return nil
+	}
+
+	return []storage.WriteOption{storage.WithQuorum(quorum, timeout)}
+}
+
+func quorumError(err error) string {
+	return fmt.Sprintf("error: %s (write applied on leader)", err.Error())
+}
+
+func (d *Database) Close() error {
+	var err error
+
+	if d.leader != nil {
+		err = d.leader.Close()
+	}
+
+	if d.replica != nil {
+		err = d.replica.Close()
+	}
+
+	if d.cluster != nil {
+		err = errors.Join(err, d.cluster.Close())
+	}
+
+	return errors.Join(err, d.dbs.close())
 }
@@ -0,0 +1,633 @@
+//nolint:exhaustruct
+package database
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/crunchydeer30/key-value-database/internal/config"
+	"github.com/crunchydeer30/key-value-database/internal/database/compute"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+	"go.uber.org/zap"
+)
+
+// array is the reply holding elements, which are replies themselves.
+func array(elements ...string) string {
+	return compute.ArrayReply(elements...)
+}
+
+// decodeReply decodes a reply, failing the test if it is not an array.
+func decodeReply(t *testing.T, reply string) []compute.Reply {
+	t.Helper()
+
+	decoded, err := compute.DecodeReply([]byte(reply))
+	if err != nil || decoded.Kind != compute.ReplyArray {
+		t.Fatalf("expected an array, got %q, %v", reply, err)
+	}
+
+	return decoded.Elements
+}
+
+func newTestDatabase(t *testing.T) *Database {
+	t.Helper()
+
+	db, err := NewDatabase(&config.Config{Engine: config.EngineConfig{Type: "in_memory"}}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		//nolint:errcheck
+		db.Close()
+	})
+
+	return db
+}
+
+func TestDatabase_Expiration(t *testing.T) {
+	db := newTestDatabase(t)
+
+	steps := []struct {
+		query string
+		want  string
+	}{
+		{"TTL session", "-2"},
+		{"SET session token EX 100", "ok"},
+		{"TTL session", "100"},
+		{"PERSIST session", "1"},
+		{"TTL session", "-1"},
+		{"PERSIST session", "0"},
+		{"EXPIRE session 50", "1"},
+		{"TTL session", "50"},
+		{"SET session other", "ok"},
+		{"TTL session", "-1"},
+		{"EXPIRE missing 10", "0"},
+		{"EXPIRE session 3153600000", "1"},
+		{"TTL session", "3153600000"},
+		{"EXPIRE session 9300000000", "invalid query: invalid argument: seconds must be an integer of at most 3153600000"},
+		{"TTL session", "3153600000"},
+		{"EXPIRE session 0", "1"},
+		{"GET session", `record with key "session" not found`},
+		{"TTL session", "-2"},
+	}
+
+	for _, step := range steps {
+		if got := db.HandleQueryString(step.query); got != step.want {
+			t.Fatalf("%s: expected %q, got %q", step.query, step.want, got)
+		}
+	}
+}
+
+func TestDatabase_ConditionalSet(t *testing.T) {
+	db := newTestDatabase(t)
+
+	steps := []struct {
+		query string
+		want  string
+	}{
+		{"SET lock a XX", replyNil},
+		{"SET lock a NX EX 100", "ok"},
+		{"SET lock b NX", replyNil},
+		{"SET lock b NX GET", "a"},
+		{"GET lock", "a"},
+		{"SET lock b GET XX KEEPTTL", "a"},
+		{"TTL lock", "100"},
+		{"SET lock c XX", "ok"},
+		{"TTL lock", "-1"},
+		{"SET fresh x GET", replyNil},
+		{"SET lock d XX NX", "invalid query: invalid option: NX and XX can not be combined"},
+		{"RPUSH queue a", "1"},
+		{"SET queue x GET", "error: " + engine.ErrWrongType.Error()},
+		{"LLEN queue", "1"},
+		{"SET queue x NX", replyNil},
+	}
+
+	for _, step := range steps {
+		if got := db.HandleQueryString(step.query); got != step.want {
+			t.Fatalf("%s: expected %q, got %q", step.query, step.want, got)
+		}
+	}
+}
+
+func TestDatabase_SetNXHasOneWinner(t *testing.T) {
+	db := newTestDatabase(t)
+
+	var wg sync.WaitGroup
+	var won atomic.Int32
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if db.HandleQueryString("SET lock owner"+strconv.Itoa(i)+" NX") == "ok" {
+				won.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if won.Load() != 1 {
+		t.Errorf("expected one SET NX to win, got %d", won.Load())
+	}
+}
+
+func TestDatabase_Increments(t *testing.T) {
+	db := newTestDatabase(t)
+
+	steps := []struct {
+		query string
+		want  string
+	}{
+		{"INCR counter", "1"},
+		{"INCR counter", "2"},
+		{"DECR counter", "1"},
+		{"INCRBY counter -11", "-10"},
+		{"GET counter", "-10"},
+		{"DECR missing", "-1"},
+		{"SET name alice", "ok"},
+		{"INCR name", "error: " + storage.ErrNotInteger.Error()},
+		{"INCRBYFLOAT name 1", "error: " + storage.ErrNotFloat.Error()},
+		{"GET name", "alice"},
+		{"SET big 9223372036854775807", "ok"},
+		{"INCR big", "error: " + storage.ErrOverflow.Error()},
+		{"INCRBY big -9223372036854775807", "0"},
+		{"INCRBYFLOAT price 10.5", "10.5"},
+		{"INCRBYFLOAT price 0.1", "10.6"},
+		{"INCRBYFLOAT counter 2.5", "-7.5"},
+		{"INCR price", "error: " + storage.ErrNotInteger.Error()},
+		{"SET session 10 EX 100", "ok"},
+		{"INCR session", "11"},
+		{"TTL session", "100"},
+		{"INCRBY counter ten", "invalid query: invalid argument: increment must be an integer"},
+		{"INCRBYFLOAT counter inf", "invalid query: invalid argument: increment must be a finite number"},
+	}
+
+	for _, step := range steps {
+		if got := db.HandleQueryString(step.query); got != step.want {
+			t.Fatalf("%s: expected %q, got %q", step.query, step.want, got)
+		}
+	}
+}
+
+func TestDatabase_Lists(t *testing.T) {
+	db := newTestDatabase(t)
+
+	wrongType := "error: " + engine.ErrWrongType.Error()
+	steps := []struct {
+		query string
+		want  string
+	}{
+		{"RPUSH queue b c d", "3"},
+		{"LPUSH queue a", "4"},
+		{"LRANGE queue 0 -1", array("a", "b", "c", "d")},
+		{"LRANGE queue -2 10", array("c", "d")},
+		{"LRANGE queue 3 1", array()},
+		{"LLEN queue", "4"},
+		{"LINDEX queue -1", "d"},
+		{"LINDEX queue 4", replyNil},
+		{"LPOP queue", "a"},
+		{"RPOP queue 2", array("d", "c")},
+		{"LTRIM queue 1 -1", "ok"},
+		{"LLEN queue", "0"},
+		{"LPOP queue", replyNil},
+		{"RPUSH queue a QUORUM 1", "error: " + storage.ErrReplicationDisabled.Error()},
+		{"RPOP queue 2 QUORUM 1", "error: " + storage.ErrReplicationDisabled.Error()},
+		{"LRANGE missing 0 -1", array()},
+		{"RPUSH list x", "1"},
+		{"GET list", wrongType},
+		{"INCR list", wrongType},
+		{"SET name alice", "ok"},
+		{"LPUSH name x", wrongType},
+		{"LRANGE name 0 -1", wrongType},
+		{"SET list y", "ok"},
+		{"GET list", "y"},
+		{"LINDEX queue first", "invalid query: invalid argument: index must be an integer"},
+	}
+
+	for _, step := range steps {
+		if got := db.HandleQueryString(step.query); got != step.want {
+			t.Fatalf("%s: expected %q, got %q", step.query, step.want, got)
+		}
+	}
+}
+
+func TestDatabase_Hashes(t *testing.T) {
+	db := newTestDatabase(t)
+
+	wrongType := "error: " + engine.ErrWrongType.Error()
+	steps := []struct {
+		query string
+		want  string
+	}{
+		{"HSET user name alice age 30", "2"},
+		{"HSET user name bob", "0"},
+		{"HGET user name", "bob"},
+		{"HGET user city", replyNil},
+		{"HINCRBY user age 5", "35"},
+		{"HINCRBY user visits 1", "1"},
+		{"HINCRBY user name 1", "error: " + storage.ErrNotInteger.Error()},
+		{"HGETALL user", array("age", "35", "name", "bob", "visits", "1")},
+		{"HEXISTS user age", "1"},
+		{"HEXISTS user city", "0"},
+		{"HLEN user", "3"},
+		{"HDEL user age visits city", "2"},
+		{"HDEL user name", "1"},
+		{"HLEN user", "0"},
+		{"HGETALL user", array()},
+		{"HSET user name alice QUORUM 1", "error: " + storage.ErrReplicationDisabled.Error()},
+		{"HDEL user name QUORUM 1", "error: " + storage.ErrReplicationDisabled.Error()},
+		{"SET name alice", "ok"},
+		{"HSET name field value", wrongType},
+		{"HGET name field", wrongType},
+		{"RPUSH list x", "1"},
+		{"HINCRBY list field 1", wrongType},
+		{"HSET config debug true", "1"},
+		{"GET config", wrongType},
+		{"HSET user name alice age", "invalid query: invalid argument: fields and values must come in pairs"},
+	}
+
+	for _, step := range steps {
+		if got := db.HandleQueryString(step.query); got != step.want {
+			t.Fatalf("%s: expected %q, got %q", step.query, step.want, got)
+		}
+	}
+}
+
+func TestDatabase_Sets(t *testing.T) {
+	db := newTestDatabase(t)
+
+	steps := []struct {
+		query string
+		want  string
+	}{
+		{"SADD flags beta dark beta", "2"},
+		{"SADD enabled dark search", "2"},
+		{"SISMEMBER flags beta", "1"},
+		{"SISMEMBER flags search", "0"},
+		{"SMEMBERS flags", array("beta", "dark")},
+		{"SCARD flags", "2"},
+		{"SINTER flags enabled", array("dark")},
+		{"SUNION flags enabled", array("beta", "dark", "search")},
+		{"SINTER flags missing", array()},
+		{"SREM flags beta dark", "2"},
+		{"SMEMBERS flags", array()},
+		{"SADD flags beta QUORUM 1", "error: " + storage.ErrReplicationDisabled.Error()},
+		{"SREM enabled dark QUORUM 1", "error: " + storage.ErrReplicationDisabled.Error()},
+		{"SET name alice", "ok"},
+		{"SADD name x", "error: " + engine.ErrWrongType.Error()},
+		{"SUNION enabled name", "error: " + engine.ErrWrongType.Error()},
+	}
+
+	for _, step := range steps {
+		if got := db.HandleQueryString(step.query); got != step.want {
+			t.Fatalf("%s: expected %q, got %q", step.query, step.want, got)
+		}
+	}
+}
+
+func TestDatabase_SortedSets(t *testing.T) {
+	db := newTestDatabase(t)
+
+	steps := []struct {
+		query string
+		want  string
+	}{
+		{"ZADD board 10 alice 5.5 bob 10 carol", "3"},
+		{"ZADD board 12 alice", "0"},
+		{"ZRANGE board 0 -1", array("bob", "carol", "alice")},
+		{"ZRANGE board 0 1 WITHSCORES", array("bob", "5.5", "carol", "10")},
+		{"ZRANGE board 6 10 BYSCORE", array("carol")},
+		{"ZRANGE board -inf +inf BYSCORE WITHSCORES", array("bob", "5.5", "carol", "10", "alice", "12")},
+		{"ZRANGE board 5 1", array()},
+		{"ZSCORE board alice", "12"},
+		{"ZSCORE board dave", replyNil},
+		{"ZRANK board carol", "1"},
+		{"ZRANK board dave", replyNil},
+		{"ZINCRBY board 0.25 bob", "5.75"},
+		{"ZINCRBY board 1 dave", "1"},
+		{"ZRANK board dave", "0"},
+		{"ZREM board dave missing", "1"},
+		{"ZADD board 1 dave QUORUM 1", "error: " + storage.ErrReplicationDisabled.Error()},
+		{"ZREM board bob QUORUM 1", "error: " + storage.ErrReplicationDisabled.Error()},
+		{"SADD flags x", "1"},
+		{"ZADD flags 1 x", "error: " + engine.ErrWrongType.Error()},
+		{"ZSCORE flags x", "error: " + engine.ErrWrongType.Error()},
+		{"ZADD board 1 alice 2", "invalid query: invalid argument: scores and members must come in pairs"},
+	}
+
+	for _, step := range steps {
+		if got := db.HandleQueryString(step.query); got != step.want {
+			t.Fatalf("%s: expected %q, got %q", step.query, step.want, got)
+		}
+	}
+}
+
+func TestDatabase_MultiKey(t *testing.T) {
+	db := newTestDatabase(t)
+
+	steps := []struct {
+		query string
+		want  string
+	}{
+		{"MSET a 1 b 2", "ok"},
+		{"MSET a 1 b", "invalid query: invalid argument: keys and values must come in pairs"},
+		{"RPUSH queue x", "1"},
+		{"MGET a missing queue b", array("1", replyNil, replyNil, "2")},
+		{"MSETNX b 3 c 4", "0"},
+		{"GET c", `record with key "c" not found`},
+		{"MSETNX c 3 d 4", "1"},
+		{"MGET c d", array("3", "4")},
+		{"MSET c 5 QUORUM 1", "error: " + storage.ErrReplicationDisabled.Error()},
+		{"MSETNX e 5 QUORUM 1", "error: " + storage.ErrReplicationDisabled.Error()},
+		{"EXISTS a a missing queue", "3"},
+		{"DEL a missing", "1"},
+		{"DEL a", "0"},
+		{"DEL b c d QUORUM 1", "error: " + storage.ErrReplicationDisabled.Error()},
+		{"SET QUORUM x", "ok"},
+		{"DEL a QUORUM", "1"},
+		{"DEL b c d queue", "4"},
+		{"EXISTS b c d queue", "0"},
+	}
+
+	for _, step := range steps {
+		if got := db.HandleQueryString(step.query); got != step.want {
+			t.Fatalf("%s: expected %q, got %q", step.query, step.want, got)
+		}
+	}
+}
+
+func TestDatabase_MSetIsAtomic(t *testing.T) {
+	db := newTestDatabase(t)
+
+	keys := make([]string, 50)
+	for i := range keys {
+		keys[i] = "key" + strconv.Itoa(i)
+	}
+
+	mset := func(value string) string {
+		query := "MSET"
+		for _, key := range keys {
+			query += " " + key + " " + value
+		}
+		return db.HandleQueryString(query)
+	}
+	mset("0")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range 500 {
+			mset(strconv.Itoa(i))
+		}
+	}()
+
+	for {
+		reply := db.HandleQueryString("MGET " + strings.Join(keys, " "))
+		values := decodeReply(t, reply)
+		for _, value := range values {
+			if value.Text != values[0].Text {
+				t.Fatalf("MGET observed a partial MSET: %q", reply)
+			}
+		}
+
+		select {
+		case <-done:
+			return
+		default:
+		}
+	}
+}
+
+// orderedEngines are the engines that keep their keys in order.
+func orderedEngines(t *testing.T) map[string]config.EngineConfig {
+	t.Helper()
+
+	return map[string]config.EngineConfig{
+		"ordered": {Type: "ordered"},
+		"lsm":     {Type: "lsm", Sections: map[string]any{"lsm": map[string]any{"data_directory": t.TempDir()}}},
+		"btree":   {Type: "btree", Sections: map[string]any{"btree": map[string]any{"data_directory": t.TempDir()}}},
+	}
+}
+
+func newTestDatabaseWithEngine(t *testing.T, engine config.EngineConfig) *Database {
+	t.Helper()
+
+	db, err := NewDatabase(&config.Config{Engine: engine}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		//nolint:errcheck
+		db.Close()
+	})
+
+	return db
+}
+
+func TestDatabase_RangeQueries(t *testing.T) {
+	for name, engine := range orderedEngines(t) {
+		t.Run(name, func(t *testing.T) {
+			db := newTestDatabaseWithEngine(t, engine)
+
+			for _, query := range []string{"SET user:1 alice", "SET user:2 bob", "SET user:3 carol", "SET users total", "SET user:4 dave", "DEL user:4"} {
+				if got := db.HandleQueryString(query); got != "ok" && got != "1" {
+					t.Fatalf("%s: expected success, got %q", query, got)
+				}
+			}
+
+			tests := []struct {
+				query string
+				want  string
+			}{
+				{"RANGE user:1 user:3", array("user:1", "alice", "user:2", "bob")},
+				{"REVRANGE user:1 user:3", array("user:2", "bob", "user:1", "alice")},
+				{"RANGE user:3 user:1", array()},
+				{"PREFIX user:", array("user:1", "alice", "user:2", "bob", "user:3", "carol")},
+				{"PREFIX user: LIMIT 2", array("user:1", "alice", "user:2", "bob")},
+				{"REVPREFIX user LIMIT 2", array("users", "total", "user:3", "carol")},
+				{"PREFIX order:", array()},
+			}
+
+			for _, tt := range tests {
+				if got := db.HandleQueryString(tt.query); got != tt.want {
+					t.Errorf("%s: expected %q, got %q", tt.query, tt.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestDatabase_RangeUnsupported(t *testing.T) {
+	db := newTestDatabase(t)
+
+	want := "error: range queries unsupported by engine"
+	if got := db.HandleQueryString("PREFIX user:"); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestDatabase_Scan(t *testing.T) {
+	engines := orderedEngines(t)
+	engines["in_memory"] = config.EngineConfig{Type: "in_memory"}
+
+	for name, engine := range engines {
+		t.Run(name, func(t *testing.T) {
+			db := newTestDatabaseWithEngine(t, engine)
+
+			for i := range 30 {
+				key := "user:" + strconv.Itoa(i)
+				if i%3 == 0 {
+					key = "order:" + strconv.Itoa(i)
+				}
+				if got := db.HandleQueryString("SET " + key + " value"); got != "ok" {
+					t.Fatalf("SET %s: expected ok, got %q", key, got)
+				}
+			}
+
+			seen := make(map[string]bool)
+			cursor := "0"
+			for {
+				reply := decodeReply(t, db.HandleQueryString("SCAN "+cursor+" MATCH user:* COUNT 5"))
+				for _, key := range reply[1].Elements {
+					if !strings.HasPrefix(key.Text, "user:") {
+						t.Errorf("unexpected key %q", key.Text)
+					}
+					seen[key.Text] = true
+				}
+
+				cursor = reply[0].Text
+				if cursor == "0" {
+					break
+				}
+			}
+
+			if len(seen) != 20 {
+				t.Errorf("expected 20 keys, got %d", len(seen))
+			}
+
+			want := "error: invalid cursor"
+			if got := db.HandleQueryString("SCAN abc"); got != want {
+				t.Errorf("expected %q, got %q", want, got)
+			}
+		})
+	}
+}
+
+var (
+	binaryKey   = []byte("key with spaces\n")
+	binaryValue = []byte("line one\nline two\x00\xff \t end ")
+	binarySet   = compute.EncodeRequest([]byte("SET"), binaryKey, binaryValue)
+	binaryGet   = compute.EncodeRequest([]byte("GET"), binaryKey)
+)
+
+func TestDatabase_BinaryRequests(t *testing.T) {
+	db := newTestDatabase(t)
+
+	if got := db.HandleQuery(binarySet); string(got) != "ok" {
+		t.Fatalf("expected ok, got %q", got)
+	}
+	if got := db.HandleQuery(binaryGet); !bytes.Equal(got, binaryValue) {
+		t.Fatalf("expected %q, got %q", binaryValue, got)
+	}
+
+	if got := db.HandleQuery([]byte("SET plain value")); string(got) != "ok" {
+		t.Fatalf("expected ok, got %q", got)
+	}
+	if got := db.HandleQuery(compute.EncodeRequest([]byte("GET"), []byte("plain"))); string(got) != "value" {
+		t.Fatalf("expected value, got %q", got)
+	}
+
+	if got := db.HandleQuery(compute.EncodeRequest([]byte("DEL"), binaryKey)); string(got) != "1" {
+		t.Fatalf("expected 1, got %q", got)
+	}
+	if got := string(db.HandleQuery(binaryGet)); !strings.HasSuffix(got, "not found") {
+		t.Fatalf("expected not found, got %q", got)
+	}
+
+	// A value that looks like an encoded reply comes back escaped.
+	db.HandleQuery(compute.EncodeRequest([]byte("SET"), []byte("nil"), []byte(compute.NilReply)))
+	reply, err := compute.DecodeReply(db.HandleQuery(compute.EncodeRequest([]byte("GET"), []byte("nil"))))
+	if err != nil || reply.Kind != compute.ReplyText || reply.Text != compute.NilReply {
+		t.Fatalf("expected %q, got %v, %v", compute.NilReply, reply, err)
+	}
+
+	if got := string(db.HandleQuery([]byte{0, 0, 0, 0, 9, 'G'})); !strings.HasPrefix(got, "invalid query") {
+		t.Fatalf("expected invalid query, got %q", got)
+	}
+}
+
+func TestDatabase_DiskEnginesKeepDataAcrossRestarts(t *testing.T) {
+	tests := []struct {
+		name   string
+		engine func(dir string) config.EngineConfig
+	}{
+		{
+			name: "lsm",
+			engine: func(dir string) config.EngineConfig {
+				return config.EngineConfig{Type: "lsm", Sections: map[string]any{"lsm": map[string]any{"data_directory": dir}}}
+			},
+		},
+		{
+			name: "btree",
+			engine: func(dir string) config.EngineConfig {
+				return config.EngineConfig{Type: "btree", Sections: map[string]any{"btree": map[string]any{"data_directory": dir}}}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{Engine: tt.engine(t.TempDir())}
+
+			db, err := NewDatabase(cfg, zap.NewNop())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := db.HandleQueryString("SET key value"); got != "ok" {
+				t.Fatalf("expected ok, got %q", got)
+			}
+			if got := db.HandleQueryString("SET session token EX 100"); got != "ok" {
+				t.Fatalf("expected ok, got %q", got)
+			}
+			if got := db.HandleQuery(binarySet); string(got) != "ok" {
+				t.Fatalf("expected ok, got %q", got)
+			}
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			db, err = NewDatabase(cfg, zap.NewNop())
+			if err != nil {
+				t.Fatal(err)
+			}
+			//nolint:errcheck
+			defer db.Close()
+
+			if got := db.HandleQueryString("GET key"); got != "value" {
+				t.Errorf("expected value, got %q", got)
+			}
+			if got := db.HandleQueryString("TTL session"); got != "100" {
+				t.Errorf("expected ttl 100, got %q", got)
+			}
+			if got := db.HandleQuery(binaryGet); !bytes.Equal(got, binaryValue) {
+				t.Errorf("expected %q, got %q", binaryValue, got)
+			}
+		})
+	}
+}
+
+func TestDatabase_UnknownEngine(t *testing.T) {
+	_, err := NewDatabase(&config.Config{Engine: config.EngineConfig{Type: "rocksdb"}}, zap.NewNop())
+	if !errors.Is(err, engine.ErrUnknownEngine) {
+		t.Fatalf("expected error type %v, got %v", engine.ErrUnknownEngine, err)
+	}
+
+	want := `unknown engine "rocksdb", available engines: btree, in_memory, lsm, ordered, sharded`
+	if err.Error() != want {
+		t.Errorf("expected error %q, got %q", want, err)
+	}
+}
@@ -0,0 +1,334 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/crunchydeer30/key-value-database/internal/config"
+	"github.com/crunchydeer30/key-value-database/internal/database/compute"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/wal"
+	"go.uber.org/zap"
+)
+
+// slotsFile records which slot every database lives in. It is kept in the
+// first directory of the config that survives a restart.
+const slotsFile = "databases"
+
+var (
+	ErrDatabaseOutOfRange = errors.New("database index is out of range")
+	ErrSameDatabase       = errors.New("source and destination databases are the same")
+)
+
+// databases holds the storage of every logical database. The files of a
+// database live in a slot: slot 0 is the directories of the config as they
+// are, slot n a "db<n>" subdirectory of each of them. SWAPDB exchanges the
+// slots of two databases rather than their data.
+type databases struct {
+	mtx      sync.RWMutex
+	storages []*storage.Storage
+	slots    []int
+	path     string
+}
+
+// newDatabases loads the slots of count databases from the file at path, if
+// any. Databases missing from the file take the lowest free slots, and slots
+// of databases beyond count are remembered for when they come back.
+func newDatabases(path string, count int) (*databases, error) {
+	slots, err := loadSlots(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for slot := 0; len(slots) < count; slot++ {
+		if !slices.Contains(slots, slot) {
+			slots = append(slots, slot)
+		}
+	}
+
+	return &databases{storages: make([]*storage.Storage, count), slots: slots, path: path}, nil
+}
+
+func (dbs *databases) count() int {
+	return len(dbs.storages)
+}
+
+func (dbs *databases) get(index int) (*storage.Storage, error) {
+	dbs.mtx.RLock()
+	defer dbs.mtx.RUnlock()
+
+	if index >= len(dbs.storages) {
+		return nil, ErrDatabaseOutOfRange
+	}
+
+	return dbs.storages[index], nil
+}
+
+// swap exchanges databases a and b, recording their new slots first so that
+// the swap survives a restart.
+func (dbs *databases) swap(a, b int) error {
+	dbs.mtx.Lock()
+	defer dbs.mtx.Unlock()
+
+	if a >= len(dbs.storages) || b >= len(dbs.storages) {
+		return ErrDatabaseOutOfRange
+	}
+
+	if a == b {
+		return nil
+	}
+
+	slots := slices.Clone(dbs.slots)
+	slots[a], slots[b] = slots[b], slots[a]
+	if err := saveSlots(dbs.path, slots); err != nil {
+		return err
+	}
+
+	dbs.slots = slots
+	dbs.storages[a], dbs.storages[b] = dbs.storages[b], dbs.storages[a]
+
+	return nil
+}
+
+func (dbs *databases) close() error {
+	var err error
+	for _, s := range dbs.storages {
+		if s != nil {
+			err = errors.Join(err, s.Close())
+		}
+	}
+
+	return err
+}
+
+// slotsPath returns where the slots of databases are recorded, or "" if
+// nothing in the config outlives the process.
+func slotsPath(cfg *config.Config) string {
+	if cfg.WAL != nil {
+		return filepath.Join(cfg.WAL.DataDirectory, slotsFile)
+	}
+
+	if dir, ok := engineDataDirectory(cfg.Engine); ok {
+		return filepath.Join(dir, slotsFile)
+	}
+
+	return ""
+}
+
+func loadSlots(path string) ([]int, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read databases file: %w", err)
+	}
+
+	var slots []int
+	for _, field := range strings.Fields(string(data)) {
+		slot, err := strconv.Atoi(field)
+		if err != nil || slot < 0 || slices.Contains(slots, slot) {
+			return nil, fmt.Errorf("corrupted databases file %s: invalid slot %q", path, field)
+		}
+		slots = append(slots, slot)
+	}
+
+	return slots, nil
+}
+
+// saveSlots replaces the file at path in one step, so that a crash leaves
+// either the old slots or the new ones.
+func saveSlots(path string, slots []int) error {
+	if path == "" {
+		return nil
+	}
+
+	var data []byte
+	for _, slot := range slots {
+		data = strconv.AppendInt(data, int64(slot), 10)
+		data = append(data, '\n')
+	}
+
+	tmpPath := path + ".tmp"
+
+	//nolint:gosec
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create databases file: %w", err)
+	}
+
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if err = errors.Join(err, file.Close()); err != nil {
+		return fmt.Errorf("failed to write databases file: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to rename databases file: %w", err)
+	}
+
+	return nil
+}
+
+// slotConfig returns the config of the database in slot, with every data
+// directory moved to the subdirectory of the slot.
+func slotConfig(cfg *config.Config, slot int) *config.Config {
+	if slot == 0 {
+		return cfg
+	}
+
+	sub := fmt.Sprintf("db%d", slot)
+	slotted := *cfg
+
+	if cfg.WAL != nil {
+		walCfg := *cfg.WAL
+		walCfg.DataDirectory = filepath.Join(walCfg.DataDirectory, sub)
+		slotted.WAL = &walCfg
+	}
+
+	if cfg.Snapshot != nil {
+		snapshotCfg := *cfg.Snapshot
+		snapshotCfg.DataDirectory = filepath.Join(snapshotCfg.DataDirectory, sub)
+		slotted.Snapshot = &snapshotCfg
+	}
+
+	if dir, ok := engineDataDirectory(cfg.Engine); ok {
+		name := engineName(cfg.Engine)
+		//nolint:forcetypeassert
+		section := maps.Clone(cfg.Engine.Sections[name].(map[string]any))
+		section["data_directory"] = filepath.Join(dir, sub)
+
+		slotted.Engine.Sections = maps.Clone(cfg.Engine.Sections)
+		slotted.Engine.Sections[name] = section
+	}
+
+	return &slotted
+}
+
+// engineDataDirectory returns the data directory of engines that keep their
+// data on disk.
+func engineDataDirectory(cfg config.EngineConfig) (string, bool) {
+	section, ok := cfg.Sections[engineName(cfg)].(map[string]any)
+	if !ok {
+		return "", false
+	}
+
+	dir, ok := section["data_directory"].(string)
+	return dir, ok && dir != ""
+}
+
+// handleSelectQuery switches the session to another database. Only the
+// session changes, so it is the one query handled outside of a database.
+func (s *Session) handleSelectQuery(query *compute.Query) string {
+	//nolint:errcheck
+	index, _ := strconv.Atoi(query.Args[0])
+	if index >= s.db.dbs.count() {
+		return fmt.Sprintf("error: %s", ErrDatabaseOutOfRange.Error())
+	}
+
+	s.selected = index
+	return "ok"
+}
+
+// handleMoveQuery moves a key to another database unless the key exists
+// there. The key is copied first and then removed from the source if it has
+// not changed in between; otherwise the copy is undone and nothing moves.
+func (d *Database) handleMoveQuery(query *compute.Query) string {
+	key := query.Args[0]
+
+	//nolint:errcheck
+	index, _ := strconv.Atoi(query.Args[1])
+	target, err := d.dbs.get(index)
+	if err != nil {
+		return fmt.Sprintf("error: %s", err.Error())
+	}
+	if d.batches != nil {
+		target, err = d.batches.get(target)
+		if err != nil {
+			return d.writeFailure(err, "failed to begin transaction")
+		}
+	}
+	if target == d.storage {
+		return fmt.Sprintf("error: %s", ErrSameDatabase.Error())
+	}
+
+	entry, err := d.storage.Entry(key)
+	if errors.Is(err, engine.ErrKeyNotFound) {
+		return replyFalse
+	}
+	if err != nil {
+		return d.readFailure(err, "failed to get entry", zap.String("key", key))
+	}
+
+	moved, err := move(entry, d.storage, target)
+	if err != nil {
+		return d.writeFailure(err, "failed to move key", zap.String("key", key), zap.Int("db", index))
+	}
+
+	if moved {
+		return replyTrue
+	}
+
+	return replyFalse
+}
+
+func move(entry engine.Entry, source, target *storage.Storage) (bool, error) {
+	inserted, err := target.Insert(entry)
+	if err != nil || !inserted {
+		return false, err
+	}
+
+	removed, err := source.Remove(entry)
+	if err == nil && removed {
+		return true, nil
+	}
+
+	_, undoErr := target.Remove(entry)
+	return false, errors.Join(err, undoErr)
+}
+
+func (d *Database) handleSwapDBQuery(query *compute.Query) string {
+	//nolint:errcheck
+	a, _ := strconv.Atoi(query.Args[0])
+	//nolint:errcheck
+	b, _ := strconv.Atoi(query.Args[1])
+
+	err := d.dbs.swap(a, b)
+	if errors.Is(err, ErrDatabaseOutOfRange) {
+		return fmt.Sprintf("error: %s", err.Error())
+	}
+	if err != nil {
+		return d.writeFailure(err, "failed to swap databases", zap.Int("a", a), zap.Int("b", b))
+	}
+
+	return "ok"
+}
+
+func (d *Database) handleFlushDBQuery(query *compute.Query) string {
+	var err error
+	if d.cluster != nil {
+		err = d.propose(wal.OperationFlush)
+	} else {
+		err = d.storage.Flush(d.writeOptions(query)...)
+	}
+
+	if err != nil {
+		return d.writeFailure(err, "failed to flush database")
+	}
+
+	return "ok"
+}
@@ -0,0 +1,159 @@
+//nolint:exhaustruct
+package database
+
+import (
+	"testing"
+
+	"github.com/crunchydeer30/key-value-database/internal/config"
+	"github.com/crunchydeer30/key-value-database/internal/database/compute"
+	"go.uber.org/zap"
+)
+
+func TestDatabase_Select(t *testing.T) {
+	db, err := NewDatabase(&config.Config{Engine: config.EngineConfig{Type: "in_memory"}, Databases: 3}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	//nolint:errcheck
+	defer db.Close()
+
+	first, second, third := db.NewSession(), db.NewSession(), db.NewSession()
+
+	steps := []struct {
+		session *Session
+		query   string
+		want    string
+	}{
+		{first, "SET user alice", "ok"},
+		{second, "SELECT 1", "ok"},
+		{second, "GET user", `record with key "user" not found`},
+		{second, "SET user bob", "ok"},
+		{first, "GET user", "alice"},
+		{second, "SELECT 3", "error: database index is out of range"},
+		{second, "GET user", "bob"},
+		{first, "MOVE user 1", "0"},
+		{first, "MOVE user 0", "error: source and destination databases are the same"},
+		{first, "MOVE user 3", "error: database index is out of range"},
+		{first, "MOVE missing 1", "0"},
+		{first, "RPUSH queue a b", "2"},
+		{first, "EXPIRE queue 100", "1"},
+		{first, "MOVE queue 2", "1"},
+		{first, "LLEN queue", "0"},
+		{first, "SELECT 2", "ok"},
+		{first, "LRANGE queue 0 -1", array("a", "b")},
+		{first, "TTL queue", "100"},
+		{first, "SWAPDB 1 2", "ok"},
+		{second, "LRANGE queue 0 -1", array("a", "b")},
+		{second, "GET user", `record with key "user" not found`},
+		{first, "GET user", "bob"},
+		{first, "FLUSHDB", "ok"},
+		{first, "GET user", `record with key "user" not found`},
+		{second, "LLEN queue", "2"},
+		{second, "SWAPDB 0 3", "error: database index is out of range"},
+		{first, "MULTI", "ok"},
+		{first, "SET city paris", "queued"},
+		{first, "MOVE city 0", "queued"},
+		{first, "SELECT 0", "queued"},
+		{first, "GET city", "queued"},
+		{third, "GET city", `record with key "city" not found`},
+		{first, "EXEC", compute.ArrayReply("ok", "1", "ok", "paris")},
+		{third, "GET city", "paris"},
+		{second, "GET city", `record with key "city" not found`},
+	}
+
+	for _, step := range steps {
+		if got := step.session.HandleQueryString(step.query); got != step.want {
+			t.Fatalf("%s: expected %q, got %q", step.query, step.want, got)
+		}
+	}
+
+	if got := db.HandleQueryString("GET user"); got != "alice" {
+		t.Errorf("expected a query without a session to use database 0, got %q", got)
+	}
+}
+
+func TestDatabase_DatabasesSurviveRestart(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  func(dir string) *config.Config
+	}{
+		{
+			name: "wal",
+			cfg: func(dir string) *config.Config {
+				return &config.Config{
+					Engine:    config.EngineConfig{Type: "in_memory"},
+					WAL:       &config.WALConfig{DataDirectory: dir, FlushPolicy: "always"},
+					Databases: 3,
+				}
+			},
+		},
+		{
+			name: "lsm",
+			cfg: func(dir string) *config.Config {
+				return &config.Config{
+					Engine:    config.EngineConfig{Type: "lsm", Sections: map[string]any{"lsm": map[string]any{"data_directory": dir}}},
+					Databases: 3,
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg(t.TempDir())
+
+			db, err := NewDatabase(cfg, zap.NewNop())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			session := db.NewSession()
+			for _, query := range []string{"SET key zero", "SELECT 2", "SET gone soon", "FLUSHDB", "SELECT 1", "SET key one", "SET moved yes", "MOVE moved 2", "SELECT 2", "SET key two", "SWAPDB 0 1"} {
+				if got := session.HandleQueryString(query); got != "ok" && got != "1" {
+					t.Fatalf("%s: unexpected reply %q", query, got)
+				}
+			}
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			db, err = NewDatabase(cfg, zap.NewNop())
+			if err != nil {
+				t.Fatal(err)
+			}
+			//nolint:errcheck
+			defer db.Close()
+
+			session = db.NewSession()
+			steps := []struct {
+				query string
+				want  string
+			}{
+				{"GET key", "one"},
+				{"SELECT 1", "ok"},
+				{"GET key", "zero"},
+				{"SELECT 2", "ok"},
+				{"GET key", "two"},
+				{"GET moved", "yes"},
+				{"GET gone", `record with key "gone" not found`},
+			}
+			for _, step := range steps {
+				if got := session.HandleQueryString(step.query); got != step.want {
+					t.Errorf("%s: expected %q, got %q", step.query, step.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestDatabase_MultipleDatabasesInClusterMode(t *testing.T) {
+	cfg := &config.Config{
+		Engine:    config.EngineConfig{Type: "in_memory"},
+		Cluster:   &config.ClusterConfig{NodeID: "node-1"},
+		Databases: 2,
+	}
+
+	if _, err := NewDatabase(cfg, zap.NewNop()); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
@@ -0,0 +1,117 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/compute"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/wal"
+	"go.uber.org/zap"
+)
+
+// Replies of EXPIRE, TTL and PERSIST follow Redis: integers, with negative
+// TTLs standing for a missing key or a key without a deadline.
+const (
+	replyFalse = "0"
+	replyTrue  = "1"
+
+	ttlNoKey      = "-2"
+	ttlNoDeadline = "-1"
+)
+
+func isWrite(command compute.CommandName) bool {
+	switch command {
+	case compute.SET, compute.DEL, compute.MSET, compute.MSETNX, compute.EXPIRE, compute.PERSIST,
+		compute.INCR, compute.DECR, compute.INCRBY, compute.INCRBYFLOAT,
+		compute.LPUSH, compute.RPUSH, compute.LPOP, compute.RPOP, compute.LTRIM,
+		compute.HSET, compute.HDEL, compute.HINCRBY,
+		compute.SADD, compute.SREM, compute.ZADD, compute.ZREM, compute.ZINCRBY,
+		compute.MOVE, compute.SWAPDB, compute.FLUSHDB, compute.CAS:
+		return true
+	default:
+		return false
+	}
+}
+
+// deadlineAfter converts a relative expiration from a query into the absolute
+// deadline that gets logged and stored. The parser has already validated it
+// and kept it within compute.MaxExpireSeconds.
+func deadlineAfter(seconds string) time.Time {
+	//nolint:errcheck
+	n, _ := strconv.ParseInt(seconds, 10, 64)
+	return time.Now().Add(time.Duration(n) * time.Second)
+}
+
+func (d *Database) setWithDeadline(query *compute.Query, deadline time.Time) error {
+	key, value := query.Args[0], query.Args[1]
+
+	if d.cluster != nil {
+		return d.propose(wal.OperationSetWithDeadline, key, value, wal.FormatDeadline(deadline))
+	}
+
+	return d.storage.SetWithDeadline(key, value, deadline, d.writeOptions(query)...)
+}
+
+// handleExpireQuery replies 1 if the key got the deadline and 0 if it does
+// not exist.
+func (d *Database) handleExpireQuery(query *compute.Query) string {
+	key := query.Args[0]
+	deadline := deadlineAfter(query.Args[1])
+
+	err := d.storage.Expire(key, deadline, d.writeOptions(query)...)
+	result := replyTrue
+	if errors.Is(err, engine.ErrKeyNotFound) {
+		result, err = replyFalse, nil
+	}
+
+	if err != nil {
+		return d.writeFailure(err, "failed to set expiration", zap.String("key", key))
+	}
+
+	return result
+}
+
+// handlePersistQuery replies 1 if the key had a deadline that was removed and
+// 0 otherwise.
+func (d *Database) handlePersistQuery(query *compute.Query) string {
+	key := query.Args[0]
+
+	persisted, err := d.storage.Persist(key, d.writeOptions(query)...)
+	result := replyFalse
+	if persisted {
+		result = replyTrue
+	}
+	if errors.Is(err, engine.ErrKeyNotFound) {
+		err = nil
+	}
+
+	if err != nil {
+		return d.writeFailure(err, "failed to remove expiration", zap.String("key", key))
+	}
+
+	return result
+}
+
+// handleTTLQuery reports the remaining time to live in seconds, rounded to the
+// nearest second.
+func (d *Database) handleTTLQuery(query *compute.Query) string {
+	deadline, err := d.storage.Deadline(query.Args[0])
+
+	if errors.Is(err, engine.ErrKeyNotFound) {
+		return ttlNoKey
+	}
+	if err != nil {
+		d.logger.Error("failed to get expiration", zap.String("key", query.Args[0]), zap.Error(err))
+		return fmt.Sprintf("error: %s", err.Error())
+	}
+
+	if deadline.IsZero() {
+		return ttlNoDeadline
+	}
+
+	remaining := (time.Until(deadline) + time.Second/2) / time.Second
+	return strconv.FormatInt(int64(remaining), 10)
+}
@@ -0,0 +1,88 @@
+package database
+
+// matchGlob reports whether s matches pattern, where "*" matches any run of
+// bytes, "?" a single byte, "[abc]", "[a-z]" and "[^a]" a byte of a set, and
+// "\" escapes the next byte. Unlike path.Match, "/" is not special.
+func matchGlob(pattern, s string) bool {
+	// On a mismatch after a star, retry with the star consuming one more byte.
+	starPattern, starS := -1, 0
+
+	p, i := 0, 0
+	for i < len(s) {
+		if p < len(pattern) {
+			switch pattern[p] {
+			case '*':
+				starPattern, starS = p, i
+				p++
+				continue
+			case '?':
+				p++
+				i++
+				continue
+			case '[':
+				if matched, next := matchClass(pattern, p, s[i]); matched {
+					p = next
+					i++
+					continue
+				}
+			default:
+				c, next := pattern[p], p+1
+				if c == '\\' && next < len(pattern) {
+					c, next = pattern[next], next+1
+				}
+				if c == s[i] {
+					p = next
+					i++
+					continue
+				}
+			}
+		}
+
+		if starPattern < 0 {
+			return false
+		}
+		starS++
+		p, i = starPattern+1, starS
+	}
+
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+
+	return p == len(pattern)
+}
+
+// matchClass matches c against the class that starts at pattern[start] and
+// returns the index after the class. A class without a closing "]" extends to
+// the end of the pattern.
+func matchClass(pattern string, start int, c byte) (bool, int) {
+	p := start + 1
+	negate := p < len(pattern) && pattern[p] == '^'
+	if negate {
+		p++
+	}
+
+	matched := false
+	for ; p < len(pattern) && pattern[p] != ']'; p++ {
+		switch {
+		case pattern[p] == '\\' && p+1 < len(pattern):
+			p++
+			matched = matched || pattern[p] == c
+		case p+2 < len(pattern) && pattern[p+1] == '-' && pattern[p+2] != ']':
+			lo, hi := pattern[p], pattern[p+2]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			matched = matched || (lo <= c && c <= hi)
+			p += 2
+		default:
+			matched = matched || pattern[p] == c
+		}
+	}
+
+	if p < len(pattern) {
+		p++
+	}
+
+	return matched != negate, p
+}
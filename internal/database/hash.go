@@ -0,0 +1,109 @@
+package database
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/compute"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+	"go.uber.org/zap"
+)
+
+// handleHSetQuery replies with the number of fields that were added rather
+// than updated.
+func (d *Database) handleHSetQuery(query *compute.Query) string {
+	key, pairs := query.Args[0], query.Args[1:]
+
+	added, err := d.storage.HSet(key, pairs, d.writeOptions(query)...)
+	if err != nil {
+		return d.writeFailure(err, "failed to set hash fields", zap.String("key", key))
+	}
+
+	return strconv.Itoa(added)
+}
+
+// handleHDelQuery replies with the number of fields that were removed.
+func (d *Database) handleHDelQuery(query *compute.Query) string {
+	key, fields := query.Args[0], query.Args[1:]
+
+	removed, err := d.storage.HDel(key, fields, d.writeOptions(query)...)
+	if err != nil {
+		return d.writeFailure(err, "failed to delete hash fields", zap.String("key", key))
+	}
+
+	return strconv.Itoa(removed)
+}
+
+func (d *Database) handleHIncrByQuery(query *compute.Query) string {
+	key, field := query.Args[0], query.Args[1]
+
+	//nolint:errcheck
+	delta, _ := strconv.ParseInt(query.Args[2], 10, 64)
+
+	n, err := d.storage.HIncrBy(key, field, delta, d.writeOptions(query)...)
+	if err != nil {
+		return d.writeFailure(err, "failed to increment hash field", zap.String("key", key), zap.String("field", field))
+	}
+
+	return strconv.FormatInt(n, 10)
+}
+
+func (d *Database) handleHGetQuery(query *compute.Query) string {
+	key := query.Args[0]
+
+	value, err := d.storage.HGet(key, query.Args[1])
+	if errors.Is(err, engine.ErrKeyNotFound) {
+		return replyNil
+	}
+
+	if err != nil {
+		return d.readFailure(err, "failed to read hash", zap.String("key", key))
+	}
+
+	return compute.ValueReply(value)
+}
+
+// handleHGetAllQuery replies with every field of a hash followed by its
+// value, ordered by field.
+func (d *Database) handleHGetAllQuery(query *compute.Query) string {
+	hash, err := d.storage.HGetAll(query.Args[0])
+	if err != nil {
+		return d.readFailure(err, "failed to read hash", zap.String("key", query.Args[0]))
+	}
+
+	fields := make([]string, 0, len(hash))
+	for field := range hash {
+		fields = append(fields, field)
+	}
+	slices.Sort(fields)
+
+	values := make([]string, 0, 2*len(fields))
+	for _, field := range fields {
+		values = append(values, field, hash[field])
+	}
+
+	return compute.ValuesReply(values)
+}
+
+func (d *Database) handleHExistsQuery(query *compute.Query) string {
+	ok, err := d.storage.HExists(query.Args[0], query.Args[1])
+	if err != nil {
+		return d.readFailure(err, "failed to read hash", zap.String("key", query.Args[0]))
+	}
+
+	if ok {
+		return replyTrue
+	}
+
+	return replyFalse
+}
+
+func (d *Database) handleHLenQuery(query *compute.Query) string {
+	length, err := d.storage.HLen(query.Args[0])
+	if err != nil {
+		return d.readFailure(err, "failed to read hash", zap.String("key", query.Args[0]))
+	}
+
+	return strconv.Itoa(length)
+}
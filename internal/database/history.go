@@ -0,0 +1,69 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/compute"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+	"go.uber.org/zap"
+)
+
+// handleHistoryQuery replies with the revisions of a key, newest first, each
+// as an array of the revision, when it was written and the value, which is
+// nil if the key was deleted. Values that are not strings show as their type
+// in parentheses.
+func (d *Database) handleHistoryQuery(query *compute.Query) string {
+	key := query.Args[0]
+
+	var limit int
+	if value, ok := query.Options[compute.LIMIT]; ok {
+		//nolint:errcheck
+		limit, _ = strconv.Atoi(value)
+	}
+
+	revisions, err := d.storage.History(key, limit)
+	if errors.Is(err, storage.ErrHistoryDisabled) {
+		return fmt.Sprintf("error: %s", err.Error())
+	}
+	if err != nil {
+		return d.readFailure(err, "failed to get history", zap.String("key", key))
+	}
+
+	elements := make([]string, 0, len(revisions))
+	for _, r := range revisions {
+		value := compute.ValueReply(string(r.Value))
+		switch {
+		case r.Deleted:
+			value = replyNil
+		case r.Type != engine.TypeString:
+			value = fmt.Sprintf("(%s)", r.Type)
+		}
+		elements = append(elements, compute.ArrayReply(strconv.FormatUint(r.Revision, 10), r.Time.UTC().Format(time.RFC3339Nano), value))
+	}
+
+	return compute.ArrayReply(elements...)
+}
+
+// handleGetAtQuery replies with the value a key held at a revision.
+func (d *Database) handleGetAtQuery(query *compute.Query) string {
+	key := query.Args[0]
+
+	//nolint:errcheck
+	revision, _ := strconv.ParseUint(query.Options[compute.AT], 10, 64)
+
+	value, err := d.storage.GetAt(key, revision)
+	switch {
+	case errors.Is(err, engine.ErrKeyNotFound):
+		return fmt.Sprintf("record with key \"%s\" not found", key)
+	case errors.Is(err, storage.ErrHistoryDisabled), errors.Is(err, storage.ErrRevisionUnavailable):
+		return fmt.Sprintf("error: %s", err.Error())
+	case err != nil:
+		return d.readFailure(err, "failed to get value at revision", zap.String("key", key), zap.Uint64("revision", revision))
+	}
+
+	return compute.ValueReply(value)
+}
@@ -0,0 +1,73 @@
+//nolint:exhaustruct
+package database
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/crunchydeer30/key-value-database/internal/config"
+	"github.com/crunchydeer30/key-value-database/internal/database/compute"
+	"go.uber.org/zap"
+)
+
+func TestDatabase_History(t *testing.T) {
+	db, err := NewDatabase(&config.Config{Engine: config.EngineConfig{
+		Type:    "in_memory",
+		History: &config.HistoryConfig{MaxVersions: 3},
+	}}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	//nolint:errcheck
+	defer db.Close()
+
+	var revisions []string
+	for _, query := range []string{"SET config a", "SET config b", "HSET config2 f v", "SET config c", "SET config d"} {
+		db.HandleQueryString(query)
+		revisions = append(revisions, db.HandleQueryString("VERSION config"))
+	}
+	db.HandleQueryString("DEL config")
+
+	var values []string
+	for _, revision := range decodeReply(t, db.HandleQueryString("HISTORY config")) {
+		if len(revision.Elements) != 3 {
+			t.Fatalf("unexpected revision %v", revision)
+		}
+		value := revision.Elements[2].Text
+		if revision.Elements[2].Kind == compute.ReplyNil {
+			value = "(nil)"
+		}
+		values = append(values, value)
+	}
+	if got, want := strings.Join(values, " "), "(nil) d c"; got != want {
+		t.Fatalf("expected values %q, got %q", want, got)
+	}
+	if got := decodeReply(t, db.HandleQueryString("HISTORY config LIMIT 1")); len(got) != 1 || got[0].Elements[2].Kind != compute.ReplyNil {
+		t.Errorf("expected the newest revision only, got %v", got)
+	}
+
+	steps := []struct {
+		query string
+		want  string
+	}{
+		{"GET config AT " + revisions[4], "d"},
+		{"GET config AT " + revisions[3], "c"},
+		{"GET config AT " + revisions[1], "error: revision is not in the history of the key"},
+		{"GET config", `record with key "config" not found`},
+		{"HISTORY missing", array()},
+		{"RPUSH queue a", "1"},
+	}
+
+	for _, step := range steps {
+		if got := db.HandleQueryString(step.query); got != step.want {
+			t.Fatalf("%s: expected %q, got %q", step.query, step.want, got)
+		}
+	}
+
+	if got := decodeReply(t, db.HandleQueryString("HISTORY queue LIMIT 1")); len(got) != 1 || got[0].Elements[2].Text != "(list)" {
+		t.Errorf("expected a list revision, got %v", got)
+	}
+	if got := newTestDatabase(t).HandleQueryString("HISTORY config"); got != "error: history is disabled" {
+		t.Errorf("expected history to be disabled by default, got %q", got)
+	}
+}
@@ -0,0 +1,127 @@
+package database
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/compute"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+	"go.uber.org/zap"
+)
+
+const replyNil = compute.NilReply
+
+// handlePushQuery handles LPUSH and RPUSH, replying with the new length of
+// the list.
+func (d *Database) handlePushQuery(query *compute.Query) string {
+	key, values := query.Args[0], query.Args[1:]
+
+	var length int
+	var err error
+	if query.Command == compute.LPUSH {
+		length, err = d.storage.LPush(key, values, d.writeOptions(query)...)
+	} else {
+		length, err = d.storage.RPush(key, values, d.writeOptions(query)...)
+	}
+
+	if err != nil {
+		return d.writeFailure(err, "failed to push to list", zap.String("key", key))
+	}
+
+	return strconv.Itoa(length)
+}
+
+// handlePopQuery handles LPOP and RPOP, replying with the popped element, or
+// with an array of the popped elements if a count is given, and nil if there
+// is no list.
+func (d *Database) handlePopQuery(query *compute.Query) string {
+	key := query.Args[0]
+
+	count, many := 1, len(query.Args) > 1
+	if many {
+		//nolint:errcheck
+		count, _ = strconv.Atoi(query.Args[1])
+	}
+
+	var popped []string
+	var err error
+	if query.Command == compute.LPOP {
+		popped, err = d.storage.LPop(key, count, d.writeOptions(query)...)
+	} else {
+		popped, err = d.storage.RPop(key, count, d.writeOptions(query)...)
+	}
+
+	if errors.Is(err, engine.ErrKeyNotFound) {
+		return replyNil
+	}
+
+	if err != nil {
+		return d.writeFailure(err, "failed to pop from list", zap.String("key", key))
+	}
+
+	if !many {
+		return compute.ValueReply(popped[0])
+	}
+
+	return compute.ValuesReply(popped)
+}
+
+// handleLRangeQuery replies with the elements between two indexes, both
+// included.
+func (d *Database) handleLRangeQuery(query *compute.Query) string {
+	key := query.Args[0]
+
+	//nolint:errcheck
+	start, _ := strconv.Atoi(query.Args[1])
+	//nolint:errcheck
+	stop, _ := strconv.Atoi(query.Args[2])
+
+	elements, err := d.storage.LRange(key, start, stop)
+	if err != nil {
+		return d.readFailure(err, "failed to read list", zap.String("key", key))
+	}
+
+	return compute.ValuesReply(elements)
+}
+
+func (d *Database) handleLLenQuery(query *compute.Query) string {
+	length, err := d.storage.LLen(query.Args[0])
+	if err != nil {
+		return d.readFailure(err, "failed to read list", zap.String("key", query.Args[0]))
+	}
+
+	return strconv.Itoa(length)
+}
+
+func (d *Database) handleLIndexQuery(query *compute.Query) string {
+	key := query.Args[0]
+
+	//nolint:errcheck
+	index, _ := strconv.Atoi(query.Args[1])
+
+	element, err := d.storage.LIndex(key, index)
+	if errors.Is(err, engine.ErrKeyNotFound) {
+		return replyNil
+	}
+
+	if err != nil {
+		return d.readFailure(err, "failed to read list", zap.String("key", key))
+	}
+
+	return compute.ValueReply(element)
+}
+
+func (d *Database) handleLTrimQuery(query *compute.Query) string {
+	key := query.Args[0]
+
+	//nolint:errcheck
+	start, _ := strconv.Atoi(query.Args[1])
+	//nolint:errcheck
+	stop, _ := strconv.Atoi(query.Args[2])
+
+	if err := d.storage.LTrim(key, start, stop, d.writeOptions(query)...); err != nil {
+		return d.writeFailure(err, "failed to trim list", zap.String("key", key))
+	}
+
+	return "ok"
+}
@@ -0,0 +1,104 @@
+package database
+
+import (
+	"strconv"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/compute"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/wal"
+	"go.uber.org/zap"
+)
+
+// isAtomic reports whether a command writes several keys that other queries
+// must only ever see changed together. Its keys are locked exclusively.
+func isAtomic(command compute.CommandName) bool {
+	return command == compute.MSET || command == compute.MSETNX
+}
+
+// handleMGetQuery replies with the value of every key, nil for keys that are
+// missing or do not hold a string.
+func (d *Database) handleMGetQuery(query *compute.Query) string {
+	values, found, err := d.storage.MGet(query.Args)
+	if err != nil {
+		return d.readFailure(err, "failed to get values", zap.Strings("keys", query.Args))
+	}
+
+	elements := make([]string, 0, len(values))
+	for i, value := range values {
+		if !found[i] {
+			elements = append(elements, replyNil)
+			continue
+		}
+		elements = append(elements, compute.ValueReply(value))
+	}
+
+	return compute.ArrayReply(elements...)
+}
+
+func (d *Database) handleMSetQuery(query *compute.Query) string {
+	var err error
+	if d.cluster != nil {
+		err = d.propose(wal.OperationMSet, query.Args...)
+	} else {
+		err = d.storage.MSet(query.Args, d.writeOptions(query)...)
+	}
+
+	if err != nil {
+		return d.writeFailure(err, "failed to set values", zap.Int("keys", len(query.Args)/2))
+	}
+
+	return "ok"
+}
+
+// handleMSetNXQuery sets the keys only if none of them exists. It replies 1
+// if they were set and 0 otherwise.
+func (d *Database) handleMSetNXQuery(query *compute.Query) string {
+	var result string
+	var err error
+	if d.cluster != nil {
+		result, err = d.proposeWithResult(wal.OperationMSetNX, query.Args...)
+	} else {
+		var set bool
+		set, err = d.storage.MSetNX(query.Args, d.writeOptions(query)...)
+		result = replyFalse
+		if set {
+			result = replyTrue
+		}
+	}
+
+	if err != nil {
+		return d.writeFailure(err, "failed to set values", zap.Int("keys", len(query.Args)/2))
+	}
+
+	return result
+}
+
+// handleDelQuery replies with the number of keys that existed and were
+// deleted.
+func (d *Database) handleDelQuery(query *compute.Query) string {
+	var result string
+	var err error
+	if d.cluster != nil {
+		result, err = d.proposeWithResult(wal.OperationDelKeys, query.Args...)
+	} else {
+		var deleted int
+		deleted, err = d.storage.DelKeys(query.Args, d.writeOptions(query)...)
+		result = strconv.Itoa(deleted)
+	}
+
+	if err != nil {
+		return d.writeFailure(err, "failed to delete values", zap.Strings("keys", query.Args))
+	}
+
+	return result
+}
+
+// handleExistsQuery replies with the number of keys that exist, counting a
+// key given twice twice.
+func (d *Database) handleExistsQuery(query *compute.Query) string {
+	count, err := d.storage.Exists(query.Args)
+	if err != nil {
+		return d.readFailure(err, "failed to check keys", zap.Strings("keys", query.Args))
+	}
+
+	return strconv.Itoa(count)
+}
@@ -0,0 +1,46 @@
+package database
+
+import (
+	"strconv"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/compute"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage"
+	"go.uber.org/zap"
+)
+
+// handleIncrQuery handles INCR, DECR and INCRBY, replying with the new value.
+func (d *Database) handleIncrQuery(query *compute.Query) string {
+	key := query.Args[0]
+
+	var delta int64
+	switch query.Command {
+	case compute.INCR:
+		delta = 1
+	case compute.DECR:
+		delta = -1
+	default:
+		//nolint:errcheck
+		delta, _ = strconv.ParseInt(query.Args[1], 10, 64)
+	}
+
+	n, err := d.storage.IncrBy(key, delta, d.writeOptions(query)...)
+	if err != nil {
+		return d.writeFailure(err, "failed to increment value", zap.String("key", key))
+	}
+
+	return strconv.FormatInt(n, 10)
+}
+
+func (d *Database) handleIncrByFloatQuery(query *compute.Query) string {
+	key := query.Args[0]
+
+	//nolint:errcheck
+	delta, _ := strconv.ParseFloat(query.Args[1], 64)
+
+	f, err := d.storage.IncrByFloat(key, delta, d.writeOptions(query)...)
+	if err != nil {
+		return d.writeFailure(err, "failed to increment value", zap.String("key", key))
+	}
+
+	return storage.FormatFloat(f)
+}
@@ -0,0 +1,126 @@
+package raft
+
+import (
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+	"go.uber.org/zap"
+)
+
+// applyLoop feeds committed entries to the state machine in log order and
+// resolves the waiters of entries proposed on this node.
+func (n *Node) applyLoop() {
+	defer n.wg.Done()
+
+	for {
+		n.mtx.Lock()
+		for n.lastApplied >= n.commitIndex && !n.closed {
+			n.applyCond.Wait()
+		}
+		closed := n.closed
+		n.mtx.Unlock()
+
+		if closed {
+			return
+		}
+
+		n.applyCommitted()
+	}
+}
+
+func (n *Node) applyCommitted() {
+	n.applyMtx.Lock()
+	defer n.applyMtx.Unlock()
+
+	n.mtx.Lock()
+	entries := n.log.slice(n.lastApplied+1, n.commitIndex+1)
+	n.mtx.Unlock()
+
+	for _, entry := range entries {
+		var result applyResult
+		if entry.Type == EntryCommand {
+			result.value, result.err = n.fsm.Apply(entry.Data)
+			if result.err != nil {
+				n.logger.Error("failed to apply entry", zap.Uint64("index", entry.Index), zap.Error(result.err))
+			}
+		}
+
+		n.mtx.Lock()
+		n.lastApplied = entry.Index
+		if w, ok := n.waiters[entry.Index]; ok {
+			delete(n.waiters, entry.Index)
+			if w.term != entry.Term {
+				result = applyResult{value: nil, err: ErrLeadershipLost}
+			}
+			w.result <- result
+		}
+		n.mtx.Unlock()
+	}
+
+	n.maybeSnapshot()
+}
+
+// maybeSnapshot starts a snapshot once enough entries have been applied since
+// the previous one. It runs with applyMtx held, so the state machine view is
+// exactly at lastApplied; only the write to disk happens in the background.
+func (n *Node) maybeSnapshot() {
+	n.mtx.Lock()
+	if n.snapshotting || n.closed || n.lastApplied-n.log.base < n.snapshotThreshold {
+		n.mtx.Unlock()
+		return
+	}
+
+	index := n.lastApplied
+	term, _ := n.log.termAt(index)
+	configuration, _ := n.configurationAt(index)
+	n.snapshotting = true
+	n.mtx.Unlock()
+
+	snap, err := n.fsm.Snapshot()
+	if err != nil {
+		n.logger.Error("failed to create snapshot", zap.Error(err))
+		n.mtx.Lock()
+		n.snapshotting = false
+		n.mtx.Unlock()
+		return
+	}
+
+	n.wg.Add(1)
+	go n.writeSnapshot(snap, index, term, configuration)
+}
+
+func (n *Node) writeSnapshot(snap engine.Snapshot, index, term uint64, configuration Configuration) {
+	defer n.wg.Done()
+
+	info, err := n.snapshots.Write(index, snap)
+	snap.Release()
+
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	n.snapshotting = false
+
+	if err != nil {
+		n.logger.Error("failed to write snapshot", zap.Uint64("index", index), zap.Error(err))
+		return
+	}
+
+	if index <= n.log.base {
+		return
+	}
+
+	if err := n.saveState(index, term, configuration); err != nil {
+		n.logger.Error("failed to persist raft state", zap.Error(err))
+		return
+	}
+
+	if err := n.log.compact(index, term); err != nil {
+		n.logger.Error("failed to compact raft log", zap.Error(err))
+		return
+	}
+	n.snapshotConfiguration = configuration
+
+	if _, err := n.snapshots.Prune(); err != nil {
+		n.logger.Warn("failed to prune snapshots", zap.Error(err))
+	}
+
+	n.logger.Info("snapshot created", zap.String("path", info.Path), zap.Uint64("index", index))
+}
@@ -0,0 +1,84 @@
+package raft
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/crunchydeer30/key-value-database/internal/config"
+)
+
+var (
+	ErrMemberExists  = errors.New("member already exists")
+	ErrUnknownMember = errors.New("unknown member")
+)
+
+type Member struct {
+	ID            string
+	Address       string
+	ClientAddress string
+}
+
+// Configuration is the set of voting members. A new configuration takes
+// effect as soon as its entry is appended to the log, committed or not.
+type Configuration struct {
+	Members []Member
+}
+
+func configurationFromPeers(peers []config.PeerConfig) Configuration {
+	members := make([]Member, 0, len(peers))
+	for _, peer := range peers {
+		members = append(members, Member{
+			ID:            peer.ID,
+			Address:       peer.Address,
+			ClientAddress: peer.ClientAddress,
+		})
+	}
+
+	return Configuration{Members: members}
+}
+
+func (c Configuration) Member(id string) (Member, bool) {
+	for _, member := range c.Members {
+		if member.ID == id {
+			return member, true
+		}
+	}
+
+	return Member{}, false
+}
+
+func (c Configuration) Contains(id string) bool {
+	_, ok := c.Member(id)
+	return ok
+}
+
+func (c Configuration) quorum() int {
+	return len(c.Members)/2 + 1
+}
+
+func (c Configuration) with(member Member) (Configuration, error) {
+	if c.Contains(member.ID) {
+		return Configuration{}, fmt.Errorf("%w: %s", ErrMemberExists, member.ID)
+	}
+
+	members := make([]Member, 0, len(c.Members)+1)
+	members = append(members, c.Members...)
+	members = append(members, member)
+
+	return Configuration{Members: members}, nil
+}
+
+func (c Configuration) without(id string) (Configuration, error) {
+	if !c.Contains(id) {
+		return Configuration{}, fmt.Errorf("%w: %s", ErrUnknownMember, id)
+	}
+
+	members := make([]Member, 0, len(c.Members))
+	for _, member := range c.Members {
+		if member.ID != id {
+			members = append(members, member)
+		}
+	}
+
+	return Configuration{Members: members}, nil
+}
@@ -0,0 +1,278 @@
+package raft
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+	"go.uber.org/zap"
+)
+
+// incomingSnapshot collects the chunks of a snapshot sent by the leader until
+// the last one arrives.
+type incomingSnapshot struct {
+	index uint64
+	data  bytes.Buffer
+}
+
+func (n *Node) HandleRequest(data []byte) []byte {
+	var req request
+	var resp response
+
+	n.mtx.Lock()
+	closed := n.closed
+	n.mtx.Unlock()
+
+	if closed {
+		resp.Error = ErrClosed.Error()
+	} else if err := decode(data, &req); err != nil {
+		resp.Error = fmt.Sprintf("failed to decode raft request: %s", err)
+	} else {
+		switch {
+		case req.Type == requestVote && req.Vote != nil:
+			reply := n.handleVote(*req.Vote)
+			resp.Vote = &reply
+		case req.Type == requestAppendEntries && req.AppendEntries != nil:
+			reply := n.handleAppendEntries(*req.AppendEntries)
+			resp.AppendEntries = &reply
+		case req.Type == requestInstallSnapshot && req.InstallSnapshot != nil:
+			reply := n.handleInstallSnapshot(*req.InstallSnapshot)
+			resp.InstallSnapshot = &reply
+		default:
+			resp.Error = fmt.Sprintf("%s: %d", ErrUnknownRequest, req.Type)
+		}
+	}
+
+	result, err := encode(resp)
+	if err != nil {
+		n.logger.Error("failed to encode raft response", zap.Error(err))
+		return nil
+	}
+
+	return result
+}
+
+func (n *Node) handleVote(req voteRequest) voteResponse {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	if n.closed || req.Term < n.term {
+		return voteResponse{Term: n.term, Granted: false}
+	}
+
+	if req.Term > n.term {
+		n.stepDown(req.Term)
+	}
+
+	lastTerm := n.log.lastTerm()
+	upToDate := req.LastLogTerm > lastTerm ||
+		(req.LastLogTerm == lastTerm && req.LastLogIndex >= n.log.lastIndex())
+
+	if !upToDate || (n.votedFor != "" && n.votedFor != req.CandidateID) {
+		return voteResponse{Term: n.term, Granted: false}
+	}
+
+	n.votedFor = req.CandidateID
+	if err := n.persist(); err != nil {
+		n.logger.Error("failed to persist raft state", zap.Error(err))
+		n.votedFor = ""
+		return voteResponse{Term: n.term, Granted: false}
+	}
+	n.resetElectionDeadline()
+
+	return voteResponse{Term: n.term, Granted: true}
+}
+
+// follow accepts the sender of a current-term request as leader. It must be
+// called with mtx held and returns false if the request is stale.
+func (n *Node) follow(term uint64, leaderID string) bool {
+	if n.closed || term < n.term {
+		return false
+	}
+
+	if term > n.term || n.role != Follower {
+		n.stepDown(term)
+	}
+
+	n.leaderID = leaderID
+	n.resetElectionDeadline()
+
+	return true
+}
+
+func (n *Node) handleAppendEntries(req appendEntriesRequest) appendEntriesResponse {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	if !n.follow(req.Term, req.LeaderID) {
+		return appendEntriesResponse{Term: n.term, Success: false, LastIndex: n.log.lastIndex()}
+	}
+
+	reject := appendEntriesResponse{Term: n.term, Success: false, LastIndex: n.log.lastIndex()}
+
+	if req.PrevLogIndex > n.log.lastIndex() {
+		return reject
+	}
+
+	// Entries up to the snapshot are committed and therefore already match.
+	entries := req.Entries
+	if req.PrevLogIndex < n.log.base {
+		skip := n.log.base - req.PrevLogIndex
+		if skip >= uint64(len(entries)) {
+			entries = nil
+		} else {
+			entries = entries[skip:]
+		}
+	} else if term, _ := n.log.termAt(req.PrevLogIndex); term != req.PrevLogTerm {
+		reject.LastIndex = n.conflictHint(req.PrevLogIndex)
+		return reject
+	}
+
+	if err := n.appendFromLeader(entries); err != nil {
+		n.logger.Error("failed to append entries", zap.Error(err))
+		return reject
+	}
+
+	lastNew := req.PrevLogIndex + uint64(len(req.Entries))
+	if commit := min(req.LeaderCommit, lastNew); commit > n.commitIndex {
+		n.commitIndex = commit
+		n.applyCond.Broadcast()
+	}
+
+	return appendEntriesResponse{Term: n.term, Success: true, LastIndex: n.log.lastIndex()}
+}
+
+// appendFromLeader skips entries the log already has, truncates the log at
+// the first conflicting entry and appends the rest.
+func (n *Node) appendFromLeader(entries []Entry) error {
+	for i, entry := range entries {
+		if entry.Index <= n.log.lastIndex() {
+			if term, _ := n.log.termAt(entry.Index); term == entry.Term {
+				continue
+			}
+
+			if err := n.log.truncateFrom(entry.Index); err != nil {
+				return err
+			}
+			n.reloadConfiguration()
+		}
+
+		if err := n.log.append(entries[i:]...); err != nil {
+			return err
+		}
+
+		for _, e := range entries[i:] {
+			if e.Type == EntryConfiguration {
+				n.reloadConfiguration()
+				break
+			}
+		}
+
+		return nil
+	}
+
+	return nil
+}
+
+// conflictHint returns the index just before the first entry of the term that
+// conflicts at index, so that the leader can skip the whole term.
+func (n *Node) conflictHint(index uint64) uint64 {
+	term, _ := n.log.termAt(index)
+	for index > n.log.base+1 {
+		if t, _ := n.log.termAt(index - 1); t != term {
+			break
+		}
+		index--
+	}
+
+	return index - 1
+}
+
+func (n *Node) handleInstallSnapshot(req installSnapshotRequest) installSnapshotResponse {
+	n.mtx.Lock()
+
+	if !n.follow(req.Term, req.LeaderID) {
+		n.mtx.Unlock()
+		return installSnapshotResponse{Term: n.term, Success: false}
+	}
+	resp := installSnapshotResponse{Term: n.term, Success: false}
+
+	if req.Offset == 0 {
+		//nolint:exhaustruct
+		n.incoming = &incomingSnapshot{index: req.LastIncludedIndex}
+	}
+
+	incoming := n.incoming
+	if incoming == nil || incoming.index != req.LastIncludedIndex || int64(incoming.data.Len()) != req.Offset {
+		n.incoming = nil
+		n.mtx.Unlock()
+		return resp
+	}
+	incoming.data.Write(req.Data)
+
+	if !req.Done {
+		n.mtx.Unlock()
+		resp.Success = true
+		return resp
+	}
+	n.incoming = nil
+	n.mtx.Unlock()
+
+	if err := n.installSnapshot(req, incoming.data.Bytes()); err != nil {
+		n.logger.Error("failed to install snapshot", zap.Uint64("snapshot_index", req.LastIncludedIndex), zap.Error(err))
+		return resp
+	}
+
+	resp.Success = true
+	return resp
+}
+
+// installSnapshot replaces the state machine with the leader's snapshot. Log
+// entries following the snapshot are kept if the log agrees with it.
+func (n *Node) installSnapshot(req installSnapshotRequest, data []byte) error {
+	n.applyMtx.Lock()
+	defer n.applyMtx.Unlock()
+
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	if req.LastIncludedIndex <= n.lastApplied {
+		return nil
+	}
+
+	info, err := n.snapshots.Install(req.LastIncludedIndex, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	if err := n.fsm.Restore(func(fn func(entry engine.Entry) error) error {
+		return n.snapshots.Read(info, fn)
+	}); err != nil {
+		return err
+	}
+
+	if err := n.saveState(req.LastIncludedIndex, req.LastIncludedTerm, req.Configuration); err != nil {
+		return err
+	}
+
+	if err := n.log.compact(req.LastIncludedIndex, req.LastIncludedTerm); err != nil {
+		return err
+	}
+
+	n.snapshotConfiguration = req.Configuration
+	n.commitIndex = max(n.commitIndex, req.LastIncludedIndex)
+	n.lastApplied = req.LastIncludedIndex
+	n.reloadConfiguration()
+
+	if _, err := n.snapshots.Prune(); err != nil {
+		n.logger.Warn("failed to prune snapshots", zap.Error(err))
+	}
+
+	n.logger.Info(
+		"installed snapshot from leader",
+		zap.String("leader", req.LeaderID),
+		zap.Uint64("snapshot_index", req.LastIncludedIndex),
+	)
+
+	return nil
+}
@@ -0,0 +1,344 @@
+package raft
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+var ErrCorruptedLog = errors.New("corrupted raft log")
+
+type EntryType uint8
+
+const (
+	EntryCommand EntryType = iota + 1
+	EntryConfiguration
+	EntryNoop
+)
+
+const (
+	entryHeaderSize = 8
+	maxEntrySize    = 64 << 20
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+type Entry struct {
+	Index uint64
+	Term  uint64
+	Type  EntryType
+	Data  []byte
+}
+
+// logStore keeps the entries that follow the latest snapshot both in memory
+// and in a single append-only file. Every append is synced before it returns,
+// since an acknowledged entry must survive a crash.
+type logStore struct {
+	path    string
+	file    *os.File
+	size    int64
+	base    uint64
+	term    uint64
+	entries []Entry
+	offsets []int64
+}
+
+// openLog loads the entries following the snapshot at base. Entries that the
+// snapshot already covers are dropped and a torn tail is truncated.
+func openLog(path string, base, baseTerm uint64) (*logStore, error) {
+	//nolint:gosec
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open raft log: %w", err)
+	}
+
+	//nolint:exhaustruct
+	l := &logStore{
+		path: path,
+		file: file,
+		base: base,
+		term: baseTerm,
+	}
+
+	if err := l.load(); err != nil {
+		//nolint:errcheck
+		file.Close()
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func (l *logStore) load() error {
+	reader := bufio.NewReader(l.file)
+
+	var offset int64
+	for {
+		entry, n, err := readEntry(reader)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, ErrCorruptedLog) {
+			if err := l.file.Truncate(offset); err != nil {
+				return fmt.Errorf("failed to truncate raft log: %w", err)
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if entry.Index > l.base {
+			if entry.Index != l.lastIndex()+1 {
+				return fmt.Errorf("%w: unexpected index %d, expected %d", ErrCorruptedLog, entry.Index, l.lastIndex()+1)
+			}
+			l.entries = append(l.entries, entry)
+			l.offsets = append(l.offsets, offset)
+		}
+
+		offset += int64(n)
+	}
+
+	l.size = offset
+	if _, err := l.file.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek raft log: %w", err)
+	}
+
+	return nil
+}
+
+func (l *logStore) lastIndex() uint64 {
+	return l.base + uint64(len(l.entries))
+}
+
+func (l *logStore) lastTerm() uint64 {
+	if len(l.entries) == 0 {
+		return l.term
+	}
+
+	return l.entries[len(l.entries)-1].Term
+}
+
+// termAt returns the term of the entry at index. The entry at base is only
+// known by its term.
+func (l *logStore) termAt(index uint64) (uint64, bool) {
+	if index == l.base {
+		return l.term, true
+	}
+
+	if index < l.base || index > l.lastIndex() {
+		return 0, false
+	}
+
+	return l.entries[index-l.base-1].Term, true
+}
+
+func (l *logStore) entry(index uint64) (Entry, bool) {
+	if index <= l.base || index > l.lastIndex() {
+		return Entry{}, false
+	}
+
+	return l.entries[index-l.base-1], true
+}
+
+// slice returns copies of the entries in [from, to).
+func (l *logStore) slice(from, to uint64) []Entry {
+	if from <= l.base {
+		from = l.base + 1
+	}
+	if to > l.lastIndex()+1 {
+		to = l.lastIndex() + 1
+	}
+	if from >= to {
+		return nil
+	}
+
+	entries := make([]Entry, to-from)
+	copy(entries, l.entries[from-l.base-1:to-l.base-1])
+
+	return entries
+}
+
+func (l *logStore) append(entries ...Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	var buf []byte
+	offsets := make([]int64, 0, len(entries))
+	for _, entry := range entries {
+		offsets = append(offsets, l.size+int64(len(buf)))
+		buf = append(buf, encodeEntry(entry)...)
+	}
+
+	if _, err := l.file.Write(buf); err != nil {
+		return fmt.Errorf("failed to write raft log: %w", err)
+	}
+
+	if err := l.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync raft log: %w", err)
+	}
+
+	l.size += int64(len(buf))
+	l.entries = append(l.entries, entries...)
+	l.offsets = append(l.offsets, offsets...)
+
+	return nil
+}
+
+// truncateFrom removes the entry at index and everything after it.
+func (l *logStore) truncateFrom(index uint64) error {
+	if index <= l.base || index > l.lastIndex() {
+		return nil
+	}
+
+	pos := index - l.base - 1
+	offset := l.offsets[pos]
+
+	if err := l.file.Truncate(offset); err != nil {
+		return fmt.Errorf("failed to truncate raft log: %w", err)
+	}
+
+	if _, err := l.file.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek raft log: %w", err)
+	}
+
+	l.size = offset
+	l.entries = l.entries[:pos]
+	l.offsets = l.offsets[:pos]
+
+	return nil
+}
+
+// compact drops every entry up to and including index, which is now covered
+// by a snapshot taken in the given term. When the log does not contain index
+// at all, the whole log is discarded.
+func (l *logStore) compact(index, term uint64) error {
+	if index <= l.base {
+		return nil
+	}
+
+	var retained []Entry
+	if t, ok := l.termAt(index); ok && t == term {
+		retained = l.entries[index-l.base:]
+	}
+
+	tmpPath := l.path + ".tmp"
+	//nolint:gosec
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create raft log: %w", err)
+	}
+
+	var size int64
+	offsets := make([]int64, 0, len(retained))
+	for _, entry := range retained {
+		frame := encodeEntry(entry)
+		if _, err := tmp.Write(frame); err != nil {
+			//nolint:errcheck
+			tmp.Close()
+			return fmt.Errorf("failed to write raft log: %w", err)
+		}
+		offsets = append(offsets, size)
+		size += int64(len(frame))
+	}
+
+	if err := tmp.Sync(); err != nil {
+		//nolint:errcheck
+		tmp.Close()
+		return fmt.Errorf("failed to sync raft log: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close raft log: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, l.path); err != nil {
+		return fmt.Errorf("failed to replace raft log: %w", err)
+	}
+
+	//nolint:errcheck
+	l.file.Close()
+
+	//nolint:gosec
+	file, err := os.OpenFile(l.path, os.O_RDWR, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open raft log: %w", err)
+	}
+
+	if _, err := file.Seek(size, io.SeekStart); err != nil {
+		//nolint:errcheck
+		file.Close()
+		return fmt.Errorf("failed to seek raft log: %w", err)
+	}
+
+	l.file = file
+	l.size = size
+	l.base = index
+	l.term = term
+	l.entries = append([]Entry(nil), retained...)
+	l.offsets = offsets
+
+	return nil
+}
+
+func (l *logStore) close() error {
+	return l.file.Close()
+}
+
+func encodeEntry(entry Entry) []byte {
+	payload := make([]byte, 0, 8+8+1+len(entry.Data))
+	payload = binary.BigEndian.AppendUint64(payload, entry.Index)
+	payload = binary.BigEndian.AppendUint64(payload, entry.Term)
+	payload = append(payload, byte(entry.Type))
+	payload = append(payload, entry.Data...)
+
+	frame := make([]byte, entryHeaderSize+len(payload))
+	//nolint:gosec
+	binary.BigEndian.PutUint32(frame[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(frame[4:8], crc32.Checksum(payload, crcTable))
+	copy(frame[entryHeaderSize:], payload)
+
+	return frame
+}
+
+// readEntry returns io.EOF only on a frame boundary; a partially written frame
+// is reported as io.ErrUnexpectedEOF.
+func readEntry(r *bufio.Reader) (Entry, int, error) {
+	header := make([]byte, entryHeaderSize)
+	n, err := io.ReadFull(r, header)
+	if err != nil {
+		return Entry{}, n, err
+	}
+
+	length := binary.BigEndian.Uint32(header[0:4])
+	checksum := binary.BigEndian.Uint32(header[4:8])
+	if length < 17 || length > maxEntrySize {
+		return Entry{}, n, fmt.Errorf("%w: entry length %d", ErrCorruptedLog, length)
+	}
+
+	payload := make([]byte, length)
+	m, err := io.ReadFull(r, payload)
+	n += m
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return Entry{}, n, io.ErrUnexpectedEOF
+		}
+		return Entry{}, n, err
+	}
+
+	if crc32.Checksum(payload, crcTable) != checksum {
+		return Entry{}, n, fmt.Errorf("%w: checksum mismatch", ErrCorruptedLog)
+	}
+
+	return Entry{
+		Index: binary.BigEndian.Uint64(payload[0:8]),
+		Term:  binary.BigEndian.Uint64(payload[8:16]),
+		Type:  EntryType(payload[16]),
+		Data:  payload[17:],
+	}, n, nil
+}
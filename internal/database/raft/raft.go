@@ -0,0 +1,730 @@
+package raft
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/config"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/snapshot"
+	"github.com/crunchydeer30/key-value-database/internal/network"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrNotLeader        = errors.New("not the leader")
+	ErrLeadershipLost   = errors.New("leadership lost before the entry was applied")
+	ErrApplyTimeout     = errors.New("timed out waiting for the entry to be applied")
+	ErrChangeInProgress = errors.New("another membership change is in progress")
+	ErrLeaderNotReady   = errors.New("leader has not committed an entry in its term yet")
+	ErrClosed           = errors.New("raft node is closed")
+)
+
+const (
+	defaultElectionTimeout   = 300 * time.Millisecond
+	defaultHeartbeatInterval = 50 * time.Millisecond
+	defaultSnapshotThreshold = 10000
+	applyTimeout             = 5 * time.Second
+	maxAppendEntries         = 512
+	snapshotChunkSize        = 1 << 20
+
+	stateFileName     = "raft.state"
+	logFileName       = "raft.log"
+	snapshotDirectory = "snapshots"
+)
+
+type Role uint8
+
+const (
+	Follower Role = iota
+	Candidate
+	Leader
+)
+
+func (r Role) String() string {
+	switch r {
+	case Follower:
+		return "follower"
+	case Candidate:
+		return "candidate"
+	case Leader:
+		return "leader"
+	default:
+		return "unknown"
+	}
+}
+
+// StateMachine is driven by committed command entries. What Apply returns is
+// handed back to the proposer of the entry. Snapshot and Restore
+// use the engine snapshot format so that snapshots can be stored with the
+// regular snapshot manager and shipped to lagging followers.
+type StateMachine interface {
+	Apply(data []byte) ([]byte, error)
+	Snapshot() (engine.Snapshot, error)
+	Restore(load func(fn func(entry engine.Entry) error) error) error
+}
+
+type Status struct {
+	ID            string
+	Role          Role
+	Term          uint64
+	LeaderID      string
+	CommitIndex   uint64
+	AppliedIndex  uint64
+	Configuration Configuration
+}
+
+type Node struct {
+	id                string
+	electionTimeout   time.Duration
+	heartbeatInterval time.Duration
+	snapshotThreshold uint64
+	statePath         string
+	fsm               StateMachine
+	snapshots         *snapshot.Manager
+	server            *network.TCPServer
+	logger            *zap.Logger
+
+	// applyMtx serializes changes to the state machine, i.e. applying
+	// committed entries and installing snapshots. It is taken before mtx.
+	applyMtx sync.Mutex
+
+	mtx                   sync.Mutex
+	applyCond             *sync.Cond
+	role                  Role
+	term                  uint64
+	votedFor              string
+	leaderID              string
+	log                   *logStore
+	commitIndex           uint64
+	lastApplied           uint64
+	configuration         Configuration
+	configurationIndex    uint64
+	snapshotConfiguration Configuration
+	peers                 map[string]*peer
+	votes                 map[string]struct{}
+	electionDeadline      time.Time
+	waiters               map[uint64]waiter
+	incoming              *incomingSnapshot
+	snapshotting          bool
+	closed                bool
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+type waiter struct {
+	term   uint64
+	result chan applyResult
+}
+
+type applyResult struct {
+	value []byte
+	err   error
+}
+
+func NewNode(cfg *config.ClusterConfig, fsm StateMachine, logger *zap.Logger) (*Node, error) {
+	if cfg == nil {
+		return nil, errors.New("cluster config is nil")
+	}
+
+	if fsm == nil {
+		return nil, errors.New("state machine is nil")
+	}
+
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	logger = logger.With(zap.String("node", cfg.NodeID))
+
+	//nolint:gosec
+	if err := os.MkdirAll(cfg.DataDirectory, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create raft directory: %w", err)
+	}
+
+	snapshots, err := snapshot.NewManager(&config.SnapshotConfig{
+		DataDirectory: filepath.Join(cfg.DataDirectory, snapshotDirectory),
+		Interval:      0,
+	}, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	//nolint:exhaustruct
+	n := &Node{
+		id:                cfg.NodeID,
+		electionTimeout:   cfg.ElectionTimeout,
+		heartbeatInterval: cfg.HeartbeatInterval,
+		snapshotThreshold: cfg.SnapshotThreshold,
+		statePath:         filepath.Join(cfg.DataDirectory, stateFileName),
+		fsm:               fsm,
+		snapshots:         snapshots,
+		logger:            logger,
+		peers:             make(map[string]*peer),
+		waiters:           make(map[uint64]waiter),
+		done:              make(chan struct{}),
+	}
+	n.applyCond = sync.NewCond(&n.mtx)
+
+	if n.electionTimeout <= 0 {
+		n.electionTimeout = defaultElectionTimeout
+	}
+	if n.heartbeatInterval <= 0 {
+		n.heartbeatInterval = defaultHeartbeatInterval
+	}
+	if n.snapshotThreshold == 0 {
+		n.snapshotThreshold = defaultSnapshotThreshold
+	}
+
+	if err := n.recover(cfg); err != nil {
+		return nil, err
+	}
+
+	server, err := network.NewTCPServer(cfg.Address, n.HandleRequest, network.WithLogger(logger))
+	if err != nil {
+		//nolint:errcheck
+		n.log.close()
+		return nil, err
+	}
+	n.server = server
+
+	return n, nil
+}
+
+// recover loads the persisted state, the latest snapshot and the log. On the
+// very first start the configured peers become the initial configuration.
+func (n *Node) recover(cfg *config.ClusterConfig) error {
+	state, ok, err := loadState(n.statePath)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		state.SnapshotConfig = configurationFromPeers(cfg.Peers)
+		if err := saveState(n.statePath, state); err != nil {
+			return err
+		}
+	}
+
+	n.term = state.Term
+	n.votedFor = state.VotedFor
+	n.snapshotConfiguration = state.SnapshotConfig
+
+	if state.SnapshotIndex > 0 {
+		info := snapshot.Info{
+			LSN:  state.SnapshotIndex,
+			Path: "",
+		}
+
+		snapshots, err := n.snapshots.List()
+		if err != nil {
+			return err
+		}
+		for _, s := range snapshots {
+			if s.LSN == state.SnapshotIndex {
+				info = s
+			}
+		}
+		if info.Path == "" {
+			return fmt.Errorf("%w: snapshot at index %d", snapshot.ErrNoSnapshot, state.SnapshotIndex)
+		}
+
+		if err := n.fsm.Restore(func(fn func(entry engine.Entry) error) error {
+			return n.snapshots.Read(info, fn)
+		}); err != nil {
+			return fmt.Errorf("failed to restore snapshot: %w", err)
+		}
+	} else if err := n.fsm.Restore(func(func(engine.Entry) error) error { return nil }); err != nil {
+		// The log is applied from its start, so whatever an engine that
+		// keeps its own data holds from before must go.
+		return fmt.Errorf("failed to clear state machine: %w", err)
+	}
+
+	n.log, err = openLog(filepath.Join(filepath.Dir(n.statePath), logFileName), state.SnapshotIndex, state.SnapshotTerm)
+	if err != nil {
+		return err
+	}
+
+	n.commitIndex = state.SnapshotIndex
+	n.lastApplied = state.SnapshotIndex
+	n.reloadConfiguration()
+
+	n.logger.Info(
+		"recovered raft state",
+		zap.Uint64("term", n.term),
+		zap.Uint64("snapshot_index", state.SnapshotIndex),
+		zap.Uint64("last_index", n.log.lastIndex()),
+		zap.Int("members", len(n.configuration.Members)),
+	)
+
+	return nil
+}
+
+func (n *Node) Start() {
+	n.mtx.Lock()
+	n.resetElectionDeadline()
+	n.mtx.Unlock()
+
+	go n.server.Serve()
+
+	n.wg.Add(2)
+	go n.tickLoop()
+	go n.applyLoop()
+}
+
+func (n *Node) Addr() string {
+	return n.server.Addr()
+}
+
+func (n *Node) Close() error {
+	n.mtx.Lock()
+	if n.closed {
+		n.mtx.Unlock()
+		return nil
+	}
+	n.closed = true
+	close(n.done)
+	n.stopReplicators()
+	for _, p := range n.peers {
+		p.client.close()
+	}
+	n.failWaiters(ErrClosed, 0)
+	n.applyCond.Broadcast()
+	n.mtx.Unlock()
+
+	err := n.server.Close()
+	n.wg.Wait()
+
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	return errors.Join(err, n.log.close())
+}
+
+// Propose appends a command to the log and waits until it has been applied to
+// the state machine. The result is what the state machine returned for it.
+func (n *Node) Propose(data []byte) ([]byte, error) {
+	n.mtx.Lock()
+	index, w, err := n.submit(EntryCommand, data)
+	n.mtx.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return n.wait(index, w)
+}
+
+// AddMember and RemoveMember change the configuration one server at a time,
+// which keeps the old and new majorities overlapping.
+func (n *Node) AddMember(member Member) error {
+	return n.changeConfiguration(func(c Configuration) (Configuration, error) {
+		return c.with(member)
+	})
+}
+
+func (n *Node) RemoveMember(id string) error {
+	return n.changeConfiguration(func(c Configuration) (Configuration, error) {
+		return c.without(id)
+	})
+}
+
+func (n *Node) changeConfiguration(change func(Configuration) (Configuration, error)) error {
+	n.mtx.Lock()
+
+	if n.role != Leader {
+		n.mtx.Unlock()
+		return ErrNotLeader
+	}
+
+	if term, _ := n.log.termAt(n.commitIndex); term != n.term {
+		n.mtx.Unlock()
+		return ErrLeaderNotReady
+	}
+
+	if n.configurationIndex > n.commitIndex {
+		n.mtx.Unlock()
+		return ErrChangeInProgress
+	}
+
+	configuration, err := change(n.configuration)
+	if err != nil {
+		n.mtx.Unlock()
+		return err
+	}
+
+	data, err := encode(configuration)
+	if err != nil {
+		n.mtx.Unlock()
+		return err
+	}
+
+	index, w, err := n.submit(EntryConfiguration, data)
+	n.mtx.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = n.wait(index, w)
+	return err
+}
+
+// submit appends an entry as leader and registers a waiter for its result.
+// It must be called with mtx held.
+func (n *Node) submit(entryType EntryType, data []byte) (uint64, waiter, error) {
+	if n.closed {
+		return 0, waiter{}, ErrClosed
+	}
+
+	if n.role != Leader {
+		return 0, waiter{}, ErrNotLeader
+	}
+
+	entry, err := n.appendEntry(entryType, data)
+	if err != nil {
+		return 0, waiter{}, err
+	}
+
+	w := waiter{term: entry.Term, result: make(chan applyResult, 1)}
+	n.waiters[entry.Index] = w
+	n.advanceCommit()
+
+	return entry.Index, w, nil
+}
+
+func (n *Node) wait(index uint64, w waiter) ([]byte, error) {
+	timer := time.NewTimer(applyTimeout)
+	defer timer.Stop()
+
+	select {
+	case result := <-w.result:
+		return result.value, result.err
+	case <-timer.C:
+		n.mtx.Lock()
+		delete(n.waiters, index)
+		n.mtx.Unlock()
+		return nil, ErrApplyTimeout
+	case <-n.done:
+		return nil, ErrClosed
+	}
+}
+
+// Ready fails unless the node leads and has applied every entry of earlier
+// terms. Entries of its own term were all proposed through it, so its state
+// machine then holds every write that callers did not leave pending.
+func (n *Node) Ready() error {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	if n.role != Leader {
+		return ErrNotLeader
+	}
+
+	if term, _ := n.log.termAt(n.lastApplied); term != n.term {
+		return ErrLeaderNotReady
+	}
+
+	return nil
+}
+
+func (n *Node) IsLeader() bool {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	return n.role == Leader
+}
+
+// Leader returns the current leader as far as this node knows.
+func (n *Node) Leader() (Member, bool) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	if n.leaderID == "" {
+		return Member{}, false
+	}
+
+	return n.configuration.Member(n.leaderID)
+}
+
+func (n *Node) Status() Status {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	members := make([]Member, len(n.configuration.Members))
+	copy(members, n.configuration.Members)
+
+	return Status{
+		ID:            n.id,
+		Role:          n.role,
+		Term:          n.term,
+		LeaderID:      n.leaderID,
+		CommitIndex:   n.commitIndex,
+		AppliedIndex:  n.lastApplied,
+		Configuration: Configuration{Members: members},
+	}
+}
+
+func (n *Node) tickLoop() {
+	defer n.wg.Done()
+
+	ticker := time.NewTicker(n.electionTimeout / 10)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-n.done:
+			return
+		case <-ticker.C:
+			n.mtx.Lock()
+			if n.role != Leader && time.Now().After(n.electionDeadline) && n.configuration.Contains(n.id) {
+				n.startElection()
+			}
+			n.mtx.Unlock()
+		}
+	}
+}
+
+func (n *Node) resetElectionDeadline() {
+	//nolint:gosec
+	jitter := time.Duration(rand.Int64N(int64(n.electionTimeout)))
+	n.electionDeadline = time.Now().Add(n.electionTimeout + jitter)
+}
+
+func (n *Node) startElection() {
+	n.role = Candidate
+	n.term++
+	n.votedFor = n.id
+	n.leaderID = ""
+	n.resetElectionDeadline()
+
+	if err := n.persist(); err != nil {
+		n.logger.Error("failed to persist raft state", zap.Error(err))
+		return
+	}
+
+	n.logger.Info("starting election", zap.Uint64("term", n.term))
+
+	n.votes = map[string]struct{}{n.id: {}}
+	if n.hasQuorum(n.votes) {
+		n.becomeLeader()
+		return
+	}
+
+	req := voteRequest{
+		Term:         n.term,
+		CandidateID:  n.id,
+		LastLogIndex: n.log.lastIndex(),
+		LastLogTerm:  n.log.lastTerm(),
+	}
+
+	for _, p := range n.peers {
+		n.wg.Add(1)
+		go n.requestVote(p, req)
+	}
+}
+
+func (n *Node) requestVote(p *peer, req voteRequest) {
+	defer n.wg.Done()
+
+	//nolint:exhaustruct
+	resp, err := p.client.call(request{Type: requestVote, Vote: &req})
+	if err != nil || resp.Vote == nil {
+		n.logger.Debug("vote request failed", zap.String("peer", p.member.ID), zap.Error(err))
+		return
+	}
+
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	if resp.Vote.Term > n.term {
+		n.stepDown(resp.Vote.Term)
+		return
+	}
+
+	if n.role != Candidate || n.term != req.Term || !resp.Vote.Granted {
+		return
+	}
+
+	n.votes[p.member.ID] = struct{}{}
+	if n.hasQuorum(n.votes) {
+		n.becomeLeader()
+	}
+}
+
+func (n *Node) hasQuorum(ids map[string]struct{}) bool {
+	count := 0
+	for _, member := range n.configuration.Members {
+		if _, ok := ids[member.ID]; ok {
+			count++
+		}
+	}
+
+	return count >= n.configuration.quorum()
+}
+
+// becomeLeader appends a no-op entry, since entries from earlier terms can
+// only be committed together with an entry from the leader's own term.
+func (n *Node) becomeLeader() {
+	n.role = Leader
+	n.leaderID = n.id
+
+	n.logger.Info("became leader", zap.Uint64("term", n.term), zap.Uint64("last_index", n.log.lastIndex()))
+
+	for _, p := range n.peers {
+		p.nextIndex = n.log.lastIndex() + 1
+		p.matchIndex = 0
+		n.startReplicator(p)
+	}
+
+	if _, err := n.appendEntry(EntryNoop, nil); err != nil {
+		n.logger.Error("failed to append no-op entry", zap.Error(err))
+		n.stepDown(n.term)
+		return
+	}
+
+	n.advanceCommit()
+}
+
+// stepDown turns the node into a follower, adopting term if it is newer.
+// Waiters for entries that are not committed yet are released, since their
+// outcome is now up to the next leader.
+func (n *Node) stepDown(term uint64) {
+	if term > n.term {
+		n.term = term
+		n.votedFor = ""
+		if err := n.persist(); err != nil {
+			n.logger.Error("failed to persist raft state", zap.Error(err))
+		}
+	}
+
+	if n.role == Follower {
+		return
+	}
+
+	if n.role == Leader {
+		n.logger.Info("stepping down", zap.Uint64("term", n.term))
+		n.stopReplicators()
+		n.failWaiters(ErrLeadershipLost, n.commitIndex)
+		n.leaderID = ""
+	}
+
+	n.role = Follower
+	n.resetElectionDeadline()
+}
+
+func (n *Node) failWaiters(err error, after uint64) {
+	for index, w := range n.waiters {
+		if index > after {
+			w.result <- applyResult{value: nil, err: err}
+			delete(n.waiters, index)
+		}
+	}
+}
+
+func (n *Node) appendEntry(entryType EntryType, data []byte) (Entry, error) {
+	entry := Entry{
+		Index: n.log.lastIndex() + 1,
+		Term:  n.term,
+		Type:  entryType,
+		Data:  data,
+	}
+
+	if err := n.log.append(entry); err != nil {
+		return Entry{}, err
+	}
+
+	if entryType == EntryConfiguration {
+		n.reloadConfiguration()
+	}
+
+	for _, p := range n.peers {
+		p.signal()
+	}
+
+	return entry, nil
+}
+
+func (n *Node) persist() error {
+	return n.saveState(n.log.base, n.log.term, n.snapshotConfiguration)
+}
+
+func (n *Node) saveState(snapshotIndex, snapshotTerm uint64, configuration Configuration) error {
+	return saveState(n.statePath, hardState{
+		Term:           n.term,
+		VotedFor:       n.votedFor,
+		SnapshotIndex:  snapshotIndex,
+		SnapshotTerm:   snapshotTerm,
+		SnapshotConfig: configuration,
+	})
+}
+
+// reloadConfiguration makes the latest configuration in the log, or the one
+// covered by the snapshot, the current one and adjusts the set of peers.
+func (n *Node) reloadConfiguration() {
+	configuration, index := n.configurationAt(n.log.lastIndex())
+	changed := index != n.configurationIndex
+
+	n.configuration = configuration
+	n.configurationIndex = index
+
+	for _, member := range configuration.Members {
+		if member.ID == n.id {
+			continue
+		}
+
+		if _, ok := n.peers[member.ID]; ok {
+			continue
+		}
+
+		p := newPeer(member, n.log.lastIndex()+1)
+		n.peers[member.ID] = p
+		if n.role == Leader && !n.closed {
+			n.startReplicator(p)
+		}
+	}
+
+	for id, p := range n.peers {
+		if configuration.Contains(id) {
+			continue
+		}
+
+		p.stopReplicator()
+		go p.client.close()
+		delete(n.peers, id)
+	}
+
+	if !changed {
+		return
+	}
+
+	n.logger.Info(
+		"configuration changed",
+		zap.Uint64("index", index),
+		zap.Any("members", configuration.Members),
+	)
+}
+
+func (n *Node) configurationAt(index uint64) (Configuration, uint64) {
+	for i := index; i > n.log.base; i-- {
+		entry, ok := n.log.entry(i)
+		if !ok || entry.Type != EntryConfiguration {
+			continue
+		}
+
+		var configuration Configuration
+		if err := decode(entry.Data, &configuration); err != nil {
+			n.logger.Error("failed to decode configuration entry", zap.Uint64("index", i), zap.Error(err))
+			continue
+		}
+
+		return configuration, i
+	}
+
+	return n.snapshotConfiguration, n.log.base
+}
@@ -0,0 +1,320 @@
+//nolint:exhaustruct
+package raft
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/config"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+	inmemory "github.com/crunchydeer30/key-value-database/internal/database/storage/engine/in_memory"
+	"go.uber.org/zap"
+)
+
+type testStateMachine struct {
+	engine engine.Engine
+}
+
+// Apply stores key=value and returns the key.
+func (m *testStateMachine) Apply(data []byte) ([]byte, error) {
+	key, value, _ := strings.Cut(string(data), "=")
+	return []byte(key), m.engine.Set([]byte(key), []byte(value))
+}
+
+func (m *testStateMachine) Snapshot() (engine.Snapshot, error) {
+	//nolint:forcetypeassert
+	return m.engine.(engine.Snapshotter).Snapshot()
+}
+
+func (m *testStateMachine) Restore(load func(fn func(entry engine.Entry) error) error) error {
+	//nolint:forcetypeassert
+	if err := m.engine.(engine.Clearer).Clear(); err != nil {
+		return err
+	}
+
+	return load(func(entry engine.Entry) error {
+		return engine.Put(m.engine, entry)
+	})
+}
+
+type testNode struct {
+	cfg  *config.ClusterConfig
+	node *Node
+	fsm  *testStateMachine
+}
+
+func freeAddress(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	//nolint:errcheck
+	defer listener.Close()
+
+	return listener.Addr().String()
+}
+
+func newTestConfig(t *testing.T, id string, snapshotThreshold uint64) *config.ClusterConfig {
+	t.Helper()
+
+	return &config.ClusterConfig{
+		NodeID:            id,
+		Address:           freeAddress(t),
+		DataDirectory:     t.TempDir(),
+		ElectionTimeout:   150 * time.Millisecond,
+		HeartbeatInterval: 20 * time.Millisecond,
+		SnapshotThreshold: snapshotThreshold,
+	}
+}
+
+func newTestCluster(t *testing.T, size int, snapshotThreshold uint64) []*testNode {
+	t.Helper()
+
+	configs := make([]*config.ClusterConfig, 0, size)
+	peers := make([]config.PeerConfig, 0, size)
+	for i := range size {
+		cfg := newTestConfig(t, "node-"+strconv.Itoa(i+1), snapshotThreshold)
+		configs = append(configs, cfg)
+		peers = append(peers, config.PeerConfig{ID: cfg.NodeID, Address: cfg.Address, ClientAddress: cfg.Address})
+	}
+
+	nodes := make([]*testNode, 0, size)
+	for _, cfg := range configs {
+		cfg.Peers = peers
+		nodes = append(nodes, startTestNode(t, cfg))
+	}
+
+	return nodes
+}
+
+func startTestNode(t *testing.T, cfg *config.ClusterConfig) *testNode {
+	t.Helper()
+
+	e, err := inmemory.NewInMemoryEngine(zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fsm := &testStateMachine{engine: e}
+	node, err := NewNode(cfg, fsm, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	node.Start()
+	t.Cleanup(func() {
+		//nolint:errcheck
+		node.Close()
+	})
+
+	return &testNode{cfg: cfg, node: node, fsm: fsm}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		<-time.After(10 * time.Millisecond)
+	}
+}
+
+func waitForLeader(t *testing.T, nodes []*testNode) *testNode {
+	t.Helper()
+
+	var leader *testNode
+	waitFor(t, "leader election", func() bool {
+		leader = nil
+		for _, n := range nodes {
+			if !n.node.IsLeader() {
+				continue
+			}
+			if leader != nil && leader.node.Status().Term == n.node.Status().Term {
+				t.Fatalf("two leaders in term %d", n.node.Status().Term)
+			}
+			if leader == nil || n.node.Status().Term > leader.node.Status().Term {
+				leader = n
+			}
+		}
+		return leader != nil
+	})
+
+	return leader
+}
+
+func waitForValue(t *testing.T, n *testNode, key, want string) {
+	t.Helper()
+
+	waitFor(t, n.cfg.NodeID+" to apply "+key, func() bool {
+		got, err := n.fsm.engine.Get([]byte(key))
+		return err == nil && string(got) == want
+	})
+}
+
+func without(nodes []*testNode, excluded *testNode) []*testNode {
+	result := make([]*testNode, 0, len(nodes))
+	for _, n := range nodes {
+		if n != excluded {
+			result = append(result, n)
+		}
+	}
+
+	return result
+}
+
+func TestCluster_ElectsLeader(t *testing.T) {
+	for _, size := range []int{3, 5} {
+		t.Run(strconv.Itoa(size)+" nodes", func(t *testing.T) {
+			nodes := newTestCluster(t, size, 0)
+			leader := waitForLeader(t, nodes)
+
+			for _, n := range without(nodes, leader) {
+				waitFor(t, n.cfg.NodeID+" to learn the leader", func() bool {
+					member, ok := n.node.Leader()
+					return ok && member.ID == leader.cfg.NodeID && member.ClientAddress == leader.cfg.Address
+				})
+			}
+		})
+	}
+}
+
+func TestCluster_ReplicatesCommands(t *testing.T) {
+	nodes := newTestCluster(t, 3, 0)
+	leader := waitForLeader(t, nodes)
+
+	for i := range 100 {
+		result, err := leader.node.Propose([]byte("key" + strconv.Itoa(i) + "=value" + strconv.Itoa(i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(result) != "key"+strconv.Itoa(i) {
+			t.Fatalf("expected result key%d, got %q", i, result)
+		}
+	}
+
+	for _, n := range nodes {
+		waitForValue(t, n, "key99", "value99")
+	}
+
+	follower := without(nodes, leader)[0]
+	if _, err := follower.node.Propose([]byte("key=value")); !errors.Is(err, ErrNotLeader) {
+		t.Errorf("expected error %v, got %v", ErrNotLeader, err)
+	}
+}
+
+func TestCluster_FailsOverAndRecovers(t *testing.T) {
+	nodes := newTestCluster(t, 3, 0)
+	leader := waitForLeader(t, nodes)
+
+	if _, err := leader.node.Propose([]byte("before=1")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := leader.node.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	survivors := without(nodes, leader)
+	newLeader := waitForLeader(t, survivors)
+
+	if _, err := newLeader.node.Propose([]byte("after=2")); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := startTestNode(t, leader.cfg)
+	for _, n := range append(survivors, restarted) {
+		waitForValue(t, n, "before", "1")
+		waitForValue(t, n, "after", "2")
+	}
+}
+
+func TestCluster_InstallsSnapshotOnLaggingFollower(t *testing.T) {
+	nodes := newTestCluster(t, 3, 10)
+	leader := waitForLeader(t, nodes)
+
+	lagging := without(nodes, leader)[0]
+	if err := lagging.node.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range 100 {
+		if _, err := leader.node.Propose([]byte("key" + strconv.Itoa(i) + "=value" + strconv.Itoa(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	waitFor(t, "log compaction on leader", func() bool {
+		leader.node.mtx.Lock()
+		defer leader.node.mtx.Unlock()
+		return leader.node.log.base >= 50
+	})
+
+	restarted := startTestNode(t, lagging.cfg)
+	waitForValue(t, restarted, "key99", "value99")
+
+	snapshots, err := restarted.node.snapshots.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) == 0 {
+		t.Errorf("expected follower to install a snapshot from the leader")
+	}
+}
+
+func TestCluster_MembershipChanges(t *testing.T) {
+	nodes := newTestCluster(t, 3, 0)
+	leader := waitForLeader(t, nodes)
+
+	if _, err := leader.node.Propose([]byte("key=value")); err != nil {
+		t.Fatal(err)
+	}
+
+	joining := startTestNode(t, newTestConfig(t, "node-4", 0))
+	err := leader.node.AddMember(Member{
+		ID:            joining.cfg.NodeID,
+		Address:       joining.cfg.Address,
+		ClientAddress: joining.cfg.Address,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForValue(t, joining, "key", "value")
+
+	err = leader.node.AddMember(Member{ID: joining.cfg.NodeID, Address: joining.cfg.Address})
+	if !errors.Is(err, ErrMemberExists) {
+		t.Errorf("expected error %v, got %v", ErrMemberExists, err)
+	}
+
+	if err := leader.node.RemoveMember(leader.cfg.NodeID); err != nil {
+		t.Fatal(err)
+	}
+
+	remaining := append(without(nodes, leader), joining)
+	newLeader := waitForLeader(t, remaining)
+
+	members := newLeader.node.Status().Configuration.Members
+	if len(members) != 3 {
+		t.Fatalf("expected 3 members, got %+v", members)
+	}
+	for _, member := range members {
+		if member.ID == leader.cfg.NodeID {
+			t.Errorf("expected %s to be removed, got %+v", leader.cfg.NodeID, members)
+		}
+	}
+
+	if _, err := newLeader.node.Propose([]byte("after=removal")); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range remaining {
+		waitForValue(t, n, "after", "removal")
+	}
+}
@@ -0,0 +1,243 @@
+package raft
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// peer tracks the leader's view of a follower. nextIndex and matchIndex are
+// guarded by the node mutex.
+type peer struct {
+	member     Member
+	client     *client
+	nextIndex  uint64
+	matchIndex uint64
+	notify     chan struct{}
+	stop       chan struct{}
+}
+
+func newPeer(member Member, nextIndex uint64) *peer {
+	return &peer{
+		member:     member,
+		client:     newClient(member.Address),
+		nextIndex:  nextIndex,
+		matchIndex: 0,
+		notify:     make(chan struct{}, 1),
+		stop:       nil,
+	}
+}
+
+func (p *peer) signal() {
+	select {
+	case p.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (p *peer) stopReplicator() {
+	if p.stop != nil {
+		close(p.stop)
+		p.stop = nil
+	}
+}
+
+func (n *Node) startReplicator(p *peer) {
+	p.stopReplicator()
+	p.stop = make(chan struct{})
+
+	n.wg.Add(1)
+	go n.replicateLoop(p, p.stop)
+}
+
+func (n *Node) stopReplicators() {
+	for _, p := range n.peers {
+		p.stopReplicator()
+	}
+}
+
+// replicateLoop sends new entries as soon as they are appended and an empty
+// AppendEntries as heartbeat when there is nothing to send.
+func (n *Node) replicateLoop(p *peer, stop chan struct{}) {
+	defer n.wg.Done()
+
+	ticker := time.NewTicker(n.heartbeatInterval)
+	defer ticker.Stop()
+
+	n.replicate(p)
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-n.done:
+			return
+		case <-p.notify:
+		case <-ticker.C:
+		}
+
+		n.replicate(p)
+	}
+}
+
+func (n *Node) replicate(p *peer) {
+	n.mtx.Lock()
+
+	if n.role != Leader {
+		n.mtx.Unlock()
+		return
+	}
+
+	if p.nextIndex <= n.log.base {
+		req := installSnapshotRequest{
+			Term:              n.term,
+			LeaderID:          n.id,
+			LastIncludedIndex: n.log.base,
+			LastIncludedTerm:  n.log.term,
+			Configuration:     n.snapshotConfiguration,
+			Offset:            0,
+			Data:              nil,
+			Done:              false,
+		}
+		n.mtx.Unlock()
+
+		n.sendSnapshot(p, req)
+		return
+	}
+
+	prevLogIndex := p.nextIndex - 1
+	prevLogTerm, _ := n.log.termAt(prevLogIndex)
+
+	req := appendEntriesRequest{
+		Term:         n.term,
+		LeaderID:     n.id,
+		PrevLogIndex: prevLogIndex,
+		PrevLogTerm:  prevLogTerm,
+		Entries:      n.log.slice(p.nextIndex, p.nextIndex+maxAppendEntries),
+		LeaderCommit: n.commitIndex,
+	}
+	n.mtx.Unlock()
+
+	//nolint:exhaustruct
+	resp, err := p.client.call(request{Type: requestAppendEntries, AppendEntries: &req})
+	if err != nil || resp.AppendEntries == nil {
+		n.logger.Debug("append entries failed", zap.String("peer", p.member.ID), zap.Error(err))
+		return
+	}
+	reply := resp.AppendEntries
+
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	if reply.Term > n.term {
+		n.stepDown(reply.Term)
+		return
+	}
+
+	if n.role != Leader || n.term != req.Term {
+		return
+	}
+
+	if reply.Success {
+		p.matchIndex = max(p.matchIndex, req.PrevLogIndex+uint64(len(req.Entries)))
+		p.nextIndex = max(p.nextIndex, p.matchIndex+1)
+		n.advanceCommit()
+	} else {
+		p.nextIndex = max(min(req.PrevLogIndex, reply.LastIndex+1), p.matchIndex+1)
+	}
+
+	if p.nextIndex <= n.log.lastIndex() {
+		p.signal()
+	}
+}
+
+// sendSnapshot streams the latest snapshot to a follower whose next entry has
+// already been compacted away.
+func (n *Node) sendSnapshot(p *peer, req installSnapshotRequest) {
+	n.logger.Info(
+		"sending snapshot to follower",
+		zap.String("peer", p.member.ID),
+		zap.Uint64("snapshot_index", req.LastIncludedIndex),
+	)
+
+	for {
+		chunk, size, err := n.snapshots.ReadChunk(req.LastIncludedIndex, req.Offset, snapshotChunkSize)
+		if err != nil {
+			n.logger.Error("failed to read snapshot", zap.Uint64("snapshot_index", req.LastIncludedIndex), zap.Error(err))
+			return
+		}
+
+		req.Data = chunk
+		req.Done = req.Offset+int64(len(chunk)) >= size
+
+		//nolint:exhaustruct
+		resp, err := p.client.call(request{Type: requestInstallSnapshot, InstallSnapshot: &req})
+		if err != nil || resp.InstallSnapshot == nil {
+			n.logger.Debug("install snapshot failed", zap.String("peer", p.member.ID), zap.Error(err))
+			return
+		}
+		reply := resp.InstallSnapshot
+
+		n.mtx.Lock()
+		if reply.Term > n.term {
+			n.stepDown(reply.Term)
+			n.mtx.Unlock()
+			return
+		}
+
+		if n.role != Leader || n.term != req.Term || !reply.Success {
+			n.mtx.Unlock()
+			return
+		}
+
+		if req.Done {
+			p.matchIndex = max(p.matchIndex, req.LastIncludedIndex)
+			p.nextIndex = p.matchIndex + 1
+			n.advanceCommit()
+			p.signal()
+			n.mtx.Unlock()
+			return
+		}
+		n.mtx.Unlock()
+
+		req.Offset += int64(len(chunk))
+	}
+}
+
+// advanceCommit moves the commit index to the highest entry of the current
+// term that is stored on a majority. A leader that is no longer part of the
+// committed configuration steps down.
+func (n *Node) advanceCommit() {
+	if n.role != Leader {
+		return
+	}
+
+	for index := n.log.lastIndex(); index > n.commitIndex; index-- {
+		if term, _ := n.log.termAt(index); term != n.term {
+			break
+		}
+
+		count := 0
+		for _, member := range n.configuration.Members {
+			if member.ID == n.id {
+				count++
+				continue
+			}
+
+			if p, ok := n.peers[member.ID]; ok && p.matchIndex >= index {
+				count++
+			}
+		}
+
+		if count >= n.configuration.quorum() {
+			n.commitIndex = index
+			n.applyCond.Broadcast()
+			break
+		}
+	}
+
+	if n.configurationIndex <= n.commitIndex && !n.configuration.Contains(n.id) {
+		n.logger.Info("removed from configuration")
+		n.stepDown(n.term)
+	}
+}
@@ -0,0 +1,106 @@
+package raft
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// hardState is everything besides the log that has to survive a restart:
+// the vote for the current term and the position and membership covered by
+// the latest snapshot.
+type hardState struct {
+	Term           uint64
+	VotedFor       string
+	SnapshotIndex  uint64
+	SnapshotTerm   uint64
+	SnapshotConfig Configuration
+}
+
+func loadState(path string) (hardState, bool, error) {
+	//nolint:gosec
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return hardState{}, false, nil
+	}
+	if err != nil {
+		return hardState{}, false, fmt.Errorf("failed to read raft state: %w", err)
+	}
+
+	var state hardState
+	if err := decode(data, &state); err != nil {
+		return hardState{}, false, fmt.Errorf("failed to decode raft state: %w", err)
+	}
+
+	return state, true, nil
+}
+
+// saveState replaces the state file atomically, so a crash leaves either the
+// previous or the new state on disk.
+func saveState(path string, state hardState) error {
+	data, err := encode(state)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := path + ".tmp"
+	//nolint:gosec
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create raft state: %w", err)
+	}
+
+	if _, err := file.Write(data); err != nil {
+		//nolint:errcheck
+		file.Close()
+		return fmt.Errorf("failed to write raft state: %w", err)
+	}
+
+	if err := file.Sync(); err != nil {
+		//nolint:errcheck
+		file.Close()
+		return fmt.Errorf("failed to sync raft state: %w", err)
+	}
+
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to close raft state: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to replace raft state: %w", err)
+	}
+
+	return syncDir(filepath.Dir(path))
+}
+
+func syncDir(path string) error {
+	//nolint:gosec
+	dir, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open directory: %w", err)
+	}
+	//nolint:errcheck
+	defer dir.Close()
+
+	if err := dir.Sync(); err != nil {
+		return fmt.Errorf("failed to sync directory: %w", err)
+	}
+
+	return nil
+}
+
+func encode(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func decode(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
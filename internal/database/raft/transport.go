@@ -0,0 +1,179 @@
+package raft
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/network"
+)
+
+var (
+	ErrUnknownRequest = errors.New("unknown raft request")
+	ErrRemoteError    = errors.New("raft peer returned error")
+)
+
+const rpcTimeout = 5 * time.Second
+
+type requestType uint8
+
+const (
+	requestVote requestType = iota + 1
+	requestAppendEntries
+	requestInstallSnapshot
+)
+
+type request struct {
+	Type            requestType
+	Vote            *voteRequest
+	AppendEntries   *appendEntriesRequest
+	InstallSnapshot *installSnapshotRequest
+}
+
+type response struct {
+	Vote            *voteResponse
+	AppendEntries   *appendEntriesResponse
+	InstallSnapshot *installSnapshotResponse
+	Error           string
+}
+
+type voteRequest struct {
+	Term         uint64
+	CandidateID  string
+	LastLogIndex uint64
+	LastLogTerm  uint64
+}
+
+type voteResponse struct {
+	Term    uint64
+	Granted bool
+}
+
+type appendEntriesRequest struct {
+	Term         uint64
+	LeaderID     string
+	PrevLogIndex uint64
+	PrevLogTerm  uint64
+	Entries      []Entry
+	LeaderCommit uint64
+}
+
+// appendEntriesResponse carries the follower's last index on rejection so
+// that the leader can skip a whole conflicting term at once.
+type appendEntriesResponse struct {
+	Term      uint64
+	Success   bool
+	LastIndex uint64
+}
+
+type installSnapshotRequest struct {
+	Term              uint64
+	LeaderID          string
+	LastIncludedIndex uint64
+	LastIncludedTerm  uint64
+	Configuration     Configuration
+	Offset            int64
+	Data              []byte
+	Done              bool
+}
+
+type installSnapshotResponse struct {
+	Term    uint64
+	Success bool
+}
+
+// client is a lazily connected, reusable connection to a single peer. Calls
+// are serialized because the framing has no request identifiers; close may
+// interrupt a call in flight. Any error drops the connection, since the peer
+// may have been restarted behind the same address.
+type client struct {
+	address string
+	callMtx sync.Mutex
+
+	mtx    sync.Mutex
+	conn   *network.TCPClient
+	closed bool
+}
+
+func newClient(address string) *client {
+	//nolint:exhaustruct
+	return &client{address: address}
+}
+
+func (c *client) call(req request) (response, error) {
+	c.callMtx.Lock()
+	defer c.callMtx.Unlock()
+
+	conn, err := c.connect()
+	if err != nil {
+		return response{}, err
+	}
+
+	data, err := encode(req)
+	if err != nil {
+		return response{}, err
+	}
+
+	data, err = conn.Send(data)
+	if err != nil {
+		c.disconnect(conn)
+		return response{}, err
+	}
+
+	var resp response
+	if err := decode(data, &resp); err != nil {
+		c.disconnect(conn)
+		return response{}, fmt.Errorf("failed to decode raft response: %w", err)
+	}
+
+	if resp.Error != "" {
+		c.disconnect(conn)
+		return response{}, fmt.Errorf("%w: %s", ErrRemoteError, resp.Error)
+	}
+
+	return resp, nil
+}
+
+func (c *client) connect() (*network.TCPClient, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if c.closed {
+		return nil, ErrClosed
+	}
+
+	if c.conn == nil {
+		conn, err := network.NewTCPClient(c.address, network.WithTimeout(rpcTimeout))
+		if err != nil {
+			return nil, err
+		}
+		c.conn = conn
+	}
+
+	return c.conn, nil
+}
+
+func (c *client) disconnect(conn *network.TCPClient) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if c.conn == conn {
+		c.conn = nil
+	}
+
+	//nolint:errcheck
+	conn.Close()
+}
+
+func (c *client) close() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.closed = true
+	if c.conn != nil {
+		//nolint:errcheck
+		c.conn.Close()
+		c.conn = nil
+	}
+}
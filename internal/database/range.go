@@ -0,0 +1,58 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/compute"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+	"go.uber.org/zap"
+)
+
+// handleRangeQuery serves RANGE start end and PREFIX p, and their REV
+// variants, which return the same keys in descending order. Ranges include
+// start and exclude end. The reply holds every match as its key followed by
+// its value, with the type in parentheses in place of values that are not
+// strings.
+func (d *Database) handleRangeQuery(query *compute.Query) string {
+	var start, end string
+	switch query.Command {
+	case compute.RANGE, compute.REVRANGE:
+		start, end = query.Args[0], query.Args[1]
+		if end <= start {
+			return compute.ArrayReply()
+		}
+	default:
+		start, end = query.Args[0], engine.PrefixEnd(query.Args[0])
+	}
+
+	reverse := query.Command == compute.REVRANGE || query.Command == compute.REVPREFIX
+
+	limit := 0
+	if value, ok := query.Options[compute.LIMIT]; ok {
+		//nolint:errcheck
+		limit, _ = strconv.Atoi(value)
+	}
+
+	entries, err := d.storage.Range(start, end, reverse, limit)
+	if errors.Is(err, engine.ErrRangeUnsupported) {
+		return fmt.Sprintf("error: %s", err.Error())
+	}
+
+	if err != nil {
+		d.logger.Error("failed to read range", zap.Strings("args", query.Args), zap.Error(err))
+		return fmt.Sprintf("error: %s", err.Error())
+	}
+
+	values := make([]string, 0, 2*len(entries))
+	for _, entry := range entries {
+		value := string(entry.Value)
+		if entry.Type != engine.TypeString {
+			value = "(" + entry.Type.String() + ")"
+		}
+		values = append(values, string(entry.Key), value)
+	}
+
+	return compute.ValuesReply(values)
+}
@@ -0,0 +1,320 @@
+package replication
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/config"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/snapshot"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/wal"
+	"github.com/crunchydeer30/key-value-database/internal/network"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrNoSnapshots   = errors.New("replica needs re-seeding but snapshots are disabled on leader")
+	ErrQuorumTimeout = errors.New("write quorum not reached")
+	ErrLeaderClosed  = errors.New("leader is closed")
+)
+
+const (
+	defaultSyncInterval = time.Second
+	defaultMaxLag       = 1 << 20
+	defaultQuorumWait   = time.Second
+	maxBatchSize        = 1024
+	snapshotChunkSize   = 1 << 20
+)
+
+type Leader struct {
+	wal          *wal.WAL
+	snapshots    *snapshot.Manager
+	takeSnapshot func() (snapshot.Info, error)
+	pollTimeout  time.Duration
+	maxLag       uint64
+	server       *network.TCPServer
+	logger       *zap.Logger
+
+	mtx       sync.Mutex
+	replicas  map[string]*replicaState
+	ackNotify chan struct{}
+
+	done chan struct{}
+}
+
+type replicaState struct {
+	mtx      sync.Mutex
+	ackLSN   uint64
+	lastSeen time.Time
+	reader   *wal.Reader
+}
+
+type ReplicaStatus struct {
+	ID       string
+	AckLSN   uint64
+	LastSeen time.Time
+}
+
+func NewLeader(
+	cfg *config.ReplicationConfig,
+	w *wal.WAL,
+	snapshots *snapshot.Manager,
+	takeSnapshot func() (snapshot.Info, error),
+	logger *zap.Logger,
+) (*Leader, error) {
+	if cfg == nil {
+		return nil, errors.New("replication config is nil")
+	}
+
+	if w == nil {
+		return nil, errors.New("replication requires wal")
+	}
+
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	//nolint:exhaustruct
+	l := &Leader{
+		wal:          w,
+		snapshots:    snapshots,
+		takeSnapshot: takeSnapshot,
+		pollTimeout:  cfg.SyncInterval,
+		maxLag:       cfg.MaxLag,
+		logger:       logger,
+		replicas:     make(map[string]*replicaState),
+		ackNotify:    make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+
+	if l.pollTimeout <= 0 {
+		l.pollTimeout = defaultSyncInterval
+	}
+	if l.maxLag == 0 {
+		l.maxLag = defaultMaxLag
+	}
+
+	server, err := network.NewTCPServer(cfg.Address, l.HandleRequest, network.WithLogger(logger))
+	if err != nil {
+		return nil, err
+	}
+	l.server = server
+
+	return l, nil
+}
+
+func (l *Leader) Start() {
+	go l.server.Serve()
+}
+
+func (l *Leader) Addr() string {
+	return l.server.Addr()
+}
+
+func (l *Leader) Close() error {
+	close(l.done)
+	return l.server.Close()
+}
+
+func (l *Leader) HandleRequest(data []byte) []byte {
+	var req request
+	var resp response
+	var err error
+
+	if err = decode(data, &req); err == nil {
+		switch req.Type {
+		case requestSync:
+			resp, err = l.handleSync(req)
+		case requestSnapshotChunk:
+			resp, err = l.handleSnapshotChunk(req)
+		default:
+			err = fmt.Errorf("%w: %d", ErrUnknownRequest, req.Type)
+		}
+	}
+
+	if err != nil {
+		l.logger.Error("failed to handle replication request", zap.String("replica", req.ReplicaID), zap.Error(err))
+		//nolint:exhaustruct
+		resp = response{Type: responseError, Error: err.Error()}
+	}
+
+	result, err := encode(resp)
+	if err != nil {
+		l.logger.Error("failed to encode replication response", zap.Error(err))
+		return nil
+	}
+
+	return result
+}
+
+func (l *Leader) handleSync(req request) (response, error) {
+	state := l.acknowledge(req.ReplicaID, req.LastLSN)
+
+	state.mtx.Lock()
+	defer state.mtx.Unlock()
+
+	lastLSN := l.wal.LastLSN()
+	if req.LastLSN > lastLSN || lastLSN-req.LastLSN > l.maxLag {
+		return l.reseed(req)
+	}
+
+	timer := time.NewTimer(l.pollTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-l.wal.Notify(req.LastLSN + 1):
+	case <-timer.C:
+		//nolint:exhaustruct
+		return response{Type: responseRecords}, nil
+	case <-l.done:
+		//nolint:exhaustruct
+		return response{Type: responseRecords}, nil
+	}
+
+	if state.reader == nil || state.reader.NextLSN() != req.LastLSN+1 {
+		state.reader = l.wal.NewReader(req.LastLSN + 1)
+	}
+
+	records, err := state.reader.Read(maxBatchSize)
+	if errors.Is(err, wal.ErrCompacted) {
+		state.reader = nil
+		return l.reseed(req)
+	}
+	if err != nil {
+		state.reader = nil
+		return response{}, err
+	}
+
+	//nolint:exhaustruct
+	return response{Type: responseRecords, Records: records}, nil
+}
+
+func (l *Leader) reseed(req request) (response, error) {
+	if l.snapshots == nil {
+		return response{}, ErrNoSnapshots
+	}
+
+	info, err := l.snapshots.Latest()
+	if err != nil && !errors.Is(err, snapshot.ErrNoSnapshot) {
+		return response{}, err
+	}
+
+	if errors.Is(err, snapshot.ErrNoSnapshot) || l.wal.LastLSN()-info.LSN > l.maxLag {
+		if info, err = l.takeSnapshot(); err != nil {
+			return response{}, fmt.Errorf("failed to create snapshot for replica: %w", err)
+		}
+	}
+
+	l.logger.Info(
+		"re-seeding replica from snapshot",
+		zap.String("replica", req.ReplicaID),
+		zap.Uint64("replica_lsn", req.LastLSN),
+		zap.Uint64("snapshot_lsn", info.LSN),
+	)
+
+	//nolint:exhaustruct
+	return response{Type: responseSnapshot, SnapshotLSN: info.LSN}, nil
+}
+
+func (l *Leader) handleSnapshotChunk(req request) (response, error) {
+	if l.snapshots == nil {
+		return response{}, ErrNoSnapshots
+	}
+
+	chunk, size, err := l.snapshots.ReadChunk(req.SnapshotLSN, req.Offset, snapshotChunkSize)
+	if err != nil {
+		return response{}, err
+	}
+
+	//nolint:exhaustruct
+	return response{
+		Type:        responseSnapshotChunk,
+		SnapshotLSN: req.SnapshotLSN,
+		Chunk:       chunk,
+		Size:        size,
+	}, nil
+}
+
+func (l *Leader) acknowledge(replicaID string, lsn uint64) *replicaState {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	state, ok := l.replicas[replicaID]
+	if !ok {
+		//nolint:exhaustruct
+		state = &replicaState{}
+		l.replicas[replicaID] = state
+		l.logger.Info("replica connected", zap.String("replica", replicaID), zap.Uint64("lsn", lsn))
+	}
+
+	if lsn != state.ackLSN {
+		close(l.ackNotify)
+		l.ackNotify = make(chan struct{})
+	}
+
+	state.ackLSN = lsn
+	state.lastSeen = time.Now()
+
+	return state
+}
+
+// WaitForQuorum blocks until at least quorum replicas have acknowledged lsn
+// or the timeout expires. The write itself is already applied on the leader.
+func (l *Leader) WaitForQuorum(lsn uint64, quorum int, timeout time.Duration) error {
+	if quorum <= 0 {
+		return nil
+	}
+
+	if timeout <= 0 {
+		timeout = defaultQuorumWait
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		l.mtx.Lock()
+		acked := 0
+		for _, state := range l.replicas {
+			if state.ackLSN >= lsn {
+				acked++
+			}
+		}
+		notify := l.ackNotify
+		l.mtx.Unlock()
+
+		if acked >= quorum {
+			return nil
+		}
+
+		select {
+		case <-notify:
+		case <-timer.C:
+			return fmt.Errorf("%w: %d of %d replicas acknowledged within %s", ErrQuorumTimeout, acked, quorum, timeout)
+		case <-l.done:
+			return ErrLeaderClosed
+		}
+	}
+}
+
+func (l *Leader) Replicas() []ReplicaStatus {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	replicas := make([]ReplicaStatus, 0, len(l.replicas))
+	for id, state := range l.replicas {
+		replicas = append(replicas, ReplicaStatus{
+			ID:       id,
+			AckLSN:   state.ackLSN,
+			LastSeen: state.lastSeen,
+		})
+	}
+
+	sort.Slice(replicas, func(i, j int) bool {
+		return replicas[i].ID < replicas[j].ID
+	})
+
+	return replicas
+}
@@ -0,0 +1,59 @@
+package replication
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/wal"
+)
+
+var ErrUnknownRequest = errors.New("unknown replication request")
+
+type requestType uint8
+
+const (
+	requestSync requestType = iota + 1
+	requestSnapshotChunk
+)
+
+type responseType uint8
+
+const (
+	responseRecords responseType = iota + 1
+	responseSnapshot
+	responseSnapshotChunk
+	responseError
+)
+
+// request is sent by a replica. For requestSync, LastLSN doubles as the
+// acknowledgement of everything the replica has durably applied so far.
+type request struct {
+	Type        requestType
+	ReplicaID   string
+	LastLSN     uint64
+	SnapshotLSN uint64
+	Offset      int64
+}
+
+type response struct {
+	Type        responseType
+	Records     []wal.Record
+	SnapshotLSN uint64
+	Chunk       []byte
+	Size        int64
+	Error       string
+}
+
+func encode(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func decode(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
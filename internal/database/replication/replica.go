@@ -0,0 +1,224 @@
+package replication
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/config"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/snapshot"
+	"github.com/crunchydeer30/key-value-database/internal/network"
+	"go.uber.org/zap"
+)
+
+var ErrLeaderError = errors.New("leader returned error")
+
+const requestTimeout = 30 * time.Second
+
+type Replica struct {
+	id            string
+	leaderAddress string
+	syncInterval  time.Duration
+	storage       *storage.Storage
+	snapshots     *snapshot.Manager
+	client        *network.TCPClient
+	logger        *zap.Logger
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+func NewReplica(
+	cfg *config.ReplicationConfig,
+	s *storage.Storage,
+	snapshots *snapshot.Manager,
+	logger *zap.Logger,
+) (*Replica, error) {
+	if cfg == nil {
+		return nil, errors.New("replication config is nil")
+	}
+
+	if s == nil {
+		return nil, errors.New("storage is nil")
+	}
+
+	if snapshots == nil {
+		return nil, errors.New("replica requires snapshots")
+	}
+
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	//nolint:exhaustruct
+	r := &Replica{
+		id:            cfg.ReplicaID,
+		leaderAddress: cfg.LeaderAddress,
+		syncInterval:  cfg.SyncInterval,
+		storage:       s,
+		snapshots:     snapshots,
+		logger:        logger,
+		done:          make(chan struct{}),
+	}
+
+	if r.syncInterval <= 0 {
+		r.syncInterval = defaultSyncInterval
+	}
+
+	return r, nil
+}
+
+func (r *Replica) Start() {
+	r.wg.Add(1)
+	go r.loop()
+}
+
+func (r *Replica) Close() error {
+	close(r.done)
+	r.wg.Wait()
+
+	return r.disconnect()
+}
+
+func (r *Replica) loop() {
+	defer r.wg.Done()
+
+	r.logger.Info("started replication", zap.String("leader", r.leaderAddress), zap.String("replica", r.id))
+
+	for {
+		select {
+		case <-r.done:
+			return
+		default:
+		}
+
+		if err := r.sync(); err != nil {
+			r.logger.Error("replication sync failed", zap.String("leader", r.leaderAddress), zap.Error(err))
+			//nolint:errcheck
+			r.disconnect()
+
+			timer := time.NewTimer(r.syncInterval)
+			select {
+			case <-r.done:
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+	}
+}
+
+func (r *Replica) sync() error {
+	//nolint:exhaustruct
+	resp, err := r.send(request{
+		Type:      requestSync,
+		ReplicaID: r.id,
+		LastLSN:   r.storage.LastLSN(),
+	})
+	if err != nil {
+		return err
+	}
+
+	switch resp.Type {
+	case responseRecords:
+		return r.storage.ApplyRecords(resp.Records)
+	case responseSnapshot:
+		return r.reseed(resp.SnapshotLSN)
+	default:
+		return fmt.Errorf("unexpected response type %d", resp.Type)
+	}
+}
+
+func (r *Replica) reseed(lsn uint64) error {
+	r.logger.Info("re-seeding from leader snapshot", zap.Uint64("snapshot_lsn", lsn))
+
+	info, err := r.snapshots.Install(lsn, &chunkReader{replica: r, lsn: lsn, offset: 0, buf: nil})
+	if err != nil {
+		return err
+	}
+
+	return r.storage.Restore(info)
+}
+
+func (r *Replica) send(req request) (response, error) {
+	if r.client == nil {
+		client, err := network.NewTCPClient(r.leaderAddress, network.WithTimeout(requestTimeout))
+		if err != nil {
+			return response{}, err
+		}
+		r.client = client
+	}
+
+	data, err := encode(req)
+	if err != nil {
+		return response{}, err
+	}
+
+	data, err = r.client.Send(data)
+	if err != nil {
+		return response{}, err
+	}
+
+	var resp response
+	if err := decode(data, &resp); err != nil {
+		return response{}, fmt.Errorf("failed to decode replication response: %w", err)
+	}
+
+	if resp.Type == responseError {
+		return response{}, fmt.Errorf("%w: %s", ErrLeaderError, resp.Error)
+	}
+
+	return resp, nil
+}
+
+func (r *Replica) disconnect() error {
+	if r.client == nil {
+		return nil
+	}
+
+	err := r.client.Close()
+	r.client = nil
+
+	return err
+}
+
+// chunkReader streams a snapshot file from the leader chunk by chunk.
+type chunkReader struct {
+	replica *Replica
+	lsn     uint64
+	offset  int64
+	buf     []byte
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	if len(c.buf) == 0 {
+		//nolint:exhaustruct
+		resp, err := c.replica.send(request{
+			Type:        requestSnapshotChunk,
+			ReplicaID:   c.replica.id,
+			SnapshotLSN: c.lsn,
+			Offset:      c.offset,
+		})
+		if err != nil {
+			return 0, err
+		}
+
+		if len(resp.Chunk) == 0 {
+			if c.offset < resp.Size {
+				return 0, io.ErrUnexpectedEOF
+			}
+			return 0, io.EOF
+		}
+
+		c.buf = resp.Chunk
+		c.offset += int64(len(resp.Chunk))
+	}
+
+	n := copy(p, c.buf)
+	c.buf = c.buf[n:]
+
+	return n, nil
+}
@@ -0,0 +1,256 @@
+//nolint:exhaustruct
+package replication
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/config"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+	inmemory "github.com/crunchydeer30/key-value-database/internal/database/storage/engine/in_memory"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/snapshot"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/wal"
+	"go.uber.org/zap"
+)
+
+type node struct {
+	storage   *storage.Storage
+	wal       *wal.WAL
+	snapshots *snapshot.Manager
+}
+
+func newTestNode(t *testing.T, maxSegmentSize int64) *node {
+	t.Helper()
+
+	w, err := wal.NewWAL(&config.WALConfig{
+		DataDirectory:  t.TempDir(),
+		MaxSegmentSize: maxSegmentSize,
+		FlushPolicy:    string(wal.FlushOS),
+	}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := snapshot.NewManager(&config.SnapshotConfig{DataDirectory: t.TempDir()}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := inmemory.NewInMemoryEngine(zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := storage.NewStorage(e, zap.NewNop(), storage.WithWAL(w), storage.WithSnapshots(m, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		//nolint:errcheck
+		s.Close()
+	})
+
+	return &node{storage: s, wal: w, snapshots: m}
+}
+
+func startLeader(t *testing.T, n *node, maxLag uint64) *Leader {
+	t.Helper()
+
+	leader, err := NewLeader(&config.ReplicationConfig{
+		Address:      "127.0.0.1:0",
+		SyncInterval: 50 * time.Millisecond,
+		MaxLag:       maxLag,
+	}, n.wal, n.snapshots, n.storage.Snapshot, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leader.Start()
+	t.Cleanup(func() {
+		//nolint:errcheck
+		leader.Close()
+	})
+
+	return leader
+}
+
+func startReplica(t *testing.T, n *node, id string, leader *Leader) *Replica {
+	t.Helper()
+
+	replica, err := NewReplica(&config.ReplicationConfig{
+		LeaderAddress: leader.Addr(),
+		ReplicaID:     id,
+		SyncInterval:  10 * time.Millisecond,
+	}, n.storage, n.snapshots, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replica.Start()
+	t.Cleanup(func() {
+		//nolint:errcheck
+		replica.Close()
+	})
+
+	return replica
+}
+
+func waitForValue(t *testing.T, s *storage.Storage, key, want string) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got, err := s.Get(key)
+		if err == nil && got == want {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("key %q: expected value %q, got %q (%v)", key, want, got, err)
+		}
+
+		<-time.After(5 * time.Millisecond)
+	}
+}
+
+func TestReplication_StreamsWAL(t *testing.T) {
+	leaderNode := newTestNode(t, 0)
+	replicaNode := newTestNode(t, 0)
+
+	leader := startLeader(t, leaderNode, 0)
+	startReplica(t, replicaNode, "replica-1", leader)
+
+	for i := range 100 {
+		if err := leaderNode.storage.Set("key"+strconv.Itoa(i), "value"+strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := leaderNode.storage.Del("key0"); err != nil {
+		t.Fatal(err)
+	}
+
+	waitForValue(t, replicaNode.storage, "key99", "value99")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for replicaNode.storage.LastLSN() != leaderNode.storage.LastLSN() {
+		if time.Now().After(deadline) {
+			t.Fatalf("replica lsn %d did not reach leader lsn %d",
+				replicaNode.storage.LastLSN(), leaderNode.storage.LastLSN())
+		}
+		<-time.After(5 * time.Millisecond)
+	}
+
+	if _, err := replicaNode.storage.Get("key0"); !errors.Is(err, engine.ErrKeyNotFound) {
+		t.Errorf("expected error %v, got %v", engine.ErrKeyNotFound, err)
+	}
+
+	deadline = time.Now().Add(5 * time.Second)
+	for {
+		replicas := leader.Replicas()
+		if len(replicas) == 1 && replicas[0].ID == "replica-1" && replicas[0].AckLSN == leaderNode.storage.LastLSN() {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("leader did not track replica acknowledgement: %+v", replicas)
+		}
+		<-time.After(5 * time.Millisecond)
+	}
+}
+
+func TestReplication_ReseedsFromSnapshot(t *testing.T) {
+	leaderNode := newTestNode(t, 128)
+	replicaNode := newTestNode(t, 128)
+
+	for i := range 50 {
+		if err := leaderNode.storage.Set("key"+strconv.Itoa(i), "value"+strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for range 2 {
+		if _, err := leaderNode.storage.Snapshot(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := replicaNode.storage.Set("stale", "value"); err != nil {
+		t.Fatal(err)
+	}
+
+	leader := startLeader(t, leaderNode, 0)
+	startReplica(t, replicaNode, "replica-1", leader)
+
+	waitForValue(t, replicaNode.storage, "key49", "value49")
+
+	if err := leaderNode.storage.Set("after_reseed", "value"); err != nil {
+		t.Fatal(err)
+	}
+	waitForValue(t, replicaNode.storage, "after_reseed", "value")
+
+	if _, err := replicaNode.storage.Get("stale"); !errors.Is(err, engine.ErrKeyNotFound) {
+		t.Errorf("expected stale key to be dropped on re-seed, got %v", err)
+	}
+}
+
+func TestReplication_ReseedsLaggingReplica(t *testing.T) {
+	leaderNode := newTestNode(t, 0)
+	replicaNode := newTestNode(t, 0)
+
+	for i := range 20 {
+		if err := leaderNode.storage.Set("key"+strconv.Itoa(i), "value"+strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	leader := startLeader(t, leaderNode, 5)
+	startReplica(t, replicaNode, "replica-1", leader)
+
+	waitForValue(t, replicaNode.storage, "key19", "value19")
+
+	snapshots, err := replicaNode.snapshots.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) == 0 {
+		t.Errorf("expected replica to be seeded from a snapshot")
+	}
+}
+
+func TestReplication_WaitForQuorum(t *testing.T) {
+	leaderNode := newTestNode(t, 0)
+	leader := startLeader(t, leaderNode, 0)
+
+	startReplica(t, newTestNode(t, 0), "replica-1", leader)
+	startReplica(t, newTestNode(t, 0), "replica-2", leader)
+
+	if err := leaderNode.storage.Set("key", "value"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := leader.WaitForQuorum(leaderNode.storage.LastLSN(), 2, 5*time.Second); err != nil {
+		t.Errorf("expected quorum of 2 to be reached, got %v", err)
+	}
+}
+
+func TestReplication_WaitForQuorumTimeout(t *testing.T) {
+	leaderNode := newTestNode(t, 0)
+	leader := startLeader(t, leaderNode, 0)
+
+	startReplica(t, newTestNode(t, 0), "replica-1", leader)
+
+	if err := leaderNode.storage.Set("key", "value"); err != nil {
+		t.Fatal(err)
+	}
+
+	err := leader.WaitForQuorum(leaderNode.storage.LastLSN(), 2, 200*time.Millisecond)
+	if !errors.Is(err, ErrQuorumTimeout) {
+		t.Errorf("expected error %v, got %v", ErrQuorumTimeout, err)
+	}
+
+	if _, getErr := leaderNode.storage.Get("key"); getErr != nil {
+		t.Errorf("expected write to stay applied on leader, got %v", getErr)
+	}
+}
@@ -0,0 +1,58 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/compute"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultScanCount = 10
+	scanDone         = "0"
+)
+
+// handleScanQuery serves SCAN cursor [MATCH pattern] [COUNT n]. The reply is
+// the cursor of the next batch, "0" once the scan is complete, and the array
+// of the keys of this batch. MATCH filters a batch after it is read, so a batch may
+// come back empty before the scan is over, and COUNT is only a hint of how
+// much work a call does.
+func (d *Database) handleScanQuery(query *compute.Query) string {
+	cursor := query.Args[0]
+	if cursor == scanDone {
+		cursor = ""
+	}
+
+	count := defaultScanCount
+	if value, ok := query.Options[compute.COUNT]; ok {
+		//nolint:errcheck
+		count, _ = strconv.Atoi(value)
+	}
+
+	keys, next, err := d.storage.Scan(cursor, count)
+	if errors.Is(err, engine.ErrScanUnsupported) || errors.Is(err, engine.ErrInvalidCursor) {
+		return fmt.Sprintf("error: %s", err.Error())
+	}
+
+	if err != nil {
+		d.logger.Error("failed to scan", zap.String("cursor", query.Args[0]), zap.Error(err))
+		return fmt.Sprintf("error: %s", err.Error())
+	}
+
+	if next == "" {
+		next = scanDone
+	}
+
+	pattern, match := query.Options[compute.MATCH]
+	matched := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if !match || matchGlob(pattern, key) {
+			matched = append(matched, key)
+		}
+	}
+
+	return compute.ArrayReply(compute.ValueReply(next), compute.ValuesReply(matched))
+}
@@ -0,0 +1,71 @@
+package database
+
+import (
+	"strconv"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/compute"
+	"go.uber.org/zap"
+)
+
+// handleSetUpdateQuery handles SADD and SREM, replying with the number of members
+// that were added or removed.
+func (d *Database) handleSetUpdateQuery(query *compute.Query) string {
+	key, members := query.Args[0], query.Args[1:]
+
+	var n int
+	var err error
+	if query.Command == compute.SADD {
+		n, err = d.storage.SAdd(key, members, d.writeOptions(query)...)
+	} else {
+		n, err = d.storage.SRem(key, members, d.writeOptions(query)...)
+	}
+
+	if err != nil {
+		return d.writeFailure(err, "failed to update set", zap.String("key", key))
+	}
+
+	return strconv.Itoa(n)
+}
+
+func (d *Database) handleSIsMemberQuery(query *compute.Query) string {
+	ok, err := d.storage.SIsMember(query.Args[0], query.Args[1])
+	if err != nil {
+		return d.readFailure(err, "failed to read set", zap.String("key", query.Args[0]))
+	}
+
+	if ok {
+		return replyTrue
+	}
+
+	return replyFalse
+}
+
+func (d *Database) handleSCardQuery(query *compute.Query) string {
+	n, err := d.storage.SCard(query.Args[0])
+	if err != nil {
+		return d.readFailure(err, "failed to read set", zap.String("key", query.Args[0]))
+	}
+
+	return strconv.Itoa(n)
+}
+
+// handleSMembersQuery handles SMEMBERS, SINTER and SUNION, replying with the
+// resulting members in order.
+func (d *Database) handleSMembersQuery(query *compute.Query) string {
+	var members []string
+	var err error
+	switch query.Command {
+	case compute.SINTER:
+		members, err = d.storage.SInter(query.Args)
+	case compute.SUNION:
+		members, err = d.storage.SUnion(query.Args)
+	default:
+		members, err = d.storage.SMembers(query.Args[0])
+	}
+
+	if err != nil {
+		return d.readFailure(err, "failed to read set", zap.Strings("keys", query.Args))
+	}
+
+	return compute.ValuesReply(members)
+}
@@ -0,0 +1,123 @@
+package database
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/compute"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+	"go.uber.org/zap"
+)
+
+// handleZAddQuery handles ZADD key score member [score member ...], replying
+// with the number of members that were added rather than updated.
+func (d *Database) handleZAddQuery(query *compute.Query) string {
+	key := query.Args[0]
+
+	members := make([]storage.ScoredMember, 0, len(query.Args)/2)
+	for i := 1; i < len(query.Args); i += 2 {
+		//nolint:errcheck
+		score, _ := strconv.ParseFloat(query.Args[i], 64)
+		members = append(members, storage.ScoredMember{Member: query.Args[i+1], Score: score})
+	}
+
+	added, err := d.storage.ZAdd(key, members, d.writeOptions(query)...)
+	if err != nil {
+		return d.writeFailure(err, "failed to add to sorted set", zap.String("key", key))
+	}
+
+	return strconv.Itoa(added)
+}
+
+func (d *Database) handleZRemQuery(query *compute.Query) string {
+	key, members := query.Args[0], query.Args[1:]
+
+	removed, err := d.storage.ZRem(key, members, d.writeOptions(query)...)
+	if err != nil {
+		return d.writeFailure(err, "failed to remove from sorted set", zap.String("key", key))
+	}
+
+	return strconv.Itoa(removed)
+}
+
+// handleZIncrByQuery handles ZINCRBY key increment member, replying with the
+// new score.
+func (d *Database) handleZIncrByQuery(query *compute.Query) string {
+	key, member := query.Args[0], query.Args[2]
+
+	//nolint:errcheck
+	delta, _ := strconv.ParseFloat(query.Args[1], 64)
+
+	score, err := d.storage.ZIncrBy(key, member, delta, d.writeOptions(query)...)
+	if err != nil {
+		return d.writeFailure(err, "failed to increment score", zap.String("key", key), zap.String("member", member))
+	}
+
+	return storage.FormatFloat(score)
+}
+
+func (d *Database) handleZScoreQuery(query *compute.Query) string {
+	score, err := d.storage.ZScore(query.Args[0], query.Args[1])
+	if errors.Is(err, engine.ErrKeyNotFound) {
+		return replyNil
+	}
+
+	if err != nil {
+		return d.readFailure(err, "failed to read sorted set", zap.String("key", query.Args[0]))
+	}
+
+	return storage.FormatFloat(score)
+}
+
+func (d *Database) handleZRankQuery(query *compute.Query) string {
+	rank, err := d.storage.ZRank(query.Args[0], query.Args[1])
+	if errors.Is(err, engine.ErrKeyNotFound) {
+		return replyNil
+	}
+
+	if err != nil {
+		return d.readFailure(err, "failed to read sorted set", zap.String("key", query.Args[0]))
+	}
+
+	return strconv.Itoa(rank)
+}
+
+// handleZRangeQuery serves ZRANGE key start stop, by rank or with BYSCORE by
+// score, both bounds included. The reply holds the members in order, each
+// followed by its score with WITHSCORES.
+func (d *Database) handleZRangeQuery(query *compute.Query) string {
+	key := query.Args[0]
+
+	var members []storage.ScoredMember
+	var err error
+	if _, ok := query.Options[compute.BYSCORE]; ok {
+		//nolint:errcheck
+		minScore, _ := strconv.ParseFloat(query.Args[1], 64)
+		//nolint:errcheck
+		maxScore, _ := strconv.ParseFloat(query.Args[2], 64)
+		members, err = d.storage.ZRangeByScore(key, minScore, maxScore)
+	} else {
+		//nolint:errcheck
+		start, _ := strconv.Atoi(query.Args[1])
+		//nolint:errcheck
+		stop, _ := strconv.Atoi(query.Args[2])
+		members, err = d.storage.ZRange(key, start, stop)
+	}
+
+	if err != nil {
+		return d.readFailure(err, "failed to read sorted set", zap.String("key", key))
+	}
+
+	_, withScores := query.Options[compute.WITHSCORES]
+
+	values := make([]string, 0, len(members))
+	for _, member := range members {
+		values = append(values, member.Member)
+		if withScores {
+			values = append(values, storage.FormatFloat(member.Score))
+		}
+	}
+
+	return compute.ValuesReply(values)
+}
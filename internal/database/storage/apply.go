@@ -0,0 +1,191 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/wal"
+)
+
+var ErrInvalidOperation = errors.New("invalid operation")
+
+// Apply performs a logged operation on e and returns its result, if the
+// operation has one. WAL replay, replication and the cluster state machine
+// all go through it so that they agree on what every operation means.
+func Apply(e engine.Engine, op wal.Operation, args []string) (string, error) {
+	switch {
+	case op == wal.OperationSet && len(args) == 2:
+		return "", e.Set([]byte(args[0]), []byte(args[1]))
+	case op == wal.OperationDel && len(args) == 1:
+		return "", e.Del([]byte(args[0]))
+	case op == wal.OperationSetWithDeadline && len(args) == 3:
+		deadline, err := wal.ParseDeadline(args[2])
+		if err != nil {
+			return "", err
+		}
+		return "", engine.Put(e, engine.Entry{Key: []byte(args[0]), Value: []byte(args[1]), Deadline: deadline})
+	case op == wal.OperationExpire && len(args) == 2:
+		expirer, ok := e.(engine.Expirer)
+		if !ok {
+			return "", engine.ErrExpirationUnsupported
+		}
+		deadline, err := wal.ParseDeadline(args[1])
+		if err != nil {
+			return "", err
+		}
+		// A key that has expired by the time the operation is applied, or
+		// applied again, leaves nothing to change rather than failing it.
+		err = expirer.Expire([]byte(args[0]), deadline)
+		if errors.Is(err, engine.ErrKeyNotFound) {
+			return "0", nil
+		}
+		return "1", err
+	case op == wal.OperationPersist && len(args) == 1:
+		expirer, ok := e.(engine.Expirer)
+		if !ok {
+			return "", engine.ErrExpirationUnsupported
+		}
+		persisted, err := expirer.Persist([]byte(args[0]))
+		if errors.Is(err, engine.ErrKeyNotFound) {
+			return "0", nil
+		}
+		if err != nil || !persisted {
+			return "0", err
+		}
+		return "1", nil
+	case op == wal.OperationHSet && len(args) >= 4 && len(args)%2 == 0:
+		deadline, err := parseRecordDeadline(args[1])
+		if err != nil {
+			return "", err
+		}
+		var added int
+		return "", e.Update([]byte(args[0]), replayAdded(engine.TypeHash, deadline, hashSet(args[2:], &added)))
+	case op == wal.OperationHDel && len(args) >= 2:
+		var removed int
+		return "", replayRemoved(e.Update([]byte(args[0]), hashDel(args[1:], &removed)))
+	case op == wal.OperationSAdd && len(args) >= 3:
+		deadline, err := parseRecordDeadline(args[1])
+		if err != nil {
+			return "", err
+		}
+		var added int
+		return "", e.Update([]byte(args[0]), replayAdded(engine.TypeSet, deadline, setAdd(args[2:], &added)))
+	case op == wal.OperationSRem && len(args) >= 2:
+		var removed int
+		return "", replayRemoved(e.Update([]byte(args[0]), setRem(args[1:], &removed)))
+	case op == wal.OperationZAdd && len(args) >= 4 && len(args)%2 == 0:
+		deadline, err := parseRecordDeadline(args[1])
+		if err != nil {
+			return "", err
+		}
+		members := make([]ScoredMember, 0, len(args)/2-1)
+		for i := 2; i < len(args); i += 2 {
+			score, err := strconv.ParseFloat(args[i], 64)
+			if err != nil {
+				return "", fmt.Errorf("%w: invalid score %q", ErrInvalidOperation, args[i])
+			}
+			members = append(members, ScoredMember{Member: args[i+1], Score: score})
+		}
+		var added int
+		return "", e.Update([]byte(args[0]), replayAdded(engine.TypeZSet, deadline, zsetAdd(members, &added)))
+	case op == wal.OperationZRem && len(args) >= 2:
+		var removed int
+		return "", replayRemoved(e.Update([]byte(args[0]), zsetRem(args[1:], &removed)))
+	case op == wal.OperationInsert && (len(args) == 3 || len(args) == 4):
+		entry, err := recordedEntry(args)
+		if err != nil {
+			return "", err
+		}
+		err = e.Update(entry.Key, insert(entry))
+		if errors.Is(err, errKeyExists) {
+			return "0", nil
+		}
+		return "1", err
+	case op == wal.OperationPut && (len(args) == 3 || len(args) == 4):
+		entry, err := recordedEntry(args)
+		if err != nil {
+			return "", err
+		}
+		return "", engine.Put(e, entry)
+	case op == wal.OperationCompareAndSet && len(args) == 3:
+		err := e.Update([]byte(args[0]), compareAndSet(args[1], args[2]))
+		if errors.Is(err, errValueChanged) {
+			return "0", nil
+		}
+		return "1", err
+	case op == wal.OperationMSet && len(args) >= 2 && len(args)%2 == 0:
+		return "", mset(e, args)
+	case op == wal.OperationMSetNX && len(args) >= 2 && len(args)%2 == 0:
+		err := msetNX(e, args)
+		if errors.Is(err, errKeyExists) {
+			return "0", nil
+		}
+		return "1", err
+	case op == wal.OperationDelKeys && len(args) >= 1:
+		deleted, err := delKeys(e, args)
+		return strconv.Itoa(deleted), err
+	case op == wal.OperationBatch && len(args) > 0:
+		records, err := batchRecords(args)
+		if err != nil {
+			return "", err
+		}
+		for _, record := range records {
+			if _, err := Apply(e, record.Operation, record.Args); err != nil {
+				return "", err
+			}
+		}
+		return "", nil
+	case op == wal.OperationFlush && len(args) == 0:
+		clearer, ok := e.(engine.Clearer)
+		if !ok {
+			return "", ErrFlushUnsupported
+		}
+		return "", clearer.Clear()
+	default:
+		return "", fmt.Errorf("%w: operation %d with %d args", ErrInvalidOperation, op, len(args))
+	}
+}
+
+// formatRecordDeadline formats the deadline of a value a record leaves, which
+// is empty if the value does not expire.
+func formatRecordDeadline(deadline time.Time) string {
+	if deadline.IsZero() {
+		return ""
+	}
+
+	return wal.FormatDeadline(deadline)
+}
+
+func parseRecordDeadline(arg string) (time.Time, error) {
+	if arg == "" {
+		return time.Time{}, nil
+	}
+
+	return wal.ParseDeadline(arg)
+}
+
+// replayAdded applies a record of elements added to a value of typ with fn.
+// The record tells what the key holds once it is applied, so a value of
+// another type, which a later record has put there if the engine is ahead of
+// the log, is replaced, and the value is left with the recorded deadline.
+func replayAdded(typ engine.ValueType, deadline time.Time, fn engine.UpdateFunc) engine.UpdateFunc {
+	return func(current engine.Entry, found bool) (engine.Entry, bool, error) {
+		updated, keep, err := fn(current, found && current.Type == typ)
+		updated.Deadline = deadline
+
+		return updated, keep, err
+	}
+}
+
+// replayRemoved returns the error of applying a record of removed elements,
+// which leaves a value of another type, put there by a later record, alone.
+func replayRemoved(err error) error {
+	if errors.Is(err, engine.ErrWrongType) {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/wal"
+)
+
+var errNotBatch = errors.New("storage is not a batch")
+
+// batch collects the records of the writes made through the storage Begin
+// returns, in place of a WAL.
+type batch struct {
+	parent  *Storage
+	staged  *staged
+	records []wal.Record
+}
+
+// Begin starts a batch of writes on s. The batch is a storage of its own that
+// sees what s holds along with the writes made through it, and logs none of
+// them: Commit logs them as one record and applies them to s together, so
+// that replaying the log applies all of them or none. Nothing else may write
+// the keys the batch reads or writes until it is committed or dropped. A
+// batch is not safe for concurrent use.
+func (s *Storage) Begin() (*Storage, error) {
+	if s.proposer != nil {
+		if err := s.proposer.Ready(); err != nil {
+			return nil, err
+		}
+	}
+
+	st, e := newStaged(s.engine)
+
+	//nolint:exhaustruct
+	tx := &Storage{
+		engine:    e,
+		logger:    s.logger,
+		historian: s.historian,
+		batch:     &batch{parent: s, staged: st, records: nil},
+	}
+	if s.expirer != nil {
+		tx.expirer = st
+	}
+
+	return tx, nil
+}
+
+// Commit logs the writes of a batch started by Begin as one record and
+// applies them to the storage the batch was started on, or proposes the
+// record if that storage has a Proposer. A batch without writes commits
+// nothing.
+func (s *Storage) Commit(opts ...WriteOption) error {
+	b := s.batch
+	if b == nil {
+		return errNotBatch
+	}
+
+	if len(b.records) == 0 {
+		return nil
+	}
+
+	parent, args := b.parent, batchArgs(b.records)
+	if parent.proposer != nil {
+		_, err := parent.proposer.Propose(wal.OperationBatch, args...)
+		return err
+	}
+
+	return parent.write(opts, func() error {
+		return parent.makeRoomFor(b.staged.pairs())
+	}, func() error {
+		parent.batchMtx.Lock()
+		defer parent.batchMtx.Unlock()
+
+		_, err := Apply(parent.engine, wal.OperationBatch, args)
+		return err
+	}, wal.OperationBatch, args...)
+}
+
+// write stands in for writeLogged on a batch: the write is made on the
+// staged engine and its record kept for Commit.
+func (b *batch) write(check func() error, apply func(log logFunc) error) error {
+	if check != nil {
+		if err := check(); err != nil {
+			return err
+		}
+	}
+
+	return apply(func(op wal.Operation, args ...string) error {
+		b.records = append(b.records, wal.Record{LSN: 0, Operation: op, Args: args})
+		return nil
+	})
+}
+
+// batchArgs encodes records as the arguments of an OperationBatch record:
+// the operation and the number of arguments of every record, followed by its
+// arguments.
+func batchArgs(records []wal.Record) []string {
+	var args []string
+	for _, record := range records {
+		args = append(args, strconv.Itoa(int(record.Operation)), strconv.Itoa(len(record.Args)))
+		args = append(args, record.Args...)
+	}
+
+	return args
+}
+
+func batchRecords(args []string) ([]wal.Record, error) {
+	var records []wal.Record
+	for len(args) > 0 {
+		if len(args) < 2 {
+			return nil, fmt.Errorf("%w: truncated batch", ErrInvalidOperation)
+		}
+
+		op, err := strconv.ParseUint(args[0], 10, 8)
+		if err != nil || wal.Operation(op) == wal.OperationBatch {
+			return nil, fmt.Errorf("%w: invalid batched operation %q", ErrInvalidOperation, args[0])
+		}
+
+		count, err := strconv.Atoi(args[1])
+		if err != nil || count < 0 || count > len(args)-2 {
+			return nil, fmt.Errorf("%w: invalid batched argument count %q", ErrInvalidOperation, args[1])
+		}
+
+		records = append(records, wal.Record{LSN: 0, Operation: wal.Operation(op), Args: args[2 : 2+count]})
+		args = args[2+count:]
+	}
+
+	return records, nil
+}
@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine/ordered"
+	"go.uber.org/zap"
+)
+
+func TestStorage_Batch(t *testing.T) {
+	dir := t.TempDir()
+
+	s := newTestStorage(t, dir)
+	if err := s.Set("balance", "10"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.RPush("queue", []string{"a", "b"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := s.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := tx.IncrBy("balance", 5); err != nil || n != 15 {
+		t.Fatalf("expected 15, got %d, %v", n, err)
+	}
+	if _, err := tx.LPop("queue", 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.HSet("user", []string{"name", "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Del("missing"); err != nil {
+		t.Fatal(err)
+	}
+
+	if value, err := s.Get("balance"); err != nil || value != "10" {
+		t.Errorf("expected the batch not to be applied before commit, got %q, %v", value, err)
+	}
+	if elements, err := s.LRange("queue", 0, -1); err != nil || !slices.Equal(elements, []string{"a", "b"}) {
+		t.Errorf("expected [a b], got %v, %v", elements, err)
+	}
+
+	lastLSN := s.LastLSN()
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if s.LastLSN() != lastLSN+1 {
+		t.Errorf("expected the batch to be logged as one record, got %d records", s.LastLSN()-lastLSN)
+	}
+	if err := s.Commit(); !errors.Is(err, errNotBatch) {
+		t.Errorf("expected error %v, got %v", errNotBatch, err)
+	}
+
+	dropped, err := s.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dropped.Set("balance", "0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s = newTestStorage(t, dir)
+	//nolint:errcheck
+	defer s.Close()
+
+	if value, err := s.Get("balance"); err != nil || value != "15" {
+		t.Errorf("expected 15, got %q, %v", value, err)
+	}
+	if elements, err := s.LRange("queue", 0, -1); err != nil || !slices.Equal(elements, []string{"b"}) {
+		t.Errorf("expected [b], got %v, %v", elements, err)
+	}
+	if value, err := s.HGet("user", "name"); err != nil || value != "alice" {
+		t.Errorf("expected alice, got %q, %v", value, err)
+	}
+}
+
+func TestStorage_BatchRangeAndScan(t *testing.T) {
+	e, err := ordered.NewOrderedEngine(zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewStorage(e, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"a", "c", "e"} {
+		if err := s.Set(key, "old"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tx, err := s.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Set("b", "new"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Set("e", "new"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Del("c"); err != nil {
+		t.Fatal(err)
+	}
+
+	keys := func(entries []engine.Entry) []string {
+		var keys []string
+		for _, entry := range entries {
+			keys = append(keys, string(entry.Key)+"="+string(entry.Value))
+		}
+		return keys
+	}
+
+	entries, err := tx.Range("", "", false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a=old", "b=new", "e=new"}; !slices.Equal(keys(entries), want) {
+		t.Errorf("expected %v, got %v", want, keys(entries))
+	}
+
+	entries, err = tx.Range("", "", true, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"e=new", "b=new"}; !slices.Equal(keys(entries), want) {
+		t.Errorf("expected %v, got %v", want, keys(entries))
+	}
+
+	var scanned []string
+	cursor := ""
+	for {
+		keys, next, err := tx.Scan(cursor, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scanned = append(scanned, keys...)
+
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if want := []string{"a", "b", "e"}; !slices.Equal(scanned, want) {
+		t.Errorf("expected %v, got %v", want, scanned)
+	}
+
+	if err := tx.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if entries, err := tx.Range("", "", false, 0); err != nil || len(entries) != 0 {
+		t.Errorf("expected no keys after flush, got %v, %v", keys(entries), err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get("a"); !errors.Is(err, engine.ErrKeyNotFound) {
+		t.Errorf("expected error %v, got %v", engine.ErrKeyNotFound, err)
+	}
+}
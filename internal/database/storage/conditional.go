@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"errors"
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+)
+
+var errNotSet = errors.New("condition not met")
+
+// SetCondition tells SetIf which keys it may set.
+type SetCondition uint8
+
+const (
+	SetAlways SetCondition = iota
+	SetIfMissing
+	SetIfExists
+)
+
+// SetOptions are what SetIf does besides storing the value.
+type SetOptions struct {
+	Condition SetCondition
+	// Deadline is when the key expires. Zero means never, unless KeepTTL is
+	// set, in which case the key keeps the deadline it had.
+	Deadline time.Time
+	KeepTTL  bool
+	// Get returns the value the key held. A key holding something else than a
+	// string is then left alone and SetIf fails with engine.ErrWrongType.
+	Get bool
+}
+
+// SetResult tells what SetIf did: whether it stored the value and, if asked
+// for, the value the key held before.
+type SetResult struct {
+	Set     bool
+	Old     string
+	Existed bool
+}
+
+// SetIf stores value at key if the key meets the condition, deciding and
+// storing in one step. The WAL records the value that was stored rather than
+// the condition, so that replaying it gives the same result whatever expired
+// since.
+func (s *Storage) SetIf(key, value string, setOpts SetOptions, opts ...WriteOption) (SetResult, error) {
+	var result SetResult
+	err := s.updateRecorded(opts, key, setIf(value, setOpts, &result), stringRecord)
+	if errors.Is(err, errNotSet) {
+		return result, nil
+	}
+
+	return result, err
+}
+
+func setIf(value string, o SetOptions, result *SetResult) engine.UpdateFunc {
+	return func(current engine.Entry, found bool) (engine.Entry, bool, error) {
+		*result = SetResult{Set: false, Old: "", Existed: found}
+
+		if o.Get && found {
+			if current.Type != engine.TypeString {
+				return engine.Entry{}, false, engine.ErrWrongType
+			}
+			result.Old = string(current.Value)
+		}
+
+		if o.Condition == SetIfMissing && found || o.Condition == SetIfExists && !found {
+			return engine.Entry{}, false, errNotSet
+		}
+
+		deadline := o.Deadline
+		if o.KeepTTL {
+			deadline = current.Deadline
+		}
+
+		result.Set = true
+		return engine.Entry{Key: current.Key, Value: []byte(value), Object: nil, Type: engine.TypeString, Deadline: deadline}, true, nil
+	}
+}
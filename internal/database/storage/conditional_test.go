@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+)
+
+func TestStorage_SetIf(t *testing.T) {
+	s := newTestStorage(t, t.TempDir())
+	//nolint:errcheck
+	defer s.Close()
+
+	deadline := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+
+	steps := []struct {
+		name  string
+		key   string
+		value string
+		opts  SetOptions
+		want  SetResult
+	}{
+		{"XX on a missing key", "lock", "a", SetOptions{Condition: SetIfExists, Get: true}, SetResult{Set: false, Old: "", Existed: false}},
+		{"NX on a missing key", "lock", "a", SetOptions{Condition: SetIfMissing, Deadline: deadline}, SetResult{Set: true, Old: "", Existed: false}},
+		{"NX on an existing key", "lock", "b", SetOptions{Condition: SetIfMissing, Get: true}, SetResult{Set: false, Old: "a", Existed: true}},
+		{"XX keeping the deadline", "lock", "c", SetOptions{Condition: SetIfExists, KeepTTL: true, Get: true}, SetResult{Set: true, Old: "a", Existed: true}},
+	}
+
+	for _, step := range steps {
+		got, err := s.SetIf(step.key, step.value, step.opts)
+		if err != nil || got != step.want {
+			t.Fatalf("%s: expected %+v, got %+v, %v", step.name, step.want, got, err)
+		}
+	}
+
+	if value, err := s.Get("lock"); err != nil || value != "c" {
+		t.Errorf("expected c, got %q, %v", value, err)
+	}
+	if got, err := s.Deadline("lock"); err != nil || !got.Equal(deadline) {
+		t.Errorf("expected deadline %v to be kept, got %v, %v", deadline, got, err)
+	}
+
+	if _, err := s.RPush("queue", []string{"a"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SetIf("queue", "x", SetOptions{Get: true}); !errors.Is(err, engine.ErrWrongType) {
+		t.Errorf("expected error %v, got %v", engine.ErrWrongType, err)
+	}
+	if got, err := s.SetIf("queue", "x", SetOptions{}); err != nil || !got.Set {
+		t.Errorf("expected SET without GET to replace a list, got %+v, %v", got, err)
+	}
+}
+
+// A conditional SET is logged as the value it stored, so replaying it after
+// the key it replaced has expired still stores it.
+func TestStorage_SetIfReplaysAfterExpiration(t *testing.T) {
+	dir := t.TempDir()
+
+	s := newTestStorage(t, dir)
+	if err := s.SetWithDeadline("lock", "a", time.Now().Add(50*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.SetIf("lock", "b", SetOptions{Condition: SetIfExists}); err != nil || !got.Set {
+		t.Fatalf("expected XX to set an existing key, got %+v, %v", got, err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	s = newTestStorage(t, dir)
+	//nolint:errcheck
+	defer s.Close()
+
+	if value, err := s.Get("lock"); err != nil || value != "b" {
+		t.Errorf("expected b, got %q, %v", value, err)
+	}
+}
@@ -0,0 +1,547 @@
+package btree
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+	"go.uber.org/zap"
+)
+
+const (
+	Name = "btree"
+
+	fileName        = "btree.db"
+	defaultPageSize = 4096
+)
+
+var ErrClosed = errors.New("btree engine is closed")
+
+// Config.PageSize only applies when the file is created; an existing file
+// keeps the page size it was created with.
+type Config struct {
+	DataDirectory string `mapstructure:"data_directory" validate:"required"`
+	PageSize      int    `mapstructure:"page_size" validate:"omitempty,min=1024,max=65536"`
+}
+
+func init() {
+	engine.Register(Name, NewBTreeEngine)
+}
+
+// BTreeEngine keeps its data in a single paged file organized as a B+tree.
+// Reads walk the tree through a read-only memory map; writes go through
+// copy-on-write transactions, one at a time.
+type BTreeEngine struct {
+	logger *zap.Logger
+	file   *os.File
+
+	// writeMtx serializes write transactions and guards the freelist and the
+	// versions of keys.
+	writeMtx sync.Mutex
+	freelist *freelist
+	versions engine.Versions
+
+	// mtx guards the memory map, the current meta page and the transactions
+	// pinned by snapshots. Remapping and publishing a commit take it
+	// exclusively, so a reader holding it never sees pages being reused.
+	mtx    sync.RWMutex
+	data   []byte
+	meta   meta
+	pinned map[uint64]int
+	closed bool
+
+	// expireCursor is where DeleteExpired continues scanning. It is guarded
+	// by writeMtx.
+	expireCursor string
+}
+
+func NewBTreeEngine(cfg *Config, logger *zap.Logger) (engine.Engine, error) {
+	if cfg == nil {
+		return nil, errors.New("btree config is nil")
+	}
+
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	pageSize := cfg.PageSize
+	if pageSize == 0 {
+		pageSize = defaultPageSize
+	}
+
+	//nolint:gosec
+	if err := os.MkdirAll(cfg.DataDirectory, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create btree directory: %w", err)
+	}
+
+	path := filepath.Join(cfg.DataDirectory, fileName)
+	//nolint:gosec
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open btree file: %w", err)
+	}
+
+	//nolint:exhaustruct
+	e := &BTreeEngine{
+		logger: logger,
+		file:   file,
+		pinned: make(map[uint64]int),
+	}
+
+	if err := e.open(pageSize); err != nil {
+		//nolint:errcheck
+		e.munmap()
+		//nolint:errcheck
+		file.Close()
+		return nil, err
+	}
+
+	logger.Info(
+		"btree engine opened",
+		zap.String("path", path),
+		zap.Uint32("page_size", e.meta.pageSize),
+		zap.Uint64("pages", uint64(e.meta.pageCount)),
+	)
+
+	return e, nil
+}
+
+func (e *BTreeEngine) open(pageSize int) error {
+	info, err := e.file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat btree file: %w", err)
+	}
+
+	size := info.Size()
+	if size == 0 {
+		if err := e.init(pageSize); err != nil {
+			return err
+		}
+		size = int64(4 * pageSize)
+	}
+
+	m, err := e.readMeta(pageSize)
+	if err != nil {
+		return err
+	}
+	e.meta = m
+
+	// The file is grown before any page past its end is written, so a valid
+	// meta page never points beyond it.
+	if size < int64(m.pageCount)*int64(m.pageSize) {
+		return fmt.Errorf("%w: file is shorter than its %d pages", ErrCorrupted, m.pageCount)
+	}
+
+	if err := e.mmap(size); err != nil {
+		return err
+	}
+
+	p, err := e.page(m, m.freelist)
+	if err != nil {
+		return err
+	}
+	e.freelist, err = decodeFreelist(p)
+
+	return err
+}
+
+// init writes an empty tree: both meta pages, an empty freelist and an empty
+// root leaf.
+func (e *BTreeEngine) init(pageSize int) error {
+	buf := make([]byte, 4*pageSize)
+
+	//nolint:gosec
+	m := meta{pageSize: uint32(pageSize), root: 3, freelist: 2, pageCount: 4, txid: 0}
+	for i := range 2 {
+		m.txid = uint64(i)
+		m.encode(page(buf[i*pageSize:]))
+	}
+	newFreelist().encode(page(buf[2*pageSize:]), 0)
+	(&node{id: 3, overflow: 0, leaf: true, dirty: false, inodes: nil}).encode(page(buf[3*pageSize:]), 0)
+
+	if _, err := e.file.WriteAt(buf, 0); err != nil {
+		return fmt.Errorf("failed to initialize btree file: %w", err)
+	}
+
+	if err := e.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync btree file: %w", err)
+	}
+
+	return nil
+}
+
+// readMeta returns the newest valid meta page. The first one is always at
+// the start of the file; the page size it records locates the second one.
+func (e *BTreeEngine) readMeta(pageSize int) (meta, error) {
+	buf := make([]byte, metaSize)
+
+	if _, err := e.file.ReadAt(buf, 0); err != nil {
+		return meta{}, fmt.Errorf("failed to read btree meta: %w", err)
+	}
+	first, firstErr := decodeMeta(buf)
+	if firstErr == nil {
+		pageSize = int(first.pageSize)
+	}
+
+	if _, err := e.file.ReadAt(buf, int64(pageSize)); err != nil {
+		return meta{}, fmt.Errorf("failed to read btree meta: %w", err)
+	}
+	second, secondErr := decodeMeta(buf)
+
+	switch {
+	case firstErr != nil && secondErr != nil:
+		return meta{}, firstErr
+	case firstErr != nil:
+		return second, nil
+	case secondErr != nil, first.txid > second.txid:
+		return first, nil
+	default:
+		return second, nil
+	}
+}
+
+// page returns the run of pages starting at id. It must be called with mtx
+// held, or by the writer.
+func (e *BTreeEngine) page(m meta, id pgid) (page, error) {
+	if id < 2 || id >= m.pageCount {
+		return nil, fmt.Errorf("%w: page %d out of bounds", ErrCorrupted, id)
+	}
+
+	pageSize := uint64(m.pageSize)
+	start := uint64(id) * pageSize
+	overflow := uint64(page(e.data[start:]).overflow())
+	if uint64(id)+overflow >= uint64(m.pageCount) {
+		return nil, fmt.Errorf("%w: page %d overflows the file", ErrCorrupted, id)
+	}
+
+	return e.data[start : start+(overflow+1)*pageSize], nil
+}
+
+func (e *BTreeEngine) Get(key []byte) ([]byte, error) {
+	return engine.StringValue(e.GetEntry(key))
+}
+
+func (e *BTreeEngine) GetEntry(key []byte) (engine.Entry, error) {
+	e.mtx.RLock()
+	defer e.mtx.RUnlock()
+
+	if e.closed {
+		return engine.Entry{}, ErrClosed
+	}
+
+	entry, deadline, ok, err := e.lookup(e.meta, key)
+	if err != nil {
+		return engine.Entry{}, err
+	}
+
+	if !ok || expired(deadline, time.Now().UnixNano()) {
+		return engine.Entry{}, engine.ErrKeyNotFound
+	}
+
+	return entry, nil
+}
+
+// lookup walks the tree of m straight through the memory map and returns a
+// copy of the entry of key along with its raw deadline. It must be called
+// with mtx held.
+func (e *BTreeEngine) lookup(m meta, key []byte) (engine.Entry, int64, bool, error) {
+	id := m.root
+	for {
+		p, err := e.page(m, id)
+		if err != nil {
+			return engine.Entry{}, 0, false, err
+		}
+
+		switch flags := p.flags(); {
+		case flags == branchPageFlag:
+			i, err := searchPage(p, func(i int) (bool, error) {
+				elemKey, _, err := p.branchElement(i)
+				return bytes.Compare(elemKey, key) > 0, err
+			})
+			if err != nil {
+				return engine.Entry{}, 0, false, err
+			}
+
+			_, child, err := p.branchElement(max(i-1, 0))
+			if err != nil {
+				return engine.Entry{}, 0, false, err
+			}
+			id = child
+		case isLeaf(flags):
+			i, err := searchPage(p, func(i int) (bool, error) {
+				elemKey, _, _, _, err := p.leafElement(i)
+				return bytes.Compare(elemKey, key) >= 0, err
+			})
+			if err != nil || i == p.count() {
+				return engine.Entry{}, 0, false, err
+			}
+
+			elemKey, value, deadline, typ, err := p.leafElement(i)
+			if err != nil || !bytes.Equal(elemKey, key) {
+				return engine.Entry{}, 0, false, err
+			}
+
+			entry := engine.Entry{Key: bytes.Clone(key), Value: bytes.Clone(value), Object: nil, Type: typ, Deadline: deadlineTime(deadline)}
+			return entry, deadline, true, nil
+		default:
+			return engine.Entry{}, 0, false, fmt.Errorf("%w: page %d is not a node", ErrCorrupted, id)
+		}
+	}
+}
+
+// searchPage is sort.Search over the elements of a page with an error.
+func searchPage(p page, f func(i int) (bool, error)) (int, error) {
+	lo, hi := 0, p.count()
+	for lo < hi {
+		mid := int(uint(lo+hi) >> 1)
+
+		ok, err := f(mid)
+		if err != nil {
+			return 0, err
+		}
+
+		if ok {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+
+	return lo, nil
+}
+
+func (e *BTreeEngine) Set(key, value []byte) error {
+	return e.update(func(tx *tx) error {
+		return tx.put(string(key), string(value), engine.TypeString, 0)
+	})
+}
+
+func (e *BTreeEngine) Del(key []byte) error {
+	return e.update(func(tx *tx) error {
+		_, err := tx.del(string(key))
+		return err
+	})
+}
+
+func (e *BTreeEngine) Update(key []byte, fn engine.UpdateFunc) error {
+	return e.update(func(tx *tx) error {
+		current := engine.Entry{Key: bytes.Clone(key), Value: nil, Object: nil, Type: engine.TypeString, Deadline: time.Time{}}
+		in, err := tx.getVisible(string(key))
+		found := err == nil
+		switch {
+		case found:
+			current.Value = []byte(in.value)
+			current.Type = in.typ
+			current.Deadline = deadlineTime(in.deadline)
+		case !errors.Is(err, engine.ErrKeyNotFound):
+			return err
+		}
+
+		updated, keep, err := fn(current, found)
+		if err != nil {
+			return err
+		}
+
+		if !keep {
+			_, err := tx.del(string(key))
+			return err
+		}
+
+		return tx.put(string(key), string(updated.Encoded().Value), updated.Type, deadlineNanos(updated.Deadline))
+	})
+}
+
+// Version returns the version of key, or that of its deletion if it does not
+// exist. A write transaction that fails to commit may still have given its
+// keys new versions, which only makes them look changed.
+func (e *BTreeEngine) Version(key []byte) (uint64, error) {
+	e.writeMtx.Lock()
+	defer e.writeMtx.Unlock()
+
+	if _, err := e.GetEntry(key); errors.Is(err, engine.ErrKeyNotFound) {
+		return e.versions.Missing(string(key)), nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	return e.versions.Get(string(key)), nil
+}
+
+func (e *BTreeEngine) KeepHistory(limits engine.HistoryLimits) {
+	e.writeMtx.Lock()
+	defer e.writeMtx.Unlock()
+
+	e.versions.KeepHistory(limits)
+}
+
+// History returns the revisions of key, newest first.
+func (e *BTreeEngine) History(key []byte, limit int) ([]engine.Revision, error) {
+	e.writeMtx.Lock()
+	defer e.writeMtx.Unlock()
+
+	return e.versions.History(string(key), limit), nil
+}
+
+func (e *BTreeEngine) CompactHistory(now time.Time, limit int) (int, bool) {
+	e.writeMtx.Lock()
+	defer e.writeMtx.Unlock()
+
+	return e.versions.CompactHistory(now, limit)
+}
+
+// Clear drops every key. The file keeps its size; freed pages are reused.
+func (e *BTreeEngine) Clear() error {
+	return e.update(func(tx *tx) error {
+		return tx.clear()
+	})
+}
+
+// update runs fn in a write transaction and commits it if it changed the
+// tree.
+func (e *BTreeEngine) update(fn func(tx *tx) error) error {
+	e.writeMtx.Lock()
+	defer e.writeMtx.Unlock()
+
+	if e.closed {
+		return ErrClosed
+	}
+
+	m := e.meta
+	m.txid++
+
+	root, err := e.page(m, m.root)
+	if err != nil {
+		return err
+	}
+	rootNode, err := decodeNode(m.root, root)
+	if err != nil {
+		return err
+	}
+
+	tx := &tx{engine: e, meta: m, freelist: e.freelist.clone(), root: rootNode, pages: make(map[pgid]page)}
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	if !tx.root.dirty {
+		return nil
+	}
+
+	return tx.commit()
+}
+
+// commit makes the pages of tx durable, then writes its meta page over the
+// older of the two and publishes it to readers.
+func (e *BTreeEngine) commit(tx *tx) error {
+	pageSize := int64(tx.meta.pageSize)
+
+	if err := e.grow(int64(tx.meta.pageCount) * pageSize); err != nil {
+		return err
+	}
+
+	for id, p := range tx.pages {
+		if _, err := e.file.WriteAt(p, int64(id)*pageSize); err != nil {
+			return fmt.Errorf("failed to write btree page: %w", err)
+		}
+	}
+
+	if err := e.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync btree file: %w", err)
+	}
+
+	buf := make(page, metaSize)
+	tx.meta.encode(buf)
+	//nolint:gosec
+	if _, err := e.file.WriteAt(buf, int64(tx.meta.txid%2)*pageSize); err != nil {
+		return fmt.Errorf("failed to write btree meta: %w", err)
+	}
+
+	if err := e.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync btree file: %w", err)
+	}
+
+	e.mtx.Lock()
+	e.meta = tx.meta
+	e.freelist = tx.freelist
+	e.freelist.release(e.oldestPinned())
+	e.mtx.Unlock()
+
+	return nil
+}
+
+// oldestPinned returns the oldest transaction a snapshot still reads from.
+// It must be called with mtx held.
+func (e *BTreeEngine) oldestPinned() uint64 {
+	oldest := uint64(math.MaxUint64)
+	for txid := range e.pinned {
+		oldest = min(oldest, txid)
+	}
+
+	return oldest
+}
+
+// grow extends the file and the memory map so that they hold at least size
+// bytes. It must be called by the writer.
+func (e *BTreeEngine) grow(size int64) error {
+	if size <= int64(len(e.data)) {
+		return nil
+	}
+
+	size = mmapSize(size)
+	if err := e.file.Truncate(size); err != nil {
+		return fmt.Errorf("failed to grow btree file: %w", err)
+	}
+
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	if err := e.munmap(); err != nil {
+		return err
+	}
+
+	return e.mmap(size)
+}
+
+// mmapSize doubles the mapping up to 1GB and then grows it 1GB at a time, so
+// that a growing file is rarely remapped.
+func mmapSize(size int64) int64 {
+	const (
+		minSize = 32 << 10
+		maxStep = 1 << 30
+	)
+
+	if size <= maxStep {
+		grown := int64(minSize)
+		for grown < size {
+			grown *= 2
+		}
+		return grown
+	}
+
+	return (size + maxStep - 1) / maxStep * maxStep
+}
+
+func (e *BTreeEngine) Close() error {
+	e.writeMtx.Lock()
+	defer e.writeMtx.Unlock()
+
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+
+	return errors.Join(e.munmap(), e.file.Close())
+}
+
+func expired(deadline, now int64) bool {
+	return deadline != 0 && now >= deadline
+}
@@ -0,0 +1,142 @@
+package btree
+
+import (
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+	"go.uber.org/zap"
+)
+
+// expireScanFactor bounds how many keys DeleteExpired walks past per key
+// with a deadline it samples, since keys without one are stored alongside.
+const expireScanFactor = 10
+
+func (e *BTreeEngine) SetWithDeadline(key, value []byte, deadline time.Time) error {
+	return e.update(func(tx *tx) error {
+		return tx.put(string(key), string(value), engine.TypeString, deadlineNanos(deadline))
+	})
+}
+
+func (e *BTreeEngine) Expire(key []byte, deadline time.Time) error {
+	return e.update(func(tx *tx) error {
+		in, err := tx.getVisible(string(key))
+		if err != nil {
+			return err
+		}
+
+		return tx.put(in.key, in.value, in.typ, deadlineNanos(deadline))
+	})
+}
+
+func (e *BTreeEngine) Persist(key []byte) (bool, error) {
+	persisted := false
+	err := e.update(func(tx *tx) error {
+		in, err := tx.getVisible(string(key))
+		if err != nil || in.deadline == 0 {
+			return err
+		}
+
+		persisted = true
+		return tx.put(in.key, in.value, in.typ, 0)
+	})
+
+	return persisted, err
+}
+
+func (e *BTreeEngine) Deadline(key []byte) (time.Time, error) {
+	e.mtx.RLock()
+	defer e.mtx.RUnlock()
+
+	if e.closed {
+		return time.Time{}, ErrClosed
+	}
+
+	_, deadline, ok, err := e.lookup(e.meta, key)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if !ok || expired(deadline, time.Now().UnixNano()) {
+		return time.Time{}, engine.ErrKeyNotFound
+	}
+
+	return deadlineTime(deadline), nil
+}
+
+func (tx *tx) getVisible(key string) (inode, error) {
+	in, ok, err := tx.get(key)
+	if err != nil {
+		return inode{}, err
+	}
+
+	if !ok || expired(in.deadline, time.Now().UnixNano()) {
+		return inode{}, engine.ErrKeyNotFound
+	}
+
+	return in, nil
+}
+
+// DeleteExpired walks the tree from where the previous call stopped, as the
+// file keeps no separate index of keys with a deadline, and wraps around at
+// the end.
+func (e *BTreeEngine) DeleteExpired(now time.Time, samples int) (int, int) {
+	nanos := now.UnixNano()
+	sampled, deleted := 0, 0
+
+	err := e.update(func(tx *tx) error {
+		var expiredKeys []string
+
+		visited, next := 0, ""
+		err := e.scan(e.meta, e.expireCursor, func(in inode) (bool, error) {
+			if sampled == samples || visited == samples*expireScanFactor {
+				next = in.key
+				return false, nil
+			}
+			visited++
+
+			if in.deadline != 0 {
+				sampled++
+				if expired(in.deadline, nanos) {
+					expiredKeys = append(expiredKeys, in.key)
+				}
+			}
+
+			return true, nil
+		})
+		if err != nil {
+			return err
+		}
+		e.expireCursor = next
+
+		for _, key := range expiredKeys {
+			if _, err := tx.del(key); err != nil {
+				return err
+			}
+		}
+		deleted = len(expiredKeys)
+
+		return nil
+	})
+	if err != nil {
+		e.logger.Error("failed to delete expired keys", zap.Error(err))
+		return sampled, 0
+	}
+
+	return sampled, deleted
+}
+
+func deadlineNanos(deadline time.Time) int64 {
+	if deadline.IsZero() {
+		return 0
+	}
+
+	return deadline.UnixNano()
+}
+
+func deadlineTime(nanos int64) time.Time {
+	if nanos == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, nanos)
+}
@@ -0,0 +1,111 @@
+package btree
+
+import (
+	"encoding/binary"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// freelist tracks pages that no longer belong to the tree. Pages freed by a
+// transaction stay pending until no reader can still reach them through an
+// older meta page, and only then become free for reuse.
+type freelist struct {
+	ids     []pgid
+	pending map[uint64][]pgid
+}
+
+func newFreelist() *freelist {
+	return &freelist{ids: nil, pending: make(map[uint64][]pgid)}
+}
+
+func (f *freelist) clone() *freelist {
+	pending := make(map[uint64][]pgid, len(f.pending))
+	for txid, ids := range f.pending {
+		pending[txid] = slices.Clone(ids)
+	}
+
+	return &freelist{ids: slices.Clone(f.ids), pending: pending}
+}
+
+// allocate takes n contiguous free pages and returns the first of them, or 0
+// if there is no such run.
+func (f *freelist) allocate(n int) pgid {
+	start := 0
+	for i := range f.ids {
+		if i > 0 && f.ids[i] != f.ids[i-1]+1 {
+			start = i
+		}
+		if i-start+1 == n {
+			id := f.ids[start]
+			f.ids = slices.Delete(f.ids, start, i+1)
+			return id
+		}
+	}
+
+	return 0
+}
+
+// free marks the run of pages starting at id as freed by txid.
+func (f *freelist) free(txid uint64, id pgid, overflow uint32) {
+	for i := range pgid(overflow) + 1 {
+		f.pending[txid] = append(f.pending[txid], id+i)
+	}
+}
+
+// release makes the pages freed by transactions up to txid reusable.
+func (f *freelist) release(txid uint64) {
+	for pending, ids := range f.pending {
+		if pending <= txid {
+			f.ids = append(f.ids, ids...)
+			delete(f.pending, pending)
+		}
+	}
+	slices.Sort(f.ids)
+}
+
+// all returns the free and pending pages. Once the file is reopened there are
+// no readers left, so pending pages are free as well.
+func (f *freelist) all() []pgid {
+	ids := slices.Clone(f.ids)
+	for _, txid := range slices.Sorted(maps.Keys(f.pending)) {
+		ids = append(ids, f.pending[txid]...)
+	}
+	slices.Sort(ids)
+
+	return ids
+}
+
+func freelistSize(count int) int {
+	return pageHeaderSize + 8 + count*8
+}
+
+func (f *freelist) encode(p page, overflow uint32) {
+	ids := f.all()
+
+	p.setHeader(freelistPageFlag, 0, overflow)
+	binary.BigEndian.PutUint64(p[pageHeaderSize:], uint64(len(ids)))
+	for i, id := range ids {
+		binary.BigEndian.PutUint64(p[pageHeaderSize+8+i*8:], uint64(id))
+	}
+}
+
+func decodeFreelist(p page) (*freelist, error) {
+	if len(p) < pageHeaderSize+8 || p.flags() != freelistPageFlag {
+		return nil, fmt.Errorf("%w: invalid freelist page", ErrCorrupted)
+	}
+
+	count := binary.BigEndian.Uint64(p[pageHeaderSize:])
+	if count > uint64(len(p)-pageHeaderSize-8)/8 {
+		return nil, fmt.Errorf("%w: truncated freelist", ErrCorrupted)
+	}
+
+	f := newFreelist()
+	f.ids = make([]pgid, 0, count)
+	for i := range int(count) {
+		f.ids = append(f.ids, pgid(binary.BigEndian.Uint64(p[pageHeaderSize+8+i*8:])))
+	}
+	slices.Sort(f.ids)
+
+	return f, nil
+}
@@ -0,0 +1,34 @@
+//go:build unix
+
+package btree
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// mmap maps the first size bytes of the file read-only. Writes go through the
+// file, and the shared mapping sees them once they are written.
+func (e *BTreeEngine) mmap(size int64) error {
+	//nolint:gosec
+	data, err := syscall.Mmap(int(e.file.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return fmt.Errorf("failed to map btree file: %w", err)
+	}
+	e.data = data
+
+	return nil
+}
+
+func (e *BTreeEngine) munmap() error {
+	if e.data == nil {
+		return nil
+	}
+
+	if err := syscall.Munmap(e.data); err != nil {
+		return fmt.Errorf("failed to unmap btree file: %w", err)
+	}
+	e.data = nil
+
+	return nil
+}
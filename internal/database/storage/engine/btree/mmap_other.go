@@ -0,0 +1,19 @@
+//go:build !unix
+
+package btree
+
+import "errors"
+
+var errMmapUnsupported = errors.New("btree engine requires mmap, which is not supported on this platform")
+
+// mmap fails on platforms without mmap, so that opening the engine reports
+// it instead of the whole server failing to build there.
+func (e *BTreeEngine) mmap(int64) error {
+	return errMmapUnsupported
+}
+
+func (e *BTreeEngine) munmap() error {
+	e.data = nil
+
+	return nil
+}
@@ -0,0 +1,146 @@
+package btree
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+)
+
+// minKeysPerPage keeps splits from producing nodes that hold a single large
+// element, which would let a tree of huge keys grow without bound.
+const minKeysPerPage = 2
+
+// inode is an element of a node. Leaves use value, type and deadline,
+// branches use child, plus node once the child has been read by a write
+// transaction.
+type inode struct {
+	key      string
+	value    string
+	typ      engine.ValueType
+	deadline int64
+	child    pgid
+	node     *node
+}
+
+// node is the decoded, mutable form of a page used by write transactions.
+// Branch keys are the smallest key of their child.
+type node struct {
+	id       pgid
+	overflow uint32
+	leaf     bool
+	dirty    bool
+	inodes   []inode
+}
+
+func decodeNode(id pgid, p page) (*node, error) {
+	n := &node{id: id, overflow: p.overflow(), leaf: false, dirty: false, inodes: make([]inode, 0, p.count())}
+
+	switch flags := p.flags(); {
+	case isLeaf(flags):
+		n.leaf = true
+		for i := range p.count() {
+			key, value, deadline, typ, err := p.leafElement(i)
+			if err != nil {
+				return nil, err
+			}
+			n.inodes = append(n.inodes, inode{key: string(key), value: string(value), typ: typ, deadline: deadline, child: 0, node: nil})
+		}
+	case flags == branchPageFlag:
+		for i := range p.count() {
+			key, child, err := p.branchElement(i)
+			if err != nil {
+				return nil, err
+			}
+			n.inodes = append(n.inodes, inode{key: string(key), value: "", typ: engine.TypeString, deadline: 0, child: child, node: nil})
+		}
+	default:
+		return nil, fmt.Errorf("%w: page %d is not a node", ErrCorrupted, id)
+	}
+
+	return n, nil
+}
+
+// search returns the index of the first element whose key is not less than
+// key, and whether it is equal to key.
+func (n *node) search(key string) (int, bool) {
+	i := sort.Search(len(n.inodes), func(i int) bool { return n.inodes[i].key >= key })
+
+	return i, i < len(n.inodes) && n.inodes[i].key == key
+}
+
+// childIndex returns the index of the child of a branch that covers key.
+func (n *node) childIndex(key string) int {
+	i := sort.Search(len(n.inodes), func(i int) bool { return n.inodes[i].key > key })
+
+	return max(i-1, 0)
+}
+
+func (n *node) elementSize(in inode) int {
+	if n.leaf {
+		return offsetSize + leafElementSize + len(in.key) + len(in.value)
+	}
+
+	return offsetSize + branchElementSize + len(in.key)
+}
+
+func (n *node) size() int {
+	size := pageHeaderSize
+	for _, in := range n.inodes {
+		size += n.elementSize(in)
+	}
+
+	return size
+}
+
+// split divides the elements of a node into runs that fit a page each, unless
+// a run would then hold fewer than minKeysPerPage elements.
+func (n *node) split(pageSize int) [][]inode {
+	var chunks [][]inode
+
+	start, size := 0, pageHeaderSize
+	for i, in := range n.inodes {
+		elementSize := n.elementSize(in)
+		if (i-start >= minKeysPerPage && size+elementSize > pageSize) || i-start == maxElements {
+			chunks = append(chunks, n.inodes[start:i])
+			start, size = i, pageHeaderSize
+		}
+		size += elementSize
+	}
+
+	return append(chunks, n.inodes[start:])
+}
+
+// encode writes the elements of n into p, which must be large enough.
+func (n *node) encode(p page, overflow uint32) {
+	flags := branchPageFlag
+	if n.leaf {
+		flags = leafPageFlag
+	}
+	p.setHeader(flags, len(n.inodes), overflow)
+
+	offset := pageHeaderSize + len(n.inodes)*offsetSize
+	for i, in := range n.inodes {
+		//nolint:gosec
+		binary.BigEndian.PutUint32(p[pageHeaderSize+i*offsetSize:], uint32(offset))
+
+		elem := p[offset:]
+		//nolint:gosec
+		binary.BigEndian.PutUint32(elem[0:4], uint32(len(in.key)))
+		if n.leaf {
+			//nolint:gosec
+			binary.BigEndian.PutUint32(elem[4:8], uint32(len(in.value)))
+			//nolint:gosec
+			binary.BigEndian.PutUint64(elem[8:16], uint64(in.deadline))
+			elem[16] = byte(in.typ)
+			copy(elem[leafElementSize:], in.key)
+			copy(elem[leafElementSize+len(in.key):], in.value)
+		} else {
+			binary.BigEndian.PutUint64(elem[4:12], uint64(in.child))
+			copy(elem[branchElementSize:], in.key)
+		}
+
+		offset += n.elementSize(in) - offsetSize
+	}
+}
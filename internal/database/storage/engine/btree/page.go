@@ -0,0 +1,205 @@
+package btree
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+)
+
+var ErrCorrupted = errors.New("corrupted btree file")
+
+type pgid uint64
+
+// Every node is stored in a run of one or more contiguous pages:
+//
+//	header    flags (u16), element count (u16), overflow pages (u32)
+//	offsets   one u32 per element, relative to the start of the run
+//	elements  leaf:   key length (u32), value length (u32), deadline (i64),
+//	                  value type (u8), key, value
+//	          branch: key length (u32), child page (u64), key
+//
+// Leaves written before values had types have no type byte and hold only
+// strings. They keep their own flag and are rewritten in the current layout
+// the next time they change.
+//
+// Pages 0 and 1 hold the two copies of the meta page.
+const (
+	pageHeaderSize    = 8
+	offsetSize        = 4
+	leafElementSize   = 17
+	branchElementSize = 12
+
+	untypedLeafElementSize = 16
+
+	branchPageFlag      uint16 = 0x01
+	untypedLeafPageFlag uint16 = 0x02
+	metaPageFlag        uint16 = 0x04
+	leafPageFlag        uint16 = 0x08
+	freelistPageFlag    uint16 = 0x10
+
+	maxElements = 1<<16 - 1
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+type page []byte
+
+func (p page) flags() uint16 {
+	return binary.BigEndian.Uint16(p[0:2])
+}
+
+func (p page) count() int {
+	return int(binary.BigEndian.Uint16(p[2:4]))
+}
+
+func (p page) overflow() uint32 {
+	return binary.BigEndian.Uint32(p[4:8])
+}
+
+func (p page) setHeader(flags uint16, count int, overflow uint32) {
+	binary.BigEndian.PutUint16(p[0:2], flags)
+	//nolint:gosec
+	binary.BigEndian.PutUint16(p[2:4], uint16(count))
+	binary.BigEndian.PutUint32(p[4:8], overflow)
+}
+
+func (p page) element(i int) ([]byte, error) {
+	at := pageHeaderSize + i*offsetSize
+	if at+offsetSize > len(p) {
+		return nil, fmt.Errorf("%w: element %d out of bounds", ErrCorrupted, i)
+	}
+
+	offset := int(binary.BigEndian.Uint32(p[at:]))
+	if offset > len(p) {
+		return nil, fmt.Errorf("%w: element %d out of bounds", ErrCorrupted, i)
+	}
+
+	return p[offset:], nil
+}
+
+func isLeaf(flags uint16) bool {
+	return flags == leafPageFlag || flags == untypedLeafPageFlag
+}
+
+// leafElement returns the key, value, deadline and value type of the i-th
+// element of a leaf. The slices point into the page.
+func (p page) leafElement(i int) ([]byte, []byte, int64, engine.ValueType, error) {
+	elem, err := p.element(i)
+	if err != nil {
+		return nil, nil, 0, 0, err
+	}
+
+	size := leafElementSize
+	if p.flags() == untypedLeafPageFlag {
+		size = untypedLeafElementSize
+	}
+
+	if len(elem) < size {
+		return nil, nil, 0, 0, fmt.Errorf("%w: truncated leaf element", ErrCorrupted)
+	}
+
+	keyLen := uint64(binary.BigEndian.Uint32(elem[0:4]))
+	valueLen := uint64(binary.BigEndian.Uint32(elem[4:8]))
+	//nolint:gosec
+	deadline := int64(binary.BigEndian.Uint64(elem[8:16]))
+
+	typ := engine.TypeString
+	if size == leafElementSize {
+		typ = engine.ValueType(elem[16])
+	}
+
+	if uint64(len(elem)-size) < keyLen+valueLen {
+		return nil, nil, 0, 0, fmt.Errorf("%w: truncated leaf element", ErrCorrupted)
+	}
+
+	key := elem[size : uint64(size)+keyLen]
+	value := elem[uint64(size)+keyLen : uint64(size)+keyLen+valueLen]
+
+	return key, value, deadline, typ, nil
+}
+
+// branchElement returns the key and child page of the i-th element of a
+// branch. The key points into the page.
+func (p page) branchElement(i int) ([]byte, pgid, error) {
+	elem, err := p.element(i)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(elem) < branchElementSize {
+		return nil, 0, fmt.Errorf("%w: truncated branch element", ErrCorrupted)
+	}
+
+	keyLen := uint64(binary.BigEndian.Uint32(elem[0:4]))
+	child := pgid(binary.BigEndian.Uint64(elem[4:12]))
+
+	if uint64(len(elem)-branchElementSize) < keyLen {
+		return nil, 0, fmt.Errorf("%w: truncated branch element", ErrCorrupted)
+	}
+
+	return elem[branchElementSize : branchElementSize+keyLen], child, nil
+}
+
+const (
+	metaMagic   uint32 = 0x4b564254
+	metaVersion uint32 = 1
+	metaSize           = pageHeaderSize + 52
+)
+
+// meta describes one committed version of the tree. The two meta pages are
+// written alternately, so a torn write can only damage the newer one and
+// opening falls back to the other.
+type meta struct {
+	pageSize  uint32
+	root      pgid
+	freelist  pgid
+	pageCount pgid
+	txid      uint64
+}
+
+func (m meta) encode(p page) {
+	p.setHeader(metaPageFlag, 0, 0)
+
+	b := p[pageHeaderSize:metaSize]
+	binary.BigEndian.PutUint32(b[0:4], metaMagic)
+	binary.BigEndian.PutUint32(b[4:8], metaVersion)
+	binary.BigEndian.PutUint32(b[8:12], m.pageSize)
+	binary.BigEndian.PutUint64(b[16:24], uint64(m.root))
+	binary.BigEndian.PutUint64(b[24:32], uint64(m.freelist))
+	binary.BigEndian.PutUint64(b[32:40], uint64(m.pageCount))
+	binary.BigEndian.PutUint64(b[40:48], m.txid)
+	binary.BigEndian.PutUint32(b[48:52], crc32.Checksum(b[:48], crcTable))
+}
+
+func decodeMeta(p page) (meta, error) {
+	if len(p) < metaSize || p.flags() != metaPageFlag {
+		return meta{}, fmt.Errorf("%w: invalid meta page", ErrCorrupted)
+	}
+
+	b := p[pageHeaderSize:metaSize]
+	if binary.BigEndian.Uint32(b[0:4]) != metaMagic {
+		return meta{}, fmt.Errorf("%w: invalid magic", ErrCorrupted)
+	}
+	if version := binary.BigEndian.Uint32(b[4:8]); version != metaVersion {
+		return meta{}, fmt.Errorf("%w: unsupported version %d", ErrCorrupted, version)
+	}
+	if crc32.Checksum(b[:48], crcTable) != binary.BigEndian.Uint32(b[48:52]) {
+		return meta{}, fmt.Errorf("%w: meta checksum mismatch", ErrCorrupted)
+	}
+
+	m := meta{
+		pageSize:  binary.BigEndian.Uint32(b[8:12]),
+		root:      pgid(binary.BigEndian.Uint64(b[16:24])),
+		freelist:  pgid(binary.BigEndian.Uint64(b[24:32])),
+		pageCount: pgid(binary.BigEndian.Uint64(b[32:40])),
+		txid:      binary.BigEndian.Uint64(b[40:48]),
+	}
+
+	if m.pageSize < metaSize || m.root < 2 || m.root >= m.pageCount || m.freelist < 2 || m.freelist >= m.pageCount {
+		return meta{}, fmt.Errorf("%w: invalid meta page", ErrCorrupted)
+	}
+
+	return m, nil
+}
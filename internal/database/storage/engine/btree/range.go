@@ -0,0 +1,80 @@
+package btree
+
+import (
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+)
+
+// Range pins the current tree like a snapshot does, so writers are not held
+// up while fn runs.
+func (e *BTreeEngine) Range(start, end []byte, reverse bool, fn func(entry engine.Entry) bool) error {
+	from, to := string(start), string(end)
+
+	m, err := e.pin()
+	if err != nil {
+		return err
+	}
+	defer e.unpin(m)
+
+	now := time.Now().UnixNano()
+	visit := func(in inode) (bool, error) {
+		if (reverse && in.key < from) || (!reverse && to != "" && in.key >= to) {
+			return false, nil
+		}
+
+		if expired(in.deadline, now) {
+			return true, nil
+		}
+
+		return fn(engine.Entry{Key: []byte(in.key), Value: []byte(in.value), Object: nil, Type: in.typ, Deadline: deadlineTime(in.deadline)}), nil
+	}
+
+	if reverse {
+		_, err = e.scanReverseNode(m, m.root, to, visit)
+		return err
+	}
+
+	return e.scan(m, from, visit)
+}
+
+// scanReverseNode is scanNode in descending order, starting below end, or at
+// the greatest key if end is empty.
+func (e *BTreeEngine) scanReverseNode(m meta, id pgid, end string, fn func(in inode) (bool, error)) (bool, error) {
+	n, err := e.readNode(m, id)
+	if err != nil {
+		return false, err
+	}
+
+	if n.leaf {
+		i := len(n.inodes)
+		if end != "" {
+			i, _ = n.search(end)
+		}
+
+		for j := i - 1; j >= 0; j-- {
+			if ok, err := fn(n.inodes[j]); !ok || err != nil {
+				return false, err
+			}
+		}
+
+		return true, nil
+	}
+
+	if len(n.inodes) == 0 {
+		return true, nil
+	}
+
+	i := len(n.inodes) - 1
+	if end != "" {
+		i = n.childIndex(end)
+	}
+
+	for j := i; j >= 0; j-- {
+		if ok, err := e.scanReverseNode(m, n.inodes[j].child, end, fn); !ok || err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
@@ -0,0 +1,64 @@
+package btree
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+)
+
+func TestBTreeEngine_Range(t *testing.T) {
+	e := openTestEngine(t, smallPages(t))
+
+	// Enough keys to span many leaves with 1KB pages.
+	var all []string
+	for i := range 300 {
+		key := fmt.Sprintf("event:%04d", i)
+		all = append(all, key)
+		if err := e.Set([]byte(key), []byte("value")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.SetWithDeadline([]byte("event:0100x"), []byte("value"), time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	reversed := slices.Clone(all)
+	slices.Reverse(reversed)
+
+	tests := []struct {
+		name    string
+		start   string
+		end     string
+		reverse bool
+		limit   int
+		want    []string
+	}{
+		{name: "range", start: "event:0099", end: "event:0102", want: all[99:102]},
+		{name: "reverse range", start: "event:0099", end: "event:0102", reverse: true, want: []string{"event:0101", "event:0100", "event:0099"}},
+		{name: "prefix", start: "event:", end: engine.PrefixEnd("event:"), want: all},
+		{name: "reverse prefix", start: "event:", end: engine.PrefixEnd("event:"), reverse: true, want: reversed},
+		{name: "reverse with limit", start: "", end: "", reverse: true, limit: 3, want: reversed[:3]},
+		{name: "limit", start: "event:0200", end: "", limit: 5, want: all[200:205]},
+		{name: "empty", start: "f", end: "g", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			err := e.Range([]byte(tt.start), []byte(tt.end), tt.reverse, func(entry engine.Entry) bool {
+				got = append(got, string(entry.Key))
+				return tt.limit == 0 || len(got) < tt.limit
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package btree
+
+import (
+	"sync"
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+)
+
+// snapshot reads the tree of the meta page that was current when it was
+// taken. Its transaction stays pinned until it is released, which keeps the
+// pages of that tree from being reused.
+type snapshot struct {
+	engine  *BTreeEngine
+	meta    meta
+	release sync.Once
+}
+
+func (e *BTreeEngine) Snapshot() (engine.Snapshot, error) {
+	m, err := e.pin()
+	if err != nil {
+		return nil, err
+	}
+
+	//nolint:exhaustruct
+	return &snapshot{engine: e, meta: m}, nil
+}
+
+// pin returns the current meta page and keeps the pages of its tree from
+// being reused until it is unpinned.
+func (e *BTreeEngine) pin() (meta, error) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	if e.closed {
+		return meta{}, ErrClosed
+	}
+
+	e.pinned[e.meta.txid]++
+
+	return e.meta, nil
+}
+
+func (e *BTreeEngine) unpin(m meta) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	e.pinned[m.txid]--
+	if e.pinned[m.txid] == 0 {
+		delete(e.pinned, m.txid)
+	}
+}
+
+func (s *snapshot) ForEach(fn func(entry engine.Entry) error) error {
+	now := time.Now().UnixNano()
+
+	return s.engine.scan(s.meta, "", func(in inode) (bool, error) {
+		if expired(in.deadline, now) {
+			return true, nil
+		}
+
+		return true, fn(engine.Entry{Key: []byte(in.key), Value: []byte(in.value), Object: nil, Type: in.typ, Deadline: deadlineTime(in.deadline)})
+	})
+}
+
+func (s *snapshot) Release() {
+	s.release.Do(func() {
+		s.engine.unpin(s.meta)
+	})
+}
+
+// scan calls fn for the leaf elements of the tree of m in key order, starting
+// at from, until fn returns false. Every page is copied out of the memory map
+// under a read lock, so writers only wait for one page at a time; m must stay
+// pinned or writers excluded for the duration.
+func (e *BTreeEngine) scan(m meta, from string, fn func(in inode) (bool, error)) error {
+	_, err := e.scanNode(m, m.root, from, fn)
+
+	return err
+}
+
+func (e *BTreeEngine) scanNode(m meta, id pgid, from string, fn func(in inode) (bool, error)) (bool, error) {
+	n, err := e.readNode(m, id)
+	if err != nil {
+		return false, err
+	}
+
+	if n.leaf {
+		i, _ := n.search(from)
+		for _, in := range n.inodes[i:] {
+			if ok, err := fn(in); !ok || err != nil {
+				return false, err
+			}
+		}
+
+		return true, nil
+	}
+
+	if len(n.inodes) == 0 {
+		return true, nil
+	}
+
+	for _, in := range n.inodes[n.childIndex(from):] {
+		if ok, err := e.scanNode(m, in.child, from, fn); !ok || err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+func (e *BTreeEngine) readNode(m meta, id pgid) (*node, error) {
+	e.mtx.RLock()
+	defer e.mtx.RUnlock()
+
+	if e.closed {
+		return nil, ErrClosed
+	}
+
+	p, err := e.page(m, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeNode(id, p)
+}
@@ -0,0 +1,346 @@
+//nolint:exhaustruct
+package btree
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+	"go.uber.org/zap"
+)
+
+func openTestEngine(t *testing.T, cfg *Config) *BTreeEngine {
+	t.Helper()
+
+	opened, err := NewBTreeEngine(cfg, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//nolint:forcetypeassert
+	e := opened.(*BTreeEngine)
+	t.Cleanup(func() {
+		//nolint:errcheck
+		e.Close()
+	})
+
+	return e
+}
+
+// smallPages makes a few hundred keys span several levels of the tree.
+func smallPages(t *testing.T) *Config {
+	t.Helper()
+
+	return &Config{DataDirectory: t.TempDir(), PageSize: 1024}
+}
+
+func (e *BTreeEngine) depth(t *testing.T) int {
+	t.Helper()
+
+	depth := 1
+	for id := e.meta.root; ; depth++ {
+		n, err := e.readNode(e.meta, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n.leaf {
+			return depth
+		}
+		id = n.inodes[0].child
+	}
+}
+
+func TestBTreeEngine_SplitsMergesAndRecovers(t *testing.T) {
+	cfg := smallPages(t)
+	e := openTestEngine(t, cfg)
+
+	for i := range 2000 {
+		if err := e.Set([]byte("key"+strconv.Itoa(i)), []byte("value"+strconv.Itoa(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if depth := e.depth(t); depth < 3 {
+		t.Errorf("expected the tree to grow at least 3 levels, got %d", depth)
+	}
+
+	for i := range 2000 {
+		if i%10 == 0 {
+			continue
+		}
+		if err := e.Del([]byte("key" + strconv.Itoa(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	e = openTestEngine(t, cfg)
+
+	for i := range 2000 {
+		value, err := e.Get([]byte("key" + strconv.Itoa(i)))
+		if i%10 != 0 {
+			if !errors.Is(err, engine.ErrKeyNotFound) {
+				t.Fatalf("key%d: expected error %v, got %v", i, engine.ErrKeyNotFound, err)
+			}
+			continue
+		}
+		if err != nil || string(value) != "value"+strconv.Itoa(i) {
+			t.Fatalf("key%d: expected value%d, got %q, %v", i, i, value, err)
+		}
+	}
+	if depth := e.depth(t); depth > 2 {
+		t.Errorf("expected the tree to shrink after deletes, got depth %d", depth)
+	}
+}
+
+func TestBTreeEngine_LargeValues(t *testing.T) {
+	cfg := smallPages(t)
+	e := openTestEngine(t, cfg)
+
+	large := strings.Repeat("x", 5000)
+	for i := range 10 {
+		if err := e.Set([]byte("key"+strconv.Itoa(i)), []byte(large+strconv.Itoa(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := range 10 {
+		value, err := e.Get([]byte("key" + strconv.Itoa(i)))
+		if err != nil || string(value) != large+strconv.Itoa(i) {
+			t.Fatalf("key%d: unexpected value of length %d, %v", i, len(value), err)
+		}
+	}
+}
+
+func TestBTreeEngine_ReusesFreedPages(t *testing.T) {
+	cfg := smallPages(t)
+	e := openTestEngine(t, cfg)
+
+	for i := range 200 {
+		if err := e.Set([]byte("key"+strconv.Itoa(i)), []byte("value")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pages := e.meta.pageCount
+
+	for range 5 {
+		for i := range 200 {
+			if err := e.Set([]byte("key"+strconv.Itoa(i)), []byte("other")); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if e.meta.pageCount > 2*pages {
+		t.Errorf("expected overwrites to reuse pages, file grew from %d to %d pages", pages, e.meta.pageCount)
+	}
+}
+
+func TestBTreeEngine_FallsBackToPreviousMeta(t *testing.T) {
+	cfg := smallPages(t)
+	e := openTestEngine(t, cfg)
+
+	if err := e.Set([]byte("committed"), []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Set([]byte("torn"), []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	newest := e.meta
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Damage the meta page of the last commit, as a torn write would.
+	path := filepath.Join(cfg.DataDirectory, fileName)
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//nolint:gosec
+	if _, err := file.WriteAt([]byte("garbage"), int64(newest.txid%2)*int64(newest.pageSize)+pageHeaderSize); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	e = openTestEngine(t, cfg)
+	if e.meta.txid != newest.txid-1 {
+		t.Errorf("expected transaction %d, got %d", newest.txid-1, e.meta.txid)
+	}
+	if value, err := e.Get([]byte("committed")); err != nil || string(value) != "value" {
+		t.Errorf("expected committed key to survive, got %q, %v", value, err)
+	}
+	if _, err := e.Get([]byte("torn")); !errors.Is(err, engine.ErrKeyNotFound) {
+		t.Errorf("expected torn write to be lost, got %v", err)
+	}
+}
+
+func TestBTreeEngine_SnapshotIsPointInTime(t *testing.T) {
+	e := openTestEngine(t, smallPages(t))
+
+	for i := range 200 {
+		if err := e.Set([]byte("key"+strconv.Itoa(i)), []byte("value")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	snap, err := e.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Release()
+
+	// Rewrite every page a few times, so that they would be reused if the
+	// snapshot did not pin them.
+	for range 2 {
+		for i := range 200 {
+			if err := e.Set([]byte("key"+strconv.Itoa(i)), []byte("changed")); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := e.Clear(); err != nil {
+		t.Fatal(err)
+	}
+
+	count := 0
+	previous := ""
+	err = snap.ForEach(func(entry engine.Entry) error {
+		if string(entry.Value) != "value" {
+			t.Fatalf("key %q: expected value from before the snapshot, got %q", entry.Key, entry.Value)
+		}
+		if string(entry.Key) <= previous {
+			t.Fatalf("expected keys in order, got %q after %q", entry.Key, previous)
+		}
+		previous = string(entry.Key)
+		count++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 200 {
+		t.Errorf("expected 200 entries, got %d", count)
+	}
+}
+
+func TestBTreeEngine_Expiration(t *testing.T) {
+	cfg := smallPages(t)
+	e := openTestEngine(t, cfg)
+
+	for i := range 100 {
+		if err := e.Set([]byte("key"+strconv.Itoa(i)), []byte("value")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deadline := time.Now().Add(time.Hour)
+	if err := e.SetWithDeadline([]byte("session"), []byte("token"), deadline); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.SetWithDeadline([]byte("expired"), []byte("token"), time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Expire([]byte("key1"), deadline); err != nil {
+		t.Fatal(err)
+	}
+	if persisted, err := e.Persist([]byte("key1")); err != nil || !persisted {
+		t.Fatalf("expected deadline to be removed, got %v, %v", persisted, err)
+	}
+	if err := e.Expire([]byte("missing"), deadline); !errors.Is(err, engine.ErrKeyNotFound) {
+		t.Errorf("expected error %v, got %v", engine.ErrKeyNotFound, err)
+	}
+
+	if _, err := e.Get([]byte("expired")); !errors.Is(err, engine.ErrKeyNotFound) {
+		t.Errorf("expected expired key to be hidden, got %v", err)
+	}
+
+	// Keys without a deadline take up most of the tree, so it may take a few
+	// passes to reach the expired one.
+	deleted := 0
+	for range 10 {
+		_, n := e.DeleteExpired(time.Now(), 2)
+		deleted += n
+	}
+	if deleted != 1 {
+		t.Errorf("expected 1 expired key to be deleted, got %d", deleted)
+	}
+
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	e = openTestEngine(t, cfg)
+
+	got, err := e.Deadline([]byte("session"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.UnixNano() != deadline.UnixNano() {
+		t.Errorf("expected deadline %v, got %v", deadline, got)
+	}
+	if got, err := e.Deadline([]byte("key1")); err != nil || !got.IsZero() {
+		t.Errorf("expected no deadline, got %v, %v", got, err)
+	}
+}
+
+func TestBTreeEngine_Clear(t *testing.T) {
+	cfg := smallPages(t)
+	e := openTestEngine(t, cfg)
+
+	for i := range 500 {
+		if err := e.Set([]byte("key"+strconv.Itoa(i)), []byte("value")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Set([]byte("after"), []byte("clear")); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	e = openTestEngine(t, cfg)
+	if _, err := e.Get([]byte("key1")); !errors.Is(err, engine.ErrKeyNotFound) {
+		t.Errorf("expected cleared key to be gone, got %v", err)
+	}
+	if value, err := e.Get([]byte("after")); err != nil || string(value) != "clear" {
+		t.Errorf("expected value written after clear, got %q, %v", value, err)
+	}
+}
+
+func TestDecodeNode_UntypedLeaf(t *testing.T) {
+	p := make(page, 64)
+	p.setHeader(untypedLeafPageFlag, 1, 0)
+
+	offset := pageHeaderSize + offsetSize
+	binary.BigEndian.PutUint32(p[pageHeaderSize:], uint32(offset))
+	elem := p[offset:]
+	binary.BigEndian.PutUint32(elem[0:4], 3)
+	binary.BigEndian.PutUint32(elem[4:8], 5)
+	binary.BigEndian.PutUint64(elem[8:16], 0)
+	copy(elem[untypedLeafElementSize:], "keyvalue")
+
+	n, err := decodeNode(2, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !n.leaf || len(n.inodes) != 1 {
+		t.Fatalf("expected a leaf with one element, got %+v", n)
+	}
+	if in := n.inodes[0]; in.key != "key" || in.value != "value" || in.typ != engine.TypeString {
+		t.Errorf("expected key=value string, got %+v", in)
+	}
+}
@@ -0,0 +1,334 @@
+package btree
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+)
+
+// tx is a write transaction. It copies every node it changes into new pages
+// and only publishes the result by writing a new meta page on commit, so the
+// committed tree is never modified in place.
+type tx struct {
+	engine   *BTreeEngine
+	meta     meta
+	freelist *freelist
+	root     *node
+	pages    map[pgid]page
+}
+
+// node reads the node stored at id. It must only be called while the engine
+// cannot be remapped, which holds for the writer.
+func (tx *tx) node(id pgid) (*node, error) {
+	p, err := tx.engine.page(tx.meta, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeNode(id, p)
+}
+
+func (tx *tx) child(n *node, i int) (*node, error) {
+	if n.inodes[i].node != nil {
+		return n.inodes[i].node, nil
+	}
+
+	child, err := tx.node(n.inodes[i].child)
+	if err != nil {
+		return nil, err
+	}
+	n.inodes[i].node = child
+
+	return child, nil
+}
+
+// seek returns the path from the root to the leaf that covers key.
+func (tx *tx) seek(key string) ([]*node, error) {
+	path := []*node{tx.root}
+	for n := tx.root; !n.leaf; {
+		if len(n.inodes) == 0 {
+			return nil, fmt.Errorf("%w: empty branch %d", ErrCorrupted, n.id)
+		}
+
+		child, err := tx.child(n, n.childIndex(key))
+		if err != nil {
+			return nil, err
+		}
+		path = append(path, child)
+		n = child
+	}
+
+	return path, nil
+}
+
+func (tx *tx) get(key string) (inode, bool, error) {
+	path, err := tx.seek(key)
+	if err != nil {
+		return inode{}, false, err
+	}
+
+	leaf := path[len(path)-1]
+	i, ok := leaf.search(key)
+	if !ok {
+		return inode{}, false, nil
+	}
+
+	return leaf.inodes[i], true, nil
+}
+
+func (tx *tx) put(key, value string, typ engine.ValueType, deadline int64) error {
+	path, err := tx.seek(key)
+	if err != nil {
+		return err
+	}
+
+	leaf := path[len(path)-1]
+	in := inode{key: key, value: value, typ: typ, deadline: deadline, child: 0, node: nil}
+	if i, ok := leaf.search(key); ok {
+		leaf.inodes[i] = in
+	} else {
+		leaf.inodes = slices.Insert(leaf.inodes, i, in)
+	}
+
+	markDirty(path)
+	tx.engine.versions.Put(key, []byte(value), typ)
+
+	return nil
+}
+
+// del removes key and reports whether it was there.
+func (tx *tx) del(key string) (bool, error) {
+	path, err := tx.seek(key)
+	if err != nil {
+		return false, err
+	}
+
+	leaf := path[len(path)-1]
+	i, ok := leaf.search(key)
+	if !ok {
+		return false, nil
+	}
+	leaf.inodes = slices.Delete(leaf.inodes, i, i+1)
+
+	markDirty(path)
+	tx.engine.versions.Forget(key)
+
+	return true, nil
+}
+
+func markDirty(path []*node) {
+	for _, n := range path {
+		n.dirty = true
+	}
+}
+
+// clear frees every page of the tree and starts over with an empty leaf.
+func (tx *tx) clear() error {
+	stack := []pgid{tx.meta.root}
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		n, err := tx.node(id)
+		if err != nil {
+			return err
+		}
+		tx.free(n)
+
+		if !n.leaf {
+			for _, in := range n.inodes {
+				stack = append(stack, in.child)
+			}
+		}
+	}
+
+	tx.root = &node{id: 0, overflow: 0, leaf: true, dirty: true, inodes: nil}
+	tx.engine.versions.Reset()
+
+	return nil
+}
+
+func (tx *tx) free(n *node) {
+	if n.id != 0 {
+		tx.freelist.free(tx.meta.txid, n.id, n.overflow)
+	}
+}
+
+// allocate returns the first of n contiguous pages, reusing free pages where
+// possible and growing the file otherwise.
+func (tx *tx) allocate(n int) pgid {
+	if id := tx.freelist.allocate(n); id != 0 {
+		return id
+	}
+
+	id := tx.meta.pageCount
+	tx.meta.pageCount += pgid(n)
+
+	return id
+}
+
+// rebalance merges changed nodes that fell below a quarter of a page into a
+// sibling and drops the ones that became empty.
+func (tx *tx) rebalance(n *node) error {
+	if n.leaf {
+		return nil
+	}
+
+	for _, in := range n.inodes {
+		if in.node != nil && in.node.dirty {
+			if err := tx.rebalance(in.node); err != nil {
+				return err
+			}
+		}
+	}
+
+	threshold := int(tx.meta.pageSize) / 4
+	for i := 0; i < len(n.inodes); {
+		child := n.inodes[i].node
+		if child == nil || !child.dirty || child.size() >= threshold {
+			i++
+			continue
+		}
+
+		if len(child.inodes) == 0 {
+			tx.free(child)
+			n.inodes = slices.Delete(n.inodes, i, i+1)
+			continue
+		}
+
+		if len(n.inodes) == 1 {
+			break
+		}
+
+		left := i
+		if i == len(n.inodes)-1 {
+			left = i - 1
+		}
+
+		leftNode, err := tx.child(n, left)
+		if err != nil {
+			return err
+		}
+		rightNode, err := tx.child(n, left+1)
+		if err != nil {
+			return err
+		}
+
+		leftNode.inodes = append(leftNode.inodes, rightNode.inodes...)
+		leftNode.dirty = true
+		tx.free(rightNode)
+		n.inodes = slices.Delete(n.inodes, left+1, left+2)
+		i = left
+	}
+
+	return nil
+}
+
+// spill writes a changed node and its changed descendants to new pages and
+// returns the elements that replace it in its parent.
+func (tx *tx) spill(n *node) ([]inode, error) {
+	if !n.leaf {
+		inodes := make([]inode, 0, len(n.inodes))
+		for _, in := range n.inodes {
+			if in.node == nil || !in.node.dirty {
+				in.node = nil
+				inodes = append(inodes, in)
+				continue
+			}
+
+			replaced, err := tx.spill(in.node)
+			if err != nil {
+				return nil, err
+			}
+			inodes = append(inodes, replaced...)
+		}
+		n.inodes = inodes
+	}
+
+	tx.free(n)
+
+	pageSize := int(tx.meta.pageSize)
+	chunks := n.split(pageSize)
+	replaced := make([]inode, 0, len(chunks))
+	for _, chunk := range chunks {
+		written := &node{id: 0, overflow: 0, leaf: n.leaf, dirty: false, inodes: chunk}
+
+		pages := (written.size() + pageSize - 1) / pageSize
+		id := tx.allocate(pages)
+		p := make(page, pages*pageSize)
+		//nolint:gosec
+		written.encode(p, uint32(pages-1))
+		tx.pages[id] = p
+
+		key := ""
+		if len(chunk) > 0 {
+			key = chunk[0].key
+		}
+		replaced = append(replaced, inode{key: key, value: "", typ: engine.TypeString, deadline: 0, child: id, node: nil})
+	}
+
+	return replaced, nil
+}
+
+// commit writes the changed nodes and a new freelist, then switches to them
+// with a new meta page.
+func (tx *tx) commit() error {
+	if err := tx.rebalance(tx.root); err != nil {
+		return err
+	}
+
+	for !tx.root.leaf && len(tx.root.inodes) <= 1 {
+		tx.free(tx.root)
+		if len(tx.root.inodes) == 0 {
+			tx.root = &node{id: 0, overflow: 0, leaf: true, dirty: true, inodes: nil}
+			break
+		}
+
+		child, err := tx.child(tx.root, 0)
+		if err != nil {
+			return err
+		}
+		child.dirty = true
+		tx.root = child
+	}
+
+	for tx.root.dirty {
+		inodes, err := tx.spill(tx.root)
+		if err != nil {
+			return err
+		}
+		if len(inodes) == 1 {
+			tx.meta.root = inodes[0].child
+			break
+		}
+
+		tx.root = &node{id: 0, overflow: 0, leaf: false, dirty: true, inodes: inodes}
+	}
+
+	if err := tx.writeFreelist(); err != nil {
+		return err
+	}
+
+	return tx.engine.commit(tx)
+}
+
+func (tx *tx) writeFreelist() error {
+	old, err := tx.engine.page(tx.meta, tx.meta.freelist)
+	if err != nil {
+		return err
+	}
+	tx.freelist.free(tx.meta.txid, tx.meta.freelist, old.overflow())
+
+	pageSize := int(tx.meta.pageSize)
+	pages := (freelistSize(len(tx.freelist.all())) + pageSize - 1) / pageSize
+	id := tx.allocate(pages)
+
+	p := make(page, pages*pageSize)
+	//nolint:gosec
+	tx.freelist.encode(p, uint32(pages-1))
+	tx.pages[id] = p
+	tx.meta.freelist = id
+
+	return nil
+}
@@ -1,11 +1,291 @@
 package engine
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
-var ErrKeyNotFound = errors.New("key not found")
+var (
+	ErrKeyNotFound           = errors.New("key not found")
+	ErrSnapshotInProgress    = errors.New("snapshot already in progress")
+	ErrExpirationUnsupported = errors.New("engine does not support key expiration")
+	ErrRangeUnsupported      = errors.New("range queries unsupported by engine")
+	ErrScanUnsupported       = errors.New("scan unsupported by engine")
+	ErrInvalidCursor         = errors.New("invalid cursor")
+	ErrWrongType             = errors.New("WRONGTYPE operation against a key holding the wrong kind of value")
+)
 
+// ValueType tells how the value of an entry is to be read. Engines store it
+// along with the value but never look inside values themselves.
+type ValueType uint8
+
+const (
+	TypeString ValueType = iota
+	TypeList
+	TypeHash
+	TypeSet
+	TypeZSet
+)
+
+func (t ValueType) String() string {
+	switch t {
+	case TypeString:
+		return "string"
+	case TypeList:
+		return "list"
+	case TypeHash:
+		return "hash"
+	case TypeSet:
+		return "set"
+	case TypeZSet:
+		return "zset"
+	default:
+		return "unknown"
+	}
+}
+
+// Engine stores keys and values as arbitrary bytes. Engines copy what they
+// are given and return copies, so callers are free to reuse their buffers.
+// Set and Get deal in strings; values of other types are written through
+// Update and read through GetEntry or View.
 type Engine interface {
-	Set(key, value string) error
-	Get(key string) (string, error)
-	Del(key string) error
+	Set(key, value []byte) error
+	// Get returns ErrWrongType if the key holds something else than a string.
+	Get(key []byte) ([]byte, error)
+	GetEntry(key []byte) (Entry, error)
+	Del(key []byte) error
+	// Update reads and replaces the entry of a key in one step, so that no
+	// other write to the key can come in between.
+	Update(key []byte, fn UpdateFunc) error
+}
+
+// UpdateFunc is given the current entry of a key, with found false if there
+// is none or it has expired, and returns the entry to store in its place, or
+// keep false to delete the key. The key of the returned entry is ignored. An
+// error leaves the key as it was and is returned by Update, so fn may only
+// change the object of the current entry in place once it can not fail.
+type UpdateFunc func(current Entry, found bool) (updated Entry, keep bool, err error)
+
+// Entry is a key with its value and the absolute time it expires at. A zero
+// deadline means the key never expires. A value other than a string may be
+// given as an Object instead of bytes, in which case Value is empty.
+type Entry struct {
+	Key      []byte
+	Value    []byte
+	Object   Object
+	Type     ValueType
+	Deadline time.Time
+}
+
+// Object is a value kept decoded, so that writes change it in place rather
+// than decoding and encoding it whole. Engines that keep their data in memory
+// hold objects as they are and pass them to Update and View; the others
+// store their encoding. GetEntry, Range and snapshots always return bytes.
+type Object interface {
+	Encode() []byte
+	// Size returns the length of the encoding without encoding the object.
+	Size() int
+}
+
+// Encoded returns the entry with its object, if it has one, encoded into
+// Value.
+func (e Entry) Encoded() Entry {
+	if e.Object != nil {
+		e.Value = e.Object.Encode()
+		e.Object = nil
+	}
+
+	return e
+}
+
+// StringValue returns the value of an entry read by GetEntry, failing with
+// ErrWrongType unless it is a string. Engines implement Get with it.
+func StringValue(entry Entry, err error) ([]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	if entry.Type != TypeString {
+		return nil, ErrWrongType
+	}
+
+	return entry.Value, nil
+}
+
+// Viewer is implemented by engines that can show an entry without copying it.
+type Viewer interface {
+	// View calls fn with the entry of key, with found false if there is none
+	// or it has expired. The entry, its object included, belongs to the
+	// engine: fn must neither change nor keep it, nor call back into the
+	// engine.
+	View(key []byte, fn func(entry Entry, found bool) error) error
+}
+
+// View calls fn with the entry of key, through the View method of e if it has
+// one and with a copy read by GetEntry otherwise.
+func View(e Engine, key []byte, fn func(entry Entry, found bool) error) error {
+	if viewer, ok := e.(Viewer); ok {
+		return viewer.View(key, fn)
+	}
+
+	entry, err := e.GetEntry(key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return fn(Entry{Key: key, Value: nil, Object: nil, Type: TypeString, Deadline: time.Time{}}, false)
+	}
+	if err != nil {
+		return err
+	}
+
+	return fn(entry, true)
+}
+
+// Expired reports whether the entry is no longer visible at now.
+func (e Entry) Expired(now time.Time) bool {
+	return !e.Deadline.IsZero() && !now.Before(e.Deadline)
+}
+
+// Snapshotter is implemented by engines that can expose a point-in-time view
+// of their contents while continuing to serve reads and writes.
+type Snapshotter interface {
+	Snapshot() (Snapshot, error)
+}
+
+type Snapshot interface {
+	ForEach(fn func(entry Entry) error) error
+	Release()
+}
+
+// Ranger is implemented by engines that keep their keys in order.
+type Ranger interface {
+	// Range calls fn with the entries whose keys fall in [start, end), in
+	// ascending order or in descending order if reverse is set, until fn
+	// returns false. An empty end means there is no upper bound. fn must not
+	// call back into the engine.
+	Range(start, end []byte, reverse bool, fn func(entry Entry) bool) error
+}
+
+// PrefixEnd returns the smallest key greater than every key that starts with
+// prefix, to be used as the end of a range, or "" if there is none.
+func PrefixEnd(prefix string) string {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1])
+		}
+	}
+
+	return ""
+}
+
+// Scanner is implemented by engines that can list their keys a batch at a
+// time without blocking writers for the whole iteration.
+type Scanner interface {
+	// Scan returns about count keys from where cursor points and the cursor
+	// to pass to get the next batch. A scan starts and ends with an empty
+	// cursor. Keys present for the whole scan are returned at least once;
+	// keys written or deleted in the meantime may or may not be.
+	Scan(cursor string, count int) (keys [][]byte, next string, err error)
+}
+
+// Versioner is implemented by engines that count the writes to every key. The
+// version of a key changes whenever the key is written, deleted or its
+// deadline changes. It is 0 for a key never written since the engine was
+// opened. Versions are kept in memory and start over when the engine is
+// opened again.
+type Versioner interface {
+	Version(key []byte) (uint64, error)
+}
+
+// Historian is implemented by engines that can keep the past values of keys.
+// History is only kept once KeepHistory is called, in memory, and starts over
+// when the engine is opened again.
+type Historian interface {
+	KeepHistory(limits HistoryLimits)
+	// History returns up to limit revisions of key, newest first, or all of
+	// them if limit is 0.
+	History(key []byte, limit int) ([]Revision, error)
+	// CompactHistory drops revisions past the age limit at now from up to
+	// limit keys, so that a call holds up writers for a bounded time. It
+	// returns how many revisions it dropped and whether keys are left with
+	// revisions to drop.
+	CompactHistory(now time.Time, limit int) (dropped int, more bool)
+}
+
+type Clearer interface {
+	Clear() error
+}
+
+// Expirer is implemented by engines that keep a deadline per key. Expired keys
+// behave as if they were deleted; Set without a deadline makes a key
+// persistent again.
+type Expirer interface {
+	SetWithDeadline(key, value []byte, deadline time.Time) error
+	// Expire sets the deadline of an existing key, returning ErrKeyNotFound
+	// if there is none.
+	Expire(key []byte, deadline time.Time) error
+	// Persist removes the deadline of a key and reports whether it had one.
+	Persist(key []byte) (bool, error)
+	// Deadline returns the deadline of a key, or the zero time if it never
+	// expires.
+	Deadline(key []byte) (time.Time, error)
+	// DeleteExpired looks at up to samples keys that have a deadline and
+	// deletes the expired ones, reporting how many were looked at and deleted.
+	DeleteExpired(now time.Time, samples int) (sampled, deleted int)
+}
+
+type EvictionPolicy string
+
+const (
+	NoEviction  EvictionPolicy = "noeviction"
+	AllKeysLRU  EvictionPolicy = "allkeys-lru"
+	AllKeysLFU  EvictionPolicy = "allkeys-lfu"
+	VolatileTTL EvictionPolicy = "volatile-ttl"
+	Random      EvictionPolicy = "random"
+)
+
+// entryOverhead approximates what an entry costs besides its key and value:
+// map slot, string headers and access metadata.
+const entryOverhead = 64
+
+// EntrySize is the approximate number of bytes an entry takes in memory.
+func EntrySize(key, value string) int64 {
+	return int64(len(key)+len(value)) + entryOverhead
+}
+
+// ObjectSize is EntrySize for a value kept as an object, counted as the
+// length of its encoding.
+func ObjectSize(key string, object Object) int64 {
+	return int64(len(key)+object.Size()) + entryOverhead
+}
+
+// Evictor is implemented by engines that track their memory usage and can
+// pick keys to evict once it runs over a limit.
+type Evictor interface {
+	// UsedMemory returns the sum of EntrySize over all entries.
+	UsedMemory() int64
+	// EvictionCandidate looks at up to samples keys, leaving out those skip
+	// reports true for, and returns the one the policy would evict first, or
+	// false if there is nothing to evict. skip may be nil.
+	EvictionCandidate(policy EvictionPolicy, samples int, skip func(key []byte) bool) ([]byte, bool)
+}
+
+// Put stores entry in e, keeping its type and deadline.
+func Put(e Engine, entry Entry) error {
+	if entry.Type != TypeString {
+		return e.Update(entry.Key, func(Entry, bool) (Entry, bool, error) {
+			return entry, true, nil
+		})
+	}
+
+	if entry.Deadline.IsZero() {
+		return e.Set(entry.Key, entry.Value)
+	}
+
+	expirer, ok := e.(Expirer)
+	if !ok {
+		return ErrExpirationUnsupported
+	}
+
+	return expirer.SetWithDeadline(entry.Key, entry.Value, entry.Deadline)
 }
@@ -0,0 +1,21 @@
+package engine
+
+import "testing"
+
+func TestPrefixEnd(t *testing.T) {
+	tests := []struct {
+		prefix string
+		want   string
+	}{
+		{prefix: "user:", want: "user;"},
+		{prefix: "a\xff", want: "b"},
+		{prefix: "\xff\xff", want: ""},
+		{prefix: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := PrefixEnd(tt.prefix); got != tt.want {
+			t.Errorf("PrefixEnd(%q): expected %q, got %q", tt.prefix, tt.want, got)
+		}
+	}
+}
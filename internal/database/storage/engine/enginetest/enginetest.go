@@ -0,0 +1,309 @@
+// Package enginetest checks that an engine behaves the way storage relies on:
+// updates, value types, versions and history. Every engine package runs it
+// from its own tests.
+package enginetest
+
+import (
+	"errors"
+	"io"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+)
+
+// Open opens the engine under test on dir. Engines that keep their data in
+// memory ignore dir.
+type Open func(t *testing.T, dir string) engine.Engine
+
+// Run runs every check on engines open returns, one fresh engine each. If
+// persistent is set, the engine is also closed and opened again on the same
+// dir to check that it kept what was written.
+func Run(t *testing.T, open Open, persistent bool) {
+	t.Helper()
+
+	checks := []struct {
+		name  string
+		check func(t *testing.T, e *testEngine)
+	}{
+		{"Update", testUpdate},
+		{"Types", testTypes},
+		{"Version", testVersion},
+		{"History", testHistory},
+	}
+
+	for _, c := range checks {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			e := &testEngine{Engine: open(t, dir), open: open, dir: dir, persistent: persistent}
+			c.check(t, e)
+		})
+	}
+}
+
+// testEngine is the engine a check runs on.
+type testEngine struct {
+	engine.Engine
+	open       Open
+	dir        string
+	persistent bool
+}
+
+// reopen closes the engine and opens it again on the same dir, reporting
+// false if it does not keep its data.
+func (e *testEngine) reopen(t *testing.T) bool {
+	t.Helper()
+
+	if !e.persistent {
+		return false
+	}
+
+	if closer, ok := e.Engine.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	e.Engine = e.open(t, e.dir)
+
+	return true
+}
+
+func (e *testEngine) expirer(t *testing.T) engine.Expirer {
+	t.Helper()
+
+	expirer, ok := e.Engine.(engine.Expirer)
+	if !ok {
+		t.Fatalf("%T does not implement engine.Expirer", e.Engine)
+	}
+
+	return expirer
+}
+
+func testUpdate(t *testing.T, e *testEngine) {
+	deadline := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	appendX := func(current engine.Entry, found bool) (engine.Entry, bool, error) {
+		current.Value = append(current.Value, 'x')
+		return current, true, nil
+	}
+
+	if err := e.Update([]byte("key"), appendX); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.expirer(t).Expire([]byte("key"), deadline); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Update([]byte("key"), appendX); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := e.Get([]byte("key")); err != nil || string(value) != "xx" {
+		t.Errorf("expected xx, got %q, %v", value, err)
+	}
+	if got, err := e.expirer(t).Deadline([]byte("key")); err != nil || !got.Equal(deadline) {
+		t.Errorf("expected deadline %v to be kept, got %v, %v", deadline, got, err)
+	}
+
+	errFailed := errors.New("failed")
+	err := e.Update([]byte("key"), func(engine.Entry, bool) (engine.Entry, bool, error) {
+		return engine.Entry{}, false, errFailed
+	})
+	if !errors.Is(err, errFailed) {
+		t.Errorf("expected error %v, got %v", errFailed, err)
+	}
+	if value, err := e.Get([]byte("key")); err != nil || string(value) != "xx" {
+		t.Errorf("expected failed update to leave xx, got %q, %v", value, err)
+	}
+
+	if err := e.expirer(t).SetWithDeadline([]byte("expired"), []byte("old"), time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	err = e.Update([]byte("expired"), func(current engine.Entry, found bool) (engine.Entry, bool, error) {
+		if found {
+			t.Errorf("expected expired key to be missing, got %q", current.Value)
+		}
+		return current, true, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := e.expirer(t).Deadline([]byte("expired")); err != nil || !got.IsZero() {
+		t.Errorf("expected recreated key to have no deadline, got %v, %v", got, err)
+	}
+
+	err = e.Update([]byte("key"), func(engine.Entry, bool) (engine.Entry, bool, error) {
+		return engine.Entry{}, false, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Get([]byte("key")); !errors.Is(err, engine.ErrKeyNotFound) {
+		t.Errorf("expected error %v, got %v", engine.ErrKeyNotFound, err)
+	}
+
+	if !e.reopen(t) {
+		return
+	}
+	if value, err := e.Get([]byte("expired")); err != nil || string(value) != "" {
+		t.Errorf("expected updates to be recovered, got %q, %v", value, err)
+	}
+	if _, err := e.Get([]byte("key")); !errors.Is(err, engine.ErrKeyNotFound) {
+		t.Errorf("expected deleted key to stay deleted, got %v", err)
+	}
+}
+
+func testTypes(t *testing.T, e *testEngine) {
+	list := engine.Entry{Key: []byte("list"), Value: []byte("\x01a"), Object: nil, Type: engine.TypeList, Deadline: time.Time{}}
+	if err := engine.Put(e, list); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Set([]byte("string"), []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Get([]byte("list")); !errors.Is(err, engine.ErrWrongType) {
+		t.Errorf("expected error %v, got %v", engine.ErrWrongType, err)
+	}
+
+	if e.reopen(t) {
+		if entry, err := e.GetEntry([]byte("list")); err != nil || entry.Type != engine.TypeList || string(entry.Value) != "\x01a" {
+			t.Errorf("expected list to be recovered, got %+v, %v", entry, err)
+		}
+		if entry, err := e.GetEntry([]byte("string")); err != nil || entry.Type != engine.TypeString {
+			t.Errorf("expected string to be recovered, got %+v, %v", entry, err)
+		}
+	}
+
+	if err := e.Set([]byte("list"), []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := e.Get([]byte("list")); err != nil || string(value) != "value" {
+		t.Errorf("expected set to replace the list, got %q, %v", value, err)
+	}
+}
+
+func testVersion(t *testing.T, e *testEngine) {
+	versioner, ok := e.Engine.(engine.Versioner)
+	if !ok {
+		t.Fatalf("%T does not implement engine.Versioner", e.Engine)
+	}
+
+	version := func() uint64 {
+		t.Helper()
+
+		v, err := versioner.Version([]byte("key"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	if v := version(); v != 0 {
+		t.Fatalf("expected version 0 for a missing key, got %d", v)
+	}
+
+	var last uint64
+	writes := []func() error{
+		func() error { return e.Set([]byte("key"), []byte("a")) },
+		func() error { return e.Set([]byte("key"), []byte("a")) },
+		func() error { return e.expirer(t).Expire([]byte("key"), time.Now().Add(time.Hour)) },
+		func() error {
+			return e.Update([]byte("key"), func(current engine.Entry, _ bool) (engine.Entry, bool, error) {
+				return current, true, nil
+			})
+		},
+	}
+	for i, write := range writes {
+		if err := write(); err != nil {
+			t.Fatal(err)
+		}
+		if v := version(); v <= last {
+			t.Fatalf("write %d: expected a version above %d, got %d", i, last, v)
+		}
+		last = version()
+	}
+
+	if err := e.Set([]byte("other"), []byte("b")); err != nil {
+		t.Fatal(err)
+	}
+	if v := version(); v != last {
+		t.Errorf("expected a write to another key to keep version %d, got %d", last, v)
+	}
+
+	if err := e.Del([]byte("key")); err != nil {
+		t.Fatal(err)
+	}
+	if v := version(); v <= last {
+		t.Errorf("expected a deleted key to get a version above %d, got %d", last, v)
+	}
+	last = version()
+
+	if err := e.Set([]byte("key"), []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if v := version(); v <= last {
+		t.Errorf("expected a recreated key to get a version above %d, got %d", last, v)
+	}
+	last = version()
+
+	clearer, ok := e.Engine.(engine.Clearer)
+	if !ok {
+		t.Fatalf("%T does not implement engine.Clearer", e.Engine)
+	}
+	if err := clearer.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if v := version(); v <= last {
+		t.Errorf("expected a cleared key to get a version above %d, got %d", last, v)
+	}
+}
+
+func testHistory(t *testing.T, e *testEngine) {
+	historian, ok := e.Engine.(engine.Historian)
+	if !ok {
+		t.Fatalf("%T does not implement engine.Historian", e.Engine)
+	}
+	historian.KeepHistory(engine.HistoryLimits{MaxVersions: 10, MaxAge: 0})
+
+	writes := []func() error{
+		func() error { return e.Set([]byte("key"), []byte("a")) },
+		func() error { return e.expirer(t).Expire([]byte("key"), time.Now().Add(time.Hour)) },
+		func() error { return e.Set([]byte("key"), []byte("b")) },
+		func() error { return e.Del([]byte("key")) },
+		func() error {
+			return e.Update([]byte("key"), func(current engine.Entry, _ bool) (engine.Entry, bool, error) {
+				current.Value, current.Type = []byte("list"), engine.TypeList
+				return current, true, nil
+			})
+		},
+	}
+	for _, write := range writes {
+		if err := write(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	revisions, err := historian.History([]byte("key"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, r := range revisions {
+		switch {
+		case r.Deleted:
+			got = append(got, "deleted")
+		case r.Type != engine.TypeString:
+			got = append(got, r.Type.String())
+		default:
+			got = append(got, string(r.Value))
+		}
+	}
+	if want := []string{"list", "deleted", "b", "a"}; !slices.Equal(got, want) {
+		t.Fatalf("expected revisions %v, got %v", want, got)
+	}
+
+	//nolint:forcetypeassert
+	if v, err := e.Engine.(engine.Versioner).Version([]byte("key")); err != nil || v != revisions[0].Revision {
+		t.Errorf("expected the newest revision %d to be the version of the key, got %d, %v", revisions[0].Revision, v, err)
+	}
+}
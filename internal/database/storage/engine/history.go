@@ -0,0 +1,221 @@
+package engine
+
+import (
+	"bytes"
+	"container/heap"
+	"slices"
+	"time"
+)
+
+// Revision is a value a key held, numbered with the version the write gave
+// the key. Writes that leave the value as it was, such as deadline changes,
+// add no revision.
+type Revision struct {
+	Revision uint64
+	Time     time.Time
+	Value    []byte
+	Type     ValueType
+	// Deleted marks the revision that deleted the key. It has no value.
+	Deleted bool
+}
+
+// HistoryLimits bound the revisions kept for every key. The last revision of
+// a key that exists is kept regardless of MaxAge, so that the history always
+// tells what a key holds. Zero means no limit.
+type HistoryLimits struct {
+	MaxVersions int
+	MaxAge      time.Duration
+}
+
+// history holds the revisions of keys, oldest first. Keys that have
+// revisions compaction may drop one day are queued by the time of their
+// oldest revision, so that compaction only looks at keys with revisions past
+// the age limit rather than at every key.
+type history struct {
+	limits HistoryLimits
+	keys   map[string][]Revision
+	queue  compactionQueue
+	queued map[string]bool
+}
+
+func (h *history) add(key string, revision Revision) {
+	revisions := append(h.keys[key], revision)
+	if h.limits.MaxVersions > 0 && len(revisions) > h.limits.MaxVersions {
+		revisions = slices.Delete(revisions, 0, len(revisions)-h.limits.MaxVersions)
+	}
+
+	h.keys[key] = revisions
+	h.schedule(key)
+}
+
+// schedule queues key for compaction if it has revisions that can be dropped
+// once they are old enough: any but the last one, or the last one if it
+// deleted the key.
+func (h *history) schedule(key string) {
+	if h.limits.MaxAge <= 0 || h.queued[key] {
+		return
+	}
+
+	revisions := h.keys[key]
+	if len(revisions) < 2 && !(len(revisions) == 1 && revisions[0].Deleted) {
+		return
+	}
+
+	h.queued[key] = true
+	heap.Push(&h.queue, queuedKey{key: key, oldest: revisions[0].Time})
+}
+
+// live reports whether key has a revision and the last one did not delete it.
+func (h *history) live(key string) bool {
+	revisions := h.keys[key]
+	return len(revisions) > 0 && !revisions[len(revisions)-1].Deleted
+}
+
+// holds reports whether the last revision of key has value and typ.
+func (h *history) holds(key string, value []byte, typ ValueType) bool {
+	if !h.live(key) {
+		return false
+	}
+
+	last := h.keys[key][len(h.keys[key])-1]
+	return last.Type == typ && bytes.Equal(last.Value, value)
+}
+
+// compact drops revisions older than MaxAge at now, except the last one of
+// every key, from up to limit of the queued keys. It returns how many
+// revisions it dropped and whether queued keys are left with revisions that
+// old.
+func (h *history) compact(now time.Time, limit int) (int, bool) {
+	if h.limits.MaxAge <= 0 {
+		return 0, false
+	}
+
+	cutoff := now.Add(-h.limits.MaxAge)
+
+	dropped := 0
+	for visited := 0; len(h.queue) > 0 && h.queue[0].oldest.Before(cutoff); visited++ {
+		if visited == limit {
+			return dropped, true
+		}
+
+		key := heap.Pop(&h.queue).(queuedKey).key //nolint:forcetypeassert
+		delete(h.queued, key)
+		dropped += h.compactKey(key, cutoff)
+		h.schedule(key)
+	}
+
+	return dropped, false
+}
+
+func (h *history) compactKey(key string, cutoff time.Time) int {
+	revisions := h.keys[key]
+
+	old := 0
+	for old < len(revisions)-1 && revisions[old].Time.Before(cutoff) {
+		old++
+	}
+
+	if old == len(revisions)-1 && revisions[old].Deleted && revisions[old].Time.Before(cutoff) {
+		delete(h.keys, key)
+		return len(revisions)
+	}
+
+	if old > 0 {
+		h.keys[key] = slices.Delete(revisions, 0, old)
+	}
+
+	return old
+}
+
+// queuedKey is a key waiting for compaction, with the time of its oldest
+// revision when it was queued. Revisions dropped for MaxVersions since only
+// make the key come up early.
+type queuedKey struct {
+	key    string
+	oldest time.Time
+}
+
+// compactionQueue is a min-heap of queued keys by the time of their oldest
+// revision.
+type compactionQueue []queuedKey
+
+func (q compactionQueue) Len() int           { return len(q) }
+func (q compactionQueue) Less(i, j int) bool { return q[i].oldest.Before(q[j].oldest) }
+func (q compactionQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+
+func (q *compactionQueue) Push(x any) {
+	*q = append(*q, x.(queuedKey)) //nolint:forcetypeassert
+}
+
+func (q *compactionQueue) Pop() any {
+	old := *q
+	last := old[len(old)-1]
+	*q = old[:len(old)-1]
+
+	return last
+}
+
+// KeepHistory starts keeping the revisions of every key written from now on,
+// within limits.
+func (v *Versions) KeepHistory(limits HistoryLimits) {
+	v.history = &history{limits: limits, keys: make(map[string][]Revision), queue: nil, queued: make(map[string]bool)}
+}
+
+// Put gives key a new version for a new value and records it in the history
+// if there is one.
+func (v *Versions) Put(key string, value []byte, typ ValueType) {
+	v.Bump(key)
+
+	if v.history == nil || v.history.holds(key, value, typ) {
+		return
+	}
+
+	v.history.add(key, Revision{Revision: v.last, Time: time.Now(), Value: bytes.Clone(value), Type: typ, Deleted: false})
+}
+
+// PutObject is Put for a value kept as an object, which is only encoded if
+// history is kept.
+func (v *Versions) PutObject(key string, object Object, typ ValueType) {
+	if v.history == nil {
+		v.Bump(key)
+		return
+	}
+
+	v.Put(key, object.Encode(), typ)
+}
+
+// History returns up to limit revisions of key, newest first, or all of them
+// if limit is 0. It returns nil if history is not kept.
+func (v *Versions) History(key string, limit int) []Revision {
+	if v.history == nil {
+		return nil
+	}
+
+	revisions := v.history.keys[key]
+	if limit > 0 && len(revisions) > limit {
+		revisions = revisions[len(revisions)-limit:]
+	}
+
+	newest := slices.Clone(revisions)
+	slices.Reverse(newest)
+
+	return newest
+}
+
+// CompactHistory drops revisions past the age limit from up to limit keys and
+// returns how many it dropped and whether more keys have revisions to drop.
+func (v *Versions) CompactHistory(now time.Time, limit int) (int, bool) {
+	if v.history == nil {
+		return 0, false
+	}
+
+	return v.history.compact(now, limit)
+}
+
+func (v *Versions) recordDeleted(key string, version uint64) {
+	if v.history == nil || !v.history.live(key) {
+		return
+	}
+
+	v.history.add(key, Revision{Revision: version, Time: time.Now(), Value: nil, Type: TypeString, Deleted: true})
+}
@@ -0,0 +1,88 @@
+package engine
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVersions_History(t *testing.T) {
+	var v Versions
+
+	v.Put("a", []byte("before"), TypeString)
+	if got := v.History("a", 0); got != nil {
+		t.Fatalf("expected no history before KeepHistory, got %v", got)
+	}
+
+	v.KeepHistory(HistoryLimits{MaxVersions: 3, MaxAge: 0})
+	v.Put("a", []byte("1"), TypeString)
+	v.Put("a", []byte("1"), TypeString)
+	v.Bump("a")
+	v.Put("a", []byte("2"), TypeString)
+	v.Forget("a")
+	v.Forget("a")
+	v.Put("a", []byte("3"), TypeList)
+
+	got := v.History("a", 0)
+	if len(got) != 3 {
+		t.Fatalf("expected 3 revisions, got %d: %v", len(got), got)
+	}
+	if string(got[0].Value) != "3" || got[0].Type != TypeList || !got[1].Deleted || string(got[2].Value) != "2" {
+		t.Errorf("unexpected revisions, newest first: %v", got)
+	}
+	for i := 1; i < len(got); i++ {
+		if got[i].Revision >= got[i-1].Revision {
+			t.Errorf("expected revisions to decrease, got %d after %d", got[i].Revision, got[i-1].Revision)
+		}
+	}
+	if got[0].Revision != v.Get("a") {
+		t.Errorf("expected the newest revision %d to be the version of the key, got %d", v.Get("a"), got[0].Revision)
+	}
+
+	if limited := v.History("a", 1); len(limited) != 1 || limited[0].Revision != got[0].Revision {
+		t.Errorf("expected only the newest revision, got %v", limited)
+	}
+
+	v.Reset()
+	if got := v.History("a", 1); len(got) != 1 || !got[0].Deleted {
+		t.Errorf("expected a reset to delete the key, got %v", got)
+	}
+}
+
+func TestVersions_CompactHistory(t *testing.T) {
+	var v Versions
+	v.KeepHistory(HistoryLimits{MaxVersions: 0, MaxAge: time.Minute})
+
+	v.Put("kept", []byte("1"), TypeString)
+	v.Put("kept", []byte("2"), TypeString)
+	v.Put("gone", []byte("1"), TypeString)
+	v.Forget("gone")
+
+	if dropped, more := v.CompactHistory(time.Now(), 10); dropped != 0 || more {
+		t.Errorf("expected nothing to be old enough yet, dropped %d", dropped)
+	}
+
+	later := time.Now().Add(time.Hour)
+	if dropped, more := v.CompactHistory(later, 1); dropped == 0 || !more {
+		t.Errorf("expected one key to be compacted with one left, dropped %d, more %v", dropped, more)
+	}
+	if dropped, more := v.CompactHistory(later, 1); dropped == 0 || more {
+		t.Errorf("expected the last key to be compacted, dropped %d, more %v", dropped, more)
+	}
+	if dropped, more := v.CompactHistory(later, 1); dropped != 0 || more {
+		t.Errorf("expected nothing left to compact, dropped %d, more %v", dropped, more)
+	}
+	if got := v.History("kept", 0); len(got) != 1 || string(got[0].Value) != "2" {
+		t.Errorf("expected the value the key holds to be kept, got %v", got)
+	}
+	if got := v.History("gone", 0); len(got) != 0 {
+		t.Errorf("expected the history of a deleted key to be dropped, got %v", got)
+	}
+
+	v.Put("kept", []byte("3"), TypeString)
+	if dropped, more := v.CompactHistory(time.Now(), 10); dropped != 0 || more {
+		t.Errorf("expected revisions written since to be kept until they age, dropped %d", dropped)
+	}
+	if dropped, _ := v.CompactHistory(later, 10); dropped != 1 {
+		t.Errorf("expected the key written again to be compacted, dropped %d", dropped)
+	}
+}
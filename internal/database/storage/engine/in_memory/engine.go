@@ -1,16 +1,33 @@
 package inmemory
 
 import (
+	"bytes"
 	"sync"
+	"time"
 
 	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
 	"go.uber.org/zap"
 )
 
 type InMemoryEngine struct {
-	logger *zap.Logger
-	mtx    sync.RWMutex
-	store  map[string]string
+	logger    *zap.Logger
+	mtx       sync.RWMutex
+	store     *table
+	deadlines map[string]time.Time
+	versions  engine.Versions
+	used      int64
+	snapshot  *snapshot
+}
+
+const Name = "in_memory"
+
+// Config is empty, as the in-memory engine has no settings of its own.
+type Config struct{}
+
+func init() {
+	engine.Register(Name, func(_ *Config, logger *zap.Logger) (engine.Engine, error) {
+		return NewInMemoryEngine(logger)
+	})
 }
 
 func NewInMemoryEngine(logger *zap.Logger) (engine.Engine, error) {
@@ -19,38 +36,228 @@ func NewInMemoryEngine(logger *zap.Logger) (engine.Engine, error) {
 	}
 
 	return &InMemoryEngine{
-		store:  make(map[string]string),
-		logger: logger,
-		mtx:    sync.RWMutex{},
+		store:     newTable(),
+		deadlines: make(map[string]time.Time),
+		versions:  engine.Versions{},
+		logger:    logger,
+		mtx:       sync.RWMutex{},
+		used:      0,
+		snapshot:  nil,
 	}, nil
 }
 
-func (e *InMemoryEngine) Get(key string) (string, error) {
+func (e *InMemoryEngine) Get(key []byte) ([]byte, error) {
+	return engine.StringValue(e.GetEntry(key))
+}
+
+func (e *InMemoryEngine) GetEntry(key []byte) (engine.Entry, error) {
+	now := time.Now()
+
 	e.mtx.RLock()
-	val, ok := e.store[key]
-	defer e.mtx.RUnlock()
+	it, ok := e.store.get(string(key))
+	expired := ok && e.expired(string(key), now)
+	if ok && !expired {
+		it.touch(now.UnixNano())
+	}
+	deadline := e.deadlines[string(key)]
+	e.mtx.RUnlock()
 
 	if !ok {
-		return "", engine.ErrKeyNotFound
+		return engine.Entry{}, engine.ErrKeyNotFound
+	}
+
+	if expired {
+		e.deleteIfExpired(string(key))
+		return engine.Entry{}, engine.ErrKeyNotFound
 	}
 
-	return val, nil
+	return engine.Entry{Key: bytes.Clone(key), Value: it.encoded(), Object: nil, Type: it.typ, Deadline: deadline}, nil
+}
+
+// View passes the object of a key as it is held, under the read lock.
+func (e *InMemoryEngine) View(key []byte, fn func(entry engine.Entry, found bool) error) error {
+	now := time.Now()
+
+	e.mtx.RLock()
+	defer e.mtx.RUnlock()
+
+	entry := engine.Entry{Key: key, Value: nil, Object: nil, Type: engine.TypeString, Deadline: time.Time{}}
+	it, found := e.store.get(string(key))
+	if found = found && !e.expired(string(key), now); found {
+		it.touch(now.UnixNano())
+		entry.Value, entry.Object = it.current()
+		entry.Type = it.typ
+		entry.Deadline = e.deadlines[string(key)]
+	}
+
+	return fn(entry, found)
+}
+
+func (e *InMemoryEngine) Set(key, value []byte) error {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	e.put(string(key), string(value), nil, engine.TypeString)
+	delete(e.deadlines, string(key))
+
+	return nil
+}
+
+func (e *InMemoryEngine) Del(key []byte) error {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	e.delete(string(key))
+
+	return nil
 }
 
-func (e *InMemoryEngine) Set(key, value string) error {
+func (e *InMemoryEngine) Update(key []byte, fn engine.UpdateFunc) error {
+	k := string(key)
+
 	e.mtx.Lock()
 	defer e.mtx.Unlock()
 
-	e.store[key] = value
+	current := engine.Entry{Key: []byte(k), Value: nil, Object: nil, Type: engine.TypeString, Deadline: time.Time{}}
+	it, found := e.store.get(k)
+	var size int64
+	if found = found && !e.expired(k, time.Now()); found {
+		current.Value, current.Object = it.current()
+		current.Type = it.typ
+		current.Deadline = e.deadlines[k]
+
+		// fn may change the object in place, so the snapshot and the memory
+		// count must look at it first.
+		if e.snapshot != nil {
+			e.snapshot.preserve(k)
+		}
+		size = it.size(k)
+	}
+
+	updated, keep, err := fn(current, found)
+	if err != nil {
+		return err
+	}
+
+	if found {
+		e.used += it.size(k) - size
+	}
+
+	if !keep {
+		e.delete(k)
+		return nil
+	}
+
+	e.put(k, string(updated.Value), updated.Object, updated.Type)
+	if updated.Deadline.IsZero() {
+		delete(e.deadlines, k)
+	} else {
+		e.deadlines[k] = updated.Deadline
+	}
 
 	return nil
 }
 
-func (e *InMemoryEngine) Del(key string) error {
+func (e *InMemoryEngine) Clear() error {
 	e.mtx.Lock()
 	defer e.mtx.Unlock()
 
-	delete(e.store, key)
+	if e.snapshot != nil {
+		for key := range e.store.all() {
+			e.snapshot.preserve(key)
+		}
+	}
+	e.store = newTable()
+	e.deadlines = make(map[string]time.Time)
+	e.versions.Reset()
+	e.used = 0
 
 	return nil
 }
+
+// Version returns the version of key, or that of its deletion if it does not
+// exist.
+func (e *InMemoryEngine) Version(key []byte) (uint64, error) {
+	k := string(key)
+
+	e.mtx.RLock()
+	defer e.mtx.RUnlock()
+
+	if _, ok := e.store.get(k); !ok || e.expired(k, time.Now()) {
+		return e.versions.Missing(k), nil
+	}
+
+	return e.versions.Get(k), nil
+}
+
+func (e *InMemoryEngine) KeepHistory(limits engine.HistoryLimits) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	e.versions.KeepHistory(limits)
+}
+
+// History returns the revisions of key, newest first.
+func (e *InMemoryEngine) History(key []byte, limit int) ([]engine.Revision, error) {
+	e.mtx.RLock()
+	defer e.mtx.RUnlock()
+
+	return e.versions.History(string(key), limit), nil
+}
+
+func (e *InMemoryEngine) CompactHistory(now time.Time, limit int) (int, bool) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	return e.versions.CompactHistory(now, limit)
+}
+
+// put stores either value or object. It must be called with the write lock
+// held.
+func (e *InMemoryEngine) put(key, value string, object engine.Object, typ engine.ValueType) {
+	if e.snapshot != nil {
+		e.snapshot.preserve(key)
+	}
+
+	it := newItem(value, object, typ, time.Now().UnixNano())
+	if old, ok := e.store.put(key, it); ok {
+		e.used -= old.size(key)
+	}
+	e.used += it.size(key)
+
+	if object != nil {
+		e.versions.PutObject(key, object, typ)
+	} else {
+		e.versions.Put(key, []byte(value), typ)
+	}
+}
+
+// delete must be called with the write lock held.
+func (e *InMemoryEngine) delete(key string) {
+	if e.snapshot != nil {
+		e.snapshot.preserve(key)
+	}
+
+	if old, ok := e.store.delete(key); ok {
+		e.used -= old.size(key)
+		e.versions.Forget(key)
+	}
+	delete(e.deadlines, key)
+}
+
+// expired must be called with the lock held.
+func (e *InMemoryEngine) expired(key string, now time.Time) bool {
+	deadline, ok := e.deadlines[key]
+	return ok && !now.Before(deadline)
+}
+
+// deleteIfExpired removes a key found expired under the read lock, unless it
+// was written again in the meantime.
+func (e *InMemoryEngine) deleteIfExpired(key string) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	if e.expired(key, time.Now()) {
+		e.delete(key)
+	}
+}
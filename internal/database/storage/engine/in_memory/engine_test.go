@@ -1,10 +1,12 @@
 package inmemory
 
 import (
+	"bytes"
 	"errors"
 	"testing"
 
 	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine/enginetest"
 	"go.uber.org/zap"
 )
 
@@ -39,7 +41,7 @@ func TestInMemoryEngine_Get(t *testing.T) {
 	for _, tt := range tests {
 		e := newTestEngine(t)
 		t.Run(tt.name, func(t *testing.T) {
-			value, err := e.Get(tt.key)
+			value, err := e.Get([]byte(tt.key))
 			if tt.wantError {
 				if err == nil {
 					t.Errorf("expected error, got nil")
@@ -50,7 +52,7 @@ func TestInMemoryEngine_Get(t *testing.T) {
 				return
 			}
 
-			if value != tt.wantValue {
+			if string(value) != tt.wantValue {
 				t.Errorf("expected value %v, got %v", tt.wantValue, value)
 			}
 		})
@@ -58,14 +60,14 @@ func TestInMemoryEngine_Get(t *testing.T) {
 
 	t.Run("key exists", func(t *testing.T) {
 		e := newTestEngine(t)
-		if err := e.Set("key1", "value1"); err != nil {
+		if err := e.Set([]byte("key1"), []byte("value1")); err != nil {
 			t.Fatal(err)
 		}
-		value, err := e.Get("key1")
+		value, err := e.Get([]byte("key1"))
 		if err != nil {
 			t.Fatal(err)
 		}
-		if value != "value1" {
+		if string(value) != "value1" {
 			t.Errorf("expected value %v, got %v", "value1", value)
 		}
 	})
@@ -99,20 +101,20 @@ func TestInMemoryEngine_Set(t *testing.T) {
 			e := newTestEngine(t)
 
 			if tt.name == "overwrite existing key" {
-				if err := e.Set(tt.key, "old_value"); err != nil {
+				if err := e.Set([]byte(tt.key), []byte("old_value")); err != nil {
 					t.Fatal(err)
 				}
 			}
 
-			if err := e.Set(tt.key, tt.value); err != nil {
+			if err := e.Set([]byte(tt.key), []byte(tt.value)); err != nil {
 				t.Errorf("Set() error = %v", err)
 			}
 
-			got, err := e.Get(tt.key)
+			got, err := e.Get([]byte(tt.key))
 			if err != nil {
 				t.Errorf("Get() after Set() error = %v", err)
 			}
-			if got != tt.value {
+			if string(got) != tt.value {
 				t.Errorf("expected value %v, got %v", tt.value, got)
 			}
 		})
@@ -145,17 +147,17 @@ func TestInMemoryEngine_Del(t *testing.T) {
 			e := newTestEngine(t)
 
 			if tt.setup {
-				if err := e.Set(tt.key, "value"); err != nil {
+				if err := e.Set([]byte(tt.key), []byte("value")); err != nil {
 					t.Fatal(err)
 				}
 			}
 
-			err := e.Del(tt.key)
+			err := e.Del([]byte(tt.key))
 			if tt.wantError && err == nil {
 				t.Errorf("expected error, got nil")
 			}
 
-			_, err = e.Get(tt.key)
+			_, err = e.Get([]byte(tt.key))
 			if tt.setup && !tt.wantError {
 				if !errors.Is(err, engine.ErrKeyNotFound) {
 					t.Errorf("expected key to be deleted, got error: %v", err)
@@ -164,3 +166,38 @@ func TestInMemoryEngine_Del(t *testing.T) {
 		})
 	}
 }
+
+func TestInMemoryEngine_BinaryKeysAndValues(t *testing.T) {
+	e := newTestEngine(t)
+
+	key := []byte{0, 'k', ' ', '\n', 0xff}
+	value := []byte{'v', 0, '\r', '\n', 0xfe}
+
+	if err := e.Set(key, value); err != nil {
+		t.Fatal(err)
+	}
+	key[0], value[0] = 1, 'x'
+
+	got, err := e.Get([]byte{0, 'k', ' ', '\n', 0xff})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{'v', 0, '\r', '\n', 0xfe}; !bytes.Equal(got, want) {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+
+	got[0] = 'x'
+	if again, _ := e.Get([]byte{0, 'k', ' ', '\n', 0xff}); again[0] != 'v' {
+		t.Errorf("value changed through a returned slice: %q", again)
+	}
+
+	if _, err := e.Get(key); !errors.Is(err, engine.ErrKeyNotFound) {
+		t.Errorf("expected %v, got %v", engine.ErrKeyNotFound, err)
+	}
+}
+
+func TestInMemoryEngine_Conformance(t *testing.T) {
+	enginetest.Run(t, func(t *testing.T, _ string) engine.Engine {
+		return newTestEngine(t)
+	}, false)
+}
@@ -0,0 +1,160 @@
+package inmemory
+
+import (
+	"iter"
+	"maps"
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+)
+
+// The access frequency is a logarithmic counter as in Redis: new keys start at
+// lfuInitial, each access increments it with a probability that falls as the
+// counter grows, and it decays by one for every lfuDecayPeriod of idleness.
+const (
+	lfuInitial     = 5
+	lfuMax         = 255
+	lfuLogFactor   = 10
+	lfuDecayPeriod = time.Minute
+)
+
+// item holds a value, as bytes or as an object, with the access metadata
+// used for eviction. The metadata is updated under the read lock, hence the
+// atomics.
+type item struct {
+	value     string
+	object    engine.Object
+	typ       engine.ValueType
+	accessed  atomic.Int64
+	frequency atomic.Uint32
+}
+
+func newItem(value string, object engine.Object, typ engine.ValueType, now int64) *item {
+	//nolint:exhaustruct
+	it := &item{value: value, object: object, typ: typ}
+	it.accessed.Store(now)
+	it.frequency.Store(lfuInitial)
+
+	return it
+}
+
+// current returns the value as held, for Update and View.
+func (it *item) current() ([]byte, engine.Object) {
+	if it.object != nil {
+		return nil, it.object
+	}
+
+	return []byte(it.value), nil
+}
+
+func (it *item) encoded() []byte {
+	if it.object != nil {
+		return it.object.Encode()
+	}
+
+	return []byte(it.value)
+}
+
+func (it *item) size(key string) int64 {
+	if it.object != nil {
+		return engine.ObjectSize(key, it.object)
+	}
+
+	return engine.EntrySize(key, it.value)
+}
+
+func (it *item) touch(now int64) {
+	counter := it.decayedFrequency(now)
+	if counter < lfuMax {
+		base := float64(max(counter, lfuInitial) - lfuInitial)
+		//nolint:gosec
+		if rand.Float64() < 1/(base*lfuLogFactor+1) {
+			counter++
+		}
+	}
+
+	it.frequency.Store(counter)
+	it.accessed.Store(now)
+}
+
+func (it *item) decayedFrequency(now int64) uint32 {
+	counter := it.frequency.Load()
+	periods := uint64(max(now-it.accessed.Load(), 0)) / uint64(lfuDecayPeriod)
+	if periods >= uint64(counter) {
+		return 0
+	}
+
+	return counter - uint32(periods)
+}
+
+func (e *InMemoryEngine) UsedMemory() int64 {
+	e.mtx.RLock()
+	defer e.mtx.RUnlock()
+
+	return e.used
+}
+
+// EvictionCandidate relies on randomized iteration orders to pick the sample,
+// so a call costs O(samples) no matter how many keys there are.
+func (e *InMemoryEngine) EvictionCandidate(policy engine.EvictionPolicy, samples int, skip func([]byte) bool) ([]byte, bool) {
+	key, ok := e.evictionCandidate(policy, samples, skip)
+	if !ok {
+		return nil, false
+	}
+
+	return []byte(key), true
+}
+
+func (e *InMemoryEngine) evictionCandidate(policy engine.EvictionPolicy, samples int, skip func([]byte) bool) (string, bool) {
+	e.mtx.RLock()
+	defer e.mtx.RUnlock()
+
+	if policy == engine.VolatileTTL {
+		return sampleMin(maps.All(e.deadlines), samples, skip, func(deadline time.Time) int64 {
+			return deadline.UnixNano()
+		})
+	}
+
+	now := time.Now().UnixNano()
+	switch policy {
+	case engine.AllKeysLRU:
+		return sampleMin(e.store.random(), samples, skip, func(it *item) int64 {
+			return it.accessed.Load()
+		})
+	case engine.AllKeysLFU:
+		return sampleMin(e.store.random(), samples, skip, func(it *item) int64 {
+			return int64(it.decayedFrequency(now))
+		})
+	case engine.Random:
+		return sampleMin(e.store.random(), 1, skip, func(*item) int64 { return 0 })
+	default:
+		return "", false
+	}
+}
+
+// sampleMin returns the key with the lowest score among the first samples
+// keys of seq that skip does not report true for.
+func sampleMin[V any](seq iter.Seq2[string, V], samples int, skip func([]byte) bool, score func(V) int64) (string, bool) {
+	var best string
+	var bestScore int64
+	found := false
+
+	sampled := 0
+	for key, value := range seq {
+		if sampled == samples {
+			break
+		}
+		if skip != nil && skip([]byte(key)) {
+			continue
+		}
+		sampled++
+
+		if s := score(value); !found || s < bestScore {
+			best, bestScore, found = key, s, true
+		}
+	}
+
+	return best, found
+}
@@ -0,0 +1,117 @@
+package inmemory
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+)
+
+func TestInMemoryEngine_UsedMemory(t *testing.T) {
+	e := newTestEngine(t)
+	evictor := e.(engine.Evictor)
+
+	if err := e.Set([]byte("key"), []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Set([]byte("key"), []byte("longer value")); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.(engine.Expirer).SetWithDeadline([]byte("other"), []byte("value"), time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	want := engine.EntrySize("key", "longer value") + engine.EntrySize("other", "value")
+	if got := evictor.UsedMemory(); got != want {
+		t.Errorf("expected %d bytes, got %d", want, got)
+	}
+
+	if err := e.Del([]byte("key")); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.(engine.Clearer).Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if got := evictor.UsedMemory(); got != 0 {
+		t.Errorf("expected 0 bytes after clear, got %d", got)
+	}
+}
+
+func TestInMemoryEngine_EvictionCandidate(t *testing.T) {
+	e := newTestEngine(t)
+	evictor := e.(engine.Evictor)
+	expirer := e.(engine.Expirer)
+
+	now := time.Now()
+	for i := range 10 {
+		if err := expirer.SetWithDeadline([]byte("key"+strconv.Itoa(i)), []byte("value"), now.Add(time.Duration(10-i)*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.Set([]byte("persistent"), []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Touch every key but key3, which becomes the least recently used one.
+	for i := range 10 {
+		if i == 3 {
+			continue
+		}
+		if _, err := e.Get([]byte("key" + strconv.Itoa(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := e.Get([]byte("persistent")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		policy engine.EvictionPolicy
+		want   string
+	}{
+		{policy: engine.AllKeysLRU, want: "key3"},
+		{policy: engine.VolatileTTL, want: "key9"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			got, ok := evictor.EvictionCandidate(tt.policy, 100, nil)
+			if !ok || string(got) != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+
+	skip := func(key []byte) bool { return string(key) == "key3" }
+	if got, ok := evictor.EvictionCandidate(engine.AllKeysLRU, 100, skip); !ok || string(got) == "key3" {
+		t.Errorf("expected a candidate other than the skipped key, got %q", got)
+	}
+
+	if _, ok := evictor.EvictionCandidate(engine.Random, 5, nil); !ok {
+		t.Errorf("expected a random candidate")
+	}
+	if _, ok := evictor.EvictionCandidate(engine.NoEviction, 5, nil); ok {
+		t.Errorf("expected no candidate under noeviction")
+	}
+}
+
+func TestInMemoryEngine_LFUPrefersRarelyUsedKeys(t *testing.T) {
+	e := newTestEngine(t)
+	evictor := e.(engine.Evictor)
+
+	for _, key := range []string{"hot", "cold"} {
+		if err := e.Set([]byte(key), []byte("value")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for range 1000 {
+		if _, err := e.Get([]byte("hot")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got, _ := evictor.EvictionCandidate(engine.AllKeysLFU, 10, nil); string(got) != "cold" {
+		t.Errorf("expected %q, got %q", "cold", got)
+	}
+}
@@ -0,0 +1,96 @@
+package inmemory
+
+import (
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+)
+
+func (e *InMemoryEngine) SetWithDeadline(key, value []byte, deadline time.Time) error {
+	k, v := string(key), string(value)
+
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	e.put(k, v, nil, engine.TypeString)
+	e.deadlines[k] = deadline
+
+	return nil
+}
+
+func (e *InMemoryEngine) Expire(key []byte, deadline time.Time) error {
+	k := string(key)
+
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	if _, ok := e.store.get(k); !ok || e.expired(k, time.Now()) {
+		return engine.ErrKeyNotFound
+	}
+
+	if e.snapshot != nil {
+		e.snapshot.preserve(k)
+	}
+	e.deadlines[k] = deadline
+	e.versions.Bump(k)
+
+	return nil
+}
+
+func (e *InMemoryEngine) Persist(key []byte) (bool, error) {
+	k := string(key)
+
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	if _, ok := e.store.get(k); !ok || e.expired(k, time.Now()) {
+		return false, engine.ErrKeyNotFound
+	}
+
+	if _, ok := e.deadlines[k]; !ok {
+		return false, nil
+	}
+
+	if e.snapshot != nil {
+		e.snapshot.preserve(k)
+	}
+	delete(e.deadlines, k)
+	e.versions.Bump(k)
+
+	return true, nil
+}
+
+func (e *InMemoryEngine) Deadline(key []byte) (time.Time, error) {
+	k := string(key)
+
+	e.mtx.RLock()
+	defer e.mtx.RUnlock()
+
+	if _, ok := e.store.get(k); !ok || e.expired(k, time.Now()) {
+		return time.Time{}, engine.ErrKeyNotFound
+	}
+
+	return e.deadlines[k], nil
+}
+
+// DeleteExpired relies on the randomized map iteration order to pick the
+// sample, so a call costs O(samples) no matter how many keys there are.
+func (e *InMemoryEngine) DeleteExpired(now time.Time, samples int) (int, int) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	sampled, deleted := 0, 0
+	for key, deadline := range e.deadlines {
+		if sampled == samples {
+			break
+		}
+		sampled++
+
+		if !now.Before(deadline) {
+			e.delete(key)
+			deleted++
+		}
+	}
+
+	return sampled, deleted
+}
@@ -0,0 +1,108 @@
+package inmemory
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+)
+
+func newTestExpirer(t *testing.T) (engine.Engine, engine.Expirer) {
+	t.Helper()
+
+	e := newTestEngine(t)
+	return e, e.(engine.Expirer)
+}
+
+func TestInMemoryEngine_ExpiredKeysAreHidden(t *testing.T) {
+	e, expirer := newTestExpirer(t)
+
+	if err := expirer.SetWithDeadline([]byte("key"), []byte("value"), time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := e.Get([]byte("key")); !errors.Is(err, engine.ErrKeyNotFound) {
+		t.Errorf("expected error %v, got %v", engine.ErrKeyNotFound, err)
+	}
+	if err := expirer.Expire([]byte("key"), time.Now().Add(time.Hour)); !errors.Is(err, engine.ErrKeyNotFound) {
+		t.Errorf("expected expired key not to be revived, got %v", err)
+	}
+}
+
+func TestInMemoryEngine_DeadlineLifecycle(t *testing.T) {
+	e, expirer := newTestExpirer(t)
+
+	if err := e.Set([]byte("key"), []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(time.Hour)
+	if err := expirer.Expire([]byte("key"), deadline); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := expirer.Deadline([]byte("key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(deadline) {
+		t.Errorf("expected deadline %v, got %v", deadline, got)
+	}
+
+	persisted, err := expirer.Persist([]byte("key"))
+	if err != nil || !persisted {
+		t.Fatalf("expected deadline to be removed, got %v, %v", persisted, err)
+	}
+	if persisted, _ := expirer.Persist([]byte("key")); persisted {
+		t.Errorf("expected no deadline to remove")
+	}
+
+	if err := expirer.SetWithDeadline([]byte("key"), []byte("value"), deadline); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Set([]byte("key"), []byte("other")); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := expirer.Deadline([]byte("key")); !got.IsZero() {
+		t.Errorf("expected Set to clear the deadline, got %v", got)
+	}
+
+	if err := expirer.Expire([]byte("missing"), deadline); !errors.Is(err, engine.ErrKeyNotFound) {
+		t.Errorf("expected error %v, got %v", engine.ErrKeyNotFound, err)
+	}
+}
+
+func TestInMemoryEngine_DeleteExpired(t *testing.T) {
+	e, expirer := newTestExpirer(t)
+
+	past := time.Now().Add(-time.Second)
+	for i := range 100 {
+		if err := expirer.SetWithDeadline([]byte("expired"+strconv.Itoa(i)), []byte("value"), past); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := expirer.SetWithDeadline([]byte("alive"), []byte("value"), time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Set([]byte("persistent"), []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+
+	sampled, deleted := expirer.DeleteExpired(time.Now(), 20)
+	if sampled != 20 || deleted > 20 || deleted < 19 {
+		t.Errorf("expected 20 sampled keys, got %d sampled and %d deleted", sampled, deleted)
+	}
+
+	for {
+		if _, deleted := expirer.DeleteExpired(time.Now(), 20); deleted == 0 {
+			break
+		}
+	}
+
+	//nolint:forcetypeassert
+	if n := e.(*InMemoryEngine).store.len; n != 2 {
+		t.Errorf("expected 2 keys left, got %d", n)
+	}
+}
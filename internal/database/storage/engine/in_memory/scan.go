@@ -0,0 +1,37 @@
+package inmemory
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+)
+
+// Scan holds the read lock for a single batch only, see table.scan for why
+// keys are not missed in between.
+func (e *InMemoryEngine) Scan(cursor string, count int) ([][]byte, string, error) {
+	var position uint64
+	if cursor != "" {
+		var err error
+		if position, err = strconv.ParseUint(cursor, 10, 64); err != nil {
+			return nil, "", engine.ErrInvalidCursor
+		}
+	}
+
+	keys := make([][]byte, 0, count)
+
+	now := time.Now()
+	e.mtx.RLock()
+	position = e.store.scan(position, count, func(key string, _ *item) {
+		if !e.expired(key, now) {
+			keys = append(keys, []byte(key))
+		}
+	})
+	e.mtx.RUnlock()
+
+	if position == 0 {
+		return keys, "", nil
+	}
+
+	return keys, strconv.FormatUint(position, 10), nil
+}
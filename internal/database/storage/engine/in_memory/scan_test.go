@@ -0,0 +1,63 @@
+package inmemory
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+)
+
+func TestInMemoryEngine_Scan(t *testing.T) {
+	e := newTestEngine(t)
+	//nolint:forcetypeassert
+	scanner := e.(engine.Scanner)
+	//nolint:forcetypeassert
+	expirer := e.(engine.Expirer)
+
+	var want []string
+	for i := range 300 {
+		key := "key" + strconv.Itoa(i)
+		want = append(want, key)
+		if err := e.Set([]byte(key), []byte("value")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := expirer.SetWithDeadline([]byte("expired"), []byte("value"), time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	cursor, calls := "", 0
+	for {
+		keys, next, err := scanner.Scan(cursor, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, key := range keys {
+			got = append(got, string(key))
+		}
+		calls++
+
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	if calls < 2 {
+		t.Errorf("expected the scan to take several calls, got %d", calls)
+	}
+
+	slices.Sort(got)
+	slices.Sort(want)
+	if !slices.Equal(got, want) {
+		t.Errorf("expected %d keys, got %d: %v", len(want), len(got), got)
+	}
+
+	if _, _, err := scanner.Scan("not-a-cursor", 10); !errors.Is(err, engine.ErrInvalidCursor) {
+		t.Errorf("expected ErrInvalidCursor, got %v", err)
+	}
+}
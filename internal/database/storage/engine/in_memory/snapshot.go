@@ -0,0 +1,104 @@
+package inmemory
+
+import (
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+)
+
+const snapshotChunkSize = 1024
+
+// snapshot is a copy-on-write view of the store: the key set is captured when
+// the snapshot starts and writers stash the previous value of a key the first
+// time they modify or delete it, so ForEach never observes later mutations.
+type snapshot struct {
+	engine *InMemoryEngine
+	keys   []string
+	frozen map[string]engine.Entry
+}
+
+func (e *InMemoryEngine) Snapshot() (engine.Snapshot, error) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	if e.snapshot != nil {
+		return nil, engine.ErrSnapshotInProgress
+	}
+
+	keys := make([]string, 0, e.store.len)
+	for key := range e.store.all() {
+		keys = append(keys, key)
+	}
+
+	e.snapshot = &snapshot{
+		engine: e,
+		keys:   keys,
+		frozen: make(map[string]engine.Entry),
+	}
+
+	return e.snapshot, nil
+}
+
+// preserve must be called with the write lock held before key is modified.
+func (s *snapshot) preserve(key string) {
+	if _, ok := s.frozen[key]; ok {
+		return
+	}
+
+	entry, ok := s.engine.entry(key)
+	if !ok {
+		return
+	}
+
+	s.frozen[key] = entry
+}
+
+// entry must be called with the lock held.
+func (e *InMemoryEngine) entry(key string) (engine.Entry, bool) {
+	it, ok := e.store.get(key)
+	if !ok {
+		return engine.Entry{}, false
+	}
+
+	return engine.Entry{Key: []byte(key), Value: it.encoded(), Object: nil, Type: it.typ, Deadline: e.deadlines[key]}, true
+}
+
+// ForEach skips keys that have already expired by the time they are visited.
+func (s *snapshot) ForEach(fn func(entry engine.Entry) error) error {
+	chunk := make([]engine.Entry, 0, snapshotChunkSize)
+
+	for start := 0; start < len(s.keys); start += snapshotChunkSize {
+		end := min(start+snapshotChunkSize, len(s.keys))
+		chunk = chunk[:0]
+
+		now := time.Now()
+		s.engine.mtx.RLock()
+		for _, key := range s.keys[start:end] {
+			entry, ok := s.frozen[key]
+			if !ok {
+				entry, ok = s.engine.entry(key)
+			}
+			if ok && !entry.Expired(now) {
+				chunk = append(chunk, entry)
+			}
+		}
+		s.engine.mtx.RUnlock()
+
+		for _, entry := range chunk {
+			if err := fn(entry); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *snapshot) Release() {
+	s.engine.mtx.Lock()
+	defer s.engine.mtx.Unlock()
+
+	if s.engine.snapshot == s {
+		s.engine.snapshot = nil
+	}
+}
@@ -0,0 +1,98 @@
+package inmemory
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+)
+
+func collect(t *testing.T, snap engine.Snapshot) map[string]string {
+	t.Helper()
+
+	result := make(map[string]string)
+	err := snap.ForEach(func(entry engine.Entry) error {
+		result[string(entry.Key)] = string(entry.Value)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ForEach() error = %v", err)
+	}
+
+	return result
+}
+
+func TestInMemoryEngine_SnapshotIsPointInTime(t *testing.T) {
+	e := newTestEngine(t)
+
+	for i := range 3000 {
+		if err := e.Set([]byte("key"+strconv.Itoa(i)), []byte("value"+strconv.Itoa(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	snap, err := e.(engine.Snapshotter).Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e.Set([]byte("key1"), []byte("changed")); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Set([]byte("key1"), []byte("changed again")); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Del([]byte("key2")); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Set([]byte("new_key"), []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+
+	got := collect(t, snap)
+	snap.Release()
+
+	if len(got) != 3000 {
+		t.Errorf("expected 3000 entries, got %d", len(got))
+	}
+	if got["key1"] != "value1" {
+		t.Errorf("expected value %v, got %v", "value1", got["key1"])
+	}
+	if got["key2"] != "value2" {
+		t.Errorf("expected deleted key to be in snapshot, got %q", got["key2"])
+	}
+	if _, ok := got["new_key"]; ok {
+		t.Errorf("expected key created after snapshot to be absent")
+	}
+
+	value, err := e.Get([]byte("key1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(value) != "changed again" {
+		t.Errorf("expected value %v, got %v", "changed again", value)
+	}
+}
+
+func TestInMemoryEngine_SnapshotInProgress(t *testing.T) {
+	e := newTestEngine(t)
+	snapshotter := e.(engine.Snapshotter)
+
+	snap, err := snapshotter.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := snapshotter.Snapshot(); !errors.Is(err, engine.ErrSnapshotInProgress) {
+		t.Errorf("expected error %v, got %v", engine.ErrSnapshotInProgress, err)
+	}
+
+	snap.Release()
+
+	snap, err = snapshotter.Snapshot()
+	if err != nil {
+		t.Errorf("expected snapshot after release, got error %v", err)
+	}
+	snap.Release()
+}
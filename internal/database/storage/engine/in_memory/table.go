@@ -0,0 +1,189 @@
+package inmemory
+
+import (
+	"hash/maphash"
+	"iter"
+	"math/bits"
+	"math/rand/v2"
+)
+
+// maxBucketLen is the number of keys a bucket holds before it is split. It
+// also bounds how much work a single Scan step does.
+const maxBucketLen = 64
+
+// hashBits bounds the depth of a bucket, as keys whose hashes are equal can
+// not be told apart by splitting.
+const hashBits = 64
+
+// scanEmptySlotsFactor limits how many empty slots a Scan call visits per key
+// it was asked for before returning, so a sparse table does not stall writers.
+const scanEmptySlotsFactor = 10
+
+type bucket struct {
+	depth uint
+	items map[string]*item
+}
+
+// table is an extendible hash table: a directory of 2^depth slots indexed by
+// the low bits of a key's hash, each pointing at a bucket that holds the keys
+// of one or more slots. A full bucket is split on its own, so the table grows
+// without rehashing everything at once. Keys are partitioned by hash, which
+// is what lets scan resume from a cursor while the table changes.
+type table struct {
+	seed  maphash.Seed
+	depth uint
+	dir   []*bucket
+	len   int
+}
+
+func newTable() *table {
+	return &table{
+		seed:  maphash.MakeSeed(),
+		depth: 0,
+		dir:   []*bucket{{depth: 0, items: make(map[string]*item)}},
+		len:   0,
+	}
+}
+
+func (t *table) hash(key string) uint64 {
+	return maphash.String(t.seed, key)
+}
+
+func (t *table) mask() uint64 {
+	return uint64(len(t.dir) - 1)
+}
+
+func (t *table) get(key string) (*item, bool) {
+	it, ok := t.dir[t.hash(key)&t.mask()].items[key]
+	return it, ok
+}
+
+// put stores it under key and returns the item it replaced, if any.
+func (t *table) put(key string, it *item) (*item, bool) {
+	h := t.hash(key)
+
+	slot := h & t.mask()
+	b := t.dir[slot]
+	if old, ok := b.items[key]; ok {
+		b.items[key] = it
+		return old, true
+	}
+
+	for len(b.items) >= maxBucketLen && b.depth < hashBits {
+		t.split(slot)
+		slot = h & t.mask()
+		b = t.dir[slot]
+	}
+
+	b.items[key] = it
+	t.len++
+
+	return nil, false
+}
+
+// split divides the bucket of slot in two by the next bit of the hash,
+// doubling the directory first if the bucket is referenced by a single slot.
+func (t *table) split(slot uint64) {
+	b := t.dir[slot]
+	if b.depth == t.depth {
+		t.dir = append(t.dir, t.dir...)
+		t.depth++
+	}
+
+	low := &bucket{depth: b.depth + 1, items: make(map[string]*item)}
+	high := &bucket{depth: b.depth + 1, items: make(map[string]*item)}
+	for key, it := range b.items {
+		if t.hash(key)>>b.depth&1 == 0 {
+			low.items[key] = it
+		} else {
+			high.items[key] = it
+		}
+	}
+
+	for i := slot & (1<<b.depth - 1); i < uint64(len(t.dir)); i += 1 << b.depth {
+		if i>>b.depth&1 == 0 {
+			t.dir[i] = low
+		} else {
+			t.dir[i] = high
+		}
+	}
+}
+
+// delete removes key and returns the item it held, if any. Buckets are never
+// merged back.
+func (t *table) delete(key string) (*item, bool) {
+	b := t.dir[t.hash(key)&t.mask()]
+
+	it, ok := b.items[key]
+	if ok {
+		delete(b.items, key)
+		t.len--
+	}
+
+	return it, ok
+}
+
+// all iterates over every key, in no particular order.
+func (t *table) all() iter.Seq2[string, *item] {
+	return t.from(0)
+}
+
+// random iterates over every key starting from a random slot, so that
+// stopping early yields a sample of the keys.
+func (t *table) random() iter.Seq2[string, *item] {
+	return t.from(rand.Uint64N(uint64(len(t.dir))))
+}
+
+// from iterates over the buckets starting at slot and wrapping around. A
+// bucket of depth d is visited from the one slot below 2^d that points at it.
+func (t *table) from(start uint64) iter.Seq2[string, *item] {
+	return func(yield func(string, *item) bool) {
+		for n := range uint64(len(t.dir)) {
+			slot := (start + n) & t.mask()
+
+			b := t.dir[slot]
+			if slot >= 1<<b.depth {
+				continue
+			}
+
+			for key, it := range b.items {
+				if !yield(key, it) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// scan calls fn with the keys of the slots from cursor on, until about count
+// keys were seen, and returns the cursor to continue from, which is 0 once
+// every slot has been visited.
+//
+// Slots are visited in the order of their bit-reversed index, as in Redis.
+// When the directory doubles, slot s becomes slots s and s+2^depth, which sit
+// next to each other in that order: both come before the cursor if s was
+// visited and after it otherwise. So a key present for the whole scan is
+// returned exactly once, without the table having to be frozen.
+func (t *table) scan(cursor uint64, count int, fn func(key string, it *item)) uint64 {
+	mask := t.mask()
+
+	seen, visited := 0, 0
+	for {
+		slot := cursor & mask
+		b := t.dir[slot]
+		for key, it := range b.items {
+			if b.depth == t.depth || t.hash(key)&mask == slot {
+				fn(key, it)
+				seen++
+			}
+		}
+		visited++
+
+		cursor |= ^mask
+		cursor = bits.Reverse64(bits.Reverse64(cursor) + 1)
+
+		if cursor == 0 || seen >= count || visited >= count*scanEmptySlotsFactor {
+			return cursor
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package inmemory
+
+import (
+	"math/rand/v2"
+	"strconv"
+	"testing"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+)
+
+func TestTable_MatchesMap(t *testing.T) {
+	tbl := newTable()
+	want := make(map[string]string)
+
+	for i := range 20000 {
+		key := "key" + strconv.Itoa(rand.IntN(5000))
+		if rand.IntN(4) == 0 {
+			_, deleted := tbl.delete(key)
+			if _, ok := want[key]; ok != deleted {
+				t.Fatalf("delete %q: expected %v, got %v", key, ok, deleted)
+			}
+			delete(want, key)
+			continue
+		}
+
+		value := strconv.Itoa(i)
+		_, replaced := tbl.put(key, newItem(value, nil, engine.TypeString, 0))
+		if _, ok := want[key]; ok != replaced {
+			t.Fatalf("put %q: expected replaced %v, got %v", key, ok, replaced)
+		}
+		want[key] = value
+	}
+
+	if tbl.depth == 0 {
+		t.Fatal("expected the table to have split")
+	}
+	if tbl.len != len(want) {
+		t.Fatalf("expected %d keys, got %d", len(want), tbl.len)
+	}
+
+	for key, value := range want {
+		if it, ok := tbl.get(key); !ok || it.value != value {
+			t.Fatalf("get %q: expected %q", key, value)
+		}
+	}
+
+	for name, seq := range map[string]func(func(string, *item) bool){"all": tbl.all(), "random": tbl.random()} {
+		seen := make(map[string]int)
+		for key := range seq {
+			seen[key]++
+		}
+		if len(seen) != len(want) {
+			t.Errorf("%s: expected %d keys, got %d", name, len(want), len(seen))
+		}
+		for key, n := range seen {
+			if n != 1 {
+				t.Errorf("%s: key %q visited %d times", name, key, n)
+			}
+		}
+	}
+}
+
+func TestTable_ScanWhileGrowing(t *testing.T) {
+	tbl := newTable()
+	for i := range 500 {
+		tbl.put("stable"+strconv.Itoa(i), newItem("", nil, engine.TypeString, 0))
+	}
+
+	depth := tbl.depth
+
+	seen := make(map[string]int)
+	cursor, added := uint64(0), 0
+	for {
+		cursor = tbl.scan(cursor, 20, func(key string, _ *item) {
+			seen[key]++
+		})
+		if cursor == 0 {
+			break
+		}
+
+		// Grow the table several times over and churn keys between the
+		// first batches.
+		if added >= 5000 {
+			continue
+		}
+		for range 500 {
+			tbl.put("added"+strconv.Itoa(added), newItem("", nil, engine.TypeString, 0))
+			tbl.delete("added" + strconv.Itoa(added/2))
+			added++
+		}
+	}
+
+	if tbl.depth < depth+2 {
+		t.Fatalf("expected the table to grow during the scan, depth went from %d to %d", depth, tbl.depth)
+	}
+
+	for i := range 500 {
+		key := "stable" + strconv.Itoa(i)
+		if n := seen[key]; n != 1 {
+			t.Errorf("expected %q to be returned once, got %d", key, n)
+		}
+	}
+}
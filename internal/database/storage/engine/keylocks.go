@@ -0,0 +1,83 @@
+package engine
+
+import (
+	"hash/maphash"
+	"slices"
+	"sync"
+)
+
+// KeyLocks locks groups of keys at once, for operations that span several
+// keys and must not interleave with operations on any of them. Keys are
+// hashed onto a fixed number of stripes, so unrelated keys may share a lock.
+// Stripes are always taken in the same order, which keeps two callers that
+// lock overlapping keys from deadlocking.
+type KeyLocks struct {
+	seed    maphash.Seed
+	stripes []sync.RWMutex
+}
+
+func NewKeyLocks(stripes int) *KeyLocks {
+	return &KeyLocks{
+		seed:    maphash.MakeSeed(),
+		stripes: make([]sync.RWMutex, max(stripes, 1)),
+	}
+}
+
+// Lock locks keys for exclusive use and returns the function that unlocks
+// them.
+func (l *KeyLocks) Lock(keys []string) func() {
+	return l.lock(l.indexes(keys), false)
+}
+
+// RLock locks keys for use alongside other RLock callers.
+func (l *KeyLocks) RLock(keys []string) func() {
+	return l.lock(l.indexes(keys), true)
+}
+
+// LockAll locks every key, including keys that do not exist yet.
+func (l *KeyLocks) LockAll() func() {
+	return l.lock(l.all(), false)
+}
+
+func (l *KeyLocks) RLockAll() func() {
+	return l.lock(l.all(), true)
+}
+
+func (l *KeyLocks) indexes(keys []string) []int {
+	indexes := make([]int, 0, len(keys))
+	for _, key := range keys {
+		indexes = append(indexes, int(maphash.String(l.seed, key)%uint64(len(l.stripes))))
+	}
+
+	slices.Sort(indexes)
+	return slices.Compact(indexes)
+}
+
+func (l *KeyLocks) all() []int {
+	indexes := make([]int, len(l.stripes))
+	for i := range indexes {
+		indexes[i] = i
+	}
+
+	return indexes
+}
+
+func (l *KeyLocks) lock(indexes []int, shared bool) func() {
+	for _, i := range indexes {
+		if shared {
+			l.stripes[i].RLock()
+		} else {
+			l.stripes[i].Lock()
+		}
+	}
+
+	return func() {
+		for _, i := range slices.Backward(indexes) {
+			if shared {
+				l.stripes[i].RUnlock()
+			} else {
+				l.stripes[i].Unlock()
+			}
+		}
+	}
+}
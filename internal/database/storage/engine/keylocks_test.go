@@ -0,0 +1,47 @@
+package engine
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestKeyLocks(t *testing.T) {
+	locks := NewKeyLocks(16)
+
+	unlock := locks.Lock([]string{"a", "b", "a"})
+
+	acquired := make(chan struct{})
+	go func() {
+		defer locks.RLock([]string{"b"})()
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("expected RLock to wait for Lock")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	unlock()
+	<-acquired
+
+	// Callers locking the same keys in opposite orders must not deadlock.
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				keys := []string{"x", "y", "z"}
+				if i%2 == 0 {
+					keys = []string{"z", "y", "x"}
+				}
+				locks.Lock(keys)()
+				locks.RLockAll()()
+				locks.LockAll()()
+			}
+		}()
+	}
+	wg.Wait()
+}
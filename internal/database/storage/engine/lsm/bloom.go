@@ -0,0 +1,83 @@
+package lsm
+
+import (
+	"hash/fnv"
+)
+
+// bloomFilter answers whether a table may contain a key. Its k probes are
+// derived from the two halves of a single 64-bit hash.
+type bloomFilter struct {
+	bits   []byte
+	probes uint32
+}
+
+func newBloomFilter(keys int, bitsPerKey int) *bloomFilter {
+	nbits := max(keys*bitsPerKey, 64)
+
+	// ln(2) * bits per key minimizes the false positive rate.
+	probes := uint32(max(1, min(30, bitsPerKey*69/100)))
+
+	return &bloomFilter{
+		bits:   make([]byte, (nbits+7)/8),
+		probes: probes,
+	}
+}
+
+func bloomHash(key string) (uint32, uint32) {
+	h := fnv.New64a()
+	//nolint:errcheck
+	h.Write([]byte(key))
+	sum := h.Sum64()
+
+	//nolint:gosec
+	return uint32(sum), uint32(sum >> 32)
+}
+
+func (f *bloomFilter) add(key string) {
+	f.addHash(bloomHash(key))
+}
+
+func (f *bloomFilter) addHash(h1, h2 uint32) {
+	//nolint:gosec
+	nbits := uint32(len(f.bits) * 8)
+
+	for i := range f.probes {
+		bit := (h1 + i*h2) % nbits
+		f.bits[bit/8] |= 1 << (bit % 8)
+	}
+}
+
+func (f *bloomFilter) mayContain(key string) bool {
+	if len(f.bits) == 0 {
+		return true
+	}
+
+	h1, h2 := bloomHash(key)
+	//nolint:gosec
+	nbits := uint32(len(f.bits) * 8)
+
+	for i := range f.probes {
+		bit := (h1 + i*h2) % nbits
+		if f.bits[bit/8]&(1<<(bit%8)) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// encode appends the probe count to the bit array.
+func (f *bloomFilter) encode() []byte {
+	return append(append([]byte(nil), f.bits...), byte(f.probes))
+}
+
+func decodeBloomFilter(data []byte) *bloomFilter {
+	if len(data) == 0 {
+		return &bloomFilter{bits: nil, probes: 0}
+	}
+
+	return &bloomFilter{
+		bits:   data[:len(data)-1],
+		probes: uint32(data[len(data)-1]),
+	}
+}
@@ -0,0 +1,285 @@
+package lsm
+
+import (
+	"container/heap"
+	"os"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func (e *LSMEngine) flushLoop() {
+	defer e.wg.Done()
+
+	for {
+		select {
+		case <-e.done:
+			return
+		case <-e.flushCh:
+			if err := e.flush(); err != nil {
+				e.logger.Error("failed to flush memtable", zap.Error(err))
+
+				e.mtx.Lock()
+				e.bgErr = err
+				e.flushed.Broadcast()
+				e.mtx.Unlock()
+			}
+		}
+	}
+}
+
+// flush writes the immutable memtable to a new table, which then takes the
+// memtable's place, and drops the log that backed it.
+func (e *LSMEngine) flush() error {
+	e.mtx.Lock()
+	imm := e.imm
+	if imm == nil {
+		e.mtx.Unlock()
+		return nil
+	}
+	number := e.allocateFile()
+	e.mtx.Unlock()
+
+	start := time.Now()
+	t, err := writeTable(fileName(e.dir, number, tableSuffix), number, &sliceIterator{entries: imm.sorted()}, e.blockSize, e.bloomBitsPerKey)
+	if err != nil {
+		return err
+	}
+
+	e.mtx.Lock()
+	if t != nil {
+		e.tables = append([]*table{t}, e.tables...)
+	}
+	e.imm = nil
+	err = e.saveManifest()
+	e.flushed.Broadcast()
+	tables := len(e.tables)
+	e.mtx.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(fileName(e.dir, imm.logNumber, logSuffix)); err != nil {
+		return err
+	}
+
+	e.logger.Debug(
+		"flushed memtable",
+		zap.Uint64("table", number),
+		zap.Int("entries", len(imm.records)),
+		zap.Int("tables", tables),
+		zap.Duration("duration", time.Since(start)),
+	)
+
+	e.triggerCompaction()
+
+	return nil
+}
+
+func (e *LSMEngine) triggerCompaction() {
+	select {
+	case e.compactCh <- struct{}{}:
+	default:
+	}
+}
+
+func (e *LSMEngine) compactLoop() {
+	defer e.wg.Done()
+
+	for {
+		select {
+		case <-e.done:
+			return
+		case <-e.compactCh:
+			if err := e.compact(); err != nil {
+				e.logger.Error("failed to compact tables", zap.Error(err))
+			}
+		}
+	}
+}
+
+// compact merges all tables into one once there are compactionThreshold of
+// them. Since the result replaces the oldest table as well, shadowed values,
+// tombstones and expired entries can all be dropped.
+func (e *LSMEngine) compact() error {
+	e.mtx.Lock()
+	if len(e.tables) < e.compactionThreshold {
+		e.mtx.Unlock()
+		return nil
+	}
+	inputs := e.acquireTables()
+	number := e.allocateFile()
+	e.mtx.Unlock()
+
+	defer e.releaseTables(inputs)
+
+	start := time.Now()
+	iterators := make([]iterator, 0, len(inputs))
+	for _, t := range inputs {
+		iterators = append(iterators, newTableIterator(t))
+	}
+
+	merged := &liveIterator{it: newMergeIterator(iterators), now: time.Now().UnixNano()}
+	path := fileName(e.dir, number, tableSuffix)
+	output, err := writeTable(path, number, merged, e.blockSize, e.bloomBitsPerKey)
+	if err != nil {
+		return err
+	}
+
+	e.mtx.Lock()
+	// Tables flushed in the meantime are newer than every input. If the
+	// inputs are gone, the engine was cleared and the output is stale.
+	n := len(e.tables) - len(inputs)
+	if n < 0 || !slices.Equal(e.tables[n:], inputs) {
+		e.mtx.Unlock()
+		if output != nil {
+			output.obsolete.Store(true)
+			output.unref()
+		}
+		return nil
+	}
+
+	replaced := e.tables[n:]
+	tables := slices.Clone(e.tables[:n])
+	if output != nil {
+		tables = append(tables, output)
+	}
+	e.tables = tables
+	err = e.saveManifest()
+	e.mtx.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	var inputSize, outputSize int64
+	for _, t := range replaced {
+		inputSize += t.size
+		t.obsolete.Store(true)
+		t.unref()
+	}
+	if output != nil {
+		outputSize = output.size
+	}
+
+	e.logger.Info(
+		"compacted tables",
+		zap.Int("tables_merged", len(replaced)),
+		zap.Int64("bytes_before", inputSize),
+		zap.Int64("bytes_after", outputSize),
+		zap.Duration("duration", time.Since(start)),
+	)
+
+	return nil
+}
+
+// liveIterator drops tombstones and expired entries. It may only be used when
+// nothing older than its source can still hold the key.
+type liveIterator struct {
+	it  iterator
+	now int64
+}
+
+func (it *liveIterator) next() (entry, bool, error) {
+	for {
+		e, ok, err := it.it.next()
+		if err != nil || !ok {
+			return e, ok, err
+		}
+		if e.visible(it.now) {
+			return e, true, nil
+		}
+	}
+}
+
+// mergeIterator merges sorted iterators, ordered newest first, into one
+// sorted stream that holds only the newest record of every key.
+type mergeIterator struct {
+	heap mergeHeap
+	err  error
+}
+
+type mergeItem struct {
+	entry entry
+	rank  int
+	it    iterator
+}
+
+type mergeHeap []*mergeItem
+
+func (h mergeHeap) Len() int { return len(h) }
+
+func (h mergeHeap) Less(i, j int) bool {
+	if h[i].entry.key != h[j].entry.key {
+		return h[i].entry.key < h[j].entry.key
+	}
+
+	return h[i].rank < h[j].rank
+}
+
+func (h mergeHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *mergeHeap) Push(x any) {
+	//nolint:forcetypeassert
+	*h = append(*h, x.(*mergeItem))
+}
+
+func (h *mergeHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+
+	return item
+}
+
+func newMergeIterator(iterators []iterator) *mergeIterator {
+	m := &mergeIterator{heap: make(mergeHeap, 0, len(iterators)), err: nil}
+	for rank, it := range iterators {
+		m.advance(&mergeItem{entry: entry{}, rank: rank, it: it})
+	}
+
+	return m
+}
+
+// advance moves item to the next entry of its iterator and puts it back on
+// the heap, or drops it once the iterator is exhausted.
+func (m *mergeIterator) advance(item *mergeItem) {
+	e, ok, err := item.it.next()
+	if err != nil {
+		m.err = err
+		return
+	}
+	if !ok {
+		return
+	}
+
+	item.entry = e
+	heap.Push(&m.heap, item)
+}
+
+func (m *mergeIterator) next() (entry, bool, error) {
+	if m.err != nil {
+		return entry{}, false, m.err
+	}
+	if m.heap.Len() == 0 {
+		return entry{}, false, nil
+	}
+
+	//nolint:forcetypeassert
+	top := heap.Pop(&m.heap).(*mergeItem)
+	result := top.entry
+	m.advance(top)
+
+	for m.heap.Len() > 0 && m.heap[0].entry.key == result.key {
+		//nolint:forcetypeassert
+		m.advance(heap.Pop(&m.heap).(*mergeItem))
+	}
+
+	if m.err != nil {
+		return entry{}, false, m.err
+	}
+
+	return result, true, nil
+}
@@ -0,0 +1,94 @@
+package lsm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+)
+
+var ErrCorrupted = errors.New("corrupted lsm data")
+
+// A typed value is followed by its type; plain values are strings, which is
+// all that files written before values had types hold.
+const (
+	kindValue      byte = 0
+	kindTombstone  byte = 1
+	kindTypedValue byte = 2
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+func appendEntry(buf []byte, e entry) []byte {
+	switch {
+	case e.tombstone:
+		buf = append(buf, kindTombstone)
+	case e.typ != engine.TypeString:
+		buf = append(buf, kindTypedValue, byte(e.typ))
+	default:
+		buf = append(buf, kindValue)
+	}
+
+	buf = binary.AppendUvarint(buf, uint64(len(e.key)))
+	buf = append(buf, e.key...)
+	buf = binary.AppendVarint(buf, e.deadline)
+	buf = binary.AppendUvarint(buf, uint64(len(e.value)))
+	buf = append(buf, e.value...)
+
+	return buf
+}
+
+// decodeEntry parses an entry from the start of data and returns the number
+// of bytes it took.
+func decodeEntry(data []byte) (entry, int, error) {
+	var e entry
+
+	if len(data) < 1 || data[0] > kindTypedValue {
+		return e, 0, fmt.Errorf("%w: invalid entry kind", ErrCorrupted)
+	}
+	e.tombstone = data[0] == kindTombstone
+	pos := 1
+
+	if data[0] == kindTypedValue {
+		if len(data) < 2 {
+			return e, 0, fmt.Errorf("%w: missing value type", ErrCorrupted)
+		}
+		e.typ = engine.ValueType(data[1])
+		pos++
+	}
+
+	key, n, err := decodeString(data[pos:])
+	if err != nil {
+		return e, 0, err
+	}
+	e.key = key
+	pos += n
+
+	deadline, n := binary.Varint(data[pos:])
+	if n <= 0 {
+		return e, 0, fmt.Errorf("%w: invalid deadline", ErrCorrupted)
+	}
+	e.deadline = deadline
+	pos += n
+
+	value, n, err := decodeString(data[pos:])
+	if err != nil {
+		return e, 0, err
+	}
+	e.value = value
+	pos += n
+
+	return e, pos, nil
+}
+
+func decodeString(data []byte) (string, int, error) {
+	length, n := binary.Uvarint(data)
+	if n <= 0 || length > uint64(len(data)-n) {
+		return "", 0, fmt.Errorf("%w: invalid string length", ErrCorrupted)
+	}
+
+	end := n + int(length)
+	return string(data[n:end]), end, nil
+}
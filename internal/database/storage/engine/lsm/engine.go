@@ -0,0 +1,582 @@
+package lsm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+	"go.uber.org/zap"
+)
+
+const (
+	Name = "lsm"
+
+	defaultMemtableSize        = 4 << 20
+	defaultBlockSize           = 4 << 10
+	defaultBloomBitsPerKey     = 10
+	defaultCompactionThreshold = 4
+)
+
+var ErrClosed = errors.New("lsm engine is closed")
+
+type Config struct {
+	DataDirectory       string `mapstructure:"data_directory" validate:"required"`
+	MemtableSize        int64  `mapstructure:"memtable_size" validate:"omitempty,min=1"`
+	BlockSize           int    `mapstructure:"block_size" validate:"omitempty,min=1"`
+	BloomBitsPerKey     int    `mapstructure:"bloom_bits_per_key" validate:"omitempty,min=1,max=30"`
+	CompactionThreshold int    `mapstructure:"compaction_threshold" validate:"omitempty,min=2"`
+}
+
+func init() {
+	engine.Register(Name, NewLSMEngine)
+}
+
+// LSMEngine is a log-structured merge tree. Writes go to a log and an
+// in-memory memtable, which is flushed to an immutable sorted table once it
+// grows past the configured size. Tables are merged in the background.
+type LSMEngine struct {
+	dir                 string
+	memtableSize        int64
+	blockSize           int
+	bloomBitsPerKey     int
+	compactionThreshold int
+	logger              *zap.Logger
+
+	// writeMtx serializes writers, which also makes read-modify-write
+	// operations atomic, and guards the log and the versions of keys.
+	writeMtx sync.Mutex
+	log      *logWriter
+	versions engine.Versions
+
+	// mtx guards the memtables, the table list and the file counter. flushed
+	// is signalled whenever the immutable memtable has been flushed.
+	mtx      sync.RWMutex
+	flushed  *sync.Cond
+	mem      *memtable
+	imm      *memtable
+	tables   []*table
+	nextFile uint64
+	bgErr    error
+	closed   bool
+
+	flushCh   chan struct{}
+	compactCh chan struct{}
+	done      chan struct{}
+	wg        sync.WaitGroup
+}
+
+func NewLSMEngine(cfg *Config, logger *zap.Logger) (engine.Engine, error) {
+	if cfg == nil {
+		return nil, errors.New("lsm config is nil")
+	}
+
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	//nolint:exhaustruct
+	e := &LSMEngine{
+		dir:                 cfg.DataDirectory,
+		memtableSize:        cfg.MemtableSize,
+		blockSize:           cfg.BlockSize,
+		bloomBitsPerKey:     cfg.BloomBitsPerKey,
+		compactionThreshold: cfg.CompactionThreshold,
+		logger:              logger,
+		flushCh:             make(chan struct{}, 1),
+		compactCh:           make(chan struct{}, 1),
+		done:                make(chan struct{}),
+	}
+	e.flushed = sync.NewCond(&e.mtx)
+
+	if e.memtableSize == 0 {
+		e.memtableSize = defaultMemtableSize
+	}
+	if e.blockSize == 0 {
+		e.blockSize = defaultBlockSize
+	}
+	if e.bloomBitsPerKey == 0 {
+		e.bloomBitsPerKey = defaultBloomBitsPerKey
+	}
+	if e.compactionThreshold == 0 {
+		e.compactionThreshold = defaultCompactionThreshold
+	}
+
+	//nolint:gosec
+	if err := os.MkdirAll(e.dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create lsm directory: %w", err)
+	}
+
+	if err := e.recover(); err != nil {
+		e.releaseTables(e.tables)
+		return nil, err
+	}
+
+	e.wg.Add(2)
+	go e.flushLoop()
+	go e.compactLoop()
+
+	e.triggerCompaction()
+
+	return e, nil
+}
+
+// recover opens the tables listed in the manifest and replays the logs that
+// were not flushed yet into a fresh table, so that it always starts with an
+// empty memtable and log.
+func (e *LSMEngine) recover() error {
+	m, err := loadManifest(e.dir)
+	if err != nil {
+		return err
+	}
+	e.nextFile = m.nextFile
+
+	for _, number := range m.tables {
+		t, err := openTable(fileName(e.dir, number, tableSuffix), number)
+		if err != nil {
+			return err
+		}
+		e.tables = append(e.tables, t)
+	}
+
+	logs, err := e.removeUnusedFiles(m)
+	if err != nil {
+		return err
+	}
+
+	replayed := newMemtable(0)
+	for _, number := range logs {
+		if err := replayLog(fileName(e.dir, number, logSuffix), func(en entry) error {
+			replayed.put(en.key, en.record)
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+
+	if !replayed.empty() {
+		number := e.allocateFile()
+		t, err := writeTable(fileName(e.dir, number, tableSuffix), number, &sliceIterator{entries: replayed.sorted()}, e.blockSize, e.bloomBitsPerKey)
+		if err != nil {
+			return err
+		}
+		if t != nil {
+			e.tables = append([]*table{t}, e.tables...)
+		}
+	}
+
+	if err := e.newLog(); err != nil {
+		return err
+	}
+	e.mem = newMemtable(e.log.number)
+
+	if err := e.saveManifest(); err != nil {
+		return err
+	}
+
+	for _, number := range logs {
+		if err := os.Remove(fileName(e.dir, number, logSuffix)); err != nil {
+			return fmt.Errorf("failed to remove lsm log: %w", err)
+		}
+	}
+
+	e.logger.Info(
+		"lsm engine opened",
+		zap.String("data_directory", e.dir),
+		zap.Int("tables", len(e.tables)),
+		zap.Int("logs_replayed", len(logs)),
+	)
+
+	return nil
+}
+
+// removeUnusedFiles deletes tables left over by an interrupted flush or
+// compaction along with logs that were already flushed, and returns the logs
+// that still have to be replayed in order.
+func (e *LSMEngine) removeUnusedFiles(m manifest) ([]uint64, error) {
+	entries, err := os.ReadDir(e.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lsm directory: %w", err)
+	}
+
+	var logs []uint64
+	for _, entry := range entries {
+		name := entry.Name()
+		path := filepath.Join(e.dir, name)
+
+		if strings.HasSuffix(name, tmpSuffix) {
+			//nolint:errcheck
+			os.Remove(path)
+			continue
+		}
+
+		ext := filepath.Ext(name)
+		number, err := strconv.ParseUint(strings.TrimSuffix(name, ext), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		switch {
+		case ext == logSuffix && number >= m.logNumber:
+			logs = append(logs, number)
+		case ext == logSuffix, ext == tableSuffix && !slices.Contains(m.tables, number):
+			if err := os.Remove(path); err != nil {
+				return nil, fmt.Errorf("failed to remove unused lsm file: %w", err)
+			}
+		}
+	}
+
+	sort.Slice(logs, func(i, j int) bool { return logs[i] < logs[j] })
+
+	return logs, nil
+}
+
+// allocateFile must be called with mtx held, or before the engine is shared.
+func (e *LSMEngine) allocateFile() uint64 {
+	number := e.nextFile
+	e.nextFile++
+
+	return number
+}
+
+// newLog must be called with writeMtx and mtx held, or before the engine is
+// shared.
+func (e *LSMEngine) newLog() error {
+	number := e.allocateFile()
+	log, err := createLog(fileName(e.dir, number, logSuffix), number)
+	if err != nil {
+		return err
+	}
+	e.log = log
+
+	return nil
+}
+
+// saveManifest must be called with mtx held.
+func (e *LSMEngine) saveManifest() error {
+	m := manifest{
+		nextFile:  e.nextFile,
+		logNumber: e.mem.logNumber,
+		tables:    make([]uint64, 0, len(e.tables)),
+	}
+	if e.imm != nil {
+		m.logNumber = e.imm.logNumber
+	}
+	for _, t := range e.tables {
+		m.tables = append(m.tables, t.number)
+	}
+
+	return saveManifest(e.dir, m)
+}
+
+func (e *LSMEngine) Get(key []byte) ([]byte, error) {
+	return engine.StringValue(e.GetEntry(key))
+}
+
+func (e *LSMEngine) GetEntry(key []byte) (engine.Entry, error) {
+	rec, ok, err := e.lookup(string(key))
+	if err != nil {
+		return engine.Entry{}, err
+	}
+
+	if !ok || !rec.visible(time.Now().UnixNano()) {
+		return engine.Entry{}, engine.ErrKeyNotFound
+	}
+
+	return engine.Entry{Key: bytes.Clone(key), Value: []byte(rec.value), Object: nil, Type: rec.typ, Deadline: deadlineTime(rec.deadline)}, nil
+}
+
+func (e *LSMEngine) Set(key, value []byte) error {
+	e.writeMtx.Lock()
+	defer e.writeMtx.Unlock()
+
+	return e.write(entry{key: string(key), record: record{value: string(value), typ: engine.TypeString, deadline: 0, tombstone: false}})
+}
+
+// Del writes a tombstone unless the newest record of key already is one, or
+// there is none.
+func (e *LSMEngine) Del(key []byte) error {
+	e.writeMtx.Lock()
+	defer e.writeMtx.Unlock()
+
+	rec, ok, err := e.lookup(string(key))
+	if err != nil || !ok || rec.tombstone {
+		return err
+	}
+
+	return e.write(entry{key: string(key), record: record{value: "", typ: engine.TypeString, deadline: 0, tombstone: true}})
+}
+
+func (e *LSMEngine) Update(key []byte, fn engine.UpdateFunc) error {
+	e.writeMtx.Lock()
+	defer e.writeMtx.Unlock()
+
+	rec, ok, err := e.lookup(string(key))
+	if err != nil {
+		return err
+	}
+
+	current := engine.Entry{Key: bytes.Clone(key), Value: nil, Object: nil, Type: engine.TypeString, Deadline: time.Time{}}
+	found := ok && rec.visible(time.Now().UnixNano())
+	if found {
+		current.Value = []byte(rec.value)
+		current.Type = rec.typ
+		current.Deadline = deadlineTime(rec.deadline)
+	}
+
+	updated, keep, err := fn(current, found)
+	if err != nil {
+		return err
+	}
+
+	if !keep {
+		if !ok || rec.tombstone {
+			return nil
+		}
+		return e.write(entry{key: string(key), record: record{value: "", typ: engine.TypeString, deadline: 0, tombstone: true}})
+	}
+
+	return e.write(entry{key: string(key), record: record{
+		value:     string(updated.Encoded().Value),
+		typ:       updated.Type,
+		deadline:  deadlineNanos(updated.Deadline),
+		tombstone: false,
+	}})
+}
+
+// Version returns the version of key, or that of its deletion if it does not
+// exist.
+func (e *LSMEngine) Version(key []byte) (uint64, error) {
+	e.writeMtx.Lock()
+	defer e.writeMtx.Unlock()
+
+	if _, err := e.lookupVisible(string(key)); errors.Is(err, engine.ErrKeyNotFound) {
+		return e.versions.Missing(string(key)), nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	return e.versions.Get(string(key)), nil
+}
+
+func (e *LSMEngine) KeepHistory(limits engine.HistoryLimits) {
+	e.writeMtx.Lock()
+	defer e.writeMtx.Unlock()
+
+	e.versions.KeepHistory(limits)
+}
+
+// History returns the revisions of key, newest first.
+func (e *LSMEngine) History(key []byte, limit int) ([]engine.Revision, error) {
+	e.writeMtx.Lock()
+	defer e.writeMtx.Unlock()
+
+	return e.versions.History(string(key), limit), nil
+}
+
+func (e *LSMEngine) CompactHistory(now time.Time, limit int) (int, bool) {
+	e.writeMtx.Lock()
+	defer e.writeMtx.Unlock()
+
+	return e.versions.CompactHistory(now, limit)
+}
+
+// lookup finds the newest record of a key, which may be a tombstone.
+func (e *LSMEngine) lookup(key string) (record, bool, error) {
+	e.mtx.RLock()
+	if e.closed {
+		e.mtx.RUnlock()
+		return record{}, false, ErrClosed
+	}
+	if rec, ok := e.mem.get(key); ok {
+		e.mtx.RUnlock()
+		return rec, true, nil
+	}
+	if e.imm != nil {
+		if rec, ok := e.imm.get(key); ok {
+			e.mtx.RUnlock()
+			return rec, true, nil
+		}
+	}
+	tables := e.acquireTables()
+	e.mtx.RUnlock()
+
+	defer e.releaseTables(tables)
+
+	for _, t := range tables {
+		rec, ok, err := t.get(key)
+		if err != nil {
+			return record{}, false, err
+		}
+		if ok {
+			return rec, true, nil
+		}
+	}
+
+	return record{}, false, nil
+}
+
+// acquireTables must be called with mtx held. The tables stay open until they
+// are released, even if a compaction replaces them in the meantime.
+func (e *LSMEngine) acquireTables() []*table {
+	tables := slices.Clone(e.tables)
+	for _, t := range tables {
+		t.ref()
+	}
+
+	return tables
+}
+
+func (e *LSMEngine) releaseTables(tables []*table) {
+	for _, t := range tables {
+		t.unref()
+	}
+}
+
+// write must be called with writeMtx held.
+func (e *LSMEngine) write(en entry) error {
+	if err := e.makeRoomForWrite(); err != nil {
+		return err
+	}
+
+	if err := e.log.append(en); err != nil {
+		return err
+	}
+
+	e.mtx.Lock()
+	e.mem.put(en.key, en.record)
+	e.mtx.Unlock()
+
+	if en.tombstone {
+		e.versions.Forget(en.key)
+	} else {
+		e.versions.Put(en.key, []byte(en.value), en.typ)
+	}
+
+	return nil
+}
+
+// makeRoomForWrite hands a full memtable over to the flusher and starts a new
+// one with its own log. Writers wait if the previous memtable is still being
+// flushed. It must be called with writeMtx held.
+func (e *LSMEngine) makeRoomForWrite() error {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	if e.closed {
+		return ErrClosed
+	}
+
+	if e.mem.size < e.memtableSize {
+		return nil
+	}
+
+	for e.imm != nil && e.bgErr == nil && !e.closed {
+		e.flushed.Wait()
+	}
+	if e.bgErr != nil {
+		return e.bgErr
+	}
+	if e.closed {
+		return ErrClosed
+	}
+
+	previous := e.log
+	if err := e.newLog(); err != nil {
+		return err
+	}
+	if err := previous.close(); err != nil {
+		return err
+	}
+
+	e.imm = e.mem
+	e.mem = newMemtable(e.log.number)
+
+	select {
+	case e.flushCh <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// Close stops background work and closes all files. Unflushed writes stay in
+// the logs and are recovered on the next start.
+func (e *LSMEngine) Close() error {
+	e.writeMtx.Lock()
+	defer e.writeMtx.Unlock()
+
+	e.mtx.Lock()
+	if e.closed {
+		e.mtx.Unlock()
+		return nil
+	}
+	e.closed = true
+	e.flushed.Broadcast()
+	e.mtx.Unlock()
+
+	close(e.done)
+	e.wg.Wait()
+
+	e.mtx.Lock()
+	tables := e.tables
+	e.tables = nil
+	e.mtx.Unlock()
+
+	e.releaseTables(tables)
+
+	return e.log.close()
+}
+
+// Clear drops every table and all buffered writes.
+func (e *LSMEngine) Clear() error {
+	e.writeMtx.Lock()
+	defer e.writeMtx.Unlock()
+
+	e.mtx.Lock()
+	for e.imm != nil && e.bgErr == nil && !e.closed {
+		e.flushed.Wait()
+	}
+	if e.bgErr != nil {
+		e.mtx.Unlock()
+		return e.bgErr
+	}
+	if e.closed {
+		e.mtx.Unlock()
+		return ErrClosed
+	}
+
+	previous := e.log
+	if err := e.newLog(); err != nil {
+		e.mtx.Unlock()
+		return err
+	}
+
+	tables := e.tables
+	e.tables = nil
+	e.mem = newMemtable(e.log.number)
+	err := e.saveManifest()
+	e.mtx.Unlock()
+
+	e.versions.Reset()
+
+	for _, t := range tables {
+		t.obsolete.Store(true)
+	}
+	e.releaseTables(tables)
+
+	err = errors.Join(err, previous.close())
+	if removeErr := os.Remove(fileName(e.dir, previous.number, logSuffix)); removeErr != nil {
+		err = errors.Join(err, fmt.Errorf("failed to remove lsm log: %w", removeErr))
+	}
+
+	return err
+}
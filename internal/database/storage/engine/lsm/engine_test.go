@@ -0,0 +1,289 @@
+//nolint:exhaustruct
+package lsm
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine/enginetest"
+	"go.uber.org/zap"
+)
+
+func openTestEngine(t *testing.T, cfg *Config) *LSMEngine {
+	t.Helper()
+
+	opened, err := NewLSMEngine(cfg, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//nolint:forcetypeassert
+	e := opened.(*LSMEngine)
+	t.Cleanup(func() {
+		//nolint:errcheck
+		e.Close()
+	})
+
+	return e
+}
+
+func newTestEngine(t *testing.T) *LSMEngine {
+	t.Helper()
+
+	return openTestEngine(t, &Config{DataDirectory: t.TempDir()})
+}
+
+// smallConfig makes every few writes flush a table and compacts often.
+func smallConfig(t *testing.T) *Config {
+	t.Helper()
+
+	return &Config{
+		DataDirectory:       t.TempDir(),
+		MemtableSize:        2 << 10,
+		BlockSize:           256,
+		CompactionThreshold: 3,
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		<-time.After(10 * time.Millisecond)
+	}
+}
+
+func (e *LSMEngine) tableCount() int {
+	e.mtx.RLock()
+	defer e.mtx.RUnlock()
+
+	return len(e.tables)
+}
+
+func TestLSMEngine_SetGetDel(t *testing.T) {
+	e := newTestEngine(t)
+
+	if _, err := e.Get([]byte("key")); !errors.Is(err, engine.ErrKeyNotFound) {
+		t.Errorf("expected error %v, got %v", engine.ErrKeyNotFound, err)
+	}
+
+	if err := e.Set([]byte("key"), []byte("old_value")); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Set([]byte("key"), []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := e.Get([]byte("key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(value) != "value" {
+		t.Errorf("expected value %v, got %v", "value", value)
+	}
+
+	if err := e.Del([]byte("key")); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Del([]byte("missing")); err != nil {
+		t.Errorf("expected deleting a missing key to succeed, got %v", err)
+	}
+	if _, err := e.Get([]byte("key")); !errors.Is(err, engine.ErrKeyNotFound) {
+		t.Errorf("expected error %v, got %v", engine.ErrKeyNotFound, err)
+	}
+}
+
+func TestLSMEngine_ReadsAcrossTablesAndCompaction(t *testing.T) {
+	e := openTestEngine(t, smallConfig(t))
+
+	for round := range 5 {
+		for i := range 100 {
+			if err := e.Set([]byte("key"+strconv.Itoa(i)), []byte("value"+strconv.Itoa(round))); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	for i := 0; i < 100; i += 2 {
+		if err := e.Del([]byte("key" + strconv.Itoa(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := range 100 {
+		value, err := e.Get([]byte("key" + strconv.Itoa(i)))
+		if i%2 == 0 {
+			if !errors.Is(err, engine.ErrKeyNotFound) {
+				t.Errorf("key%d: expected error %v, got %v", i, engine.ErrKeyNotFound, err)
+			}
+			continue
+		}
+		if err != nil || string(value) != "value4" {
+			t.Errorf("key%d: expected value4, got %q, %v", i, value, err)
+		}
+	}
+
+	waitFor(t, "compaction", func() bool {
+		return e.tableCount() < e.compactionThreshold
+	})
+}
+
+func TestLSMEngine_Recover(t *testing.T) {
+	cfg := smallConfig(t)
+
+	e := openTestEngine(t, cfg)
+	for i := range 300 {
+		if err := e.Set([]byte("key"+strconv.Itoa(i)), []byte("value"+strconv.Itoa(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.Del([]byte("key7")); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	e = openTestEngine(t, cfg)
+	for i := range 300 {
+		value, err := e.Get([]byte("key" + strconv.Itoa(i)))
+		if i == 7 {
+			if !errors.Is(err, engine.ErrKeyNotFound) {
+				t.Errorf("expected deleted key to stay deleted, got %q, %v", value, err)
+			}
+			continue
+		}
+		if err != nil || string(value) != "value"+strconv.Itoa(i) {
+			t.Errorf("key%d: expected value%d, got %q, %v", i, i, value, err)
+		}
+	}
+}
+
+func TestLSMEngine_SnapshotIsPointInTime(t *testing.T) {
+	e := openTestEngine(t, smallConfig(t))
+
+	for i := range 200 {
+		if err := e.Set([]byte("key"+strconv.Itoa(i)), []byte("value")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	snap, err := e.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Release()
+
+	for i := range 200 {
+		if err := e.Set([]byte("key"+strconv.Itoa(i)), []byte("changed")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.Del([]byte("key0")); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "compaction", func() bool {
+		return e.tableCount() < e.compactionThreshold
+	})
+
+	count := 0
+	err = snap.ForEach(func(entry engine.Entry) error {
+		if string(entry.Value) != "value" {
+			t.Errorf("key %q: expected value from before the snapshot, got %q", entry.Key, entry.Value)
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 200 {
+		t.Errorf("expected 200 entries, got %d", count)
+	}
+}
+
+func TestLSMEngine_Expiration(t *testing.T) {
+	cfg := smallConfig(t)
+	e := openTestEngine(t, cfg)
+
+	deadline := time.Now().Add(time.Hour)
+	if err := e.SetWithDeadline([]byte("session"), []byte("token"), deadline); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.SetWithDeadline([]byte("expired"), []byte("token"), time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Set([]byte("persistent"), []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Expire([]byte("persistent"), deadline); err != nil {
+		t.Fatal(err)
+	}
+	if persisted, err := e.Persist([]byte("persistent")); err != nil || !persisted {
+		t.Fatalf("expected deadline to be removed, got %v, %v", persisted, err)
+	}
+
+	if _, err := e.Get([]byte("expired")); !errors.Is(err, engine.ErrKeyNotFound) {
+		t.Errorf("expected expired key to be hidden, got %v", err)
+	}
+	if _, deleted := e.DeleteExpired(time.Now(), 10); deleted != 1 {
+		t.Errorf("expected 1 expired key to be deleted, got %d", deleted)
+	}
+
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	e = openTestEngine(t, cfg)
+
+	got, err := e.Deadline([]byte("session"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.UnixNano() != deadline.UnixNano() {
+		t.Errorf("expected deadline %v, got %v", deadline, got)
+	}
+	if got, err := e.Deadline([]byte("persistent")); err != nil || !got.IsZero() {
+		t.Errorf("expected no deadline, got %v, %v", got, err)
+	}
+}
+
+func TestLSMEngine_Clear(t *testing.T) {
+	cfg := smallConfig(t)
+	e := openTestEngine(t, cfg)
+
+	for i := range 200 {
+		if err := e.Set([]byte("key"+strconv.Itoa(i)), []byte("value")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := e.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Set([]byte("after"), []byte("clear")); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	e = openTestEngine(t, cfg)
+	if _, err := e.Get([]byte("key1")); !errors.Is(err, engine.ErrKeyNotFound) {
+		t.Errorf("expected cleared key to be gone, got %v", err)
+	}
+	if value, err := e.Get([]byte("after")); err != nil || string(value) != "clear" {
+		t.Errorf("expected value written after clear, got %q, %v", value, err)
+	}
+}
+
+func TestLSMEngine_Conformance(t *testing.T) {
+	enginetest.Run(t, func(t *testing.T, dir string) engine.Engine {
+		return openTestEngine(t, &Config{DataDirectory: dir})
+	}, true)
+}
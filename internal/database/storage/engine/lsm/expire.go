@@ -0,0 +1,114 @@
+package lsm
+
+import (
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+	"go.uber.org/zap"
+)
+
+func (e *LSMEngine) SetWithDeadline(key, value []byte, deadline time.Time) error {
+	e.writeMtx.Lock()
+	defer e.writeMtx.Unlock()
+
+	return e.write(entry{key: string(key), record: record{value: string(value), typ: engine.TypeString, deadline: deadlineNanos(deadline), tombstone: false}})
+}
+
+func (e *LSMEngine) Expire(key []byte, deadline time.Time) error {
+	e.writeMtx.Lock()
+	defer e.writeMtx.Unlock()
+
+	rec, err := e.lookupVisible(string(key))
+	if err != nil {
+		return err
+	}
+
+	rec.deadline = deadlineNanos(deadline)
+	return e.write(entry{key: string(key), record: rec})
+}
+
+func (e *LSMEngine) Persist(key []byte) (bool, error) {
+	e.writeMtx.Lock()
+	defer e.writeMtx.Unlock()
+
+	rec, err := e.lookupVisible(string(key))
+	if err != nil {
+		return false, err
+	}
+
+	if rec.deadline == 0 {
+		return false, nil
+	}
+
+	rec.deadline = 0
+	return true, e.write(entry{key: string(key), record: rec})
+}
+
+func (e *LSMEngine) Deadline(key []byte) (time.Time, error) {
+	rec, err := e.lookupVisible(string(key))
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return deadlineTime(rec.deadline), nil
+}
+
+func (e *LSMEngine) lookupVisible(key string) (record, error) {
+	rec, ok, err := e.lookup(key)
+	if err != nil {
+		return record{}, err
+	}
+
+	if !ok || !rec.visible(time.Now().UnixNano()) {
+		return record{}, engine.ErrKeyNotFound
+	}
+
+	return rec, nil
+}
+
+// DeleteExpired only samples the memtable. Expired entries that already made
+// it into a table stay hidden until compaction drops them.
+func (e *LSMEngine) DeleteExpired(now time.Time, samples int) (int, int) {
+	nanos := now.UnixNano()
+
+	e.mtx.RLock()
+	sampled := 0
+	var expired []string
+	for key := range e.mem.expiring {
+		if sampled == samples {
+			break
+		}
+		sampled++
+
+		if rec, _ := e.mem.get(key); rec.expired(nanos) {
+			expired = append(expired, key)
+		}
+	}
+	e.mtx.RUnlock()
+
+	if len(expired) == 0 {
+		return sampled, 0
+	}
+
+	e.writeMtx.Lock()
+	defer e.writeMtx.Unlock()
+
+	deleted := 0
+	for _, key := range expired {
+		e.mtx.RLock()
+		rec, ok := e.mem.get(key)
+		e.mtx.RUnlock()
+
+		if !ok || rec.tombstone || !rec.expired(nanos) {
+			continue
+		}
+
+		if err := e.write(entry{key: key, record: record{value: "", typ: engine.TypeString, deadline: 0, tombstone: true}}); err != nil {
+			e.logger.Error("failed to delete expired key", zap.String("key", key), zap.Error(err))
+			break
+		}
+		deleted++
+	}
+
+	return sampled, deleted
+}
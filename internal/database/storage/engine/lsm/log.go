@@ -0,0 +1,96 @@
+package lsm
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+const (
+	logHeaderSize    = 8
+	maxLogRecordSize = 64 << 20
+)
+
+// logWriter appends memtable writes to a log file. Every write goes straight
+// to the file, so a crash of the process loses nothing; the file is synced
+// when the memtable is rotated and on close.
+type logWriter struct {
+	number uint64
+	file   *os.File
+}
+
+func createLog(path string, number uint64) (*logWriter, error) {
+	//nolint:gosec
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create lsm log: %w", err)
+	}
+
+	return &logWriter{number: number, file: file}, nil
+}
+
+func (l *logWriter) append(e entry) error {
+	payload := appendEntry(nil, e)
+
+	frame := make([]byte, logHeaderSize, logHeaderSize+len(payload))
+	//nolint:gosec
+	binary.BigEndian.PutUint32(frame[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(frame[4:8], crc32.Checksum(payload, crcTable))
+	frame = append(frame, payload...)
+
+	if _, err := l.file.Write(frame); err != nil {
+		return fmt.Errorf("failed to write lsm log: %w", err)
+	}
+
+	return nil
+}
+
+func (l *logWriter) close() error {
+	return errors.Join(l.file.Sync(), l.file.Close())
+}
+
+// replayLog feeds the entries of a log to fn. A torn or corrupted record ends
+// the log, as it can only be the tail of a write that never completed.
+func replayLog(path string, fn func(entry) error) error {
+	//nolint:gosec
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open lsm log: %w", err)
+	}
+	//nolint:errcheck
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	header := make([]byte, logHeaderSize)
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			return nil
+		}
+
+		length := binary.BigEndian.Uint32(header[0:4])
+		if length > maxLogRecordSize {
+			return nil
+		}
+
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(reader, payload); err != nil {
+			return nil
+		}
+		if crc32.Checksum(payload, crcTable) != binary.BigEndian.Uint32(header[4:8]) {
+			return nil
+		}
+
+		e, _, err := decodeEntry(payload)
+		if err != nil {
+			return nil
+		}
+
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+}
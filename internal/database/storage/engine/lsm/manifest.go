@@ -0,0 +1,113 @@
+package lsm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+)
+
+const (
+	manifestName = "MANIFEST"
+	tmpSuffix    = ".tmp"
+	logSuffix    = ".log"
+	tableSuffix  = ".sst"
+)
+
+// manifest records which files make up the tree. Tables are listed newest
+// first, and every log numbered logNumber or above still has to be replayed.
+type manifest struct {
+	nextFile  uint64
+	logNumber uint64
+	tables    []uint64
+}
+
+func fileName(dir string, number uint64, suffix string) string {
+	return filepath.Join(dir, fmt.Sprintf("%06d%s", number, suffix))
+}
+
+func loadManifest(dir string) (manifest, error) {
+	//nolint:gosec
+	data, err := os.ReadFile(filepath.Join(dir, manifestName))
+	if errors.Is(err, os.ErrNotExist) {
+		return manifest{nextFile: 1, logNumber: 0, tables: nil}, nil
+	}
+	if err != nil {
+		return manifest{}, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	if len(data) < crcSize || crc32.Checksum(data[crcSize:], crcTable) != binary.BigEndian.Uint32(data) {
+		return manifest{}, fmt.Errorf("%w: manifest checksum mismatch", ErrCorrupted)
+	}
+	data = data[crcSize:]
+
+	var values []uint64
+	for len(data) > 0 {
+		value, n := binary.Uvarint(data)
+		if n <= 0 {
+			return manifest{}, fmt.Errorf("%w: invalid manifest", ErrCorrupted)
+		}
+		values = append(values, value)
+		data = data[n:]
+	}
+
+	if len(values) < 3 || uint64(len(values)-3) != values[2] {
+		return manifest{}, fmt.Errorf("%w: invalid manifest", ErrCorrupted)
+	}
+
+	return manifest{nextFile: values[0], logNumber: values[1], tables: values[3:]}, nil
+}
+
+func saveManifest(dir string, m manifest) error {
+	var payload []byte
+	payload = binary.AppendUvarint(payload, m.nextFile)
+	payload = binary.AppendUvarint(payload, m.logNumber)
+	payload = binary.AppendUvarint(payload, uint64(len(m.tables)))
+	for _, number := range m.tables {
+		payload = binary.AppendUvarint(payload, number)
+	}
+
+	data := binary.BigEndian.AppendUint32(nil, crc32.Checksum(payload, crcTable))
+	data = append(data, payload...)
+
+	path := filepath.Join(dir, manifestName)
+	tmpPath := path + tmpSuffix
+
+	//nolint:gosec
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create manifest: %w", err)
+	}
+
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if err = errors.Join(err, file.Close()); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to rename manifest: %w", err)
+	}
+
+	return syncDir(dir)
+}
+
+func syncDir(dir string) error {
+	//nolint:gosec
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open lsm directory: %w", err)
+	}
+	//nolint:errcheck
+	defer d.Close()
+
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("failed to sync lsm directory: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,139 @@
+package lsm
+
+import (
+	"sort"
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+)
+
+// record is the latest state of a key as known by one level of the tree. A
+// tombstone shadows older values of the key in lower levels.
+type record struct {
+	value     string
+	typ       engine.ValueType
+	deadline  int64
+	tombstone bool
+}
+
+func (r record) expired(now int64) bool {
+	return r.deadline != 0 && now >= r.deadline
+}
+
+func (r record) visible(now int64) bool {
+	return !r.tombstone && !r.expired(now)
+}
+
+func deadlineNanos(deadline time.Time) int64 {
+	if deadline.IsZero() {
+		return 0
+	}
+
+	return deadline.UnixNano()
+}
+
+func deadlineTime(nanos int64) time.Time {
+	if nanos == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, nanos)
+}
+
+// recordOverhead approximates the per-record bookkeeping of the memtable.
+const recordOverhead = 48
+
+// memtable buffers recent writes. Its contents are also in the log numbered
+// logNumber until it has been flushed to a table.
+type memtable struct {
+	logNumber uint64
+	records   map[string]record
+	expiring  map[string]struct{}
+	size      int64
+}
+
+func newMemtable(logNumber uint64) *memtable {
+	return &memtable{
+		logNumber: logNumber,
+		records:   make(map[string]record),
+		expiring:  make(map[string]struct{}),
+		size:      0,
+	}
+}
+
+func (m *memtable) put(key string, rec record) {
+	if old, ok := m.records[key]; ok {
+		m.size -= int64(len(key)+len(old.value)) + recordOverhead
+	}
+
+	m.records[key] = rec
+	m.size += int64(len(key)+len(rec.value)) + recordOverhead
+
+	if rec.deadline != 0 && !rec.tombstone {
+		m.expiring[key] = struct{}{}
+	} else {
+		delete(m.expiring, key)
+	}
+}
+
+func (m *memtable) get(key string) (record, bool) {
+	rec, ok := m.records[key]
+	return rec, ok
+}
+
+func (m *memtable) empty() bool {
+	return len(m.records) == 0
+}
+
+// sorted returns the records in key order for flushing and iteration.
+func (m *memtable) sorted() []entry {
+	entries := make([]entry, 0, len(m.records))
+	for key, rec := range m.records {
+		entries = append(entries, entry{key: key, record: rec})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].key < entries[j].key
+	})
+
+	return entries
+}
+
+// between returns the records with keys in [from, to) in key order. An empty
+// to means there is no upper bound.
+func (m *memtable) between(from, to string) []entry {
+	var entries []entry
+	for key, rec := range m.records {
+		if key >= from && (to == "" || key < to) {
+			entries = append(entries, entry{key: key, record: rec})
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].key < entries[j].key
+	})
+
+	return entries
+}
+
+type entry struct {
+	key string
+	record
+}
+
+// sliceIterator iterates over entries that are already sorted.
+type sliceIterator struct {
+	entries []entry
+	pos     int
+}
+
+func (it *sliceIterator) next() (entry, bool, error) {
+	if it.pos >= len(it.entries) {
+		return entry{}, false, nil
+	}
+
+	e := it.entries[it.pos]
+	it.pos++
+
+	return e, true, nil
+}
@@ -0,0 +1,65 @@
+package lsm
+
+import (
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+)
+
+// Range merges the memtables with the tables like a snapshot does, so writers
+// are not held up while fn runs. Tables can only be read forwards, so a
+// descending range is collected in full before fn sees any of it.
+func (e *LSMEngine) Range(start, end []byte, reverse bool, fn func(entry engine.Entry) bool) error {
+	from, to := string(start), string(end)
+
+	e.mtx.RLock()
+	if e.closed {
+		e.mtx.RUnlock()
+		return ErrClosed
+	}
+	iterators := []iterator{&sliceIterator{entries: e.mem.between(from, to), pos: 0}}
+	if e.imm != nil {
+		iterators = append(iterators, &sliceIterator{entries: e.imm.between(from, to), pos: 0})
+	}
+	tables := e.acquireTables()
+	e.mtx.RUnlock()
+
+	defer e.releaseTables(tables)
+
+	for _, t := range tables {
+		iterators = append(iterators, newTableIteratorFrom(t, from))
+	}
+
+	var collected []engine.Entry
+	it := &liveIterator{it: newMergeIterator(iterators), now: time.Now().UnixNano()}
+	for {
+		en, ok, err := it.next()
+		if err != nil {
+			return err
+		}
+		if !ok || (to != "" && en.key >= to) {
+			break
+		}
+		// Tables start at the block holding from, which may begin below it.
+		if en.key < from {
+			continue
+		}
+
+		entry := engine.Entry{Key: []byte(en.key), Value: []byte(en.value), Object: nil, Type: en.typ, Deadline: deadlineTime(en.deadline)}
+		if reverse {
+			collected = append(collected, entry)
+			continue
+		}
+		if !fn(entry) {
+			return nil
+		}
+	}
+
+	for i := len(collected) - 1; i >= 0; i-- {
+		if !fn(collected[i]) {
+			return nil
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package lsm
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+)
+
+func TestLSMEngine_Range(t *testing.T) {
+	e := openTestEngine(t, smallConfig(t))
+
+	// Enough keys to flush several tables of many blocks, with deletes and
+	// overwrites landing in newer tables and the memtable.
+	var all []string
+	for i := range 300 {
+		key := fmt.Sprintf("event:%04d", i)
+		if err := e.Set([]byte(key), []byte("old")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := range 300 {
+		key := fmt.Sprintf("event:%04d", i)
+		if i%10 == 5 {
+			if err := e.Del([]byte(key)); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		all = append(all, key)
+		if err := e.Set([]byte(key), []byte("value")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.SetWithDeadline([]byte("event:0100x"), []byte("value"), time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if e.tableCount() == 0 {
+		t.Fatal("expected writes to be flushed to tables")
+	}
+
+	reversed := slices.Clone(all)
+	slices.Reverse(reversed)
+
+	tests := []struct {
+		name    string
+		start   string
+		end     string
+		reverse bool
+		limit   int
+		want    []string
+	}{
+		{name: "range", start: "event:0099", end: "event:0102", want: []string{"event:0099", "event:0100", "event:0101"}},
+		{name: "skips deleted", start: "event:0104", end: "event:0107", want: []string{"event:0104", "event:0106"}},
+		{name: "reverse range", start: "event:0099", end: "event:0102", reverse: true, want: []string{"event:0101", "event:0100", "event:0099"}},
+		{name: "prefix", start: "event:", end: engine.PrefixEnd("event:"), want: all},
+		{name: "reverse prefix", start: "event:", end: engine.PrefixEnd("event:"), reverse: true, want: reversed},
+		{name: "reverse with limit", start: "", end: "", reverse: true, limit: 3, want: reversed[:3]},
+		{name: "limit", start: "event:0200", end: "", limit: 5, want: []string{"event:0200", "event:0201", "event:0202", "event:0203", "event:0204"}},
+		{name: "empty", start: "f", end: "g", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			err := e.Range([]byte(tt.start), []byte(tt.end), tt.reverse, func(entry engine.Entry) bool {
+				if string(entry.Value) != "value" {
+					t.Errorf("key %q: expected the newest value, got %q", entry.Key, entry.Value)
+				}
+				got = append(got, string(entry.Key))
+				return tt.limit == 0 || len(got) < tt.limit
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
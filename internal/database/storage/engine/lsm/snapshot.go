@@ -0,0 +1,68 @@
+package lsm
+
+import (
+	"sync"
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+)
+
+// snapshot pins the tables that existed when it was taken and copies the
+// memtables, which are small next to the tables.
+type snapshot struct {
+	engine  *LSMEngine
+	mem     []entry
+	imm     []entry
+	tables  []*table
+	release sync.Once
+}
+
+func (e *LSMEngine) Snapshot() (engine.Snapshot, error) {
+	e.mtx.RLock()
+	defer e.mtx.RUnlock()
+
+	if e.closed {
+		return nil, ErrClosed
+	}
+
+	//nolint:exhaustruct
+	s := &snapshot{
+		engine: e,
+		mem:    e.mem.sorted(),
+		tables: e.acquireTables(),
+	}
+	if e.imm != nil {
+		s.imm = e.imm.sorted()
+	}
+
+	return s, nil
+}
+
+func (s *snapshot) ForEach(fn func(entry engine.Entry) error) error {
+	iterators := make([]iterator, 0, len(s.tables)+2)
+	iterators = append(iterators, &sliceIterator{entries: s.mem, pos: 0}, &sliceIterator{entries: s.imm, pos: 0})
+	for _, t := range s.tables {
+		iterators = append(iterators, newTableIterator(t))
+	}
+
+	it := &liveIterator{it: newMergeIterator(iterators), now: time.Now().UnixNano()}
+	for {
+		e, ok, err := it.next()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+
+		if err := fn(engine.Entry{Key: []byte(e.key), Value: []byte(e.value), Object: nil, Type: e.typ, Deadline: deadlineTime(e.deadline)}); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *snapshot) Release() {
+	s.release.Do(func() {
+		s.engine.releaseTables(s.tables)
+	})
+}
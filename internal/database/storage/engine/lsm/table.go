@@ -0,0 +1,392 @@
+package lsm
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"sort"
+	"sync/atomic"
+)
+
+// An SSTable is an immutable file of sorted entries:
+//
+//	data block*  entries followed by a CRC32C
+//	index block  last key, offset and length of every data block, then a CRC32C
+//	bloom block  bloom filter over all keys, then a CRC32C
+//	footer       index offset and length, bloom offset and length, magic
+const (
+	tableMagic   uint64 = 0x4b564c534d544142
+	footerSize          = 5 * 8
+	crcSize             = 4
+	maxBlockSize        = 64 << 20
+)
+
+type iterator interface {
+	next() (entry, bool, error)
+}
+
+type indexEntry struct {
+	lastKey string
+	offset  uint64
+	length  uint64
+}
+
+type table struct {
+	number uint64
+	path   string
+	file   *os.File
+	size   int64
+	index  []indexEntry
+	bloom  *bloomFilter
+
+	// refs counts the engine's table list and every snapshot or read using
+	// the table. The file is closed, and deleted once obsolete, when the last
+	// reference goes away.
+	refs     atomic.Int32
+	obsolete atomic.Bool
+}
+
+// writeTable writes the entries of it to a new table. It returns nil if there
+// were no entries to write.
+func writeTable(path string, number uint64, it iterator, blockSize, bloomBitsPerKey int) (*table, error) {
+	tmpPath := path + tmpSuffix
+
+	//nolint:gosec
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create table: %w", err)
+	}
+
+	count, err := writeTableFile(file, it, blockSize, bloomBitsPerKey)
+	if err == nil {
+		err = file.Sync()
+	}
+	err = errors.Join(err, file.Close())
+	if err != nil || count == 0 {
+		//nolint:errcheck
+		os.Remove(tmpPath)
+		return nil, err
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return nil, fmt.Errorf("failed to rename table: %w", err)
+	}
+
+	return openTable(path, number)
+}
+
+func writeTableFile(file *os.File, it iterator, blockSize, bloomBitsPerKey int) (int, error) {
+	writer := bufio.NewWriter(file)
+
+	var offset uint64
+	var index []indexEntry
+	var hashes [][2]uint32
+	var block []byte
+	var lastKey string
+
+	flushBlock := func() error {
+		if len(block) == 0 {
+			return nil
+		}
+
+		block = binary.BigEndian.AppendUint32(block, crc32.Checksum(block, crcTable))
+		if _, err := writer.Write(block); err != nil {
+			return err
+		}
+
+		index = append(index, indexEntry{lastKey: lastKey, offset: offset, length: uint64(len(block))})
+		offset += uint64(len(block))
+		block = block[:0]
+
+		return nil
+	}
+
+	for {
+		e, ok, err := it.next()
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			break
+		}
+
+		block = appendEntry(block, e)
+		lastKey = e.key
+		h1, h2 := bloomHash(e.key)
+		hashes = append(hashes, [2]uint32{h1, h2})
+
+		if len(block) >= blockSize {
+			if err := flushBlock(); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if err := flushBlock(); err != nil {
+		return 0, err
+	}
+
+	if len(hashes) == 0 {
+		return 0, nil
+	}
+
+	var indexBlock []byte
+	for _, ie := range index {
+		indexBlock = binary.AppendUvarint(indexBlock, uint64(len(ie.lastKey)))
+		indexBlock = append(indexBlock, ie.lastKey...)
+		indexBlock = binary.AppendUvarint(indexBlock, ie.offset)
+		indexBlock = binary.AppendUvarint(indexBlock, ie.length)
+	}
+	indexBlock = binary.BigEndian.AppendUint32(indexBlock, crc32.Checksum(indexBlock, crcTable))
+
+	bloom := newBloomFilter(len(hashes), bloomBitsPerKey)
+	for _, h := range hashes {
+		bloom.addHash(h[0], h[1])
+	}
+	bloomBlock := bloom.encode()
+	bloomBlock = binary.BigEndian.AppendUint32(bloomBlock, crc32.Checksum(bloomBlock, crcTable))
+
+	footer := make([]byte, 0, footerSize)
+	footer = binary.BigEndian.AppendUint64(footer, offset)
+	footer = binary.BigEndian.AppendUint64(footer, uint64(len(indexBlock)))
+	footer = binary.BigEndian.AppendUint64(footer, offset+uint64(len(indexBlock)))
+	footer = binary.BigEndian.AppendUint64(footer, uint64(len(bloomBlock)))
+	footer = binary.BigEndian.AppendUint64(footer, tableMagic)
+
+	for _, part := range [][]byte{indexBlock, bloomBlock, footer} {
+		if _, err := writer.Write(part); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(hashes), writer.Flush()
+}
+
+func openTable(path string, number uint64) (*table, error) {
+	//nolint:gosec
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open table: %w", err)
+	}
+
+	t, err := loadTable(file, path, number)
+	if err != nil {
+		//nolint:errcheck
+		file.Close()
+		return nil, fmt.Errorf("failed to load table %s: %w", path, err)
+	}
+	t.refs.Store(1)
+
+	return t, nil
+}
+
+func loadTable(file *os.File, path string, number uint64) (*table, error) {
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if stat.Size() < footerSize {
+		return nil, fmt.Errorf("%w: table too short", ErrCorrupted)
+	}
+
+	footer := make([]byte, footerSize)
+	if _, err := file.ReadAt(footer, stat.Size()-footerSize); err != nil {
+		return nil, err
+	}
+	if binary.BigEndian.Uint64(footer[32:]) != tableMagic {
+		return nil, fmt.Errorf("%w: bad table magic", ErrCorrupted)
+	}
+
+	indexBlock, err := readBlock(file, binary.BigEndian.Uint64(footer[0:]), binary.BigEndian.Uint64(footer[8:]))
+	if err != nil {
+		return nil, err
+	}
+	bloomBlock, err := readBlock(file, binary.BigEndian.Uint64(footer[16:]), binary.BigEndian.Uint64(footer[24:]))
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := decodeIndex(indexBlock)
+	if err != nil {
+		return nil, err
+	}
+
+	//nolint:exhaustruct
+	return &table{
+		number: number,
+		path:   path,
+		file:   file,
+		size:   stat.Size(),
+		index:  index,
+		bloom:  decodeBloomFilter(bloomBlock),
+	}, nil
+}
+
+// readBlock reads a block and verifies its trailing checksum, which is not
+// part of the returned data.
+func readBlock(file *os.File, offset, length uint64) ([]byte, error) {
+	if length < crcSize || length > maxBlockSize {
+		return nil, fmt.Errorf("%w: invalid block length %d", ErrCorrupted, length)
+	}
+
+	buf := make([]byte, length)
+	//nolint:gosec
+	if _, err := file.ReadAt(buf, int64(offset)); err != nil {
+		return nil, fmt.Errorf("failed to read block: %w", err)
+	}
+
+	data := buf[:length-crcSize]
+	if crc32.Checksum(data, crcTable) != binary.BigEndian.Uint32(buf[length-crcSize:]) {
+		return nil, fmt.Errorf("%w: block checksum mismatch", ErrCorrupted)
+	}
+
+	return data, nil
+}
+
+func decodeIndex(data []byte) ([]indexEntry, error) {
+	var index []indexEntry
+	for len(data) > 0 {
+		key, n, err := decodeString(data)
+		if err != nil {
+			return nil, err
+		}
+		data = data[n:]
+
+		offset, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, fmt.Errorf("%w: invalid block offset", ErrCorrupted)
+		}
+		data = data[n:]
+
+		length, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, fmt.Errorf("%w: invalid block length", ErrCorrupted)
+		}
+		data = data[n:]
+
+		index = append(index, indexEntry{lastKey: key, offset: offset, length: length})
+	}
+
+	return index, nil
+}
+
+func decodeBlock(data []byte) ([]entry, error) {
+	var entries []entry
+	for len(data) > 0 {
+		e, n, err := decodeEntry(data)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+		data = data[n:]
+	}
+
+	return entries, nil
+}
+
+// get looks the key up in the only block that may contain it, after
+// consulting the bloom filter.
+func (t *table) get(key string) (record, bool, error) {
+	if !t.bloom.mayContain(key) {
+		return record{}, false, nil
+	}
+
+	i := sort.Search(len(t.index), func(i int) bool {
+		return t.index[i].lastKey >= key
+	})
+	if i == len(t.index) {
+		return record{}, false, nil
+	}
+
+	data, err := readBlock(t.file, t.index[i].offset, t.index[i].length)
+	if err != nil {
+		return record{}, false, err
+	}
+
+	for len(data) > 0 {
+		e, n, err := decodeEntry(data)
+		if err != nil {
+			return record{}, false, err
+		}
+		if e.key == key {
+			return e.record, true, nil
+		}
+		if e.key > key {
+			break
+		}
+		data = data[n:]
+	}
+
+	return record{}, false, nil
+}
+
+func (t *table) ref() {
+	t.refs.Add(1)
+}
+
+func (t *table) unref() {
+	if t.refs.Add(-1) != 0 {
+		return
+	}
+
+	//nolint:errcheck
+	t.file.Close()
+	if t.obsolete.Load() {
+		//nolint:errcheck
+		os.Remove(t.path)
+	}
+}
+
+// tableIterator reads a table block by block.
+type tableIterator struct {
+	table   *table
+	block   int
+	entries []entry
+	pos     int
+}
+
+func newTableIterator(t *table) *tableIterator {
+	//nolint:exhaustruct
+	return &tableIterator{table: t}
+}
+
+// newTableIteratorFrom skips the blocks that only hold keys below start.
+func newTableIteratorFrom(t *table, start string) *tableIterator {
+	it := newTableIterator(t)
+	it.block = sort.Search(len(t.index), func(i int) bool {
+		return t.index[i].lastKey >= start
+	})
+
+	return it
+}
+
+func (it *tableIterator) next() (entry, bool, error) {
+	for it.pos >= len(it.entries) {
+		if it.block >= len(it.table.index) {
+			return entry{}, false, nil
+		}
+
+		ie := it.table.index[it.block]
+		data, err := readBlock(it.table.file, ie.offset, ie.length)
+		if err != nil {
+			return entry{}, false, err
+		}
+
+		entries, err := decodeBlock(data)
+		if err != nil {
+			return entry{}, false, err
+		}
+
+		it.entries = entries
+		it.pos = 0
+		it.block++
+	}
+
+	e := it.entries[it.pos]
+	it.pos++
+
+	return e, true, nil
+}
@@ -0,0 +1,99 @@
+package lsm
+
+import (
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestTable_GetAndIterate(t *testing.T) {
+	entries := make([]entry, 0, 1000)
+	for i := range 1000 {
+		key := "key" + strconv.Itoa(100000+i)
+		entries = append(entries, entry{key: key, record: record{value: "value" + strconv.Itoa(i), deadline: int64(i), tombstone: i%10 == 0}})
+	}
+
+	tbl, err := writeTable(filepath.Join(t.TempDir(), "000001.sst"), 1, &sliceIterator{entries: entries, pos: 0}, 512, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tbl.unref()
+
+	if len(tbl.index) < 2 {
+		t.Fatalf("expected several blocks, got %d", len(tbl.index))
+	}
+
+	for _, want := range entries {
+		got, ok, err := tbl.get(want.key)
+		if err != nil || !ok {
+			t.Fatalf("key %q: expected to be found, got %v, %v", want.key, ok, err)
+		}
+		if got != want.record {
+			t.Errorf("key %q: expected %+v, got %+v", want.key, want.record, got)
+		}
+	}
+
+	falsePositives := 0
+	for i := range 1000 {
+		key := "missing" + strconv.Itoa(i)
+		if tbl.bloom.mayContain(key) {
+			falsePositives++
+		}
+		if _, ok, err := tbl.get(key); ok || err != nil {
+			t.Errorf("key %q: expected miss, got %v, %v", key, ok, err)
+		}
+	}
+	if falsePositives > 50 {
+		t.Errorf("expected about 1%% bloom filter false positives, got %d of 1000", falsePositives)
+	}
+
+	it := newTableIterator(tbl)
+	for i := 0; ; i++ {
+		e, ok, err := it.next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			if i != len(entries) {
+				t.Errorf("expected %d entries, got %d", len(entries), i)
+			}
+			break
+		}
+		if e != entries[i] {
+			t.Fatalf("entry %d: expected %+v, got %+v", i, entries[i], e)
+		}
+	}
+}
+
+func TestMergeIterator_PrefersNewest(t *testing.T) {
+	newer := []entry{
+		{key: "a", record: record{value: "new"}},
+		{key: "c", record: record{tombstone: true}},
+	}
+	older := []entry{
+		{key: "a", record: record{value: "old"}},
+		{key: "b", record: record{value: "old"}},
+		{key: "c", record: record{value: "old"}},
+	}
+
+	it := &liveIterator{it: newMergeIterator([]iterator{
+		&sliceIterator{entries: newer},
+		&sliceIterator{entries: older},
+	})}
+
+	var got []string
+	for {
+		e, ok, err := it.next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			break
+		}
+		got = append(got, e.key+"="+e.value)
+	}
+
+	if len(got) != 2 || got[0] != "a=new" || got[1] != "b=old" {
+		t.Errorf("expected [a=new b=old], got %v", got)
+	}
+}
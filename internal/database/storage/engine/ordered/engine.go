@@ -0,0 +1,248 @@
+package ordered
+
+import (
+	"bytes"
+	"sync"
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+	"go.uber.org/zap"
+)
+
+const Name = "ordered"
+
+// Config is empty, as the ordered engine has no settings of its own.
+type Config struct{}
+
+func init() {
+	engine.Register(Name, func(_ *Config, logger *zap.Logger) (engine.Engine, error) {
+		return NewOrderedEngine(logger)
+	})
+}
+
+// OrderedEngine keeps its keys in a skiplist, which makes lookups O(log n)
+// instead of O(1) but supports range queries.
+type OrderedEngine struct {
+	logger    *zap.Logger
+	mtx       sync.RWMutex
+	list      *skiplist
+	deadlines map[string]time.Time
+	versions  engine.Versions
+	snapshot  *snapshot
+}
+
+func NewOrderedEngine(logger *zap.Logger) (engine.Engine, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	return &OrderedEngine{
+		logger:    logger,
+		mtx:       sync.RWMutex{},
+		list:      newSkiplist(),
+		deadlines: make(map[string]time.Time),
+		versions:  engine.Versions{},
+		snapshot:  nil,
+	}, nil
+}
+
+func (e *OrderedEngine) Get(key []byte) ([]byte, error) {
+	return engine.StringValue(e.GetEntry(key))
+}
+
+func (e *OrderedEngine) GetEntry(key []byte) (engine.Entry, error) {
+	e.mtx.RLock()
+	n, ok := e.list.get(string(key))
+	expired := ok && e.expired(string(key), time.Now())
+	var entry engine.Entry
+	if ok {
+		entry = engine.Entry{Key: bytes.Clone(key), Value: n.encoded(), Object: nil, Type: n.typ, Deadline: e.deadlines[n.key]}
+	}
+	e.mtx.RUnlock()
+
+	if !ok {
+		return engine.Entry{}, engine.ErrKeyNotFound
+	}
+
+	if expired {
+		e.deleteIfExpired(string(key))
+		return engine.Entry{}, engine.ErrKeyNotFound
+	}
+
+	return entry, nil
+}
+
+// View passes the object of a key as it is held, under the read lock.
+func (e *OrderedEngine) View(key []byte, fn func(entry engine.Entry, found bool) error) error {
+	e.mtx.RLock()
+	defer e.mtx.RUnlock()
+
+	entry := engine.Entry{Key: key, Value: nil, Object: nil, Type: engine.TypeString, Deadline: time.Time{}}
+	n, found := e.list.get(string(key))
+	if found = found && !e.expired(string(key), time.Now()); found {
+		entry.Value, entry.Object = n.current()
+		entry.Type = n.typ
+		entry.Deadline = e.deadlines[n.key]
+	}
+
+	return fn(entry, found)
+}
+
+func (e *OrderedEngine) Set(key, value []byte) error {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	e.put(string(key), string(value), nil, engine.TypeString)
+	delete(e.deadlines, string(key))
+
+	return nil
+}
+
+func (e *OrderedEngine) Del(key []byte) error {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	e.delete(string(key))
+
+	return nil
+}
+
+func (e *OrderedEngine) Update(key []byte, fn engine.UpdateFunc) error {
+	k := string(key)
+
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	current := engine.Entry{Key: []byte(k), Value: nil, Object: nil, Type: engine.TypeString, Deadline: time.Time{}}
+	n, found := e.list.get(k)
+	if found = found && !e.expired(k, time.Now()); found {
+		current.Value, current.Object = n.current()
+		current.Type = n.typ
+		current.Deadline = e.deadlines[k]
+
+		// fn may change the object in place, so the snapshot must keep it
+		// first.
+		if e.snapshot != nil {
+			e.snapshot.preserve(k)
+		}
+	}
+
+	updated, keep, err := fn(current, found)
+	if err != nil {
+		return err
+	}
+
+	if !keep {
+		e.delete(k)
+		return nil
+	}
+
+	e.put(k, string(updated.Value), updated.Object, updated.Type)
+	if updated.Deadline.IsZero() {
+		delete(e.deadlines, k)
+	} else {
+		e.deadlines[k] = updated.Deadline
+	}
+
+	return nil
+}
+
+func (e *OrderedEngine) Clear() error {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	if e.snapshot != nil {
+		for n := e.list.head.next[0]; n != nil; n = n.next[0] {
+			e.snapshot.preserve(n.key)
+		}
+	}
+	e.list = newSkiplist()
+	e.deadlines = make(map[string]time.Time)
+	e.versions.Reset()
+
+	return nil
+}
+
+// Version returns the version of key, or that of its deletion if it does not
+// exist.
+func (e *OrderedEngine) Version(key []byte) (uint64, error) {
+	k := string(key)
+
+	e.mtx.RLock()
+	defer e.mtx.RUnlock()
+
+	if _, ok := e.list.get(k); !ok || e.expired(k, time.Now()) {
+		return e.versions.Missing(k), nil
+	}
+
+	return e.versions.Get(k), nil
+}
+
+func (e *OrderedEngine) KeepHistory(limits engine.HistoryLimits) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	e.versions.KeepHistory(limits)
+}
+
+// History returns the revisions of key, newest first.
+func (e *OrderedEngine) History(key []byte, limit int) ([]engine.Revision, error) {
+	e.mtx.RLock()
+	defer e.mtx.RUnlock()
+
+	return e.versions.History(string(key), limit), nil
+}
+
+func (e *OrderedEngine) CompactHistory(now time.Time, limit int) (int, bool) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	return e.versions.CompactHistory(now, limit)
+}
+
+// put stores either value or object. It must be called with the write lock
+// held.
+func (e *OrderedEngine) put(key, value string, object engine.Object, typ engine.ValueType) {
+	if e.snapshot != nil {
+		e.snapshot.preserve(key)
+	}
+
+	n := e.list.put(key, value)
+	n.object, n.typ = object, typ
+
+	if object != nil {
+		e.versions.PutObject(key, object, typ)
+	} else {
+		e.versions.Put(key, []byte(value), typ)
+	}
+}
+
+// delete must be called with the write lock held.
+func (e *OrderedEngine) delete(key string) {
+	if e.snapshot != nil {
+		e.snapshot.preserve(key)
+	}
+
+	_, ok := e.list.delete(key)
+	delete(e.deadlines, key)
+	if ok {
+		e.versions.Forget(key)
+	}
+}
+
+// expired must be called with the lock held.
+func (e *OrderedEngine) expired(key string, now time.Time) bool {
+	deadline, ok := e.deadlines[key]
+	return ok && !now.Before(deadline)
+}
+
+// deleteIfExpired removes a key found expired under the read lock, unless it
+// was written again in the meantime.
+func (e *OrderedEngine) deleteIfExpired(key string) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	if e.expired(key, time.Now()) {
+		e.delete(key)
+	}
+}
@@ -0,0 +1,48 @@
+package ordered
+
+import (
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+)
+
+// Range holds the read lock while it calls fn and skips expired keys without
+// deleting them.
+func (e *OrderedEngine) Range(start, end []byte, reverse bool, fn func(entry engine.Entry) bool) error {
+	from, to, now := string(start), string(end), time.Now()
+
+	e.mtx.RLock()
+	defer e.mtx.RUnlock()
+
+	visit := func(n *skipNode) bool {
+		deadline, ok := e.deadlines[n.key]
+		if ok && !now.Before(deadline) {
+			return true
+		}
+
+		return fn(engine.Entry{Key: []byte(n.key), Value: n.encoded(), Object: nil, Type: n.typ, Deadline: deadline})
+	}
+
+	if reverse {
+		n := e.list.last()
+		if to != "" {
+			n = e.list.before(to)
+		}
+
+		for ; n != nil && n.key >= from; n = n.prev {
+			if !visit(n) {
+				break
+			}
+		}
+
+		return nil
+	}
+
+	for n := e.list.seek(from, nil); n != nil && (to == "" || n.key < to); n = n.next[0] {
+		if !visit(n) {
+			break
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package ordered
+
+import (
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+	"go.uber.org/zap"
+)
+
+func newTestOrderedEngine(t *testing.T) *OrderedEngine {
+	t.Helper()
+
+	e, err := NewOrderedEngine(zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//nolint:forcetypeassert
+	return e.(*OrderedEngine)
+}
+
+func collect(t *testing.T, r engine.Ranger, start, end string, reverse bool, limit int) []string {
+	t.Helper()
+
+	var keys []string
+	err := r.Range([]byte(start), []byte(end), reverse, func(entry engine.Entry) bool {
+		keys = append(keys, string(entry.Key))
+		return limit == 0 || len(keys) < limit
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return keys
+}
+
+func TestOrderedEngine_Range(t *testing.T) {
+	e := newTestOrderedEngine(t)
+
+	for _, key := range []string{"a", "b:1", "b:2", "b:3", "c"} {
+		if err := e.Set([]byte(key), []byte("value")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.SetWithDeadline([]byte("b:0"), []byte("value"), time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		start   string
+		end     string
+		reverse bool
+		limit   int
+		want    []string
+	}{
+		{name: "prefix", start: "b:", end: engine.PrefixEnd("b:"), want: []string{"b:1", "b:2", "b:3"}},
+		{name: "reverse prefix", start: "b:", end: engine.PrefixEnd("b:"), reverse: true, want: []string{"b:3", "b:2", "b:1"}},
+		{name: "end is exclusive", start: "a", end: "b:3", want: []string{"a", "b:1", "b:2"}},
+		{name: "no upper bound", start: "b:3", end: "", want: []string{"b:3", "c"}},
+		{name: "reverse without upper bound", start: "", end: "", reverse: true, limit: 2, want: []string{"c", "b:3"}},
+		{name: "limit", start: "", end: "", limit: 2, want: []string{"a", "b:1"}},
+		{name: "empty", start: "d", end: "e", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := collect(t, e, tt.start, tt.end, tt.reverse, tt.limit)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSkiplist_MatchesSortedMap(t *testing.T) {
+	l := newSkiplist()
+	want := make(map[string]string)
+
+	for i := range 5000 {
+		key := "key" + strconv.Itoa(rand.IntN(1000))
+		if rand.IntN(3) == 0 {
+			_, deleted := l.delete(key)
+			_, ok := want[key]
+			if deleted != ok {
+				t.Fatalf("delete %q: expected %v, got %v", key, ok, deleted)
+			}
+			delete(want, key)
+			continue
+		}
+
+		l.put(key, strconv.Itoa(i))
+		want[key] = strconv.Itoa(i)
+	}
+
+	keys := make([]string, 0, len(want))
+	for key := range want {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	if l.len != len(keys) {
+		t.Fatalf("expected %d keys, got %d", len(keys), l.len)
+	}
+
+	i := 0
+	for n := l.head.next[0]; n != nil; n = n.next[0] {
+		if n.key != keys[i] || n.value != want[n.key] {
+			t.Fatalf("position %d: expected %q=%q, got %q=%q", i, keys[i], want[keys[i]], n.key, n.value)
+		}
+		i++
+	}
+
+	i = len(keys) - 1
+	for n := l.last(); n != nil; n = n.prev {
+		if n.key != keys[i] {
+			t.Fatalf("position %d walking back: expected %q, got %q", i, keys[i], n.key)
+		}
+		i--
+	}
+	if i != -1 {
+		t.Errorf("expected to walk back over all keys, stopped at %d", i)
+	}
+}
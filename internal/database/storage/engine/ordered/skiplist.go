@@ -0,0 +1,167 @@
+package ordered
+
+import (
+	"math/rand/v2"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+)
+
+// A node is promoted to the next level with probability 1/4, which keeps the
+// expected search cost low with fewer pointers than 1/2 would need.
+const (
+	maxLevel    = 32
+	levelFactor = 4
+)
+
+// skipNode holds a value either as bytes or as an object.
+type skipNode struct {
+	key    string
+	value  string
+	object engine.Object
+	typ    engine.ValueType
+	next   []*skipNode
+	prev   *skipNode
+}
+
+// current returns the value as held, for Update and View.
+func (n *skipNode) current() ([]byte, engine.Object) {
+	if n.object != nil {
+		return nil, n.object
+	}
+
+	return []byte(n.value), nil
+}
+
+func (n *skipNode) encoded() []byte {
+	if n.object != nil {
+		return n.object.Encode()
+	}
+
+	return []byte(n.value)
+}
+
+// skiplist is a sorted map from keys to values. The bottom level is doubly
+// linked so that it can be walked in both directions.
+type skiplist struct {
+	head  *skipNode
+	level int
+	len   int
+}
+
+func newSkiplist() *skiplist {
+	return &skiplist{
+		head:  &skipNode{key: "", value: "", object: nil, typ: engine.TypeString, next: make([]*skipNode, maxLevel), prev: nil},
+		level: 1,
+		len:   0,
+	}
+}
+
+func randomLevel() int {
+	level := 1
+	for level < maxLevel && rand.IntN(levelFactor) == 0 {
+		level++
+	}
+
+	return level
+}
+
+// seek returns the first node whose key is not less than key, or nil. If
+// update is given, it receives the last node before that one on every level.
+func (l *skiplist) seek(key string, update []*skipNode) *skipNode {
+	n := l.head
+	for level := l.level - 1; level >= 0; level-- {
+		for n.next[level] != nil && n.next[level].key < key {
+			n = n.next[level]
+		}
+		if update != nil {
+			update[level] = n
+		}
+	}
+
+	return n.next[0]
+}
+
+func (l *skiplist) get(key string) (*skipNode, bool) {
+	n := l.seek(key, nil)
+	if n == nil || n.key != key {
+		return nil, false
+	}
+
+	return n, true
+}
+
+// put inserts or replaces key and returns the node that holds it.
+func (l *skiplist) put(key, value string) *skipNode {
+	update := make([]*skipNode, maxLevel)
+	if n := l.seek(key, update); n != nil && n.key == key {
+		n.value, n.object = value, nil
+		return n
+	}
+
+	level := randomLevel()
+	for ; l.level < level; l.level++ {
+		update[l.level] = l.head
+	}
+
+	n := &skipNode{key: key, value: value, object: nil, typ: engine.TypeString, next: make([]*skipNode, level), prev: nil}
+	for i := range level {
+		n.next[i] = update[i].next[i]
+		update[i].next[i] = n
+	}
+
+	if update[0] != l.head {
+		n.prev = update[0]
+	}
+	if n.next[0] != nil {
+		n.next[0].prev = n
+	}
+	l.len++
+
+	return n
+}
+
+func (l *skiplist) delete(key string) (*skipNode, bool) {
+	update := make([]*skipNode, maxLevel)
+	n := l.seek(key, update)
+	if n == nil || n.key != key {
+		return nil, false
+	}
+
+	for i := range len(n.next) {
+		update[i].next[i] = n.next[i]
+	}
+	if n.next[0] != nil {
+		n.next[0].prev = n.prev
+	}
+	for l.level > 1 && l.head.next[l.level-1] == nil {
+		l.level--
+	}
+	l.len--
+
+	return n, true
+}
+
+// last returns the node with the greatest key, or nil if the list is empty.
+func (l *skiplist) last() *skipNode {
+	n := l.head
+	for level := l.level - 1; level >= 0; level-- {
+		for n.next[level] != nil {
+			n = n.next[level]
+		}
+	}
+
+	if n == l.head {
+		return nil
+	}
+
+	return n
+}
+
+// before returns the node with the greatest key less than key, or nil.
+func (l *skiplist) before(key string) *skipNode {
+	if n := l.seek(key, nil); n != nil {
+		return n.prev
+	}
+
+	return l.last()
+}
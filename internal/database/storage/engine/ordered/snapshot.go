@@ -0,0 +1,105 @@
+package ordered
+
+import (
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+)
+
+const snapshotChunkSize = 1024
+
+// snapshot is a copy-on-write view of the list, taken the same way as for the
+// in-memory engine: the keys are captured in order when it starts, and
+// writers stash the previous value of a key the first time they change it.
+type snapshot struct {
+	engine *OrderedEngine
+	keys   []string
+	frozen map[string]engine.Entry
+}
+
+func (e *OrderedEngine) Snapshot() (engine.Snapshot, error) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	if e.snapshot != nil {
+		return nil, engine.ErrSnapshotInProgress
+	}
+
+	keys := make([]string, 0, e.list.len)
+	for n := e.list.head.next[0]; n != nil; n = n.next[0] {
+		keys = append(keys, n.key)
+	}
+
+	e.snapshot = &snapshot{
+		engine: e,
+		keys:   keys,
+		frozen: make(map[string]engine.Entry),
+	}
+
+	return e.snapshot, nil
+}
+
+// preserve must be called with the write lock held before key is modified.
+func (s *snapshot) preserve(key string) {
+	if _, ok := s.frozen[key]; ok {
+		return
+	}
+
+	entry, ok := s.engine.entry(key)
+	if !ok {
+		return
+	}
+
+	s.frozen[key] = entry
+}
+
+// entry must be called with the lock held.
+func (e *OrderedEngine) entry(key string) (engine.Entry, bool) {
+	n, ok := e.list.get(key)
+	if !ok {
+		return engine.Entry{}, false
+	}
+
+	return engine.Entry{Key: []byte(key), Value: n.encoded(), Object: nil, Type: n.typ, Deadline: e.deadlines[key]}, true
+}
+
+// ForEach visits the keys in order and skips the ones that have already
+// expired by the time they are visited.
+func (s *snapshot) ForEach(fn func(entry engine.Entry) error) error {
+	chunk := make([]engine.Entry, 0, snapshotChunkSize)
+
+	for start := 0; start < len(s.keys); start += snapshotChunkSize {
+		end := min(start+snapshotChunkSize, len(s.keys))
+		chunk = chunk[:0]
+
+		now := time.Now()
+		s.engine.mtx.RLock()
+		for _, key := range s.keys[start:end] {
+			entry, ok := s.frozen[key]
+			if !ok {
+				entry, ok = s.engine.entry(key)
+			}
+			if ok && !entry.Expired(now) {
+				chunk = append(chunk, entry)
+			}
+		}
+		s.engine.mtx.RUnlock()
+
+		for _, entry := range chunk {
+			if err := fn(entry); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *snapshot) Release() {
+	s.engine.mtx.Lock()
+	defer s.engine.mtx.Unlock()
+
+	if s.engine.snapshot == s {
+		s.engine.snapshot = nil
+	}
+}
@@ -0,0 +1,68 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/crunchydeer30/key-value-database/internal/config"
+	"go.uber.org/zap"
+)
+
+var ErrUnknownEngine = errors.New("unknown engine")
+
+// Factory builds an engine from its decoded config section.
+type Factory[C any] func(cfg *C, logger *zap.Logger) (Engine, error)
+
+type factory func(section any, logger *zap.Logger) (Engine, error)
+
+var (
+	registryMtx sync.RWMutex
+	registry    = make(map[string]factory)
+)
+
+// Register makes an engine available under name. The section of the engine
+// config named after it is decoded into a new C and validated before the
+// factory is called. Register is meant to be called from init and panics if
+// name is already taken.
+func Register[C any](name string, f Factory[C]) {
+	registryMtx.Lock()
+	defer registryMtx.Unlock()
+
+	if _, ok := registry[name]; ok {
+		panic(fmt.Sprintf("engine %q registered twice", name))
+	}
+
+	registry[name] = func(section any, logger *zap.Logger) (Engine, error) {
+		cfg := new(C)
+		if err := config.DecodeSection(section, cfg); err != nil {
+			return nil, fmt.Errorf("invalid %s engine config: %w", name, err)
+		}
+
+		return f(cfg, logger)
+	}
+}
+
+// New builds the engine registered under name from its config section.
+func New(name string, section any, logger *zap.Logger) (Engine, error) {
+	registryMtx.RLock()
+	f, ok := registry[name]
+	registryMtx.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w %q, available engines: %s", ErrUnknownEngine, name, strings.Join(Names(), ", "))
+	}
+
+	return f(section, logger)
+}
+
+// Names returns the names of the registered engines in order.
+func Names() []string {
+	registryMtx.RLock()
+	defer registryMtx.RUnlock()
+
+	return slices.Sorted(maps.Keys(registry))
+}
@@ -0,0 +1,69 @@
+package engine
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/crunchydeer30/key-value-database/internal/config"
+	"go.uber.org/zap"
+)
+
+type testEngine struct {
+	Engine
+	cfg *testConfig
+}
+
+type testConfig struct {
+	Path  string `mapstructure:"path" validate:"required"`
+	Limit int    `mapstructure:"limit" validate:"min=0"`
+}
+
+func init() {
+	Register("test", func(cfg *testConfig, _ *zap.Logger) (Engine, error) {
+		return &testEngine{Engine: nil, cfg: cfg}, nil
+	})
+}
+
+func TestNew_DecodesConfigSection(t *testing.T) {
+	e, err := New("test", map[string]any{"path": "./data", "limit": 10}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//nolint:forcetypeassert
+	cfg := e.(*testEngine).cfg
+	if cfg.Path != "./data" || cfg.Limit != 10 {
+		t.Errorf("unexpected config: %+v", cfg)
+	}
+}
+
+func TestNew_ValidatesConfigSection(t *testing.T) {
+	_, err := New("test", nil, zap.NewNop())
+	if !errors.Is(err, config.ErrValidationFailed) {
+		t.Errorf("expected error type %v, got %v", config.ErrValidationFailed, err)
+	}
+}
+
+func TestNew_UnknownEngine(t *testing.T) {
+	_, err := New("missing", nil, zap.NewNop())
+	if !errors.Is(err, ErrUnknownEngine) {
+		t.Fatalf("expected error type %v, got %v", ErrUnknownEngine, err)
+	}
+
+	if !strings.Contains(err.Error(), "available engines: test") {
+		t.Errorf("expected error to list the registered engines, got %q", err)
+	}
+}
+
+func TestRegister_PanicsOnDuplicateName(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected registering a name twice to panic")
+		}
+	}()
+
+	Register("test", func(*testConfig, *zap.Logger) (Engine, error) {
+		return nil, errors.New("unreachable")
+	})
+}
@@ -0,0 +1,100 @@
+package sharded
+
+import (
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+	inmemory "github.com/crunchydeer30/key-value-database/internal/database/storage/engine/in_memory"
+	"go.uber.org/zap"
+)
+
+const benchmarkKeys = 1 << 16
+
+var benchmarkProcs = []int{1, 2, 4, 8, 16}
+
+type benchmarkEngine struct {
+	name string
+	new  func() (engine.Engine, error)
+}
+
+var benchmarkEngines = []benchmarkEngine{
+	{name: "in_memory", new: func() (engine.Engine, error) { return inmemory.NewInMemoryEngine(zap.NewNop()) }},
+	{name: "sharded", new: func() (engine.Engine, error) { return NewShardedEngine(DefaultShards, zap.NewNop()) }},
+}
+
+func benchmarkKeySet() []string {
+	keys := make([]string, benchmarkKeys)
+	for i := range keys {
+		keys[i] = "key" + strconv.Itoa(i)
+	}
+
+	return keys
+}
+
+// runEngineBenchmark runs op from b.RunParallel for every engine and every
+// GOMAXPROCS value. Each goroutine walks the key set from its own offset.
+func runEngineBenchmark(b *testing.B, op func(e engine.Engine, key string, i int) error) {
+	b.Helper()
+
+	keys := benchmarkKeySet()
+
+	for _, be := range benchmarkEngines {
+		for _, procs := range benchmarkProcs {
+			b.Run(be.name+"/procs="+strconv.Itoa(procs), func(b *testing.B) {
+				e, err := be.new()
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				for _, key := range keys {
+					if err := e.Set([]byte(key), []byte(key)); err != nil {
+						b.Fatal(err)
+					}
+				}
+
+				defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(procs))
+
+				var worker atomic.Int64
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					i := int(worker.Add(1)) * 7919
+					for pb.Next() {
+						if err := op(e, keys[i%len(keys)], i); err != nil {
+							b.Error(err)
+							return
+						}
+						i++
+					}
+				})
+			})
+		}
+	}
+}
+
+func BenchmarkSet(b *testing.B) {
+	runEngineBenchmark(b, func(e engine.Engine, key string, _ int) error {
+		return e.Set([]byte(key), []byte("value"))
+	})
+}
+
+func BenchmarkGet(b *testing.B) {
+	runEngineBenchmark(b, func(e engine.Engine, key string, _ int) error {
+		_, err := e.Get([]byte(key))
+		return err
+	})
+}
+
+// BenchmarkMixed issues one SET for every four GETs.
+func BenchmarkMixed(b *testing.B) {
+	runEngineBenchmark(b, func(e engine.Engine, key string, i int) error {
+		if i%5 == 0 {
+			return e.Set([]byte(key), []byte("value"))
+		}
+
+		_, err := e.Get([]byte(key))
+		return err
+	})
+}
@@ -0,0 +1,133 @@
+package sharded
+
+import (
+	"errors"
+	"hash/maphash"
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+	inmemory "github.com/crunchydeer30/key-value-database/internal/database/storage/engine/in_memory"
+	"go.uber.org/zap"
+)
+
+const (
+	Name          = "sharded"
+	DefaultShards = 32
+)
+
+type Config struct {
+	Shards int `mapstructure:"shards" validate:"omitempty,min=1"`
+}
+
+func init() {
+	engine.Register(Name, func(cfg *Config, logger *zap.Logger) (engine.Engine, error) {
+		return NewShardedEngine(cfg.Shards, logger)
+	})
+}
+
+// ShardedEngine splits the keyspace over independent in-memory shards, each
+// with its own map and lock, so that writers to different keys rarely contend.
+type ShardedEngine struct {
+	logger *zap.Logger
+	seed   maphash.Seed
+	shards []*inmemory.InMemoryEngine
+}
+
+func NewShardedEngine(shards int, logger *zap.Logger) (engine.Engine, error) {
+	if shards < 0 {
+		return nil, errors.New("number of shards must be positive")
+	}
+
+	if shards == 0 {
+		shards = DefaultShards
+	}
+
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	e := &ShardedEngine{
+		logger: logger,
+		seed:   maphash.MakeSeed(),
+		shards: make([]*inmemory.InMemoryEngine, 0, shards),
+	}
+
+	for range shards {
+		shard, err := inmemory.NewInMemoryEngine(logger)
+		if err != nil {
+			return nil, err
+		}
+		//nolint:forcetypeassert
+		e.shards = append(e.shards, shard.(*inmemory.InMemoryEngine))
+	}
+
+	return e, nil
+}
+
+func (e *ShardedEngine) shard(key []byte) *inmemory.InMemoryEngine {
+	return e.shards[maphash.Bytes(e.seed, key)%uint64(len(e.shards))]
+}
+
+func (e *ShardedEngine) Get(key []byte) ([]byte, error) {
+	return e.shard(key).Get(key)
+}
+
+func (e *ShardedEngine) GetEntry(key []byte) (engine.Entry, error) {
+	return e.shard(key).GetEntry(key)
+}
+
+func (e *ShardedEngine) View(key []byte, fn func(entry engine.Entry, found bool) error) error {
+	return e.shard(key).View(key, fn)
+}
+
+func (e *ShardedEngine) Set(key, value []byte) error {
+	return e.shard(key).Set(key, value)
+}
+
+func (e *ShardedEngine) Del(key []byte) error {
+	return e.shard(key).Del(key)
+}
+
+func (e *ShardedEngine) Update(key []byte, fn engine.UpdateFunc) error {
+	return e.shard(key).Update(key, fn)
+}
+
+// Version returns the version of key as counted by its shard. Shards count
+// on their own, which is enough as versions are only compared per key.
+func (e *ShardedEngine) Version(key []byte) (uint64, error) {
+	return e.shard(key).Version(key)
+}
+
+func (e *ShardedEngine) KeepHistory(limits engine.HistoryLimits) {
+	for _, shard := range e.shards {
+		shard.KeepHistory(limits)
+	}
+}
+
+// History returns the revisions of key as numbered by its shard.
+func (e *ShardedEngine) History(key []byte, limit int) ([]engine.Revision, error) {
+	return e.shard(key).History(key, limit)
+}
+
+// CompactHistory compacts up to limit keys of every shard, each under the
+// lock of its shard only.
+func (e *ShardedEngine) CompactHistory(now time.Time, limit int) (int, bool) {
+	dropped, more := 0, false
+	for _, shard := range e.shards {
+		n, left := shard.CompactHistory(now, limit)
+		dropped += n
+		more = more || left
+	}
+
+	return dropped, more
+}
+
+func (e *ShardedEngine) Clear() error {
+	for _, shard := range e.shards {
+		if err := shard.Clear(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,193 @@
+package sharded
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine/enginetest"
+	"go.uber.org/zap"
+)
+
+func newTestEngine(t *testing.T, shards int) *ShardedEngine {
+	t.Helper()
+
+	e, err := NewShardedEngine(shards, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//nolint:forcetypeassert
+	return e.(*ShardedEngine)
+}
+
+func TestShardedEngine_SetGetDel(t *testing.T) {
+	e := newTestEngine(t, 4)
+
+	for i := range 1000 {
+		if err := e.Set([]byte("key"+strconv.Itoa(i)), []byte("value"+strconv.Itoa(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i, shard := range e.shards {
+		snap, err := shard.Snapshot()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		count := 0
+		//nolint:errcheck
+		snap.ForEach(func(engine.Entry) error {
+			count++
+			return nil
+		})
+		snap.Release()
+
+		if count == 0 {
+			t.Errorf("expected keys to be spread over all shards, shard %d is empty", i)
+		}
+	}
+
+	value, err := e.Get([]byte("key500"))
+	if err != nil || string(value) != "value500" {
+		t.Errorf("expected value %q, got %q (%v)", "value500", value, err)
+	}
+
+	if err := e.Del([]byte("key500")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := e.Get([]byte("key500")); !errors.Is(err, engine.ErrKeyNotFound) {
+		t.Errorf("expected error %v, got %v", engine.ErrKeyNotFound, err)
+	}
+}
+
+func TestShardedEngine_InvalidShards(t *testing.T) {
+	if _, err := NewShardedEngine(-1, zap.NewNop()); err == nil {
+		t.Errorf("expected error for negative number of shards")
+	}
+
+	e := newTestEngine(t, 0)
+	if len(e.shards) != DefaultShards {
+		t.Errorf("expected %d shards, got %d", DefaultShards, len(e.shards))
+	}
+}
+
+func TestShardedEngine_ConcurrentAccess(t *testing.T) {
+	e := newTestEngine(t, 8)
+
+	var wg sync.WaitGroup
+	for w := range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 500 {
+				key := "key" + strconv.Itoa(w) + "_" + strconv.Itoa(i)
+				if err := e.Set([]byte(key), []byte(key)); err != nil {
+					t.Error(err)
+					return
+				}
+				if value, err := e.Get([]byte(key)); err != nil || string(value) != key {
+					t.Errorf("expected value %q, got %q (%v)", key, value, err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestShardedEngine_SnapshotAndClear(t *testing.T) {
+	e := newTestEngine(t, 4)
+
+	for i := range 100 {
+		if err := e.Set([]byte("key"+strconv.Itoa(i)), []byte("value")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	snap, err := e.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Release()
+
+	if _, err := e.Snapshot(); !errors.Is(err, engine.ErrSnapshotInProgress) {
+		t.Errorf("expected error %v, got %v", engine.ErrSnapshotInProgress, err)
+	}
+
+	if err := e.Clear(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := e.Get([]byte("key0")); !errors.Is(err, engine.ErrKeyNotFound) {
+		t.Errorf("expected error %v, got %v", engine.ErrKeyNotFound, err)
+	}
+
+	count := 0
+	err = snap.ForEach(func(entry engine.Entry) error {
+		if string(entry.Value) != "value" {
+			t.Errorf("unexpected value %q", entry.Value)
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 100 {
+		t.Errorf("expected snapshot to keep 100 keys, got %d", count)
+	}
+}
+
+func TestShardedEngine_Scan(t *testing.T) {
+	e := newTestEngine(t, 4)
+
+	for i := range 500 {
+		if err := e.Set([]byte("key"+strconv.Itoa(i)), []byte("value")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	seen := make(map[string]int)
+	cursor := ""
+	for {
+		keys, next, err := e.Scan(cursor, 25)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, key := range keys {
+			seen[string(key)]++
+		}
+
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	if len(seen) != 500 {
+		t.Errorf("expected 500 keys, got %d", len(seen))
+	}
+	for key, n := range seen {
+		if n != 1 {
+			t.Errorf("key %q returned %d times", key, n)
+		}
+	}
+
+	for _, cursor := range []string{"4", "x:1", "1:x"} {
+		if _, _, err := e.Scan(cursor, 10); !errors.Is(err, engine.ErrInvalidCursor) {
+			t.Errorf("cursor %q: expected error %v, got %v", cursor, engine.ErrInvalidCursor, err)
+		}
+	}
+}
+
+func TestShardedEngine_Conformance(t *testing.T) {
+	enginetest.Run(t, func(t *testing.T, _ string) engine.Engine {
+		return newTestEngine(t, 4)
+	}, false)
+}
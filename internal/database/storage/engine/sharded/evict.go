@@ -0,0 +1,32 @@
+package sharded
+
+import (
+	"math/rand/v2"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+)
+
+func (e *ShardedEngine) UsedMemory() int64 {
+	var used int64
+	for _, shard := range e.shards {
+		used += shard.UsedMemory()
+	}
+
+	return used
+}
+
+// EvictionCandidate samples a single shard picked at random, falling through
+// to the next ones only if it has nothing to evict. Keys are spread evenly, so
+// the sample is as representative as one taken across all shards.
+func (e *ShardedEngine) EvictionCandidate(policy engine.EvictionPolicy, samples int, skip func([]byte) bool) ([]byte, bool) {
+	//nolint:gosec
+	start := rand.IntN(len(e.shards))
+	for i := range e.shards {
+		shard := e.shards[(start+i)%len(e.shards)]
+		if key, ok := shard.EvictionCandidate(policy, samples, skip); ok {
+			return key, true
+		}
+	}
+
+	return nil, false
+}
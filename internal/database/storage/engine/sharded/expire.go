@@ -0,0 +1,34 @@
+package sharded
+
+import (
+	"time"
+)
+
+func (e *ShardedEngine) SetWithDeadline(key, value []byte, deadline time.Time) error {
+	return e.shard(key).SetWithDeadline(key, value, deadline)
+}
+
+func (e *ShardedEngine) Expire(key []byte, deadline time.Time) error {
+	return e.shard(key).Expire(key, deadline)
+}
+
+func (e *ShardedEngine) Persist(key []byte) (bool, error) {
+	return e.shard(key).Persist(key)
+}
+
+func (e *ShardedEngine) Deadline(key []byte) (time.Time, error) {
+	return e.shard(key).Deadline(key)
+}
+
+// DeleteExpired samples every shard, since keys with a deadline may be
+// concentrated in any of them.
+func (e *ShardedEngine) DeleteExpired(now time.Time, samples int) (int, int) {
+	sampled, deleted := 0, 0
+	for _, shard := range e.shards {
+		s, d := shard.DeleteExpired(now, samples)
+		sampled += s
+		deleted += d
+	}
+
+	return sampled, deleted
+}
@@ -0,0 +1,44 @@
+package sharded
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+)
+
+// Scan goes through the shards one after another. The cursor is the index of
+// the current shard, followed by ":" and the cursor within it once the shard
+// is partly scanned.
+func (e *ShardedEngine) Scan(cursor string, count int) ([][]byte, string, error) {
+	index, shardCursor := 0, ""
+	if cursor != "" {
+		var err error
+		prefix, rest, _ := strings.Cut(cursor, ":")
+		if index, err = strconv.Atoi(prefix); err != nil || index < 0 || index >= len(e.shards) {
+			return nil, "", engine.ErrInvalidCursor
+		}
+		shardCursor = rest
+	}
+
+	var keys [][]byte
+	for len(keys) < count {
+		batch, next, err := e.shards[index].Scan(shardCursor, count-len(keys))
+		if err != nil {
+			return nil, "", err
+		}
+		keys = append(keys, batch...)
+
+		if next != "" {
+			return keys, strconv.Itoa(index) + ":" + next, nil
+		}
+
+		index++
+		shardCursor = ""
+		if index == len(e.shards) {
+			return keys, "", nil
+		}
+	}
+
+	return keys, strconv.Itoa(index), nil
+}
@@ -0,0 +1,43 @@
+package sharded
+
+import (
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+)
+
+// snapshot combines one copy-on-write snapshot per shard. Shards are captured
+// one after another, so the caller must keep writers out while Snapshot runs
+// to get a view that is consistent across shards, as storage already does.
+type snapshot struct {
+	shards []engine.Snapshot
+}
+
+func (e *ShardedEngine) Snapshot() (engine.Snapshot, error) {
+	s := &snapshot{shards: make([]engine.Snapshot, 0, len(e.shards))}
+
+	for _, shard := range e.shards {
+		snap, err := shard.Snapshot()
+		if err != nil {
+			s.Release()
+			return nil, err
+		}
+		s.shards = append(s.shards, snap)
+	}
+
+	return s, nil
+}
+
+func (s *snapshot) ForEach(fn func(entry engine.Entry) error) error {
+	for _, shard := range s.shards {
+		if err := shard.ForEach(fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *snapshot) Release() {
+	for _, shard := range s.shards {
+		shard.Release()
+	}
+}
@@ -0,0 +1,93 @@
+package engine
+
+// initialVersion is the version of keys that have not been written since the
+// engine was opened.
+const initialVersion = 1
+
+// minTombstones is how many tombstones are kept at least before they are
+// dropped for a floor.
+const minTombstones = 1024
+
+// Versions keeps the versions of keys for engines that implement Versioner,
+// and their history for engines that implement Historian. Every write,
+// deletions included, takes the next number of a counter shared by all keys,
+// so a key never gets an old version back. It is not safe for concurrent use:
+// engines call it under the lock that guards their writes.
+//
+// A deleted key keeps the version of its deletion as a tombstone. Once
+// tombstones outnumber the keys, they are all dropped and missing keys report
+// the floor instead, the last version at that point. That makes every missing
+// key look changed once, which only fails watches that did not need to fail.
+type Versions struct {
+	last       uint64
+	keys       map[string]uint64
+	tombstones map[string]uint64
+	floor      uint64
+	history    *history
+}
+
+// Bump gives key a new version. It must be called on every write to the key
+// that Put is not called for, such as deadline changes.
+func (v *Versions) Bump(key string) {
+	if v.keys == nil {
+		v.keys = make(map[string]uint64)
+	}
+
+	v.keys[key] = v.next()
+	delete(v.tombstones, key)
+}
+
+// Forget gives a deleted key a new version, kept as its tombstone.
+func (v *Versions) Forget(key string) {
+	delete(v.keys, key)
+	version := v.next()
+	v.recordDeleted(key, version)
+
+	if v.tombstones == nil {
+		v.tombstones = make(map[string]uint64)
+	}
+	v.tombstones[key] = version
+
+	if len(v.tombstones) > max(minTombstones, len(v.keys)) {
+		v.tombstones = nil
+		v.floor = version
+	}
+}
+
+// Get returns the version of a key that exists.
+func (v *Versions) Get(key string) uint64 {
+	if version, ok := v.keys[key]; ok {
+		return version
+	}
+
+	return initialVersion
+}
+
+// Missing returns the version of a key that does not exist: that of its
+// deletion, or the floor if there is no tombstone for it.
+func (v *Versions) Missing(key string) uint64 {
+	if version, ok := v.tombstones[key]; ok {
+		return version
+	}
+
+	return v.floor
+}
+
+// Reset forgets every key while keeping the counter. Every missing key then
+// reports the version of the reset.
+func (v *Versions) Reset() {
+	v.keys = nil
+	v.tombstones = nil
+	v.floor = v.next()
+
+	if v.history != nil {
+		for key := range v.history.keys {
+			v.recordDeleted(key, v.floor)
+		}
+	}
+}
+
+func (v *Versions) next() uint64 {
+	v.last = max(v.last, initialVersion) + 1
+	return v.last
+}
@@ -0,0 +1,70 @@
+package engine
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestVersions(t *testing.T) {
+	var v Versions
+
+	if got := v.Get("loaded"); got != initialVersion {
+		t.Errorf("expected initial version %d, got %d", initialVersion, got)
+	}
+
+	v.Bump("a")
+	first := v.Get("a")
+	v.Bump("b")
+	v.Bump("a")
+	if got := v.Get("a"); got <= first || got <= v.Get("b") {
+		t.Errorf("expected the latest write to have the highest version, got a=%d b=%d", got, v.Get("b"))
+	}
+
+	last := v.Get("a")
+	v.Reset()
+	v.Bump("a")
+	if got := v.Get("a"); got <= last {
+		t.Errorf("expected versions to keep growing after a reset, got %d after %d", got, last)
+	}
+}
+
+func TestVersions_Tombstones(t *testing.T) {
+	var v Versions
+
+	if got := v.Missing("a"); got != 0 {
+		t.Errorf("expected version 0 for a key never written, got %d", got)
+	}
+
+	v.Bump("a")
+	written := v.Get("a")
+	v.Forget("a")
+	deleted := v.Missing("a")
+	if deleted <= written {
+		t.Errorf("expected the deletion to get a version above %d, got %d", written, deleted)
+	}
+
+	v.Bump("a")
+	if got := v.Get("a"); got <= deleted {
+		t.Errorf("expected a recreated key to get a version above %d, got %d", deleted, got)
+	}
+
+	// Past minTombstones, tombstones give way to a floor that still sets
+	// every deleted key apart from what it was before.
+	for i := range minTombstones + 1 {
+		key := strconv.Itoa(i)
+		v.Bump(key)
+		v.Forget(key)
+	}
+	if len(v.tombstones) > minTombstones {
+		t.Errorf("expected at most %d tombstones, got %d", minTombstones, len(v.tombstones))
+	}
+	if got := v.Missing("0"); got <= deleted {
+		t.Errorf("expected a deleted key to keep a version above %d, got %d", deleted, got)
+	}
+
+	last := v.Get("a")
+	v.Reset()
+	if got := v.Missing("a"); got <= last {
+		t.Errorf("expected a reset to give missing keys a version above %d, got %d", last, got)
+	}
+}
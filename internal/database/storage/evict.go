@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/wal"
+	"go.uber.org/zap"
+)
+
+const (
+	evictionSamples        = 5
+	evictionReportInterval = 10 * time.Second
+)
+
+var ErrOutOfMemory = errors.New("max memory reached")
+
+// WithMaxMemory caps the approximate memory used by entries. Writes that
+// would go over the limit first evict keys chosen by policy, or fail with
+// ErrOutOfMemory under engine.NoEviction.
+func WithMaxMemory(limit int64, policy engine.EvictionPolicy) StorageOption {
+	return func(s *Storage) {
+		s.maxMemory = limit
+		s.evictionPolicy = policy
+	}
+}
+
+// makeRoom evicts keys until key fits under the limit with value in place of
+// what it holds now.
+func (s *Storage) makeRoom(key, value string) error {
+	return s.makeRoomFor([]string{key, value})
+}
+
+// makeRoomFor evicts keys until the keys of pairs, given as key, value, key,
+// value..., fit under the limit with their new values. Only what they grow by
+// over their current entries has to fit, and none of them is evicted to make
+// room for the others.
+func (s *Storage) makeRoomFor(pairs []string) error {
+	if s.maxMemory == 0 {
+		return nil
+	}
+
+	values := make(map[string]string, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		values[pairs[i]] = pairs[i+1]
+	}
+
+	var size, growth int64
+	for key, value := range values {
+		entrySize := engine.EntrySize(key, value)
+		size += entrySize
+		growth += entrySize
+
+		current, err := s.engine.GetEntry([]byte(key))
+		switch {
+		case err == nil:
+			growth -= engine.EntrySize(key, string(current.Value))
+		case !errors.Is(err, engine.ErrKeyNotFound):
+			return err
+		}
+	}
+
+	if size > s.maxMemory {
+		return fmt.Errorf("%w: entry of %d bytes is larger than the limit", ErrOutOfMemory, size)
+	}
+
+	skip := func(key []byte) bool {
+		_, ok := values[string(key)]
+		return ok
+	}
+
+	for s.evictor.UsedMemory()+growth > s.maxMemory {
+		if s.evictionPolicy == engine.NoEviction {
+			return ErrOutOfMemory
+		}
+
+		victim, ok := s.evictor.EvictionCandidate(s.evictionPolicy, evictionSamples, skip)
+		if !ok {
+			return fmt.Errorf("%w: no keys to evict under policy %s", ErrOutOfMemory, s.evictionPolicy)
+		}
+
+		if err := s.evict(string(victim)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// evict deletes a key on behalf of the memory limit. The deletion is logged
+// like any other, so replaying the WAL and replicas evict the same keys.
+func (s *Storage) evict(key string) error {
+	if s.wal != nil {
+		if _, err := s.wal.Append(wal.OperationDel, key); err != nil {
+			return err
+		}
+	}
+
+	if err := s.engine.Del([]byte(key)); err != nil {
+		return err
+	}
+	s.evicted.Add(1)
+
+	return nil
+}
+
+func (s *Storage) evictionReportLoop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(evictionReportInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			s.reportEvictions()
+			return
+		case <-ticker.C:
+			s.reportEvictions()
+		}
+	}
+}
+
+func (s *Storage) reportEvictions() {
+	evicted := s.evicted.Swap(0)
+	if evicted == 0 {
+		return
+	}
+
+	s.logger.Info(
+		"evicted keys",
+		zap.Int64("evicted", evicted),
+		zap.String("policy", string(s.evictionPolicy)),
+		zap.Int64("used_memory", s.evictor.UsedMemory()),
+		zap.Int64("max_memory", s.maxMemory),
+	)
+}
@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"errors"
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/wal"
+	"go.uber.org/zap"
+)
+
+const (
+	expireInterval = 100 * time.Millisecond
+	expireSamples  = 20
+	// A sampling round is repeated while more than a quarter of the sampled
+	// keys turn out to be expired, but never for longer than expireBudget.
+	expireBudget = 25 * time.Millisecond
+)
+
+var errNoDeadline = errors.New("key has no deadline")
+
+func (s *Storage) SetWithDeadline(key, value string, deadline time.Time, opts ...WriteOption) error {
+	if s.expirer == nil {
+		return engine.ErrExpirationUnsupported
+	}
+
+	return s.write(opts, func() error {
+		return s.makeRoom(key, value)
+	}, func() error {
+		return s.expirer.SetWithDeadline([]byte(key), []byte(value), deadline)
+	}, wal.OperationSetWithDeadline, key, value, wal.FormatDeadline(deadline))
+}
+
+// Expire sets the deadline of an existing key. It is logged as the entry it
+// leaves, so that replaying the log past the old deadline keeps the key.
+// Nothing is logged if the key does not exist.
+func (s *Storage) Expire(key string, deadline time.Time, opts ...WriteOption) error {
+	if s.expirer == nil {
+		return engine.ErrExpirationUnsupported
+	}
+
+	return s.updateRecorded(opts, key, expire(deadline), entryRecord)
+}
+
+// Persist removes the deadline of a key and reports whether it had one. Like
+// Expire, it is logged as the entry it leaves.
+func (s *Storage) Persist(key string, opts ...WriteOption) (bool, error) {
+	if s.expirer == nil {
+		return false, engine.ErrExpirationUnsupported
+	}
+
+	err := s.updateRecorded(opts, key, func(current engine.Entry, found bool) (engine.Entry, bool, error) {
+		if found && current.Deadline.IsZero() {
+			return engine.Entry{}, false, errNoDeadline
+		}
+		return expire(time.Time{})(current, found)
+	}, entryRecord)
+
+	if errors.Is(err, errNoDeadline) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// expire gives an existing key deadline, which is zero to remove it.
+func expire(deadline time.Time) engine.UpdateFunc {
+	return func(current engine.Entry, found bool) (engine.Entry, bool, error) {
+		if !found {
+			return engine.Entry{}, false, engine.ErrKeyNotFound
+		}
+
+		current.Deadline = deadline
+		return current, true, nil
+	}
+}
+
+// Deadline returns the deadline of a key, or the zero time if it never
+// expires.
+func (s *Storage) Deadline(key string) (time.Time, error) {
+	if s.expirer == nil {
+		return time.Time{}, engine.ErrExpirationUnsupported
+	}
+
+	return s.expirer.Deadline([]byte(key))
+}
+
+// expireLoop removes expired keys nobody reads anymore. Deletions are not
+// logged: deadlines are absolute, so replaying the log expires the same keys.
+func (s *Storage) expireLoop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(expireInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			if deleted := s.deleteExpired(); deleted > 0 {
+				s.logger.Debug("deleted expired keys", zap.Int("deleted", deleted))
+			}
+		}
+	}
+}
+
+func (s *Storage) deleteExpired() int {
+	start := time.Now()
+
+	total := 0
+	for {
+		now := time.Now()
+		sampled, deleted := s.expirer.DeleteExpired(now, expireSamples)
+		total += deleted
+
+		if deleted*4 <= sampled || now.Sub(start) > expireBudget {
+			return total
+		}
+	}
+}
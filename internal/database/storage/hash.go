@@ -0,0 +1,248 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/wal"
+)
+
+var ErrCorruptedHash = errors.New("corrupted hash value")
+
+// A hash is encoded as its fields and values in alternation, ordered by field
+// and encoded like a list. Engines that keep their data in memory hold it as
+// a hash object instead, a map writes change in place. Like lists, hashes
+// never stay empty. Writes to a hash are logged as the fields they leave and
+// the deadline of the hash, so that replaying them again changes nothing.
+
+// HSet sets fields of the hash at key from pairs of fields and values and
+// returns how many of the fields are new.
+func (s *Storage) HSet(key string, pairs []string, opts ...WriteOption) (int, error) {
+	var added int
+	err := s.updateRecorded(opts, key, hashSet(pairs, &added), addedRecord(wal.OperationHSet, pairs))
+
+	return added, err
+}
+
+// HDel removes fields from the hash at key and returns how many of them were
+// there.
+func (s *Storage) HDel(key string, fields []string, opts ...WriteOption) (int, error) {
+	var removed int
+	err := s.updateRecorded(opts, key, hashDel(fields, &removed), removedRecord(wal.OperationHDel, fields))
+
+	return removed, err
+}
+
+// HIncrBy adds delta to the integer in a field of the hash at key, which
+// counts as 0 if it is missing, and returns the result. It is logged as
+// setting the field to the result.
+func (s *Storage) HIncrBy(key, field string, delta int64, opts ...WriteOption) (int64, error) {
+	var result int64
+	err := s.updateRecorded(opts, key, hashIncrBy(field, delta, &result), func(key string, updated engine.Entry, keep bool) (wal.Operation, []string) {
+		return addedRecord(wal.OperationHSet, []string{field, strconv.FormatInt(result, 10)})(key, updated, keep)
+	})
+
+	return result, err
+}
+
+// HGet returns a field of the hash at key, failing with
+// engine.ErrKeyNotFound if there is none.
+func (s *Storage) HGet(key, field string) (string, error) {
+	var value string
+	found := false
+	err := s.viewHash(key, func(h *hash) {
+		value, found = h.fields[field]
+	})
+	if err == nil && !found {
+		err = engine.ErrKeyNotFound
+	}
+
+	return value, err
+}
+
+// HGetAll returns every field of the hash at key with its value.
+func (s *Storage) HGetAll(key string) (map[string]string, error) {
+	var fields map[string]string
+	err := s.viewHash(key, func(h *hash) {
+		fields = maps.Clone(h.fields)
+	})
+
+	return fields, err
+}
+
+func (s *Storage) HExists(key, field string) (bool, error) {
+	var ok bool
+	err := s.viewHash(key, func(h *hash) {
+		_, ok = h.fields[field]
+	})
+
+	return ok, err
+}
+
+func (s *Storage) HLen(key string) (int, error) {
+	var length int
+	err := s.viewHash(key, func(h *hash) {
+		length = len(h.fields)
+	})
+
+	return length, err
+}
+
+// viewHash calls fn with the hash at key, which is empty if the key is
+// missing. fn must not change the hash.
+func (s *Storage) viewHash(key string, fn func(h *hash)) error {
+	return engine.View(s.engine, []byte(key), func(entry engine.Entry, found bool) error {
+		h, err := currentHash(entry, found)
+		if err != nil {
+			return err
+		}
+
+		fn(h)
+		return nil
+	})
+}
+
+// hash is the object hashes are kept as. size tracks the length of the
+// encoded hash as fields change.
+type hash struct {
+	fields map[string]string
+	size   int
+}
+
+func (h *hash) Encode() []byte {
+	fields := slices.Sorted(maps.Keys(h.fields))
+
+	buf := make([]byte, 0, h.size)
+	for _, field := range fields {
+		buf = appendElement(buf, field)
+		buf = appendElement(buf, h.fields[field])
+	}
+
+	return buf
+}
+
+func (h *hash) Size() int {
+	return h.size
+}
+
+func (h *hash) set(field, value string) bool {
+	old, ok := h.fields[field]
+	if ok {
+		h.size -= encodedLen(old)
+	} else {
+		h.size += encodedLen(field)
+	}
+
+	h.fields[field] = value
+	h.size += encodedLen(value)
+
+	return !ok
+}
+
+func (h *hash) del(field string) bool {
+	value, ok := h.fields[field]
+	if ok {
+		delete(h.fields, field)
+		h.size -= encodedLen(field) + encodedLen(value)
+	}
+
+	return ok
+}
+
+// currentHash returns the hash of an entry passed to an UpdateFunc or a
+// view: the object the engine holds, or one decoded from its value. A missing
+// key holds an empty hash.
+func currentHash(current engine.Entry, found bool) (*hash, error) {
+	if !found {
+		return &hash{fields: make(map[string]string), size: 0}, nil
+	}
+
+	if current.Type != engine.TypeHash {
+		return nil, engine.ErrWrongType
+	}
+
+	if h, ok := current.Object.(*hash); ok {
+		return h, nil
+	}
+
+	pairs, err := decodeList(current.Value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCorruptedHash, err)
+	}
+	if len(pairs)%2 != 0 {
+		return nil, fmt.Errorf("%w: field without value", ErrCorruptedHash)
+	}
+
+	h := &hash{fields: make(map[string]string, len(pairs)/2), size: len(current.Value)}
+	for i := 0; i < len(pairs); i += 2 {
+		h.fields[pairs[i]] = pairs[i+1]
+	}
+
+	return h, nil
+}
+
+// hashEntry returns current holding h in place of its value.
+func hashEntry(current engine.Entry, h *hash) engine.Entry {
+	current.Value, current.Object, current.Type = nil, h, engine.TypeHash
+	return current
+}
+
+func hashSet(pairs []string, added *int) engine.UpdateFunc {
+	return func(current engine.Entry, found bool) (engine.Entry, bool, error) {
+		h, err := currentHash(current, found)
+		if err != nil {
+			return engine.Entry{}, false, err
+		}
+
+		*added = 0
+		for i := 0; i+1 < len(pairs); i += 2 {
+			if h.set(pairs[i], pairs[i+1]) {
+				*added++
+			}
+		}
+
+		return hashEntry(current, h), true, nil
+	}
+}
+
+func hashDel(fields []string, removed *int) engine.UpdateFunc {
+	return func(current engine.Entry, found bool) (engine.Entry, bool, error) {
+		h, err := currentHash(current, found)
+		if err != nil || !found {
+			return engine.Entry{}, false, err
+		}
+
+		*removed = 0
+		for _, field := range fields {
+			if h.del(field) {
+				*removed++
+			}
+		}
+
+		return hashEntry(current, h), len(h.fields) > 0, nil
+	}
+}
+
+func hashIncrBy(field string, delta int64, result *int64) engine.UpdateFunc {
+	return func(current engine.Entry, found bool) (engine.Entry, bool, error) {
+		h, err := currentHash(current, found)
+		if err != nil {
+			return engine.Entry{}, false, err
+		}
+
+		value, ok := h.fields[field]
+		n, err := addInt(value, ok, delta)
+		if err != nil {
+			return engine.Entry{}, false, err
+		}
+
+		*result = n
+		h.set(field, strconv.FormatInt(n, 10))
+
+		return hashEntry(current, h), true, nil
+	}
+}
@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"errors"
+	"maps"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine/btree"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine/lsm"
+)
+
+func TestStorage_Hashes(t *testing.T) {
+	dir := t.TempDir()
+
+	s := newTestStorage(t, dir)
+	if n, err := s.HSet("user", []string{"name", "alice", "age", "30"}); err != nil || n != 2 {
+		t.Fatalf("expected 2, got %d, %v", n, err)
+	}
+	if n, err := s.HSet("user", []string{"name", "bob", "city", "paris"}); err != nil || n != 1 {
+		t.Fatalf("expected 1, got %d, %v", n, err)
+	}
+	if n, err := s.HIncrBy("user", "age", 2); err != nil || n != 32 {
+		t.Fatalf("expected 32, got %d, %v", n, err)
+	}
+	if n, err := s.HDel("user", []string{"city", "missing"}); err != nil || n != 1 {
+		t.Fatalf("expected 1, got %d, %v", n, err)
+	}
+	if _, err := s.HSet("temp", []string{"field", "value"}); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := s.HDel("temp", []string{"field"}); err != nil || n != 1 {
+		t.Fatalf("expected 1, got %d, %v", n, err)
+	}
+	if err := s.Set("name", "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	lastLSN := s.LastLSN()
+	if _, err := s.HSet("name", []string{"field", "value"}); !errors.Is(err, engine.ErrWrongType) {
+		t.Errorf("expected error %v, got %v", engine.ErrWrongType, err)
+	}
+	if _, err := s.HIncrBy("user", "name", 1); !errors.Is(err, ErrNotInteger) {
+		t.Errorf("expected error %v, got %v", ErrNotInteger, err)
+	}
+	if s.LastLSN() != lastLSN {
+		t.Errorf("expected failed hash writes not to be logged")
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s = newTestStorage(t, dir)
+	//nolint:errcheck
+	defer s.Close()
+
+	hash, err := s.HGetAll("user")
+	if err != nil || len(hash) != 2 || hash["name"] != "bob" || hash["age"] != "32" {
+		t.Errorf("expected name=bob age=32, got %v, %v", hash, err)
+	}
+	if _, err := s.HGet("user", "city"); !errors.Is(err, engine.ErrKeyNotFound) {
+		t.Errorf("expected error %v, got %v", engine.ErrKeyNotFound, err)
+	}
+	if ok, err := s.HExists("temp", "field"); err != nil || ok {
+		t.Errorf("expected emptied hash to be deleted, got %v, %v", ok, err)
+	}
+	if _, err := s.HLen("name"); !errors.Is(err, engine.ErrWrongType) {
+		t.Errorf("expected error %v, got %v", engine.ErrWrongType, err)
+	}
+}
+
+func TestStorage_HIncrByIsAtomic(t *testing.T) {
+	s := newTestStorage(t, t.TempDir())
+	//nolint:errcheck
+	defer s.Close()
+
+	const workers, increments = 8, 50
+
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range increments {
+				if _, err := s.HIncrBy("stats", "hits", 1); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got, err := s.HGet("stats", "hits"); err != nil || got != "400" {
+		t.Errorf("expected 400, got %q, %v", got, err)
+	}
+}
+
+func TestStorage_HashesOnPersistentEngines(t *testing.T) {
+	for _, name := range []string{lsm.Name, btree.Name} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			s := newPersistentTestStorage(t, dir, name)
+			if _, err := s.HSet("user", []string{"name", "alice", "age", "30"}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.HIncrBy("user", "age", 1); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.HDel("user", []string{"name"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			s = newPersistentTestStorage(t, dir, name)
+			//nolint:errcheck
+			defer s.Close()
+
+			want := map[string]string{"age": "31"}
+			if hash, err := s.HGetAll("user"); err != nil || !maps.Equal(hash, want) {
+				t.Errorf("expected %v, got %v, %v", want, hash, err)
+			}
+		})
+	}
+}
+
+func TestStorage_HashKeepsExpiryAcrossRestart(t *testing.T) {
+	dir := t.TempDir()
+	deadline := time.Now().Add(50 * time.Millisecond)
+
+	s := newTestStorage(t, dir)
+	if _, err := s.HSet("user", []string{"name", "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Expire("user", deadline); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.HIncrBy("user", "visits", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(time.Until(deadline))
+
+	s = newTestStorage(t, dir)
+	//nolint:errcheck
+	defer s.Close()
+
+	if hash, err := s.HGetAll("user"); err != nil || len(hash) != 0 {
+		t.Errorf("expected the hash to have expired, got %v, %v", hash, err)
+	}
+}
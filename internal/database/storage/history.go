@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"errors"
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+	"go.uber.org/zap"
+)
+
+const (
+	historyCompactInterval = time.Second
+	// historyCompactBatch is how many keys a compaction step looks at while
+	// holding the engine lock.
+	historyCompactBatch = 256
+)
+
+var (
+	ErrHistoryDisabled     = errors.New("history is disabled")
+	ErrRevisionUnavailable = errors.New("revision is not in the history of the key")
+)
+
+// WithHistory makes the engine keep past values of keys within limits. The
+// history starts when the storage is opened, after the WAL is replayed.
+func WithHistory(limits engine.HistoryLimits) StorageOption {
+	return func(s *Storage) {
+		s.historyLimits = &limits
+	}
+}
+
+// History returns up to limit revisions of key, newest first, or all of them
+// if limit is 0.
+func (s *Storage) History(key string, limit int) ([]engine.Revision, error) {
+	if s.historian == nil {
+		return nil, ErrHistoryDisabled
+	}
+
+	return s.historian.History([]byte(key), limit)
+}
+
+// GetAt returns the string key held at revision: the value of its newest
+// revision up to it. It fails with engine.ErrKeyNotFound if the key was
+// deleted then, and with ErrRevisionUnavailable if the history does not go
+// back that far.
+func (s *Storage) GetAt(key string, revision uint64) (string, error) {
+	revisions, err := s.History(key, 0)
+	if err != nil {
+		return "", err
+	}
+
+	for _, r := range revisions {
+		if r.Revision > revision {
+			continue
+		}
+
+		if r.Deleted {
+			return "", engine.ErrKeyNotFound
+		}
+		if r.Type != engine.TypeString {
+			return "", engine.ErrWrongType
+		}
+
+		return string(r.Value), nil
+	}
+
+	return "", ErrRevisionUnavailable
+}
+
+// historyLoop drops revisions once they are older than the age limit.
+func (s *Storage) historyLoop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(historyCompactInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case now := <-ticker.C:
+			if dropped := s.compactHistory(now); dropped > 0 {
+				s.logger.Debug("compacted history", zap.Int("dropped", dropped))
+			}
+		}
+	}
+}
+
+// compactHistory compacts in batches, letting writers in between them.
+func (s *Storage) compactHistory(now time.Time) int {
+	total := 0
+	for {
+		dropped, more := s.historian.CompactHistory(now, historyCompactBatch)
+		total += dropped
+
+		if !more {
+			return total
+		}
+	}
+}
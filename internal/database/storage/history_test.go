@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+	inmemory "github.com/crunchydeer30/key-value-database/internal/database/storage/engine/in_memory"
+	"go.uber.org/zap"
+)
+
+func TestStorage_History(t *testing.T) {
+	e, err := inmemory.NewInMemoryEngine(zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewStorage(e, zap.NewNop(), WithHistory(engine.HistoryLimits{MaxVersions: 3, MaxAge: 0}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	//nolint:errcheck
+	defer s.Close()
+
+	var revisions []uint64
+	for _, value := range []string{"a", "b", "c", "d"} {
+		if err := s.Set("config", value); err != nil {
+			t.Fatal(err)
+		}
+		version, err := s.Version("config")
+		if err != nil {
+			t.Fatal(err)
+		}
+		revisions = append(revisions, version)
+	}
+	if err := s.Del("config"); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := s.History("config", 0)
+	if err != nil || len(history) != 3 {
+		t.Fatalf("expected 3 revisions, got %v, %v", history, err)
+	}
+
+	if _, err := s.GetAt("config", revisions[0]); !errors.Is(err, ErrRevisionUnavailable) {
+		t.Errorf("expected error %v for a compacted revision, got %v", ErrRevisionUnavailable, err)
+	}
+	if value, err := s.GetAt("config", revisions[2]); err != nil || value != "c" {
+		t.Errorf("expected c, got %q, %v", value, err)
+	}
+	if value, err := s.GetAt("config", revisions[3]); err != nil || value != "d" {
+		t.Errorf("expected d, got %q, %v", value, err)
+	}
+	if _, err := s.GetAt("config", history[0].Revision); !errors.Is(err, engine.ErrKeyNotFound) {
+		t.Errorf("expected error %v after the delete, got %v", engine.ErrKeyNotFound, err)
+	}
+	if _, err := s.GetAt("missing", 1); !errors.Is(err, ErrRevisionUnavailable) {
+		t.Errorf("expected error %v for a key without history, got %v", ErrRevisionUnavailable, err)
+	}
+}
+
+func TestStorage_HistoryDisabled(t *testing.T) {
+	s := newTestStorage(t, t.TempDir())
+	//nolint:errcheck
+	defer s.Close()
+
+	if _, err := s.History("config", 0); !errors.Is(err, ErrHistoryDisabled) {
+		t.Errorf("expected error %v, got %v", ErrHistoryDisabled, err)
+	}
+}
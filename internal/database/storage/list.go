@@ -0,0 +1,375 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+)
+
+var ErrCorruptedList = errors.New("corrupted list value")
+
+// A list is encoded as every element as its length (uvarint) followed by its
+// bytes, head first. Engines that keep their data in memory hold it as a list
+// object instead, which pushes and pops change in place. Lists never stay
+// empty: removing the last element deletes the key. Writes to a list are
+// logged as the list they leave, as pushes and pops can not be replayed on
+// top of their own result.
+
+// LPush inserts values at the head of the list at key, one after the other,
+// and returns the new length of the list.
+func (s *Storage) LPush(key string, values []string, opts ...WriteOption) (int, error) {
+	var length int
+	err := s.updateRecorded(opts, key, listPush(true, values, &length), entryRecord)
+
+	return length, err
+}
+
+// RPush is LPush for the tail of the list.
+func (s *Storage) RPush(key string, values []string, opts ...WriteOption) (int, error) {
+	var length int
+	err := s.updateRecorded(opts, key, listPush(false, values, &length), entryRecord)
+
+	return length, err
+}
+
+// LPop removes and returns up to count elements from the head of the list at
+// key. It fails with engine.ErrKeyNotFound if there is no list.
+func (s *Storage) LPop(key string, count int, opts ...WriteOption) ([]string, error) {
+	var popped []string
+	err := s.updateRecorded(opts, key, listPop(true, count, &popped), entryRecord)
+
+	return popped, err
+}
+
+// RPop is LPop for the tail of the list.
+func (s *Storage) RPop(key string, count int, opts ...WriteOption) ([]string, error) {
+	var popped []string
+	err := s.updateRecorded(opts, key, listPop(false, count, &popped), entryRecord)
+
+	return popped, err
+}
+
+// LTrim keeps only the elements of the list at key between start and stop,
+// both inclusive. Negative indexes count from the tail.
+func (s *Storage) LTrim(key string, start, stop int, opts ...WriteOption) error {
+	return s.updateRecorded(opts, key, listTrim(start, stop), entryRecord)
+}
+
+// LRange returns the elements of the list at key between start and stop, both
+// inclusive. Negative indexes count from the tail.
+func (s *Storage) LRange(key string, start, stop int) ([]string, error) {
+	var elements []string
+	err := s.viewList(key, func(l *list) {
+		if from, to, ok := listBounds(start, stop, l.len); ok {
+			elements = l.slice(from, to+1)
+		}
+	})
+
+	return elements, err
+}
+
+func (s *Storage) LLen(key string) (int, error) {
+	var length int
+	err := s.viewList(key, func(l *list) {
+		length = l.len
+	})
+
+	return length, err
+}
+
+// LIndex returns the element at index of the list at key, failing with
+// engine.ErrKeyNotFound if there is none.
+func (s *Storage) LIndex(key string, index int) (string, error) {
+	var element string
+	found := false
+	err := s.viewList(key, func(l *list) {
+		if index < 0 {
+			index += l.len
+		}
+		if index >= 0 && index < l.len {
+			element, found = l.at(index), true
+		}
+	})
+	if err == nil && !found {
+		err = engine.ErrKeyNotFound
+	}
+
+	return element, err
+}
+
+// viewList calls fn with the list at key, which is empty if the key is
+// missing. fn must not change the list.
+func (s *Storage) viewList(key string, fn func(l *list)) error {
+	return engine.View(s.engine, []byte(key), func(entry engine.Entry, found bool) error {
+		l, err := currentList(entry, found)
+		if err != nil {
+			return err
+		}
+
+		fn(l)
+		return nil
+	})
+}
+
+// EncodeList encodes elements the way lists are stored.
+func EncodeList(elements []string) []byte {
+	size := 0
+	for _, element := range elements {
+		size += encodedLen(element)
+	}
+
+	buf := make([]byte, 0, size)
+	for _, element := range elements {
+		buf = appendElement(buf, element)
+	}
+
+	return buf
+}
+
+// DecodeList decodes elements encoded by EncodeList.
+func DecodeList(value string) ([]string, error) {
+	return decodeList([]byte(value))
+}
+
+func decodeList(value []byte) ([]string, error) {
+	var elements []string
+	for len(value) > 0 {
+		length, n := binary.Uvarint(value)
+		if n <= 0 || length > uint64(len(value)-n) {
+			return nil, fmt.Errorf("%w: invalid element length", ErrCorruptedList)
+		}
+		value = value[n:]
+
+		elements = append(elements, string(value[:length]))
+		value = value[length:]
+	}
+
+	return elements, nil
+}
+
+func appendElement(buf []byte, element string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(element)))
+	return append(buf, element...)
+}
+
+// encodedLen is the number of bytes EncodeList takes for element.
+func encodedLen(element string) int {
+	return (bits.Len64(uint64(len(element))|1)+6)/7 + len(element)
+}
+
+// list is the object lists are kept as: a ring buffer of elements, so that
+// pushing and popping at either end take O(1).
+type list struct {
+	elements []string
+	head     int
+	len      int
+	size     int
+}
+
+func newList() *list {
+	return &list{elements: nil, head: 0, len: 0, size: 0}
+}
+
+func decodeListObject(value []byte) (*list, error) {
+	elements, err := decodeList(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return &list{elements: elements, head: 0, len: len(elements), size: len(value)}, nil
+}
+
+func (l *list) Encode() []byte {
+	buf := make([]byte, 0, l.size)
+	for i := range l.len {
+		buf = appendElement(buf, l.at(i))
+	}
+
+	return buf
+}
+
+func (l *list) Size() int {
+	return l.size
+}
+
+// at returns the element at index, which must be in range.
+func (l *list) at(index int) string {
+	return l.elements[(l.head+index)%len(l.elements)]
+}
+
+// slice returns a copy of the elements in [from, to).
+func (l *list) slice(from, to int) []string {
+	elements := make([]string, 0, to-from)
+	for i := from; i < to; i++ {
+		elements = append(elements, l.at(i))
+	}
+
+	return elements
+}
+
+func (l *list) pushHead(element string) {
+	l.grow()
+	l.head = (l.head + len(l.elements) - 1) % len(l.elements)
+	l.elements[l.head] = element
+	l.len++
+	l.size += encodedLen(element)
+}
+
+func (l *list) pushTail(element string) {
+	l.grow()
+	l.elements[(l.head+l.len)%len(l.elements)] = element
+	l.len++
+	l.size += encodedLen(element)
+}
+
+func (l *list) popHead() string {
+	element := l.elements[l.head]
+	l.elements[l.head] = ""
+	l.head = (l.head + 1) % len(l.elements)
+	l.len--
+	l.size -= encodedLen(element)
+
+	return element
+}
+
+func (l *list) popTail() string {
+	i := (l.head + l.len - 1) % len(l.elements)
+	element := l.elements[i]
+	l.elements[i] = ""
+	l.len--
+	l.size -= encodedLen(element)
+
+	return element
+}
+
+// trim keeps the elements in [from, to).
+func (l *list) trim(from, to int) {
+	elements := l.slice(from, to)
+
+	l.elements, l.head, l.len, l.size = elements, 0, len(elements), 0
+	for _, element := range elements {
+		l.size += encodedLen(element)
+	}
+}
+
+// grow makes room for one more element, doubling the buffer once it is full.
+func (l *list) grow() {
+	if l.len < len(l.elements) {
+		return
+	}
+
+	elements := make([]string, max(2*len(l.elements), 4))
+	for i := range l.len {
+		elements[i] = l.at(i)
+	}
+	l.elements, l.head = elements, 0
+}
+
+// listBounds resolves start and stop against a list of n elements into
+// indexes that can be sliced, reporting false if the range is empty.
+func listBounds(start, stop, n int) (int, int, bool) {
+	if start < 0 {
+		start = max(start+n, 0)
+	}
+	if stop < 0 {
+		stop += n
+	}
+	stop = min(stop, n-1)
+
+	if start > stop {
+		return 0, 0, false
+	}
+
+	return start, stop, true
+}
+
+// currentList returns the list of an entry passed to an UpdateFunc or a
+// view: the object the engine holds, or one decoded from its value. A missing
+// key holds an empty list.
+func currentList(current engine.Entry, found bool) (*list, error) {
+	if !found {
+		return newList(), nil
+	}
+
+	if current.Type != engine.TypeList {
+		return nil, engine.ErrWrongType
+	}
+
+	if l, ok := current.Object.(*list); ok {
+		return l, nil
+	}
+
+	return decodeListObject(current.Value)
+}
+
+// listEntry returns current holding l in place of its value.
+func listEntry(current engine.Entry, l *list) engine.Entry {
+	current.Value, current.Object, current.Type = nil, l, engine.TypeList
+	return current
+}
+
+func listPush(head bool, values []string, length *int) engine.UpdateFunc {
+	return func(current engine.Entry, found bool) (engine.Entry, bool, error) {
+		l, err := currentList(current, found)
+		if err != nil {
+			return engine.Entry{}, false, err
+		}
+
+		for _, value := range values {
+			if head {
+				l.pushHead(value)
+			} else {
+				l.pushTail(value)
+			}
+		}
+
+		*length = l.len
+
+		return listEntry(current, l), true, nil
+	}
+}
+
+func listPop(head bool, count int, popped *[]string) engine.UpdateFunc {
+	return func(current engine.Entry, found bool) (engine.Entry, bool, error) {
+		if !found {
+			return engine.Entry{}, false, engine.ErrKeyNotFound
+		}
+
+		l, err := currentList(current, found)
+		if err != nil {
+			return engine.Entry{}, false, err
+		}
+
+		*popped = make([]string, 0, min(count, l.len))
+		for l.len > 0 && len(*popped) < count {
+			if head {
+				*popped = append(*popped, l.popHead())
+			} else {
+				*popped = append(*popped, l.popTail())
+			}
+		}
+
+		return listEntry(current, l), l.len > 0, nil
+	}
+}
+
+func listTrim(start, stop int) engine.UpdateFunc {
+	return func(current engine.Entry, found bool) (engine.Entry, bool, error) {
+		l, err := currentList(current, found)
+		if err != nil || !found {
+			return engine.Entry{}, false, err
+		}
+
+		from, to, ok := listBounds(start, stop, l.len)
+		if !ok {
+			return current, false, nil
+		}
+
+		l.trim(from, to+1)
+
+		return listEntry(current, l), true, nil
+	}
+}
@@ -0,0 +1,195 @@
+package storage
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine/btree"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine/lsm"
+)
+
+func TestStorage_Lists(t *testing.T) {
+	dir := t.TempDir()
+
+	s := newTestStorage(t, dir)
+	if n, err := s.RPush("queue", []string{"b", "c"}); err != nil || n != 2 {
+		t.Fatalf("expected 2, got %d, %v", n, err)
+	}
+	if n, err := s.LPush("queue", []string{"a", "z"}); err != nil || n != 4 {
+		t.Fatalf("expected 4, got %d, %v", n, err)
+	}
+	if popped, err := s.LPop("queue", 1); err != nil || !slices.Equal(popped, []string{"z"}) {
+		t.Fatalf("expected [z], got %v, %v", popped, err)
+	}
+	if _, err := s.RPush("temp", []string{"x"}); err != nil {
+		t.Fatal(err)
+	}
+	if popped, err := s.RPop("temp", 5); err != nil || !slices.Equal(popped, []string{"x"}) {
+		t.Fatalf("expected [x], got %v, %v", popped, err)
+	}
+	if err := s.Set("name", "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	lastLSN := s.LastLSN()
+	if _, err := s.LPush("name", []string{"a"}); !errors.Is(err, engine.ErrWrongType) {
+		t.Errorf("expected error %v, got %v", engine.ErrWrongType, err)
+	}
+	if _, err := s.LPop("missing", 1); !errors.Is(err, engine.ErrKeyNotFound) {
+		t.Errorf("expected error %v, got %v", engine.ErrKeyNotFound, err)
+	}
+	if _, err := s.IncrBy("queue", 1); !errors.Is(err, engine.ErrWrongType) {
+		t.Errorf("expected error %v, got %v", engine.ErrWrongType, err)
+	}
+	if s.LastLSN() != lastLSN {
+		t.Errorf("expected failed list writes not to be logged")
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s = newTestStorage(t, dir)
+	//nolint:errcheck
+	defer s.Close()
+
+	if list, err := s.LRange("queue", 0, -1); err != nil || !slices.Equal(list, []string{"a", "b", "c"}) {
+		t.Errorf("expected [a b c], got %v, %v", list, err)
+	}
+	if _, err := s.Get("temp"); !errors.Is(err, engine.ErrKeyNotFound) {
+		t.Errorf("expected emptied list to be deleted, got %v", err)
+	}
+	if _, err := s.Get("queue"); !errors.Is(err, engine.ErrWrongType) {
+		t.Errorf("expected error %v, got %v", engine.ErrWrongType, err)
+	}
+	if _, err := s.LLen("name"); !errors.Is(err, engine.ErrWrongType) {
+		t.Errorf("expected error %v, got %v", engine.ErrWrongType, err)
+	}
+}
+
+func TestStorage_ListsOnPersistentEngines(t *testing.T) {
+	for _, name := range []string{lsm.Name, btree.Name} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			s := newPersistentTestStorage(t, dir, name)
+			if _, err := s.RPush("queue", []string{"a", "b"}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.LPush("queue", []string{"z"}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.RPop("queue", 1); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			s = newPersistentTestStorage(t, dir, name)
+			//nolint:errcheck
+			defer s.Close()
+
+			if list, err := s.LRange("queue", 0, -1); err != nil || !slices.Equal(list, []string{"z", "a"}) {
+				t.Errorf("expected [z a], got %v, %v", list, err)
+			}
+		})
+	}
+}
+
+func TestStorage_ListKeepsExpiryAcrossRestart(t *testing.T) {
+	dir := t.TempDir()
+	deadline := time.Now().Add(50 * time.Millisecond)
+
+	s := newTestStorage(t, dir)
+	if _, err := s.RPush("queue", []string{"a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Expire("queue", deadline); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.RPush("queue", []string{"b"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(time.Until(deadline))
+
+	s = newTestStorage(t, dir)
+	//nolint:errcheck
+	defer s.Close()
+
+	if list, err := s.LRange("queue", 0, -1); err != nil || len(list) != 0 {
+		t.Errorf("expected the list to have expired, got %v, %v", list, err)
+	}
+}
+
+func TestList_WrapsAround(t *testing.T) {
+	l := newList()
+	want := []string{}
+	for i := range 10 {
+		element := strconv.Itoa(i)
+		if i%2 == 0 {
+			l.pushHead(element)
+			want = append([]string{element}, want...)
+		} else {
+			l.pushTail(element)
+			want = append(want, element)
+		}
+
+		if i%3 == 0 {
+			if got := l.popTail(); got != want[len(want)-1] {
+				t.Fatalf("expected %s popped, got %s", want[len(want)-1], got)
+			}
+			want = want[:len(want)-1]
+		}
+	}
+
+	if got := l.slice(0, l.len); !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if encoded := l.Encode(); len(encoded) != l.Size() || !slices.Equal(mustDecodeList(t, encoded), want) {
+		t.Errorf("expected %v encoded in %d bytes, got %q", want, l.Size(), encoded)
+	}
+}
+
+func mustDecodeList(t *testing.T, value []byte) []string {
+	t.Helper()
+
+	elements, err := decodeList(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return elements
+}
+
+func TestListBounds(t *testing.T) {
+	tests := []struct {
+		start, stop, n int
+		from, to       int
+		ok             bool
+	}{
+		{0, -1, 3, 0, 2, true},
+		{-2, -1, 3, 1, 2, true},
+		{-10, 10, 3, 0, 2, true},
+		{1, 1, 3, 1, 1, true},
+		{2, 1, 3, 0, 0, false},
+		{3, 5, 3, 0, 0, false},
+		{0, -4, 3, 0, 0, false},
+		{0, -1, 0, 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		from, to, ok := listBounds(tt.start, tt.stop, tt.n)
+		if ok != tt.ok || ok && (from != tt.from || to != tt.to) {
+			t.Errorf("listBounds(%d, %d, %d) = %d, %d, %v, expected %d, %d, %v",
+				tt.start, tt.stop, tt.n, from, to, ok, tt.from, tt.to, tt.ok)
+		}
+	}
+}
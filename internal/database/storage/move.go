@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/wal"
+)
+
+var ErrFlushUnsupported = errors.New("engine does not support flushing")
+
+var (
+	errKeyExists    = errors.New("key exists")
+	errEntryChanged = errors.New("entry changed")
+)
+
+// Entry returns the whole entry of key: its value, type and deadline.
+func (s *Storage) Entry(key string) (engine.Entry, error) {
+	return s.engine.GetEntry([]byte(key))
+}
+
+// Insert stores entry as is, type and deadline included, unless its key
+// exists. It reports whether the entry was stored.
+func (s *Storage) Insert(entry engine.Entry, opts ...WriteOption) (bool, error) {
+	err := s.update(opts, string(entry.Key), insert(entry), wal.OperationInsert, entryArgs(string(entry.Key), entry)...)
+	if errors.Is(err, errKeyExists) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// Remove deletes the key of entry if it still holds the same value and type,
+// and reports whether it did.
+func (s *Storage) Remove(entry engine.Entry, opts ...WriteOption) (bool, error) {
+	err := s.update(opts, string(entry.Key), remove(entry), wal.OperationDel, string(entry.Key))
+	if errors.Is(err, errEntryChanged) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// Flush deletes every key.
+func (s *Storage) Flush(opts ...WriteOption) error {
+	clearer, ok := s.engine.(engine.Clearer)
+	if !ok {
+		return ErrFlushUnsupported
+	}
+
+	return s.write(opts, nil, clearer.Clear, wal.OperationFlush)
+}
+
+func insert(entry engine.Entry) engine.UpdateFunc {
+	return func(_ engine.Entry, found bool) (engine.Entry, bool, error) {
+		if found {
+			return engine.Entry{}, false, errKeyExists
+		}
+
+		return entry, true, nil
+	}
+}
+
+func remove(entry engine.Entry) engine.UpdateFunc {
+	return func(current engine.Entry, found bool) (engine.Entry, bool, error) {
+		if !found || current.Type != entry.Type || !bytes.Equal(current.Encoded().Value, entry.Value) {
+			return engine.Entry{}, false, errEntryChanged
+		}
+
+		return current, false, nil
+	}
+}
+
+// entryRecord records the entry of a key as the value it was set to, with its
+// type and deadline.
+func entryRecord(key string, updated engine.Entry, keep bool) (wal.Operation, []string) {
+	if !keep {
+		return wal.OperationDel, []string{key}
+	}
+
+	return wal.OperationPut, entryArgs(key, updated)
+}
+
+// entryArgs encodes an entry as the arguments of OperationInsert and
+// OperationPut records.
+func entryArgs(key string, entry engine.Entry) []string {
+	args := []string{key, string(entry.Encoded().Value), strconv.Itoa(int(entry.Type))}
+	if !entry.Deadline.IsZero() {
+		args = append(args, wal.FormatDeadline(entry.Deadline))
+	}
+
+	return args
+}
+
+// recordedEntry decodes the arguments of OperationInsert and OperationPut
+// records.
+func recordedEntry(args []string) (engine.Entry, error) {
+	typ, err := strconv.ParseUint(args[2], 10, 8)
+	if err != nil {
+		return engine.Entry{}, fmt.Errorf("%w: invalid type %q", ErrInvalidOperation, args[2])
+	}
+
+	entry := engine.Entry{Key: []byte(args[0]), Value: []byte(args[1]), Object: nil, Type: engine.ValueType(typ), Deadline: time.Time{}}
+	if len(args) == 4 {
+		entry.Deadline, err = wal.ParseDeadline(args[3])
+	}
+
+	return entry, err
+}
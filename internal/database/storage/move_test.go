@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+)
+
+func TestStorage_InsertRemoveFlush(t *testing.T) {
+	srcDir, dstDir := t.TempDir(), t.TempDir()
+	deadline := time.Now().Add(time.Hour)
+
+	src := newTestStorage(t, srcDir)
+	dst := newTestStorage(t, dstDir)
+	if _, err := src.RPush("queue", []string{"a", "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.SetWithDeadline("session", "token", deadline); err != nil {
+		t.Fatal(err)
+	}
+	if err := dst.Set("taken", "x"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"queue", "session"} {
+		entry, err := src.Entry(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok, err := dst.Insert(entry); err != nil || !ok {
+			t.Fatalf("expected %s to be inserted, got %v, %v", key, ok, err)
+		}
+		if ok, err := src.Remove(entry); err != nil || !ok {
+			t.Fatalf("expected %s to be removed, got %v, %v", key, ok, err)
+		}
+	}
+
+	if ok, err := dst.Insert(engine.Entry{Key: []byte("taken"), Value: []byte("y"), Type: engine.TypeString, Deadline: time.Time{}}); err != nil || ok {
+		t.Errorf("expected an existing key to be kept, got %v, %v", ok, err)
+	}
+	if ok, err := dst.Remove(engine.Entry{Key: []byte("taken"), Value: []byte("y"), Type: engine.TypeString, Deadline: time.Time{}}); err != nil || ok {
+		t.Errorf("expected a changed key to be kept, got %v, %v", ok, err)
+	}
+	if err := src.Set("left", "behind"); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.Set("after", "flush"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := errors.Join(src.Close(), dst.Close()); err != nil {
+		t.Fatal(err)
+	}
+
+	src = newTestStorage(t, srcDir)
+	dst = newTestStorage(t, dstDir)
+	//nolint:errcheck
+	defer src.Close()
+	//nolint:errcheck
+	defer dst.Close()
+
+	if list, err := dst.LRange("queue", 0, -1); err != nil || !slices.Equal(list, []string{"a", "b"}) {
+		t.Errorf("expected [a b], got %v, %v", list, err)
+	}
+	if got, err := dst.Deadline("session"); err != nil || !got.Equal(deadline) {
+		t.Errorf("expected deadline %v, got %v, %v", deadline, got, err)
+	}
+	if value, err := dst.Get("taken"); err != nil || value != "x" {
+		t.Errorf("expected x, got %q, %v", value, err)
+	}
+	for _, key := range []string{"queue", "session", "left"} {
+		if _, err := src.Get(key); !errors.Is(err, engine.ErrKeyNotFound) {
+			t.Errorf("expected %s to be gone, got %v", key, err)
+		}
+	}
+	if value, err := src.Get("after"); err != nil || value != "flush" {
+		t.Errorf("expected flush, got %q, %v", value, err)
+	}
+}
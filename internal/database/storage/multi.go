@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"errors"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/wal"
+)
+
+// MSet sets every key of pairs, given as key, value, key, value..., to its
+// value. The keys are logged as one record and set under the batch lock, so
+// that MGet sees either all of them or none.
+func (s *Storage) MSet(pairs []string, opts ...WriteOption) error {
+	return s.write(opts, func() error {
+		return s.makeRoomFor(pairs)
+	}, func() error {
+		s.batchMtx.Lock()
+		defer s.batchMtx.Unlock()
+
+		return mset(s.engine, pairs)
+	}, wal.OperationMSet, pairs...)
+}
+
+// MSetNX sets the keys of pairs like MSet, unless any of them exists. It
+// reports whether the keys were set.
+func (s *Storage) MSetNX(pairs []string, opts ...WriteOption) (bool, error) {
+	err := s.write(opts, func() error {
+		if err := noneExist(s.engine, pairs); err != nil {
+			return err
+		}
+		return s.makeRoomFor(pairs)
+	}, func() error {
+		s.batchMtx.Lock()
+		defer s.batchMtx.Unlock()
+
+		return msetNX(s.engine, pairs)
+	}, wal.OperationMSetNX, pairs...)
+	if errors.Is(err, errKeyExists) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// DelKeys deletes keys and returns how many of them existed. A key given
+// twice is counted once.
+func (s *Storage) DelKeys(keys []string, opts ...WriteOption) (int, error) {
+	var deleted int
+	err := s.write(opts, nil, func() error {
+		var err error
+		deleted, err = delKeys(s.engine, keys)
+		return err
+	}, wal.OperationDelKeys, keys...)
+
+	return deleted, err
+}
+
+// MGet returns the value of every key, with found false for the keys that
+// are missing or do not hold a string. The keys are read under the batch
+// lock, so a multi-key write is seen either whole or not at all.
+func (s *Storage) MGet(keys []string) (values []string, found []bool, err error) {
+	s.batchMtx.RLock()
+	defer s.batchMtx.RUnlock()
+
+	values = make([]string, len(keys))
+	found = make([]bool, len(keys))
+	for i, key := range keys {
+		value, err := s.engine.Get([]byte(key))
+		if errors.Is(err, engine.ErrKeyNotFound) || errors.Is(err, engine.ErrWrongType) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		values[i], found[i] = string(value), true
+	}
+
+	return values, found, nil
+}
+
+// Exists returns how many of keys exist. A key given twice is counted twice.
+func (s *Storage) Exists(keys []string) (int, error) {
+	s.batchMtx.RLock()
+	defer s.batchMtx.RUnlock()
+
+	var count int
+	for _, key := range keys {
+		_, err := s.engine.GetEntry([]byte(key))
+		if errors.Is(err, engine.ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+func mset(e engine.Engine, pairs []string) error {
+	for i := 0; i < len(pairs); i += 2 {
+		if err := e.Set([]byte(pairs[i]), []byte(pairs[i+1])); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func msetNX(e engine.Engine, pairs []string) error {
+	if err := noneExist(e, pairs); err != nil {
+		return err
+	}
+
+	return mset(e, pairs)
+}
+
+// noneExist returns errKeyExists if any key of pairs exists.
+func noneExist(e engine.Engine, pairs []string) error {
+	for i := 0; i < len(pairs); i += 2 {
+		_, err := e.GetEntry([]byte(pairs[i]))
+		if err == nil {
+			return errKeyExists
+		}
+		if !errors.Is(err, engine.ErrKeyNotFound) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func delKeys(e engine.Engine, keys []string) (int, error) {
+	var deleted int
+	for _, key := range keys {
+		err := e.Update([]byte(key), func(current engine.Entry, found bool) (engine.Entry, bool, error) {
+			if found {
+				deleted++
+			}
+			return current, false, nil
+		})
+		if err != nil {
+			return deleted, err
+		}
+	}
+
+	return deleted, nil
+}
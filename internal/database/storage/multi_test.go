@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/wal"
+)
+
+func TestStorage_MultiKey(t *testing.T) {
+	dir := t.TempDir()
+
+	s := newTestStorage(t, dir)
+	if err := s.MSet([]string{"a", "1", "b", "2"}); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := s.MSetNX([]string{"c", "3", "a", "9"}); err != nil || ok {
+		t.Errorf("expected an existing key to stop MSETNX, got %v, %v", ok, err)
+	}
+	if ok, err := s.MSetNX([]string{"c", "3", "d", "4"}); err != nil || !ok {
+		t.Errorf("expected MSETNX of new keys to set them, got %v, %v", ok, err)
+	}
+	if n, err := s.Exists([]string{"a", "a", "missing", "d"}); err != nil || n != 3 {
+		t.Errorf("expected 3 existing keys, got %d, %v", n, err)
+	}
+	if n, err := s.DelKeys([]string{"b", "b", "missing", "d"}); err != nil || n != 2 {
+		t.Errorf("expected 2 deleted keys, got %d, %v", n, err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s = newTestStorage(t, dir)
+	//nolint:errcheck
+	defer s.Close()
+
+	for key, want := range map[string]string{"a": "1", "c": "3"} {
+		if value, err := s.Get(key); err != nil || value != want {
+			t.Errorf("%s: expected %q, got %q, %v", key, want, value, err)
+		}
+	}
+	for _, key := range []string{"b", "d"} {
+		if _, err := s.Get(key); !errors.Is(err, engine.ErrKeyNotFound) {
+			t.Errorf("%s: expected error %v, got %v", key, engine.ErrKeyNotFound, err)
+		}
+	}
+}
+
+func TestStorage_ReplicatedMSetIsAtomicForMGet(t *testing.T) {
+	s := newTestStorage(t, t.TempDir())
+	//nolint:errcheck
+	defer s.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		for lsn := uint64(1); lsn <= 200; lsn++ {
+			value := strconv.FormatUint(lsn, 10)
+			record := wal.Record{LSN: lsn, Operation: wal.OperationMSet, Args: []string{"a", value, "b", value}}
+			if err := s.ApplyRecords([]wal.Record{record}); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+			return
+		default:
+		}
+
+		values, found, err := s.MGet([]string{"a", "b"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found[0] != found[1] || values[0] != values[1] {
+			t.Fatalf("expected both keys from the same MSET, got %q (%v) and %q (%v)", values[0], found[0], values[1], found[1])
+		}
+	}
+}
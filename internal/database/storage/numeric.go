@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"errors"
+	"math"
+	"strconv"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+)
+
+var (
+	ErrNotInteger = errors.New("value is not an integer or out of range")
+	ErrNotFloat   = errors.New("value is not a valid float")
+	ErrOverflow   = errors.New("increment or decrement would overflow")
+)
+
+// IncrBy adds delta to the integer stored at key, which counts as 0 if it is
+// missing, and returns the result. The key keeps its deadline. The WAL records
+// the result, so that replaying it neither adds the delta twice nor depends on
+// what expired since.
+func (s *Storage) IncrBy(key string, delta int64, opts ...WriteOption) (int64, error) {
+	var result int64
+	err := s.updateRecorded(opts, key, incrBy(delta, &result), stringRecord)
+
+	return result, err
+}
+
+// IncrByFloat is IncrBy for floating point numbers.
+func (s *Storage) IncrByFloat(key string, delta float64, opts ...WriteOption) (float64, error) {
+	var result float64
+	err := s.updateRecorded(opts, key, incrByFloat(delta, &result), stringRecord)
+
+	return result, err
+}
+
+// FormatFloat formats a number the way IncrByFloat stores it: as the shortest
+// decimal that parses back to it, without an exponent.
+func FormatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func incrBy(delta int64, result *int64) engine.UpdateFunc {
+	return func(current engine.Entry, found bool) (engine.Entry, bool, error) {
+		if found && current.Type != engine.TypeString {
+			return engine.Entry{}, false, engine.ErrWrongType
+		}
+
+		n, err := addInt(string(current.Value), found, delta)
+		if err != nil {
+			return engine.Entry{}, false, err
+		}
+
+		*result = n
+		current.Value = []byte(strconv.FormatInt(n, 10))
+
+		return current, true, nil
+	}
+}
+
+// addInt adds delta to the integer in value, which counts as 0 if it is not
+// set.
+func addInt(value string, set bool, delta int64) (int64, error) {
+	var n int64
+	if set {
+		var err error
+		if n, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return 0, ErrNotInteger
+		}
+	}
+
+	if delta > 0 && n > math.MaxInt64-delta || delta < 0 && n < math.MinInt64-delta {
+		return 0, ErrOverflow
+	}
+
+	return n + delta, nil
+}
+
+func incrByFloat(delta float64, result *float64) engine.UpdateFunc {
+	return func(current engine.Entry, found bool) (engine.Entry, bool, error) {
+		if found && current.Type != engine.TypeString {
+			return engine.Entry{}, false, engine.ErrWrongType
+		}
+
+		var f float64
+		if found {
+			var err error
+			if f, err = strconv.ParseFloat(string(current.Value), 64); err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+				return engine.Entry{}, false, ErrNotFloat
+			}
+		}
+
+		f += delta
+		if math.IsInf(f, 0) || math.IsNaN(f) {
+			return engine.Entry{}, false, ErrOverflow
+		}
+
+		*result = f
+		current.Value = []byte(FormatFloat(f))
+
+		return current, true, nil
+	}
+}
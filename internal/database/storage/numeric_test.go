@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine/btree"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine/lsm"
+)
+
+func TestStorage_IncrBy(t *testing.T) {
+	dir := t.TempDir()
+	deadline := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	s := newTestStorage(t, dir)
+	if n, err := s.IncrBy("counter", 5); err != nil || n != 5 {
+		t.Fatalf("expected 5, got %d, %v", n, err)
+	}
+	if n, err := s.IncrBy("counter", -7); err != nil || n != -2 {
+		t.Fatalf("expected -2, got %d, %v", n, err)
+	}
+	if err := s.SetWithDeadline("session", "41", deadline); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := s.IncrBy("session", 1); err != nil || n != 42 {
+		t.Fatalf("expected 42, got %d, %v", n, err)
+	}
+	if f, err := s.IncrByFloat("price", 0.25); err != nil || f != 0.25 {
+		t.Fatalf("expected 0.25, got %v, %v", f, err)
+	}
+
+	lastLSN := s.LastLSN()
+	if err := s.Set("name", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.IncrBy("name", 1); !errors.Is(err, ErrNotInteger) {
+		t.Errorf("expected error %v, got %v", ErrNotInteger, err)
+	}
+	if _, err := s.IncrByFloat("name", 1); !errors.Is(err, ErrNotFloat) {
+		t.Errorf("expected error %v, got %v", ErrNotFloat, err)
+	}
+	if _, err := s.IncrBy("counter", math.MinInt64); !errors.Is(err, ErrOverflow) {
+		t.Errorf("expected error %v, got %v", ErrOverflow, err)
+	}
+	if s.LastLSN() != lastLSN+1 {
+		t.Errorf("expected failed increments not to be logged")
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s = newTestStorage(t, dir)
+	//nolint:errcheck
+	defer s.Close()
+
+	for key, want := range map[string]string{"counter": "-2", "session": "42", "price": "0.25", "name": "alice"} {
+		if got, err := s.Get(key); err != nil || got != want {
+			t.Errorf("key %q: expected %q, got %q, %v", key, want, got, err)
+		}
+	}
+
+	if got, err := s.Deadline("session"); err != nil || !got.Equal(deadline) {
+		t.Errorf("expected deadline %v to be kept, got %v, %v", deadline, got, err)
+	}
+}
+
+func TestStorage_IncrByOnPersistentEngines(t *testing.T) {
+	for _, name := range []string{lsm.Name, btree.Name} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			s := newPersistentTestStorage(t, dir, name)
+			for range 2 {
+				if _, err := s.IncrBy("counter", 1); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := s.IncrByFloat("price", 0.5); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			s = newPersistentTestStorage(t, dir, name)
+			//nolint:errcheck
+			defer s.Close()
+
+			for key, want := range map[string]string{"counter": "2", "price": "0.5"} {
+				if got, err := s.Get(key); err != nil || got != want {
+					t.Errorf("key %q: expected %q, got %q, %v", key, want, got, err)
+				}
+			}
+		})
+	}
+}
+
+func TestStorage_IncrByKeepsExpiryAcrossRestart(t *testing.T) {
+	dir := t.TempDir()
+	deadline := time.Now().Add(50 * time.Millisecond)
+
+	s := newTestStorage(t, dir)
+	if err := s.SetWithDeadline("counter", "0", deadline); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := s.IncrBy("counter", 1); err != nil || n != 1 {
+		t.Fatalf("expected 1, got %d, %v", n, err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(time.Until(deadline))
+
+	s = newTestStorage(t, dir)
+	//nolint:errcheck
+	defer s.Close()
+
+	if got, err := s.Get("counter"); !errors.Is(err, engine.ErrKeyNotFound) {
+		t.Errorf("expected error %v, got %q, %v", engine.ErrKeyNotFound, got, err)
+	}
+}
@@ -0,0 +1,24 @@
+package storage
+
+import "github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+
+// Range returns up to limit entries with keys in [start, end), in ascending
+// or descending order. A limit of 0 means no limit, and an empty end means no
+// upper bound.
+func (s *Storage) Range(start, end string, reverse bool, limit int) ([]engine.Entry, error) {
+	ranger, ok := s.engine.(engine.Ranger)
+	if !ok {
+		return nil, engine.ErrRangeUnsupported
+	}
+
+	var entries []engine.Entry
+	err := ranger.Range([]byte(start), []byte(end), reverse, func(entry engine.Entry) bool {
+		entries = append(entries, entry)
+		return limit == 0 || len(entries) < limit
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"encoding/hex"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+)
+
+// Scan returns about count keys from cursor on and the cursor of the next
+// batch, which is empty once the scan is complete. Engines that keep their
+// keys in order are scanned by range, with the hex-encoded key to resume from
+// as the cursor.
+func (s *Storage) Scan(cursor string, count int) ([]string, string, error) {
+	if scanner, ok := s.engine.(engine.Scanner); ok {
+		keys, next, err := scanner.Scan(cursor, count)
+		if err != nil {
+			return nil, "", err
+		}
+
+		return toStrings(keys), next, nil
+	}
+
+	ranger, ok := s.engine.(engine.Ranger)
+	if !ok {
+		return nil, "", engine.ErrScanUnsupported
+	}
+
+	start, err := hex.DecodeString(cursor)
+	if err != nil {
+		return nil, "", engine.ErrInvalidCursor
+	}
+
+	keys := make([]string, 0, count)
+	err = ranger.Range(start, nil, false, func(entry engine.Entry) bool {
+		keys = append(keys, string(entry.Key))
+		return len(keys) <= count
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	// The key past the batch, if any, is where the next one starts.
+	if len(keys) <= count {
+		return keys, "", nil
+	}
+
+	return keys[:count], hex.EncodeToString([]byte(keys[count])), nil
+}
+
+func toStrings(keys [][]byte) []string {
+	strs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		strs = append(strs, string(key))
+	}
+
+	return strs
+}
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine/ordered"
+	"go.uber.org/zap"
+)
+
+func TestStorage_ScanOrderedEngine(t *testing.T) {
+	e, err := ordered.NewOrderedEngine(zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewStorage(e, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want []string
+	for i := range 25 {
+		key := "key" + strconv.Itoa(i)
+		want = append(want, key)
+		if err := s.Set(key, "value"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	slices.Sort(want)
+
+	var got []string
+	cursor := ""
+	for {
+		keys, next, err := s.Scan(cursor, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, keys...)
+
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	if !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	if _, _, err := s.Scan("zz", 10); !errors.Is(err, engine.ErrInvalidCursor) {
+		t.Errorf("expected error %v, got %v", engine.ErrInvalidCursor, err)
+	}
+}
@@ -0,0 +1,229 @@
+package storage
+
+import (
+	"maps"
+	"slices"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/wal"
+)
+
+// A set is encoded as its members in order, encoded like a list. Engines
+// that keep their data in memory hold it as a set object instead, which
+// writes change in place. Like lists, sets never stay empty. Writes to a set
+// are logged as the members they add or remove and the deadline of the set.
+
+// SAdd adds members to the set at key and returns how many of them are new.
+func (s *Storage) SAdd(key string, members []string, opts ...WriteOption) (int, error) {
+	var added int
+	err := s.updateRecorded(opts, key, setAdd(members, &added), addedRecord(wal.OperationSAdd, members))
+
+	return added, err
+}
+
+// SRem removes members from the set at key and returns how many of them were
+// there.
+func (s *Storage) SRem(key string, members []string, opts ...WriteOption) (int, error) {
+	var removed int
+	err := s.updateRecorded(opts, key, setRem(members, &removed), removedRecord(wal.OperationSRem, members))
+
+	return removed, err
+}
+
+func (s *Storage) SIsMember(key, member string) (bool, error) {
+	var ok bool
+	err := s.viewSet(key, func(st *set) {
+		_, ok = st.members[member]
+	})
+
+	return ok, err
+}
+
+// SMembers returns the members of the set at key in order.
+func (s *Storage) SMembers(key string) ([]string, error) {
+	var members []string
+	err := s.viewSet(key, func(st *set) {
+		members = st.sorted()
+	})
+
+	return members, err
+}
+
+func (s *Storage) SCard(key string) (int, error) {
+	var n int
+	err := s.viewSet(key, func(st *set) {
+		n = len(st.members)
+	})
+
+	return n, err
+}
+
+// SInter returns the members found in the sets at every one of keys, in
+// order. Missing keys count as empty sets.
+func (s *Storage) SInter(keys []string) ([]string, error) {
+	var inter map[string]struct{}
+	for _, key := range keys {
+		err := s.viewSet(key, func(st *set) {
+			if inter == nil {
+				inter = maps.Clone(st.members)
+				return
+			}
+
+			maps.DeleteFunc(inter, func(member string, _ struct{}) bool {
+				_, ok := st.members[member]
+				return !ok
+			})
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return slices.Sorted(maps.Keys(inter)), nil
+}
+
+// SUnion returns the members found in the sets at any of keys, in order.
+func (s *Storage) SUnion(keys []string) ([]string, error) {
+	union := make(map[string]struct{})
+	for _, key := range keys {
+		err := s.viewSet(key, func(st *set) {
+			maps.Copy(union, st.members)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return slices.Sorted(maps.Keys(union)), nil
+}
+
+// viewSet calls fn with the set at key, which is empty if the key is missing.
+// fn must not change the set.
+func (s *Storage) viewSet(key string, fn func(st *set)) error {
+	return engine.View(s.engine, []byte(key), func(entry engine.Entry, found bool) error {
+		st, err := currentSet(entry, found)
+		if err != nil {
+			return err
+		}
+
+		fn(st)
+		return nil
+	})
+}
+
+// set is the object sets are kept as. size tracks the length of the encoded
+// set as members change.
+type set struct {
+	members map[string]struct{}
+	size    int
+}
+
+func (st *set) Encode() []byte {
+	buf := make([]byte, 0, st.size)
+	for _, member := range st.sorted() {
+		buf = appendElement(buf, member)
+	}
+
+	return buf
+}
+
+func (st *set) Size() int {
+	return st.size
+}
+
+func (st *set) sorted() []string {
+	return slices.Sorted(maps.Keys(st.members))
+}
+
+func (st *set) add(member string) bool {
+	if _, ok := st.members[member]; ok {
+		return false
+	}
+
+	st.members[member] = struct{}{}
+	st.size += encodedLen(member)
+
+	return true
+}
+
+func (st *set) remove(member string) bool {
+	if _, ok := st.members[member]; !ok {
+		return false
+	}
+
+	delete(st.members, member)
+	st.size -= encodedLen(member)
+
+	return true
+}
+
+// currentSet returns the set of an entry passed to an UpdateFunc or a view:
+// the object the engine holds, or one decoded from its value. A missing key
+// holds an empty set.
+func currentSet(current engine.Entry, found bool) (*set, error) {
+	if !found {
+		return &set{members: make(map[string]struct{}), size: 0}, nil
+	}
+
+	if current.Type != engine.TypeSet {
+		return nil, engine.ErrWrongType
+	}
+
+	if st, ok := current.Object.(*set); ok {
+		return st, nil
+	}
+
+	members, err := decodeList(current.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	st := &set{members: make(map[string]struct{}, len(members)), size: len(current.Value)}
+	for _, member := range members {
+		st.members[member] = struct{}{}
+	}
+
+	return st, nil
+}
+
+// setEntry returns current holding st in place of its value.
+func setEntry(current engine.Entry, st *set) engine.Entry {
+	current.Value, current.Object, current.Type = nil, st, engine.TypeSet
+	return current
+}
+
+func setAdd(members []string, added *int) engine.UpdateFunc {
+	return func(current engine.Entry, found bool) (engine.Entry, bool, error) {
+		st, err := currentSet(current, found)
+		if err != nil {
+			return engine.Entry{}, false, err
+		}
+
+		*added = 0
+		for _, member := range members {
+			if st.add(member) {
+				*added++
+			}
+		}
+
+		return setEntry(current, st), true, nil
+	}
+}
+
+func setRem(members []string, removed *int) engine.UpdateFunc {
+	return func(current engine.Entry, found bool) (engine.Entry, bool, error) {
+		st, err := currentSet(current, found)
+		if err != nil || !found {
+			return engine.Entry{}, false, err
+		}
+
+		*removed = 0
+		for _, member := range members {
+			if st.remove(member) {
+				*removed++
+			}
+		}
+
+		return setEntry(current, st), len(st.members) > 0, nil
+	}
+}
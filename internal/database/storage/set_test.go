@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine/btree"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine/lsm"
+)
+
+func TestStorage_Sets(t *testing.T) {
+	walDir, snapshotDir := t.TempDir(), t.TempDir()
+
+	s := newTestStorageWithSnapshots(t, walDir, snapshotDir)
+	if n, err := s.SAdd("flags", []string{"beta", "dark", "beta"}); err != nil || n != 2 {
+		t.Fatalf("expected 2, got %d, %v", n, err)
+	}
+	if _, err := s.SAdd("enabled", []string{"dark", "search"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := s.SRem("flags", []string{"beta", "missing"}); err != nil || n != 1 {
+		t.Fatalf("expected 1, got %d, %v", n, err)
+	}
+	if _, err := s.SAdd("flags", []string{"new"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set("name", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SAdd("name", []string{"x"}); !errors.Is(err, engine.ErrWrongType) {
+		t.Errorf("expected error %v, got %v", engine.ErrWrongType, err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s = newTestStorageWithSnapshots(t, walDir, snapshotDir)
+	//nolint:errcheck
+	defer s.Close()
+
+	if members, err := s.SMembers("flags"); err != nil || !slices.Equal(members, []string{"dark", "new"}) {
+		t.Errorf("expected [dark new], got %v, %v", members, err)
+	}
+	if members, err := s.SInter([]string{"flags", "enabled"}); err != nil || !slices.Equal(members, []string{"dark"}) {
+		t.Errorf("expected [dark], got %v, %v", members, err)
+	}
+	if members, err := s.SUnion([]string{"flags", "enabled", "missing"}); err != nil || !slices.Equal(members, []string{"dark", "new", "search"}) {
+		t.Errorf("expected [dark new search], got %v, %v", members, err)
+	}
+	if members, err := s.SInter([]string{"flags", "missing"}); err != nil || len(members) != 0 {
+		t.Errorf("expected no members, got %v, %v", members, err)
+	}
+	if _, err := s.SInter([]string{"flags", "name"}); !errors.Is(err, engine.ErrWrongType) {
+		t.Errorf("expected error %v, got %v", engine.ErrWrongType, err)
+	}
+}
+
+func TestStorage_SetsOnPersistentEngines(t *testing.T) {
+	for _, name := range []string{lsm.Name, btree.Name} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			s := newPersistentTestStorage(t, dir, name)
+			if _, err := s.SAdd("flags", []string{"a", "b"}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.SRem("flags", []string{"a"}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.SAdd("flags", []string{"c"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			s = newPersistentTestStorage(t, dir, name)
+			//nolint:errcheck
+			defer s.Close()
+
+			if members, err := s.SMembers("flags"); err != nil || !slices.Equal(members, []string{"b", "c"}) {
+				t.Errorf("expected [b c], got %v, %v", members, err)
+			}
+		})
+	}
+}
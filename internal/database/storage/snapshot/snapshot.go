@@ -0,0 +1,495 @@
+package snapshot
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/config"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrCorruptedSnapshot  = errors.New("corrupted snapshot")
+	ErrUnsupportedVersion = errors.New("unsupported snapshot version")
+	ErrNoSnapshot         = errors.New("no snapshot found")
+)
+
+const (
+	// Version 3 stores the value type after the deadline, version 2 stores
+	// an absolute deadline after each value and version 1 files contain
+	// neither. Older files are still readable and hold only strings.
+	formatVersion   uint16 = 3
+	deadlineVersion uint16 = 2
+	legacyVersion   uint16 = 1
+
+	filePrefix = "snapshot_"
+	fileSuffix = ".snap"
+	tmpSuffix  = ".tmp"
+
+	entryMarker byte = 1
+	endMarker   byte = 0
+
+	retainedSnapshots = 2
+	maxStringSize     = 1 << 30
+)
+
+var (
+	magic    = []byte("KVSNAP")
+	crcTable = crc32.MakeTable(crc32.Castagnoli)
+)
+
+type Info struct {
+	LSN  uint64
+	Path string
+}
+
+type Manager struct {
+	dir    string
+	logger *zap.Logger
+}
+
+func NewManager(cfg *config.SnapshotConfig, logger *zap.Logger) (*Manager, error) {
+	if cfg == nil {
+		return nil, errors.New("snapshot config is nil")
+	}
+
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	//nolint:gosec
+	if err := os.MkdirAll(cfg.DataDirectory, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+
+	return &Manager{
+		dir:    cfg.DataDirectory,
+		logger: logger,
+	}, nil
+}
+
+func fileName(lsn uint64) string {
+	return fmt.Sprintf("%s%020d%s", filePrefix, lsn, fileSuffix)
+}
+
+// List returns the snapshots found on disk, newest first.
+func (m *Manager) List() ([]Info, error) {
+	entries, err := os.ReadDir(m.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot directory: %w", err)
+	}
+
+	snapshots := make([]Info, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, filePrefix) || !strings.HasSuffix(name, fileSuffix) {
+			continue
+		}
+
+		lsn, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, filePrefix), fileSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		snapshots = append(snapshots, Info{LSN: lsn, Path: filepath.Join(m.dir, name)})
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].LSN > snapshots[j].LSN
+	})
+
+	return snapshots, nil
+}
+
+// Write serializes snap as the state covering every WAL record up to and
+// including lsn. The file only becomes visible once it is complete and synced.
+func (m *Manager) Write(lsn uint64, snap engine.Snapshot) (Info, error) {
+	path := filepath.Join(m.dir, fileName(lsn))
+	tmpPath := path + tmpSuffix
+
+	//nolint:gosec
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return Info{}, fmt.Errorf("failed to create snapshot file: %w", err)
+	}
+
+	err = writeSnapshot(file, lsn, snap)
+	if err == nil {
+		err = file.Sync()
+	}
+	err = errors.Join(err, file.Close())
+	if err != nil {
+		//nolint:errcheck
+		os.Remove(tmpPath)
+		return Info{}, fmt.Errorf("failed to write snapshot: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return Info{}, fmt.Errorf("failed to rename snapshot: %w", err)
+	}
+
+	if err := syncDir(m.dir); err != nil {
+		return Info{}, err
+	}
+
+	return Info{LSN: lsn, Path: path}, nil
+}
+
+func writeSnapshot(w io.Writer, lsn uint64, snap engine.Snapshot) error {
+	checksum := crc32.New(crcTable)
+	writer := bufio.NewWriter(io.MultiWriter(w, checksum))
+
+	header := make([]byte, 0, len(magic)+2+8)
+	header = append(header, magic...)
+	header = binary.BigEndian.AppendUint16(header, formatVersion)
+	header = binary.BigEndian.AppendUint64(header, lsn)
+	if _, err := writer.Write(header); err != nil {
+		return err
+	}
+
+	var count uint64
+	buf := make([]byte, 0, 64)
+	err := snap.ForEach(func(entry engine.Entry) error {
+		buf = buf[:0]
+		buf = append(buf, entryMarker)
+		buf = binary.AppendUvarint(buf, uint64(len(entry.Key)))
+		buf = append(buf, entry.Key...)
+		buf = binary.AppendUvarint(buf, uint64(len(entry.Value)))
+		buf = append(buf, entry.Value...)
+		buf = binary.AppendVarint(buf, deadlineNanos(entry.Deadline))
+		buf = append(buf, byte(entry.Type))
+		count++
+
+		_, err := writer.Write(buf)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	trailer := []byte{endMarker}
+	trailer = binary.BigEndian.AppendUint64(trailer, count)
+	if _, err := writer.Write(trailer); err != nil {
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	_, err = w.Write(binary.BigEndian.AppendUint32(nil, checksum.Sum32()))
+	return err
+}
+
+// Load restores the newest snapshot that passes verification, falling back to
+// older ones, and returns the WAL position it covers.
+func (m *Manager) Load(fn func(entry engine.Entry) error) (Info, error) {
+	snapshots, err := m.List()
+	if err != nil {
+		return Info{}, err
+	}
+
+	for _, info := range snapshots {
+		if err := m.verify(info); err != nil {
+			m.logger.Warn("skipping invalid snapshot", zap.String("path", info.Path), zap.Error(err))
+			continue
+		}
+
+		if err := m.read(info, fn); err != nil {
+			return Info{}, fmt.Errorf("failed to load snapshot %s: %w", info.Path, err)
+		}
+
+		return info, nil
+	}
+
+	return Info{}, ErrNoSnapshot
+}
+
+// Read verifies the given snapshot and feeds its entries to fn.
+func (m *Manager) Read(info Info, fn func(entry engine.Entry) error) error {
+	if err := m.verify(info); err != nil {
+		return err
+	}
+
+	return m.read(info, fn)
+}
+
+func (m *Manager) Latest() (Info, error) {
+	snapshots, err := m.List()
+	if err != nil {
+		return Info{}, err
+	}
+
+	if len(snapshots) == 0 {
+		return Info{}, ErrNoSnapshot
+	}
+
+	return snapshots[0], nil
+}
+
+// ReadChunk returns up to size bytes of the raw snapshot file starting at
+// offset, along with the total file size.
+func (m *Manager) ReadChunk(lsn uint64, offset int64, size int) ([]byte, int64, error) {
+	//nolint:gosec
+	file, err := os.Open(filepath.Join(m.dir, fileName(lsn)))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, 0, ErrNoSnapshot
+		}
+		return nil, 0, fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	//nolint:errcheck
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to stat snapshot: %w", err)
+	}
+
+	buf := make([]byte, size)
+	n, err := file.ReadAt(buf, offset)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, 0, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+
+	return buf[:n], stat.Size(), nil
+}
+
+// Install stores a raw snapshot file received from elsewhere. The data is
+// verified before it replaces anything on disk.
+func (m *Manager) Install(lsn uint64, src io.Reader) (Info, error) {
+	path := filepath.Join(m.dir, fileName(lsn))
+	tmpPath := path + tmpSuffix
+
+	//nolint:gosec
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return Info{}, fmt.Errorf("failed to create snapshot file: %w", err)
+	}
+
+	_, err = io.Copy(file, src)
+	if err == nil {
+		err = file.Sync()
+	}
+	err = errors.Join(err, file.Close())
+	if err == nil {
+		err = m.verify(Info{LSN: lsn, Path: tmpPath})
+	}
+	if err != nil {
+		//nolint:errcheck
+		os.Remove(tmpPath)
+		return Info{}, fmt.Errorf("failed to install snapshot: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return Info{}, fmt.Errorf("failed to rename snapshot: %w", err)
+	}
+
+	if err := syncDir(m.dir); err != nil {
+		return Info{}, err
+	}
+
+	return Info{LSN: lsn, Path: path}, nil
+}
+
+func (m *Manager) verify(info Info) error {
+	return m.read(info, func(engine.Entry) error { return nil })
+}
+
+func (m *Manager) read(info Info, fn func(entry engine.Entry) error) error {
+	//nolint:gosec
+	file, err := os.Open(info.Path)
+	if err != nil {
+		return fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	//nolint:errcheck
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat snapshot: %w", err)
+	}
+	if stat.Size() < int64(len(magic)+2+8+1+8+4) {
+		return fmt.Errorf("%w: file too short", ErrCorruptedSnapshot)
+	}
+
+	checksum := crc32.New(crcTable)
+	reader := bufio.NewReader(io.TeeReader(io.LimitReader(file, stat.Size()-4), checksum))
+
+	version, lsn, err := readHeader(reader)
+	if err != nil {
+		return err
+	}
+	if lsn != info.LSN {
+		return fmt.Errorf("%w: header lsn %d does not match file name", ErrCorruptedSnapshot, lsn)
+	}
+
+	if err := readEntries(reader, version, fn); err != nil {
+		return err
+	}
+
+	expected := make([]byte, 4)
+	if _, err := io.ReadFull(file, expected); err != nil {
+		return fmt.Errorf("%w: missing checksum", ErrCorruptedSnapshot)
+	}
+	if binary.BigEndian.Uint32(expected) != checksum.Sum32() {
+		return fmt.Errorf("%w: checksum mismatch", ErrCorruptedSnapshot)
+	}
+
+	return nil
+}
+
+func readHeader(r *bufio.Reader) (uint16, uint64, error) {
+	header := make([]byte, len(magic)+2+8)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, 0, fmt.Errorf("%w: %w", ErrCorruptedSnapshot, err)
+	}
+
+	if string(header[:len(magic)]) != string(magic) {
+		return 0, 0, fmt.Errorf("%w: bad magic", ErrCorruptedSnapshot)
+	}
+
+	version := binary.BigEndian.Uint16(header[len(magic):])
+	if version < legacyVersion || version > formatVersion {
+		return 0, 0, fmt.Errorf("%w: %d", ErrUnsupportedVersion, version)
+	}
+
+	return version, binary.BigEndian.Uint64(header[len(magic)+2:]), nil
+}
+
+func readEntries(r *bufio.Reader, version uint16, fn func(entry engine.Entry) error) error {
+	var count uint64
+	for {
+		marker, err := r.ReadByte()
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrCorruptedSnapshot, err)
+		}
+
+		if marker == endMarker {
+			break
+		}
+		if marker != entryMarker {
+			return fmt.Errorf("%w: unexpected marker %d", ErrCorruptedSnapshot, marker)
+		}
+
+		key, err := readBytes(r)
+		if err != nil {
+			return err
+		}
+		value, err := readBytes(r)
+		if err != nil {
+			return err
+		}
+
+		entry := engine.Entry{Key: key, Value: value, Type: engine.TypeString}
+		if version >= deadlineVersion {
+			nanos, err := binary.ReadVarint(r)
+			if err != nil {
+				return fmt.Errorf("%w: %w", ErrCorruptedSnapshot, err)
+			}
+			if nanos != 0 {
+				entry.Deadline = time.Unix(0, nanos)
+			}
+		}
+		if version >= formatVersion {
+			typ, err := r.ReadByte()
+			if err != nil {
+				return fmt.Errorf("%w: %w", ErrCorruptedSnapshot, err)
+			}
+			entry.Type = engine.ValueType(typ)
+		}
+
+		if err := fn(entry); err != nil {
+			return err
+		}
+		count++
+	}
+
+	trailer := make([]byte, 8)
+	if _, err := io.ReadFull(r, trailer); err != nil {
+		return fmt.Errorf("%w: %w", ErrCorruptedSnapshot, err)
+	}
+	if binary.BigEndian.Uint64(trailer) != count {
+		return fmt.Errorf("%w: entry count mismatch", ErrCorruptedSnapshot)
+	}
+
+	if _, err := r.ReadByte(); !errors.Is(err, io.EOF) {
+		return fmt.Errorf("%w: trailing data", ErrCorruptedSnapshot)
+	}
+
+	return nil
+}
+
+func deadlineNanos(deadline time.Time) int64 {
+	if deadline.IsZero() {
+		return 0
+	}
+
+	return deadline.UnixNano()
+}
+
+func readBytes(r *bufio.Reader) ([]byte, error) {
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCorruptedSnapshot, err)
+	}
+	if length > maxStringSize {
+		return nil, fmt.Errorf("%w: length %d too large", ErrCorruptedSnapshot, length)
+	}
+
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCorruptedSnapshot, err)
+	}
+
+	return buf, nil
+}
+
+// Prune removes all but the newest retained snapshots and returns the oldest
+// one that is kept, which bounds how much of the WAL may be discarded.
+func (m *Manager) Prune() (Info, error) {
+	snapshots, err := m.List()
+	if err != nil {
+		return Info{}, err
+	}
+
+	if len(snapshots) == 0 {
+		return Info{}, ErrNoSnapshot
+	}
+
+	keep := min(retainedSnapshots, len(snapshots))
+	for _, info := range snapshots[keep:] {
+		if err := os.Remove(info.Path); err != nil {
+			return Info{}, fmt.Errorf("failed to remove snapshot: %w", err)
+		}
+		m.logger.Debug("removed old snapshot", zap.String("path", info.Path))
+	}
+
+	return snapshots[keep-1], nil
+}
+
+func syncDir(dir string) error {
+	//nolint:gosec
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open snapshot directory: %w", err)
+	}
+	//nolint:errcheck
+	defer d.Close()
+
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("failed to sync snapshot directory: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,280 @@
+package snapshot
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/config"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+	"go.uber.org/zap"
+)
+
+type mapSnapshot map[string]string
+
+func (m mapSnapshot) ForEach(fn func(entry engine.Entry) error) error {
+	for key, value := range m {
+		if err := fn(engine.Entry{Key: []byte(key), Value: []byte(value)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m mapSnapshot) Release() {}
+
+type entrySnapshot []engine.Entry
+
+func (s entrySnapshot) ForEach(fn func(entry engine.Entry) error) error {
+	for _, entry := range s {
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s entrySnapshot) Release() {}
+
+func newTestManager(t *testing.T) *Manager {
+	t.Helper()
+
+	//nolint:exhaustruct
+	m, err := NewManager(&config.SnapshotConfig{DataDirectory: t.TempDir()}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return m
+}
+
+func load(t *testing.T, m *Manager) (Info, map[string]string, error) {
+	t.Helper()
+
+	result := make(map[string]string)
+	info, err := m.Load(func(entry engine.Entry) error {
+		result[string(entry.Key)] = string(entry.Value)
+		return nil
+	})
+
+	return info, result, err
+}
+
+func TestManager_WriteAndLoad(t *testing.T) {
+	m := newTestManager(t)
+
+	data := mapSnapshot{"key1": "value1", "key 2": "value with spaces", "empty": ""}
+	if _, err := m.Write(42, data); err != nil {
+		t.Fatal(err)
+	}
+
+	info, got, err := load(t, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.LSN != 42 {
+		t.Errorf("expected lsn 42, got %d", info.LSN)
+	}
+
+	if len(got) != len(data) {
+		t.Fatalf("expected %d entries, got %d", len(data), len(got))
+	}
+	for key, value := range data {
+		if got[key] != value {
+			t.Errorf("key %q: expected value %q, got %q", key, value, got[key])
+		}
+	}
+}
+
+func TestManager_LoadFallsBackToValidSnapshot(t *testing.T) {
+	m := newTestManager(t)
+
+	if _, err := m.Write(10, mapSnapshot{"key": "old"}); err != nil {
+		t.Fatal(err)
+	}
+	newest, err := m.Write(20, mapSnapshot{"key": "new"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(newest.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content[len(content)-6] ^= 0xff
+	//nolint:gosec
+	if err := os.WriteFile(newest.Path, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	info, got, err := load(t, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.LSN != 10 {
+		t.Errorf("expected lsn 10, got %d", info.LSN)
+	}
+	if got["key"] != "old" {
+		t.Errorf("expected value %q, got %q", "old", got["key"])
+	}
+}
+
+func TestManager_LoadWithoutSnapshots(t *testing.T) {
+	m := newTestManager(t)
+
+	if _, _, err := load(t, m); !errors.Is(err, ErrNoSnapshot) {
+		t.Errorf("expected error %v, got %v", ErrNoSnapshot, err)
+	}
+}
+
+func TestManager_Prune(t *testing.T) {
+	m := newTestManager(t)
+
+	for _, lsn := range []uint64{1, 2, 3, 4} {
+		if _, err := m.Write(lsn, mapSnapshot{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	oldest, err := m.Prune()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if oldest.LSN != 3 {
+		t.Errorf("expected oldest retained lsn 3, got %d", oldest.LSN)
+	}
+
+	snapshots, err := m.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != retainedSnapshots {
+		t.Errorf("expected %d snapshots, got %d", retainedSnapshots, len(snapshots))
+	}
+}
+
+func TestManager_WriteAndLoadDeadlines(t *testing.T) {
+	m := newTestManager(t)
+
+	deadline := time.Unix(0, 1_900_000_000_123_456_789)
+	data := entrySnapshot{
+		{Key: []byte("expiring"), Value: []byte("value"), Deadline: deadline},
+		{Key: []byte("persistent"), Value: []byte("value")},
+	}
+	if _, err := m.Write(1, data); err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]engine.Entry)
+	_, err := m.Load(func(entry engine.Entry) error {
+		got[string(entry.Key)] = entry
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !got["expiring"].Deadline.Equal(deadline) {
+		t.Errorf("expected deadline %v, got %v", deadline, got["expiring"].Deadline)
+	}
+	if !got["persistent"].Deadline.IsZero() {
+		t.Errorf("expected no deadline, got %v", got["persistent"].Deadline)
+	}
+}
+
+func TestManager_LoadLegacyVersion(t *testing.T) {
+	m := newTestManager(t)
+
+	data := append([]byte(nil), magic...)
+	data = binary.BigEndian.AppendUint16(data, legacyVersion)
+	data = binary.BigEndian.AppendUint64(data, 7)
+	data = append(data, entryMarker)
+	data = binary.AppendUvarint(data, 3)
+	data = append(data, "key"...)
+	data = binary.AppendUvarint(data, 5)
+	data = append(data, "value"...)
+	data = append(data, endMarker)
+	data = binary.BigEndian.AppendUint64(data, 1)
+	data = binary.BigEndian.AppendUint32(data, crc32.Checksum(data, crcTable))
+
+	//nolint:gosec
+	if err := os.WriteFile(filepath.Join(m.dir, fileName(7)), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	info, got, err := load(t, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.LSN != 7 || got["key"] != "value" {
+		t.Errorf("expected key=value at lsn 7, got %v at lsn %d", got, info.LSN)
+	}
+}
+
+func TestManager_WriteAndLoadTypes(t *testing.T) {
+	m := newTestManager(t)
+
+	data := entrySnapshot{
+		{Key: []byte("list"), Value: []byte("\x01a"), Type: engine.TypeList},
+		{Key: []byte("string"), Value: []byte("value"), Type: engine.TypeString},
+	}
+	if _, err := m.Write(1, data); err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]engine.Entry)
+	_, err := m.Load(func(entry engine.Entry) error {
+		got[string(entry.Key)] = entry
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, entry := range data {
+		if got[string(entry.Key)].Type != entry.Type {
+			t.Errorf("key %q: expected type %v, got %v", entry.Key, entry.Type, got[string(entry.Key)].Type)
+		}
+	}
+}
+
+func TestManager_LoadDeadlineVersion(t *testing.T) {
+	m := newTestManager(t)
+
+	data := append([]byte(nil), magic...)
+	data = binary.BigEndian.AppendUint16(data, deadlineVersion)
+	data = binary.BigEndian.AppendUint64(data, 7)
+	data = append(data, entryMarker)
+	data = binary.AppendUvarint(data, 3)
+	data = append(data, "key"...)
+	data = binary.AppendUvarint(data, 5)
+	data = append(data, "value"...)
+	data = binary.AppendVarint(data, 0)
+	data = append(data, endMarker)
+	data = binary.BigEndian.AppendUint64(data, 1)
+	data = binary.BigEndian.AppendUint32(data, crc32.Checksum(data, crcTable))
+
+	//nolint:gosec
+	if err := os.WriteFile(filepath.Join(m.dir, fileName(7)), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var entry engine.Entry
+	if _, err := m.Load(func(e engine.Entry) error {
+		entry = e
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if string(entry.Value) != "value" || entry.Type != engine.TypeString {
+		t.Errorf("expected string value, got %q of type %v", entry.Value, entry.Type)
+	}
+}
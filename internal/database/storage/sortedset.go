@@ -0,0 +1,223 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/wal"
+)
+
+var ErrCorruptedSortedSet = errors.New("corrupted sorted set value")
+
+// A sorted set is encoded as its members in order, each followed by its score
+// as formatted by FormatFloat, encoded like a list. Engines that keep their
+// data in memory hold it as a zset instead, which writes change in place.
+// Like lists, sorted sets never stay empty. Writes to a sorted set are logged
+// as the scores they leave and the deadline of the set.
+
+// ZAdd sets the scores of members of the sorted set at key and returns how
+// many of them are new.
+func (s *Storage) ZAdd(key string, members []ScoredMember, opts ...WriteOption) (int, error) {
+	var added int
+	err := s.updateRecorded(opts, key, zsetAdd(members, &added), addedRecord(wal.OperationZAdd, scoreArgs(members)))
+
+	return added, err
+}
+
+// ZRem removes members from the sorted set at key and returns how many of
+// them were there.
+func (s *Storage) ZRem(key string, members []string, opts ...WriteOption) (int, error) {
+	var removed int
+	err := s.updateRecorded(opts, key, zsetRem(members, &removed), removedRecord(wal.OperationZRem, members))
+
+	return removed, err
+}
+
+// ZIncrBy adds delta to the score of member, which counts as 0 if it is
+// missing, and returns the new score. It is logged as setting the score to
+// the result.
+func (s *Storage) ZIncrBy(key, member string, delta float64, opts ...WriteOption) (float64, error) {
+	var result float64
+	err := s.updateRecorded(opts, key, zsetIncrBy(member, delta, &result), func(key string, updated engine.Entry, keep bool) (wal.Operation, []string) {
+		return addedRecord(wal.OperationZAdd, []string{FormatFloat(result), member})(key, updated, keep)
+	})
+
+	return result, err
+}
+
+// ZScore returns the score of member, failing with engine.ErrKeyNotFound if
+// it is not in the sorted set at key.
+func (s *Storage) ZScore(key, member string) (float64, error) {
+	var score float64
+	found := false
+	err := s.viewZSet(key, func(z *zset) {
+		score, found = z.score(member)
+	})
+	if err == nil && !found {
+		err = engine.ErrKeyNotFound
+	}
+
+	return score, err
+}
+
+// ZRank returns the 0-based rank of member in the sorted set at key, failing
+// with engine.ErrKeyNotFound if it is not there.
+func (s *Storage) ZRank(key, member string) (int, error) {
+	var rank int
+	found := false
+	err := s.viewZSet(key, func(z *zset) {
+		rank, found = z.rank(member)
+	})
+	if err == nil && !found {
+		err = engine.ErrKeyNotFound
+	}
+
+	return rank, err
+}
+
+// ZRange returns the members of the sorted set at key with ranks between
+// start and stop, both inclusive. Negative ranks count from the end.
+func (s *Storage) ZRange(key string, start, stop int) ([]ScoredMember, error) {
+	var members []ScoredMember
+	err := s.viewZSet(key, func(z *zset) {
+		members = z.rangeByRank(start, stop)
+	})
+
+	return members, err
+}
+
+// ZRangeByScore returns the members of the sorted set at key with scores
+// between minScore and maxScore, both inclusive.
+func (s *Storage) ZRangeByScore(key string, minScore, maxScore float64) ([]ScoredMember, error) {
+	var members []ScoredMember
+	err := s.viewZSet(key, func(z *zset) {
+		members = z.rangeByScore(minScore, maxScore)
+	})
+
+	return members, err
+}
+
+// viewZSet calls fn with the sorted set at key, which is empty if the key is
+// missing. fn must not change the set.
+func (s *Storage) viewZSet(key string, fn func(z *zset)) error {
+	return engine.View(s.engine, []byte(key), func(entry engine.Entry, found bool) error {
+		z, err := currentZSet(entry, found)
+		if err != nil {
+			return err
+		}
+
+		fn(z)
+		return nil
+	})
+}
+
+// scoreArgs formats members as the scores and members of OperationZAdd
+// records.
+func scoreArgs(members []ScoredMember) []string {
+	args := make([]string, 0, 2*len(members))
+	for _, member := range members {
+		args = append(args, FormatFloat(member.Score), member.Member)
+	}
+
+	return args
+}
+
+// currentZSet returns the sorted set of an entry passed to an UpdateFunc or a
+// view: the object the engine holds, or one decoded from its value. A missing
+// key holds an empty set.
+func currentZSet(current engine.Entry, found bool) (*zset, error) {
+	if !found {
+		return newZSet(), nil
+	}
+
+	if current.Type != engine.TypeZSet {
+		return nil, engine.ErrWrongType
+	}
+
+	if z, ok := current.Object.(*zset); ok {
+		return z, nil
+	}
+
+	elements, err := decodeList(current.Value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCorruptedSortedSet, err)
+	}
+	if len(elements)%2 != 0 {
+		return nil, fmt.Errorf("%w: member without score", ErrCorruptedSortedSet)
+	}
+
+	z := newZSet()
+	for i := 0; i < len(elements); i += 2 {
+		score, err := strconv.ParseFloat(elements[i+1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid score %q", ErrCorruptedSortedSet, elements[i+1])
+		}
+		z.add(elements[i], score)
+	}
+
+	return z, nil
+}
+
+// zsetEntry returns current holding z in place of its value.
+func zsetEntry(current engine.Entry, z *zset) engine.Entry {
+	current.Value, current.Object, current.Type = nil, z, engine.TypeZSet
+	return current
+}
+
+func zsetAdd(members []ScoredMember, added *int) engine.UpdateFunc {
+	return func(current engine.Entry, found bool) (engine.Entry, bool, error) {
+		z, err := currentZSet(current, found)
+		if err != nil {
+			return engine.Entry{}, false, err
+		}
+
+		*added = 0
+		for _, member := range members {
+			if z.add(member.Member, member.Score) {
+				*added++
+			}
+		}
+
+		return zsetEntry(current, z), true, nil
+	}
+}
+
+func zsetRem(members []string, removed *int) engine.UpdateFunc {
+	return func(current engine.Entry, found bool) (engine.Entry, bool, error) {
+		z, err := currentZSet(current, found)
+		if err != nil || !found {
+			return engine.Entry{}, false, err
+		}
+
+		*removed = 0
+		for _, member := range members {
+			if z.remove(member) {
+				*removed++
+			}
+		}
+
+		return zsetEntry(current, z), z.len() > 0, nil
+	}
+}
+
+func zsetIncrBy(member string, delta float64, result *float64) engine.UpdateFunc {
+	return func(current engine.Entry, found bool) (engine.Entry, bool, error) {
+		z, err := currentZSet(current, found)
+		if err != nil {
+			return engine.Entry{}, false, err
+		}
+
+		score, _ := z.score(member)
+		score += delta
+		if math.IsInf(score, 0) || math.IsNaN(score) {
+			return engine.Entry{}, false, ErrOverflow
+		}
+
+		*result = score
+		z.add(member, score)
+		return zsetEntry(current, z), true, nil
+	}
+}
@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine/btree"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine/lsm"
+)
+
+func TestStorage_SortedSets(t *testing.T) {
+	walDir, snapshotDir := t.TempDir(), t.TempDir()
+
+	s := newTestStorageWithSnapshots(t, walDir, snapshotDir)
+	members := []ScoredMember{{Member: "alice", Score: 10}, {Member: "bob", Score: 5.5}, {Member: "carol", Score: 10}}
+	if n, err := s.ZAdd("board", members); err != nil || n != 3 {
+		t.Fatalf("expected 3, got %d, %v", n, err)
+	}
+	if _, err := s.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+	if score, err := s.ZIncrBy("board", "bob", 10); err != nil || score != 15.5 {
+		t.Fatalf("expected 15.5, got %v, %v", score, err)
+	}
+	if n, err := s.ZAdd("board", []ScoredMember{{Member: "dave", Score: -1}, {Member: "alice", Score: 12}}); err != nil || n != 1 {
+		t.Fatalf("expected 1, got %d, %v", n, err)
+	}
+	if n, err := s.ZRem("board", []string{"carol", "missing"}); err != nil || n != 1 {
+		t.Fatalf("expected 1, got %d, %v", n, err)
+	}
+
+	lastLSN := s.LastLSN()
+	if _, err := s.ZIncrBy("big", "max", 1e308); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ZIncrBy("big", "max", 1e308); !errors.Is(err, ErrOverflow) {
+		t.Errorf("expected error %v, got %v", ErrOverflow, err)
+	}
+	if s.LastLSN() != lastLSN+1 {
+		t.Errorf("expected failed increments not to be logged")
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s = newTestStorageWithSnapshots(t, walDir, snapshotDir)
+	//nolint:errcheck
+	defer s.Close()
+
+	want := []ScoredMember{{Member: "dave", Score: -1}, {Member: "alice", Score: 12}, {Member: "bob", Score: 15.5}}
+	if got, err := s.ZRange("board", 0, -1); err != nil || !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v, %v", want, got, err)
+	}
+	if got, err := s.ZRangeByScore("board", 0, 15.5); err != nil || !slices.Equal(got, want[1:]) {
+		t.Errorf("expected %v, got %v, %v", want[1:], got, err)
+	}
+	if rank, err := s.ZRank("board", "bob"); err != nil || rank != 2 {
+		t.Errorf("expected rank 2, got %d, %v", rank, err)
+	}
+	if _, err := s.ZScore("board", "carol"); !errors.Is(err, engine.ErrKeyNotFound) {
+		t.Errorf("expected error %v, got %v", engine.ErrKeyNotFound, err)
+	}
+	if _, err := s.SCard("board"); !errors.Is(err, engine.ErrWrongType) {
+		t.Errorf("expected error %v, got %v", engine.ErrWrongType, err)
+	}
+}
+
+func TestStorage_SortedSetsOnPersistentEngines(t *testing.T) {
+	for _, name := range []string{lsm.Name, btree.Name} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			s := newPersistentTestStorage(t, dir, name)
+			if _, err := s.ZAdd("board", []ScoredMember{{Member: "alice", Score: 1}, {Member: "bob", Score: 2}}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.ZIncrBy("board", "alice", 2.5); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.ZRem("board", []string{"bob"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			s = newPersistentTestStorage(t, dir, name)
+			//nolint:errcheck
+			defer s.Close()
+
+			want := []ScoredMember{{Member: "alice", Score: 3.5}}
+			if members, err := s.ZRange("board", 0, -1); err != nil || !slices.Equal(members, want) {
+				t.Errorf("expected %v, got %v, %v", want, members, err)
+			}
+		})
+	}
+}
+
+func TestStorage_SortedSetKeepsExpiryAcrossRestart(t *testing.T) {
+	dir := t.TempDir()
+	deadline := time.Now().Add(50 * time.Millisecond)
+
+	s := newTestStorage(t, dir)
+	if _, err := s.ZAdd("board", []ScoredMember{{Member: "alice", Score: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Expire("board", deadline); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ZIncrBy("board", "alice", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(time.Until(deadline))
+
+	s = newTestStorage(t, dir)
+	//nolint:errcheck
+	defer s.Close()
+
+	if members, err := s.ZRange("board", 0, -1); err != nil || len(members) != 0 {
+		t.Errorf("expected the sorted set to have expired, got %v, %v", members, err)
+	}
+}
@@ -0,0 +1,323 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+)
+
+// staged is the engine of a batch: it keeps the writes of the batch to itself
+// and reads through to base for keys the batch has not written. Values read
+// from base are copies, so writes that change an object in place never reach
+// base. It is only used by the one session running the batch, and needs no
+// lock.
+type staged struct {
+	base    engine.Engine
+	entries map[string]stagedEntry
+	// cleared hides every key of base, after a flush in the batch.
+	cleared bool
+}
+
+// stagedEntry is a key written by the batch, deleted if it no longer exists.
+type stagedEntry struct {
+	entry   engine.Entry
+	deleted bool
+}
+
+// stagedScanner is staged on top of an engine that scans its keys rather
+// than ranging over them in order.
+type stagedScanner struct {
+	*staged
+}
+
+// newStaged returns the engine of a batch on top of base.
+func newStaged(base engine.Engine) (*staged, engine.Engine) {
+	s := &staged{base: base, entries: make(map[string]stagedEntry), cleared: false}
+	if _, ok := base.(engine.Scanner); ok {
+		return s, stagedScanner{staged: s}
+	}
+
+	return s, s
+}
+
+// lookup returns the entry of key as the batch sees it. Entries the batch has
+// written are returned as they are held, objects included.
+func (s *staged) lookup(key []byte) (engine.Entry, bool, error) {
+	if st, ok := s.entries[string(key)]; ok {
+		if st.deleted || stagedExpired(st.entry, time.Now()) {
+			return engine.Entry{}, false, nil
+		}
+
+		return st.entry, true, nil
+	}
+
+	if s.cleared {
+		return engine.Entry{}, false, nil
+	}
+
+	entry, err := s.base.GetEntry(key)
+	if errors.Is(err, engine.ErrKeyNotFound) {
+		return engine.Entry{}, false, nil
+	}
+
+	return entry, err == nil, err
+}
+
+func (s *staged) put(entry engine.Entry) {
+	s.entries[string(entry.Key)] = stagedEntry{entry: entry, deleted: false}
+}
+
+// pairs returns the keys the batch leaves with a value along with the values,
+// as key, value, key, value...
+func (s *staged) pairs() []string {
+	pairs := make([]string, 0, 2*len(s.entries))
+	for key, st := range s.entries {
+		if !st.deleted {
+			pairs = append(pairs, key, string(st.entry.Encoded().Value))
+		}
+	}
+
+	return pairs
+}
+
+// existing is lookup for a key that must exist.
+func (s *staged) existing(key []byte) (engine.Entry, error) {
+	entry, found, err := s.lookup(key)
+	if err == nil && !found {
+		err = engine.ErrKeyNotFound
+	}
+
+	return entry, err
+}
+
+func (s *staged) GetEntry(key []byte) (engine.Entry, error) {
+	entry, err := s.existing(key)
+	if err != nil {
+		return engine.Entry{}, err
+	}
+
+	return stagedCopy(entry), nil
+}
+
+func (s *staged) Get(key []byte) ([]byte, error) {
+	entry, err := s.GetEntry(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry.Type != engine.TypeString {
+		return nil, engine.ErrWrongType
+	}
+
+	return entry.Value, nil
+}
+
+func (s *staged) Set(key, value []byte) error {
+	s.put(engine.Entry{Key: bytes.Clone(key), Value: bytes.Clone(value), Object: nil, Type: engine.TypeString, Deadline: time.Time{}})
+	return nil
+}
+
+func (s *staged) Del(key []byte) error {
+	s.entries[string(key)] = stagedEntry{entry: engine.Entry{}, deleted: true}
+	return nil
+}
+
+func (s *staged) Update(key []byte, fn engine.UpdateFunc) error {
+	current, found, err := s.lookup(key)
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		current = engine.Entry{Key: key, Value: nil, Object: nil, Type: engine.TypeString, Deadline: time.Time{}}
+	}
+
+	updated, keep, err := fn(current, found)
+	if err != nil {
+		return err
+	}
+
+	if !keep {
+		return s.Del(key)
+	}
+
+	updated.Key = bytes.Clone(key)
+	s.put(updated)
+
+	return nil
+}
+
+func (s *staged) SetWithDeadline(key, value []byte, deadline time.Time) error {
+	s.put(engine.Entry{Key: bytes.Clone(key), Value: bytes.Clone(value), Object: nil, Type: engine.TypeString, Deadline: deadline})
+	return nil
+}
+
+func (s *staged) Expire(key []byte, deadline time.Time) error {
+	entry, err := s.existing(key)
+	if err != nil {
+		return err
+	}
+
+	entry.Deadline = deadline
+	s.put(entry)
+
+	return nil
+}
+
+func (s *staged) Persist(key []byte) (bool, error) {
+	entry, err := s.existing(key)
+	if err != nil {
+		return false, err
+	}
+
+	if entry.Deadline.IsZero() {
+		return false, nil
+	}
+
+	entry.Deadline = time.Time{}
+	s.put(entry)
+
+	return true, nil
+}
+
+func (s *staged) Deadline(key []byte) (time.Time, error) {
+	entry, err := s.existing(key)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return entry.Deadline, nil
+}
+
+// DeleteExpired deletes nothing: expired keys of the batch already read as
+// missing.
+func (s *staged) DeleteExpired(time.Time, int) (int, int) {
+	return 0, 0
+}
+
+func (s *staged) Clear() error {
+	s.entries = make(map[string]stagedEntry)
+	s.cleared = true
+
+	return nil
+}
+
+// Version returns the version of key before the batch, as versions only
+// change once the batch is applied.
+func (s *staged) Version(key []byte) (uint64, error) {
+	versioner, ok := s.base.(engine.Versioner)
+	if !ok {
+		return 0, ErrVersionsUnsupported
+	}
+
+	return versioner.Version(key)
+}
+
+// Range merges the keys the batch has written into the range of base.
+func (s *staged) Range(start, end []byte, reverse bool, fn func(entry engine.Entry) bool) error {
+	ranger, ok := s.base.(engine.Ranger)
+	if !ok {
+		return engine.ErrRangeUnsupported
+	}
+
+	keys := s.keysIn(start, end, reverse)
+	now := time.Now()
+	next := func() bool {
+		st := s.entries[keys[0]]
+		keys = keys[1:]
+
+		return st.deleted || stagedExpired(st.entry, now) || fn(stagedCopy(st.entry))
+	}
+
+	more := true
+	if !s.cleared {
+		err := ranger.Range(start, end, reverse, func(entry engine.Entry) bool {
+			key := string(entry.Key)
+			for more && len(keys) > 0 && (keys[0] < key) != reverse && keys[0] != key {
+				more = next()
+			}
+
+			if _, ok := s.entries[key]; ok || !more {
+				return more
+			}
+
+			more = fn(entry)
+			return more
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for more && len(keys) > 0 {
+		more = next()
+	}
+
+	return nil
+}
+
+// keysIn returns the keys the batch has written in [start, end), in the order
+// of a range.
+func (s *staged) keysIn(start, end []byte, reverse bool) []string {
+	keys := make([]string, 0, len(s.entries))
+	for key := range s.entries {
+		if key >= string(start) && (len(end) == 0 || key < string(end)) {
+			keys = append(keys, key)
+		}
+	}
+
+	slices.Sort(keys)
+	if reverse {
+		slices.Reverse(keys)
+	}
+
+	return keys
+}
+
+// Scan returns the keys the batch has left with a value with the first batch
+// of keys, and leaves them out of the scan of base.
+func (s stagedScanner) Scan(cursor string, count int) ([][]byte, string, error) {
+	var keys [][]byte
+	if cursor == "" {
+		now := time.Now()
+		for key, st := range s.entries {
+			if !st.deleted && !stagedExpired(st.entry, now) {
+				keys = append(keys, []byte(key))
+			}
+		}
+	}
+
+	if s.cleared {
+		return keys, "", nil
+	}
+
+	//nolint:forcetypeassert
+	scanned, next, err := s.base.(engine.Scanner).Scan(cursor, count)
+	if err != nil {
+		return nil, "", err
+	}
+
+	for _, key := range scanned {
+		if _, ok := s.entries[string(key)]; !ok {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys, next, nil
+}
+
+func stagedExpired(entry engine.Entry, now time.Time) bool {
+	return !entry.Deadline.IsZero() && !now.Before(entry.Deadline)
+}
+
+// stagedCopy returns entry encoded, with a value of its own.
+func stagedCopy(entry engine.Entry) engine.Entry {
+	entry = entry.Encoded()
+	entry.Key = bytes.Clone(entry.Key)
+	entry.Value = bytes.Clone(entry.Value)
+
+	return entry
+}
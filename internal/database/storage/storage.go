@@ -2,17 +2,114 @@ package storage
 
 import (
 	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/snapshot"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/wal"
 	"go.uber.org/zap"
 )
 
+var ErrReplicationDisabled = errors.New("write quorum requested but replication is disabled")
+
+type Replicator interface {
+	WaitForQuorum(lsn uint64, quorum int, timeout time.Duration) error
+}
+
+// Proposer replicates writes through a consensus log in place of the WAL. The
+// log applies what it commits through ApplyOperation, on every node alike.
+type Proposer interface {
+	// Ready fails unless this node has applied every write proposed before,
+	// since writes that read what they change prepare their record from it.
+	Ready() error
+	Propose(op wal.Operation, args ...string) (string, error)
+}
+
 type Storage struct {
-	engine engine.Engine
-	logger *zap.Logger
+	engine     engine.Engine
+	expirer    engine.Expirer
+	wal        *wal.WAL
+	replicator Replicator
+	proposer   Proposer
+	mtx        sync.Mutex
+	logger     *zap.Logger
+
+	// batchMtx keeps readers of several keys from seeing a write to several
+	// keys half applied, whether it is made here, replayed or replicated.
+	batchMtx sync.RWMutex
+
+	maxMemory      int64
+	evictionPolicy engine.EvictionPolicy
+	evictor        engine.Evictor
+	evicted        atomic.Int64
+
+	historian     engine.Historian
+	historyLimits *engine.HistoryLimits
+
+	// batch is set on the storage Begin returns, which keeps the records of
+	// its writes there rather than in a WAL.
+	batch *batch
+
+	snapshots        *snapshot.Manager
+	snapshotter      engine.Snapshotter
+	snapshotInterval time.Duration
+	snapshotMtx      sync.Mutex
+	lastSnapshotLSN  uint64
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+type StorageOption func(*Storage)
+
+func WithWAL(w *wal.WAL) StorageOption {
+	return func(s *Storage) {
+		s.wal = w
+	}
+}
+
+func WithReplicator(r Replicator) StorageOption {
+	return func(s *Storage) {
+		s.replicator = r
+	}
+}
+
+// WithProposer makes writes that are logged as what they stored propose that
+// record instead of applying it. The caller keeps other writes to the key out
+// until the proposal has been applied.
+func WithProposer(p Proposer) StorageOption {
+	return func(s *Storage) {
+		s.proposer = p
+	}
+}
+
+type WriteOption func(*writeOptions)
+
+type writeOptions struct {
+	quorum  int
+	timeout time.Duration
+}
+
+// WithQuorum makes a write wait until quorum replicas have acknowledged it.
+func WithQuorum(quorum int, timeout time.Duration) WriteOption {
+	return func(o *writeOptions) {
+		o.quorum = quorum
+		o.timeout = timeout
+	}
+}
+
+func WithSnapshots(m *snapshot.Manager, interval time.Duration) StorageOption {
+	return func(s *Storage) {
+		s.snapshots = m
+		s.snapshotInterval = interval
+	}
 }
 
-func NewStorage(e engine.Engine, logger *zap.Logger) (*Storage, error) {
+func NewStorage(e engine.Engine, logger *zap.Logger, opts ...StorageOption) (*Storage, error) {
 	if e == nil {
 		return nil, errors.New("engine is nil")
 	}
@@ -21,20 +118,439 @@ func NewStorage(e engine.Engine, logger *zap.Logger) (*Storage, error) {
 		logger = zap.NewNop()
 	}
 
-	return &Storage{
+	//nolint:exhaustruct
+	s := &Storage{
 		engine: e,
 		logger: logger,
-	}, nil
+		done:   make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.snapshots != nil {
+		if s.wal == nil {
+			return nil, errors.New("snapshots require wal")
+		}
+
+		snapshotter, ok := e.(engine.Snapshotter)
+		if !ok {
+			return nil, errors.New("engine does not support snapshots")
+		}
+		s.snapshotter = snapshotter
+	}
+
+	if s.maxMemory > 0 {
+		evictor, ok := e.(engine.Evictor)
+		if !ok {
+			return nil, errors.New("engine does not support max memory")
+		}
+		s.evictor = evictor
+
+		if s.evictionPolicy == "" {
+			s.evictionPolicy = engine.NoEviction
+		}
+	}
+
+	if s.historyLimits != nil {
+		historian, ok := e.(engine.Historian)
+		if !ok {
+			return nil, errors.New("engine does not support history")
+		}
+		s.historian = historian
+	}
+
+	if s.wal != nil {
+		if err := s.recover(); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.historian != nil {
+		s.historian.KeepHistory(*s.historyLimits)
+
+		if s.historyLimits.MaxAge > 0 {
+			s.wg.Add(1)
+			go s.historyLoop()
+		}
+	}
+
+	if s.snapshots != nil && s.snapshotInterval > 0 {
+		s.wg.Add(1)
+		go s.snapshotLoop()
+	}
+
+	if expirer, ok := e.(engine.Expirer); ok {
+		s.expirer = expirer
+		s.wg.Add(1)
+		go s.expireLoop()
+	}
+
+	if s.evictor != nil {
+		s.wg.Add(1)
+		go s.evictionReportLoop()
+	}
+
+	return s, nil
+}
+
+func (s *Storage) recover() error {
+	fromLSN := uint64(1)
+
+	if s.snapshots != nil {
+		info, err := s.snapshots.Load(s.put)
+		switch {
+		case errors.Is(err, snapshot.ErrNoSnapshot):
+		case err != nil:
+			return fmt.Errorf("failed to recover from snapshot: %w", err)
+		default:
+			fromLSN = info.LSN + 1
+			s.lastSnapshotLSN = info.LSN
+			s.logger.Info("loaded snapshot", zap.String("path", info.Path), zap.Uint64("lsn", info.LSN))
+		}
+	}
+
+	if lastLSN := s.wal.LastLSN(); lastLSN+1 < fromLSN {
+		return fmt.Errorf("wal ends at lsn %d before snapshot lsn %d", lastLSN, fromLSN-1)
+	}
+
+	stats, err := s.wal.Replay(fromLSN, s.applyRecord)
+	if err != nil {
+		return fmt.Errorf("failed to recover from wal: %w", err)
+	}
+
+	s.logger.Info(
+		"recovered from wal",
+		zap.Uint64("snapshot_lsn", fromLSN-1),
+		zap.Int("segments_read", stats.SegmentsRead),
+		zap.Int("records_applied", stats.RecordsApplied),
+		zap.Int64("bytes_discarded", stats.BytesDiscarded),
+	)
+
+	return nil
+}
+
+func (s *Storage) applyRecord(record wal.Record) error {
+	_, err := s.ApplyOperation(record.Operation, record.Args)
+	if errors.Is(err, ErrInvalidOperation) {
+		return fmt.Errorf("%w: %w", wal.ErrCorruptedRecord, err)
+	}
+
+	return err
+}
+
+// ApplyOperation performs an operation logged or proposed elsewhere, like
+// Apply, taking the batch lock for operations on several keys.
+func (s *Storage) ApplyOperation(op wal.Operation, args []string) (string, error) {
+	if op.MultiKey() {
+		s.batchMtx.Lock()
+		defer s.batchMtx.Unlock()
+	}
+
+	return Apply(s.engine, op, args)
+}
+
+func (s *Storage) put(entry engine.Entry) error {
+	return engine.Put(s.engine, entry)
 }
 
 func (s *Storage) Get(key string) (string, error) {
-	return s.engine.Get(key)
+	value, err := s.engine.Get([]byte(key))
+	return string(value), err
+}
+
+// read returns the entry of key and whether it exists, for commands that
+// treat a missing key as an empty value of their type.
+func (s *Storage) read(key string) (engine.Entry, bool, error) {
+	entry, err := s.engine.GetEntry([]byte(key))
+	if errors.Is(err, engine.ErrKeyNotFound) {
+		return entry, false, nil
+	}
+
+	return entry, err == nil, err
+}
+
+func (s *Storage) Set(key, value string, opts ...WriteOption) error {
+	return s.write(opts, func() error {
+		return s.makeRoom(key, value)
+	}, func() error {
+		return s.engine.Set([]byte(key), []byte(value))
+	}, wal.OperationSet, key, value)
 }
 
-func (s *Storage) Set(key, value string) error {
-	return s.engine.Set(key, value)
+func (s *Storage) Del(key string, opts ...WriteOption) error {
+	return s.write(opts, nil, func() error {
+		return s.engine.Del([]byte(key))
+	}, wal.OperationDel, key)
 }
 
-func (s *Storage) Del(key string) error {
-	return s.engine.Del(key)
+// update applies fn to the entry of key in one step and logs op with args
+// for it. With a WAL, fn also runs beforehand as the check, so that a failing
+// update is never logged.
+func (s *Storage) update(opts []WriteOption, key string, fn engine.UpdateFunc, op wal.Operation, args ...string) error {
+	return s.write(opts, func() error {
+		return s.dryRun(key, fn)
+	}, func() error {
+		return s.engine.Update([]byte(key), fn)
+	}, op, args...)
+}
+
+// recordFunc returns the record that stores updated at key, or deletes the key
+// if keep is false.
+type recordFunc func(key string, updated engine.Entry, keep bool) (wal.Operation, []string)
+
+// updateRecorded is update for writes logged as what they stored rather than
+// as the operation, so that replaying the log, on top of an engine that kept
+// its own data or on another node, gives the same result whatever expired
+// since. With a proposer, the record is prepared from the current entry and
+// proposed instead.
+func (s *Storage) updateRecorded(opts []WriteOption, key string, fn engine.UpdateFunc, record recordFunc) error {
+	if s.proposer != nil {
+		return s.propose(key, fn, record)
+	}
+
+	// fn only needs a dry run to make room: it runs on a copy of the value,
+	// which for objects means decoding it.
+	var check func() error
+	if s.maxMemory > 0 {
+		check = func() error {
+			return s.dryRun(key, fn)
+		}
+	}
+
+	return s.writeLogged(opts, check, func(log logFunc) error {
+		var logErr error
+		err := s.engine.Update([]byte(key), func(current engine.Entry, found bool) (engine.Entry, bool, error) {
+			updated, keep, err := fn(current, found)
+			if err != nil || !found && !keep {
+				return engine.Entry{}, false, err
+			}
+
+			op, args := record(key, updated, keep)
+			if logErr = log(op, args...); logErr != nil && updated.Object == nil {
+				return engine.Entry{}, false, logErr
+			}
+
+			// An object fn changed in place stays changed, so the entry
+			// is kept whether or not the record made it to the log.
+			return updated, keep, nil
+		})
+		if err != nil {
+			return err
+		}
+
+		return logErr
+	})
+}
+
+func (s *Storage) propose(key string, fn engine.UpdateFunc, record recordFunc) error {
+	if err := s.proposer.Ready(); err != nil {
+		return err
+	}
+
+	current, found, err := s.read(key)
+	if err != nil {
+		return err
+	}
+
+	updated, keep, err := fn(current, found)
+	if err != nil || !found && !keep {
+		return err
+	}
+
+	op, args := record(key, updated, keep)
+	_, err = s.proposer.Propose(op, args...)
+
+	return err
+}
+
+// stringRecord records a string as the value it was set to and its deadline.
+func stringRecord(key string, updated engine.Entry, keep bool) (wal.Operation, []string) {
+	switch {
+	case !keep:
+		return wal.OperationDel, []string{key}
+	case updated.Deadline.IsZero():
+		return wal.OperationSet, []string{key, string(updated.Value)}
+	default:
+		return wal.OperationSetWithDeadline, []string{key, string(updated.Value), wal.FormatDeadline(updated.Deadline)}
+	}
+}
+
+// addedRecord records elements added to a hash, set or sorted set as op: the
+// key, the deadline the value is left with and the elements. Elements that
+// were there already are recorded too, as replaying the record sets them to
+// what they are now either way.
+func addedRecord(op wal.Operation, elements []string) recordFunc {
+	return func(key string, updated engine.Entry, _ bool) (wal.Operation, []string) {
+		return op, append([]string{key, formatRecordDeadline(updated.Deadline)}, elements...)
+	}
+}
+
+// removedRecord records elements removed from a hash, set or sorted set as
+// op, or the key as deleted if nothing is left.
+func removedRecord(op wal.Operation, elements []string) recordFunc {
+	return func(key string, _ engine.Entry, keep bool) (wal.Operation, []string) {
+		if !keep {
+			return wal.OperationDel, []string{key}
+		}
+
+		return op, append([]string{key}, elements...)
+	}
+}
+
+// dryRun runs fn on the entry of key without storing what it returns, and
+// makes room for the result if fn keeps the key.
+func (s *Storage) dryRun(key string, fn engine.UpdateFunc) error {
+	current, err := s.engine.GetEntry([]byte(key))
+	found := err == nil
+	switch {
+	case errors.Is(err, engine.ErrKeyNotFound):
+		current = engine.Entry{Key: []byte(key), Value: nil, Object: nil, Type: engine.TypeString, Deadline: time.Time{}}
+	case err != nil:
+		return err
+	}
+
+	updated, keep, err := fn(current, found)
+	if err != nil || !keep {
+		return err
+	}
+
+	return s.makeRoom(key, string(updated.Encoded().Value))
+}
+
+// write appends the mutation to the WAL and applies it to the engine under a
+// single lock, so that replaying the log reproduces the engine state exactly.
+// The caller only returns once the record is durable under the flush policy
+// and, if requested, acknowledged by a quorum of replicas. A non-nil check runs
+// first, under the lock if there is a WAL or a memory limit, and may reject
+// the write or make room for it before the write itself is logged.
+func (s *Storage) write(opts []WriteOption, check, apply func() error, op wal.Operation, args ...string) error {
+	return s.writeLogged(opts, check, func(log logFunc) error {
+		if err := log(op, args...); err != nil {
+			return err
+		}
+		return apply()
+	})
+}
+
+// logFunc appends a record to the WAL, if there is one.
+type logFunc func(op wal.Operation, args ...string) error
+
+// writeLogged is write for mutations that only know what to log once they
+// see what they replace. apply logs the mutation through log, at most once
+// and before changing anything, or logs nothing if it changes nothing.
+func (s *Storage) writeLogged(opts []WriteOption, check func() error, apply func(log logFunc) error) error {
+	if s.batch != nil {
+		return s.batch.write(check, apply)
+	}
+
+	var options writeOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	if options.quorum > 0 && s.replicator == nil {
+		return ErrReplicationDisabled
+	}
+
+	if s.wal == nil {
+		if s.maxMemory > 0 {
+			// Writers making room one at a time keep the limit, where
+			// concurrent ones could each fit and together go over it.
+			s.mtx.Lock()
+			defer s.mtx.Unlock()
+		}
+
+		if check != nil {
+			if err := check(); err != nil {
+				return err
+			}
+		}
+		return apply(func(wal.Operation, ...string) error { return nil })
+	}
+
+	s.mtx.Lock()
+	if check != nil {
+		if err := check(); err != nil {
+			s.mtx.Unlock()
+			return err
+		}
+	}
+
+	var lsn uint64
+	err := apply(func(op wal.Operation, args ...string) error {
+		var err error
+		lsn, err = s.wal.Append(op, args...)
+		return err
+	})
+	s.mtx.Unlock()
+
+	if err != nil || lsn == 0 {
+		return err
+	}
+
+	if err := s.wal.Sync(lsn); err != nil {
+		return err
+	}
+
+	if options.quorum > 0 {
+		return s.replicator.WaitForQuorum(lsn, options.quorum, options.timeout)
+	}
+
+	return nil
+}
+
+func (s *Storage) LastLSN() uint64 {
+	if s.wal == nil {
+		return 0
+	}
+
+	return s.wal.LastLSN()
+}
+
+// ApplyRecords logs and applies records replicated from a leader, keeping the
+// leader's LSNs so that both logs stay aligned.
+func (s *Storage) ApplyRecords(records []wal.Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	if s.wal == nil {
+		return errors.New("replication requires wal")
+	}
+
+	s.mtx.Lock()
+	for _, record := range records {
+		if err := s.wal.AppendRecord(record); err != nil {
+			s.mtx.Unlock()
+			return err
+		}
+
+		if err := s.applyRecord(record); err != nil {
+			s.mtx.Unlock()
+			return err
+		}
+	}
+	s.mtx.Unlock()
+
+	return s.wal.Sync(records[len(records)-1].LSN)
+}
+
+// Close stops background work and closes the WAL, and the engine if it holds
+// resources of its own.
+func (s *Storage) Close() error {
+	close(s.done)
+	s.wg.Wait()
+
+	var err error
+	if s.wal != nil {
+		err = s.wal.Close()
+	}
+
+	if closer, ok := s.engine.(io.Closer); ok {
+		err = errors.Join(err, closer.Close())
+	}
+
+	return err
 }
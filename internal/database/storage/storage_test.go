@@ -0,0 +1,529 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/config"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine/btree"
+	inmemory "github.com/crunchydeer30/key-value-database/internal/database/storage/engine/in_memory"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine/lsm"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/snapshot"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/wal"
+	"go.uber.org/zap"
+)
+
+func newTestStorage(t *testing.T, dir string) *Storage {
+	t.Helper()
+
+	//nolint:exhaustruct
+	w, err := wal.NewWAL(&config.WALConfig{DataDirectory: dir, FlushPolicy: string(wal.FlushAlways)}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := inmemory.NewInMemoryEngine(zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewStorage(e, zap.NewNop(), WithWAL(w))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+// newPersistentTestStorage opens storage on an engine that keeps its own data
+// in dir next to the WAL, so that reopening it replays the WAL on top of what
+// the engine kept.
+func newPersistentTestStorage(t *testing.T, dir, engineName string) *Storage {
+	t.Helper()
+
+	//nolint:exhaustruct
+	w, err := wal.NewWAL(&config.WALConfig{DataDirectory: filepath.Join(dir, "wal"), FlushPolicy: string(wal.FlushAlways)}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var e engine.Engine
+	switch engineName {
+	case lsm.Name:
+		//nolint:exhaustruct
+		e, err = lsm.NewLSMEngine(&lsm.Config{DataDirectory: filepath.Join(dir, "engine")}, zap.NewNop())
+	case btree.Name:
+		//nolint:exhaustruct
+		e, err = btree.NewBTreeEngine(&btree.Config{DataDirectory: filepath.Join(dir, "engine")}, zap.NewNop())
+	default:
+		t.Fatalf("unknown engine %q", engineName)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewStorage(e, zap.NewNop(), WithWAL(w))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+func TestStorage_RecoverFromWAL(t *testing.T) {
+	dir := t.TempDir()
+
+	s := newTestStorage(t, dir)
+	if err := s.Set("key1", "value1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set("key2", "value2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set("key1", "value3"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Del("key2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s = newTestStorage(t, dir)
+	//nolint:errcheck
+	defer s.Close()
+
+	value, err := s.Get("key1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != "value3" {
+		t.Errorf("expected value %v, got %v", "value3", value)
+	}
+
+	if _, err := s.Get("key2"); !errors.Is(err, engine.ErrKeyNotFound) {
+		t.Errorf("expected error %v, got %v", engine.ErrKeyNotFound, err)
+	}
+}
+
+func TestStorage_RecoverWithTornTail(t *testing.T) {
+	dir := t.TempDir()
+
+	s := newTestStorage(t, dir)
+	if err := s.Set("key", "value"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	matches, err := filepath.Glob(filepath.Join(dir, "wal_*.log"))
+	if err != nil || len(matches) != 1 {
+		t.Fatalf("expected one segment, got %v (%v)", matches, err)
+	}
+
+	//nolint:gosec
+	f, err := os.OpenFile(matches[0], os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte{0, 0, 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s = newTestStorage(t, dir)
+	//nolint:errcheck
+	defer s.Close()
+
+	value, err := s.Get("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != "value" {
+		t.Errorf("expected value %v, got %v", "value", value)
+	}
+}
+
+func newTestStorageWithSnapshots(t *testing.T, walDir, snapshotDir string) *Storage {
+	t.Helper()
+
+	//nolint:exhaustruct
+	w, err := wal.NewWAL(&config.WALConfig{
+		DataDirectory:  walDir,
+		MaxSegmentSize: 128,
+		FlushPolicy:    string(wal.FlushOS),
+	}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//nolint:exhaustruct
+	m, err := snapshot.NewManager(&config.SnapshotConfig{DataDirectory: snapshotDir}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := inmemory.NewInMemoryEngine(zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewStorage(e, zap.NewNop(), WithWAL(w), WithSnapshots(m, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+func TestStorage_RecoverFromSnapshotAndWALTail(t *testing.T) {
+	walDir, snapshotDir := t.TempDir(), t.TempDir()
+
+	s := newTestStorageWithSnapshots(t, walDir, snapshotDir)
+	for i := range 20 {
+		if err := s.Set("key"+strconv.Itoa(i), "value"+strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := s.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set("key0", "after first snapshot"); err != nil {
+		t.Fatal(err)
+	}
+	info, err := s.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Set("key1", "after snapshot"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Del("key2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	segments, err := filepath.Glob(filepath.Join(walDir, "wal_*.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) >= 20 {
+		t.Errorf("expected wal segments to be truncated, got %d", len(segments))
+	}
+
+	s = newTestStorageWithSnapshots(t, walDir, snapshotDir)
+	//nolint:errcheck
+	defer s.Close()
+
+	if s.lastSnapshotLSN != info.LSN {
+		t.Errorf("expected snapshot lsn %d, got %d", info.LSN, s.lastSnapshotLSN)
+	}
+
+	expected := map[string]string{
+		"key0":  "after first snapshot",
+		"key1":  "after snapshot",
+		"key19": "value19",
+	}
+	for key, want := range expected {
+		got, err := s.Get(key)
+		if err != nil {
+			t.Fatalf("Get(%q) error = %v", key, err)
+		}
+		if got != want {
+			t.Errorf("key %q: expected value %q, got %q", key, want, got)
+		}
+	}
+
+	if _, err := s.Get("key2"); !errors.Is(err, engine.ErrKeyNotFound) {
+		t.Errorf("expected error %v, got %v", engine.ErrKeyNotFound, err)
+	}
+}
+
+func TestStorage_QuorumWithoutReplication(t *testing.T) {
+	e, err := inmemory.NewInMemoryEngine(zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewStorage(e, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Set("key", "value", WithQuorum(1, time.Second)); !errors.Is(err, ErrReplicationDisabled) {
+		t.Errorf("expected error %v, got %v", ErrReplicationDisabled, err)
+	}
+}
+
+func TestStorage_RecoverDeadlines(t *testing.T) {
+	walDir := t.TempDir()
+	snapshotDir := t.TempDir()
+
+	deadline := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	s := newTestStorageWithSnapshots(t, walDir, snapshotDir)
+	if err := s.SetWithDeadline("from_snapshot", "value", deadline); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetWithDeadline("expired", "value", time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set("from_wal", "value"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Expire("from_wal", deadline); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set("persisted", "value"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Expire("persisted", deadline); err != nil {
+		t.Fatal(err)
+	}
+	if persisted, err := s.Persist("persisted"); err != nil || !persisted {
+		t.Fatalf("expected deadline to be removed, got %v, %v", persisted, err)
+	}
+	lastLSN := s.LastLSN()
+	if err := s.Expire("missing", deadline); !errors.Is(err, engine.ErrKeyNotFound) {
+		t.Errorf("expected error %v, got %v", engine.ErrKeyNotFound, err)
+	}
+	if s.LastLSN() != lastLSN {
+		t.Errorf("expected expiring a missing key not to be logged")
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s = newTestStorageWithSnapshots(t, walDir, snapshotDir)
+	//nolint:errcheck
+	defer s.Close()
+
+	for key, want := range map[string]time.Time{
+		"from_snapshot": deadline,
+		"from_wal":      deadline,
+		"persisted":     {},
+	} {
+		got, err := s.Deadline(key)
+		if err != nil {
+			t.Fatalf("key %q: %v", key, err)
+		}
+		if !got.Equal(want) {
+			t.Errorf("key %q: expected deadline %v, got %v", key, want, got)
+		}
+	}
+
+	if _, err := s.Get("expired"); !errors.Is(err, engine.ErrKeyNotFound) {
+		t.Errorf("expected error %v, got %v", engine.ErrKeyNotFound, err)
+	}
+}
+
+func TestStorage_RecoverDeadlinesChangedBeforeTheyPassed(t *testing.T) {
+	dir := t.TempDir()
+	deadline := time.Now().Add(50 * time.Millisecond)
+	extended := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	s := newTestStorage(t, dir)
+	if err := s.SetWithDeadline("persisted", "value", deadline); err != nil {
+		t.Fatal(err)
+	}
+	if persisted, err := s.Persist("persisted"); err != nil || !persisted {
+		t.Fatalf("expected deadline to be removed, got %v, %v", persisted, err)
+	}
+	if err := s.SetWithDeadline("extended", "value", deadline); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Expire("extended", extended); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(time.Until(deadline))
+
+	s = newTestStorage(t, dir)
+	//nolint:errcheck
+	defer s.Close()
+
+	for key, want := range map[string]time.Time{
+		"persisted": {},
+		"extended":  extended,
+	} {
+		got, err := s.Deadline(key)
+		if err != nil {
+			t.Fatalf("key %q: %v", key, err)
+		}
+		if !got.Equal(want) {
+			t.Errorf("key %q: expected deadline %v, got %v", key, want, got)
+		}
+	}
+}
+
+func TestStorage_RemovesExpiredKeysInBackground(t *testing.T) {
+	s := newTestStorage(t, t.TempDir())
+	//nolint:errcheck
+	defer s.Close()
+
+	if err := s.SetWithDeadline("key", "value", time.Now().Add(50*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		// Sampling as of the zero time counts keys with a deadline without
+		// deleting any of them.
+		if sampled, _ := s.expirer.DeleteExpired(time.Time{}, 1); sampled == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expired key was not removed")
+		}
+		<-time.After(10 * time.Millisecond)
+	}
+}
+
+func newTestStorageWithMaxMemory(t *testing.T, dir string, limit int64, policy engine.EvictionPolicy) *Storage {
+	t.Helper()
+
+	//nolint:exhaustruct
+	w, err := wal.NewWAL(&config.WALConfig{DataDirectory: dir, FlushPolicy: string(wal.FlushAlways)}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := inmemory.NewInMemoryEngine(zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewStorage(e, zap.NewNop(), WithWAL(w), WithMaxMemory(limit, policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+func TestStorage_EvictsUnderMemoryLimit(t *testing.T) {
+	dir := t.TempDir()
+	limit := 10 * engine.EntrySize("key00", "value")
+
+	s := newTestStorageWithMaxMemory(t, dir, limit, engine.AllKeysLRU)
+	for i := range 50 {
+		if err := s.Set(fmt.Sprintf("key%02d", i), "value"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if used := s.evictor.UsedMemory(); used > limit {
+		t.Errorf("expected at most %d bytes, got %d", limit, used)
+	}
+	if _, err := s.Get("key49"); err != nil {
+		t.Errorf("expected the latest key to be kept, got %v", err)
+	}
+
+	present := make(map[string]bool)
+	for i := range 50 {
+		key := fmt.Sprintf("key%02d", i)
+		_, err := s.Get(key)
+		present[key] = err == nil
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s = newTestStorage(t, dir)
+	//nolint:errcheck
+	defer s.Close()
+
+	for key, want := range present {
+		if _, err := s.Get(key); (err == nil) != want {
+			t.Errorf("key %q: expected presence %v after recovery, got error %v", key, want, err)
+		}
+	}
+}
+
+func TestStorage_NoEviction(t *testing.T) {
+	limit := 2 * engine.EntrySize("key0", "value")
+
+	s := newTestStorageWithMaxMemory(t, t.TempDir(), limit, engine.NoEviction)
+	//nolint:errcheck
+	defer s.Close()
+
+	for i := range 2 {
+		if err := s.Set("key"+strconv.Itoa(i), "value"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.Set("key2", "value"); !errors.Is(err, ErrOutOfMemory) {
+		t.Errorf("expected error %v, got %v", ErrOutOfMemory, err)
+	}
+	if err := s.Del("key0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set("key2", "value"); err != nil {
+		t.Errorf("expected write to fit after a delete, got %v", err)
+	}
+}
+
+func TestStorage_OverwriteIsCreditedWithReplacedEntry(t *testing.T) {
+	value := strings.Repeat("a", 600)
+	limit := engine.EntrySize("key", value) + 100
+
+	s := newTestStorageWithMaxMemory(t, t.TempDir(), limit, engine.NoEviction)
+	//nolint:errcheck
+	defer s.Close()
+
+	for range 2 {
+		if err := s.Set("key", value); err != nil {
+			t.Fatalf("expected an overwrite of the same size to fit, got %v", err)
+		}
+	}
+}
+
+func TestStorage_DoesNotEvictKeyBeingWritten(t *testing.T) {
+	limit := int64(1000)
+
+	s := newTestStorageWithMaxMemory(t, t.TempDir(), limit, engine.AllKeysLRU)
+	//nolint:errcheck
+	defer s.Close()
+
+	if _, err := s.RPush("list", []string{strings.Repeat("a", 600)}); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := s.RPush("list", []string{"x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected length 2, got %d", n)
+	}
+
+	got, err := s.LRange("list", 0, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0] != strings.Repeat("a", 600) || got[1] != "x" {
+		t.Errorf("expected both elements to be kept, got %d elements", len(got))
+	}
+}
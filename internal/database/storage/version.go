@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"errors"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+)
+
+var (
+	ErrVersionsUnsupported = errors.New("engine does not support versions")
+
+	errValueChanged = errors.New("value changed")
+)
+
+// Version returns the version of key, which changes on every write to it,
+// deletions included, and is 0 if it was never written.
+func (s *Storage) Version(key string) (uint64, error) {
+	versioner, ok := s.engine.(engine.Versioner)
+	if !ok {
+		return 0, ErrVersionsUnsupported
+	}
+
+	return versioner.Version([]byte(key))
+}
+
+// CompareAndSet replaces the string at key with value if it still equals
+// expected, keeping its deadline, and reports whether it did. A missing key
+// never matches. Like SetIf, it is logged as the value it stores rather than
+// the comparison.
+func (s *Storage) CompareAndSet(key, expected, value string, opts ...WriteOption) (bool, error) {
+	err := s.updateRecorded(opts, key, compareAndSet(expected, value), stringRecord)
+	if errors.Is(err, errValueChanged) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func compareAndSet(expected, value string) engine.UpdateFunc {
+	return func(current engine.Entry, found bool) (engine.Entry, bool, error) {
+		if found && current.Type != engine.TypeString {
+			return engine.Entry{}, false, engine.ErrWrongType
+		}
+
+		if !found || string(current.Value) != expected {
+			return engine.Entry{}, false, errValueChanged
+		}
+
+		current.Value = []byte(value)
+		return current, true, nil
+	}
+}
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/storage/engine"
+)
+
+func TestStorage_CompareAndSet(t *testing.T) {
+	dir := t.TempDir()
+
+	s := newTestStorage(t, dir)
+	if err := s.Set("balance", "10"); err != nil {
+		t.Fatal(err)
+	}
+	before, err := s.Version("balance")
+	if err != nil || before == 0 {
+		t.Fatalf("expected a version, got %d, %v", before, err)
+	}
+
+	if ok, err := s.CompareAndSet("balance", "5", "0"); err != nil || ok {
+		t.Errorf("expected a mismatch to keep the value, got %v, %v", ok, err)
+	}
+	if v, err := s.Version("balance"); err != nil || v != before {
+		t.Errorf("expected version %d after a mismatch, got %d, %v", before, v, err)
+	}
+	if ok, err := s.CompareAndSet("balance", "10", "20"); err != nil || !ok {
+		t.Errorf("expected a match to swap the value, got %v, %v", ok, err)
+	}
+	if v, err := s.Version("balance"); err != nil || v <= before {
+		t.Errorf("expected a version above %d after a swap, got %d, %v", before, v, err)
+	}
+	if ok, err := s.CompareAndSet("missing", "", "x"); err != nil || ok {
+		t.Errorf("expected a missing key not to match, got %v, %v", ok, err)
+	}
+	if _, err := s.RPush("queue", []string{"a"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CompareAndSet("queue", "a", "b"); !errors.Is(err, engine.ErrWrongType) {
+		t.Errorf("expected error %v, got %v", engine.ErrWrongType, err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s = newTestStorage(t, dir)
+	//nolint:errcheck
+	defer s.Close()
+
+	if value, err := s.Get("balance"); err != nil || value != "20" {
+		t.Errorf("expected 20, got %q, %v", value, err)
+	}
+	if _, err := s.Get("missing"); !errors.Is(err, engine.ErrKeyNotFound) {
+		t.Errorf("expected error %v, got %v", engine.ErrKeyNotFound, err)
+	}
+}
@@ -0,0 +1,269 @@
+package wal
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+type ReplayStats struct {
+	SegmentsRead   int
+	RecordsApplied int
+	BytesDiscarded int64
+}
+
+// Replay feeds every record with LSN >= fromLSN to fn in log order. A torn
+// tail has already been truncated by NewWAL, so any corruption found here is
+// reported as an error.
+func (w *WAL) Replay(fromLSN uint64, fn func(Record) error) (ReplayStats, error) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	stats := ReplayStats{
+		SegmentsRead:   0,
+		RecordsApplied: 0,
+		BytesDiscarded: w.discardedBytes,
+	}
+
+	segments, err := listSegments(w.dir)
+	if err != nil {
+		return stats, err
+	}
+
+	expected := uint64(0)
+	for i, s := range segments {
+		if i+1 < len(segments) && segments[i+1].firstLSN <= fromLSN {
+			continue
+		}
+
+		if expected == 0 {
+			if s.firstLSN > fromLSN && s.firstLSN <= w.lastLSN {
+				return stats, fmt.Errorf("%w: segment %s starts at lsn %d, expected %d or earlier",
+					ErrCorruptedRecord, s.path, s.firstLSN, fromLSN)
+			}
+			expected = s.firstLSN
+		}
+
+		if s.firstLSN != expected {
+			return stats, fmt.Errorf("%w: segment %s starts at lsn %d, expected %d",
+				ErrCorruptedRecord, s.path, s.firstLSN, expected)
+		}
+
+		_, _, err := scanSegment(s.path, func(record Record) error {
+			if record.LSN != expected {
+				return fmt.Errorf("%w: unexpected lsn %d, expected %d", ErrCorruptedRecord, record.LSN, expected)
+			}
+			expected++
+
+			if record.LSN < fromLSN {
+				return nil
+			}
+
+			if err := fn(record); err != nil {
+				return err
+			}
+			stats.RecordsApplied++
+
+			return nil
+		})
+		if err != nil {
+			return stats, fmt.Errorf("failed to replay segment %s: %w", s.path, err)
+		}
+
+		stats.SegmentsRead++
+	}
+
+	return stats, nil
+}
+
+// RemoveSegmentsBefore deletes segments whose records all precede lsn. The
+// active segment is never removed.
+func (w *WAL) RemoveSegmentsBefore(lsn uint64) (int, error) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	segments, err := listSegments(w.dir)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for i := 0; i+1 < len(segments); i++ {
+		if segments[i+1].firstLSN > lsn {
+			break
+		}
+
+		if err := os.Remove(segments[i].path); err != nil {
+			return removed, fmt.Errorf("failed to remove wal segment: %w", err)
+		}
+		removed++
+	}
+
+	return removed, nil
+}
+
+// Reader follows the log from a given LSN across segment rotations. It keeps
+// its byte position so that repeated reads do not rescan the segment.
+type Reader struct {
+	wal      *WAL
+	nextLSN  uint64
+	segment  segment
+	offset   int64
+	position bool
+}
+
+func (w *WAL) NewReader(fromLSN uint64) *Reader {
+	//nolint:exhaustruct
+	return &Reader{
+		wal:     w,
+		nextLSN: fromLSN,
+	}
+}
+
+func (r *Reader) NextLSN() uint64 {
+	return r.nextLSN
+}
+
+// Read returns up to limit records starting at NextLSN. It returns
+// ErrCompacted when that position is no longer covered by any segment.
+func (r *Reader) Read(limit int) ([]Record, error) {
+	if !r.position {
+		if err := r.seek(); err != nil {
+			return nil, err
+		}
+	}
+
+	var records []Record
+	for len(records) < limit {
+		batch, err := r.readSegment(limit - len(records))
+		if err != nil {
+			return records, err
+		}
+		records = append(records, batch...)
+
+		if len(batch) > 0 {
+			continue
+		}
+
+		next, ok, err := r.nextSegment()
+		if err != nil || !ok {
+			return records, err
+		}
+		r.segment = next
+		r.offset = 0
+	}
+
+	return records, nil
+}
+
+func (r *Reader) seek() error {
+	segments, err := listSegments(r.wal.dir)
+	if err != nil {
+		return err
+	}
+
+	if len(segments) == 0 || r.nextLSN < segments[0].firstLSN {
+		return ErrCompacted
+	}
+
+	current := segments[0]
+	for _, s := range segments[1:] {
+		if s.firstLSN > r.nextLSN {
+			break
+		}
+		current = s
+	}
+
+	r.segment = current
+	r.offset = 0
+
+	err = r.iterate(func(record Record, n int) bool {
+		if record.LSN >= r.nextLSN {
+			return false
+		}
+		r.offset += int64(n)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	r.position = true
+	return nil
+}
+
+func (r *Reader) readSegment(limit int) ([]Record, error) {
+	var records []Record
+	var lsnErr error
+
+	err := r.iterate(func(record Record, n int) bool {
+		if record.LSN != r.nextLSN {
+			lsnErr = fmt.Errorf("%w: unexpected lsn %d, expected %d", ErrCorruptedRecord, record.LSN, r.nextLSN)
+			return false
+		}
+
+		records = append(records, record)
+		r.offset += int64(n)
+		r.nextLSN++
+
+		return len(records) < limit
+	})
+	if err != nil {
+		return records, err
+	}
+
+	return records, lsnErr
+}
+
+// iterate reads records from the current position until fn returns false or
+// the end of the written data is reached. A partially written frame at the end
+// of the segment is not an error: the writer may still be appending it.
+func (r *Reader) iterate(fn func(Record, int) bool) error {
+	//nolint:gosec
+	file, err := os.Open(r.segment.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			r.position = false
+			return ErrCompacted
+		}
+		return fmt.Errorf("failed to open wal segment: %w", err)
+	}
+	//nolint:errcheck
+	defer file.Close()
+
+	if _, err := file.Seek(r.offset, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek wal segment: %w", err)
+	}
+
+	reader := bufio.NewReader(file)
+	for {
+		record, n, err := readRecord(reader)
+		if err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, ErrTornRecord) {
+				return nil
+			}
+			return err
+		}
+
+		if !fn(record, n) {
+			return nil
+		}
+	}
+}
+
+func (r *Reader) nextSegment() (segment, bool, error) {
+	segments, err := listSegments(r.wal.dir)
+	if err != nil {
+		return segment{}, false, err
+	}
+
+	for _, s := range segments {
+		if s.firstLSN == r.nextLSN && s.path != r.segment.path {
+			return s, true, nil
+		}
+	}
+
+	return segment{}, false, nil
+}
@@ -0,0 +1,195 @@
+package wal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrCorruptedRecord = errors.New("corrupted wal record")
+	ErrTornRecord      = errors.New("torn wal record")
+)
+
+type Operation uint8
+
+const (
+	OperationSet Operation = iota + 1
+	OperationDel
+	// Records of the operations below carry deadlines as absolute Unix
+	// nanoseconds, so replaying them never extends the life of a key.
+	OperationSetWithDeadline
+	OperationExpire
+	OperationPersist
+	// OperationHSet, OperationSAdd and OperationZAdd carry the deadline of the
+	// value, or an empty argument if it does not expire, before the elements
+	// they add.
+	OperationHSet
+	OperationHDel
+	OperationSAdd
+	OperationSRem
+	OperationZAdd
+	OperationZRem
+	// OperationInsert carries the type of the value and, if the key expires,
+	// its deadline, so that a key moved between databases keeps both.
+	OperationInsert
+	// OperationPut stores a value of any type as is, like OperationInsert
+	// whether or not the key exists. Writes that change a value in place are
+	// logged as the value they leave.
+	OperationPut
+	OperationFlush
+	OperationCompareAndSet
+	// OperationMSet, OperationMSetNX and OperationDelKeys write several keys
+	// in one record, so that replaying the log applies all of them or none.
+	OperationMSet
+	OperationMSetNX
+	OperationDelKeys
+	// The operation here was a conditional SET that the cluster used to
+	// propose. Its number is kept so that later operations keep theirs.
+	_
+	// OperationBatch holds the records of the writes of a transaction, applied
+	// together in order.
+	OperationBatch
+)
+
+// MultiKey reports whether records of op write several keys.
+func (op Operation) MultiKey() bool {
+	return op == OperationMSet || op == OperationMSetNX || op == OperationDelKeys || op == OperationBatch
+}
+
+const (
+	recordHeaderSize = 8
+	maxRecordSize    = 64 << 20
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// FormatDeadline encodes a deadline as a record argument.
+func FormatDeadline(deadline time.Time) string {
+	return strconv.FormatInt(deadline.UnixNano(), 10)
+}
+
+func ParseDeadline(arg string) (time.Time, error) {
+	nanos, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: invalid deadline %q", ErrCorruptedRecord, arg)
+	}
+
+	return time.Unix(0, nanos), nil
+}
+
+type Record struct {
+	LSN       uint64
+	Operation Operation
+	Args      []string
+}
+
+func encodeRecord(record Record) []byte {
+	size := 8 + 1 + binary.MaxVarintLen64
+	for _, arg := range record.Args {
+		size += binary.MaxVarintLen64 + len(arg)
+	}
+
+	payload := make([]byte, 0, size)
+	payload = binary.BigEndian.AppendUint64(payload, record.LSN)
+	payload = append(payload, byte(record.Operation))
+	payload = binary.AppendUvarint(payload, uint64(len(record.Args)))
+	for _, arg := range record.Args {
+		payload = binary.AppendUvarint(payload, uint64(len(arg)))
+		payload = append(payload, arg...)
+	}
+
+	frame := make([]byte, recordHeaderSize+len(payload))
+	//nolint:gosec
+	binary.BigEndian.PutUint32(frame[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(frame[4:8], crc32.Checksum(payload, crcTable))
+	copy(frame[recordHeaderSize:], payload)
+
+	return frame
+}
+
+// readRecord returns io.EOF only when the reader ends exactly on a record
+// boundary; a partially written frame is reported as ErrTornRecord, and so is
+// a last frame that fails its checksum, as a write cut short may leave its
+// bytes in place without their contents. A bad frame followed by more data is
+// reported as ErrCorruptedRecord.
+func readRecord(r *bufio.Reader) (Record, int, error) {
+	header := make([]byte, recordHeaderSize)
+	n, err := io.ReadFull(r, header)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return Record{}, 0, io.EOF
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return Record{}, n, ErrTornRecord
+		}
+		return Record{}, n, err
+	}
+
+	length := binary.BigEndian.Uint32(header[0:4])
+	checksum := binary.BigEndian.Uint32(header[4:8])
+	if length > maxRecordSize {
+		return Record{}, n, fmt.Errorf("%w: record length %d", ErrCorruptedRecord, length)
+	}
+
+	payload := make([]byte, length)
+	m, err := io.ReadFull(r, payload)
+	n += m
+	if err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return Record{}, n, ErrTornRecord
+		}
+		return Record{}, n, err
+	}
+
+	if crc32.Checksum(payload, crcTable) != checksum {
+		if _, err := r.Peek(1); errors.Is(err, io.EOF) {
+			return Record{}, n, ErrTornRecord
+		}
+		return Record{}, n, fmt.Errorf("%w: checksum mismatch", ErrCorruptedRecord)
+	}
+
+	record, err := decodePayload(payload)
+	if err != nil {
+		return Record{}, n, err
+	}
+
+	return record, n, nil
+}
+
+func decodePayload(payload []byte) (Record, error) {
+	if len(payload) < 9 {
+		return Record{}, fmt.Errorf("%w: payload too short", ErrCorruptedRecord)
+	}
+
+	record := Record{
+		LSN:       binary.BigEndian.Uint64(payload[0:8]),
+		Operation: Operation(payload[8]),
+		Args:      nil,
+	}
+	payload = payload[9:]
+
+	count, n := binary.Uvarint(payload)
+	if n <= 0 || count > uint64(len(payload)) {
+		return Record{}, fmt.Errorf("%w: invalid argument count", ErrCorruptedRecord)
+	}
+	payload = payload[n:]
+
+	record.Args = make([]string, 0, count)
+	for range count {
+		length, n := binary.Uvarint(payload)
+		if n <= 0 || length > uint64(len(payload)-n) {
+			return Record{}, fmt.Errorf("%w: invalid argument length", ErrCorruptedRecord)
+		}
+		payload = payload[n:]
+		record.Args = append(record.Args, string(payload[:length]))
+		payload = payload[length:]
+	}
+
+	return record, nil
+}
@@ -0,0 +1,67 @@
+package wal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	segmentPrefix = "wal_"
+	segmentSuffix = ".log"
+)
+
+type segment struct {
+	firstLSN uint64
+	path     string
+}
+
+func segmentName(firstLSN uint64) string {
+	return fmt.Sprintf("%s%020d%s", segmentPrefix, firstLSN, segmentSuffix)
+}
+
+func parseSegmentName(name string) (uint64, bool) {
+	if !strings.HasPrefix(name, segmentPrefix) || !strings.HasSuffix(name, segmentSuffix) {
+		return 0, false
+	}
+
+	lsn, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, segmentPrefix), segmentSuffix), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return lsn, true
+}
+
+func listSegments(dir string) ([]segment, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read wal directory: %w", err)
+	}
+
+	segments := make([]segment, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		lsn, ok := parseSegmentName(entry.Name())
+		if !ok {
+			continue
+		}
+
+		segments = append(segments, segment{
+			firstLSN: lsn,
+			path:     filepath.Join(dir, entry.Name()),
+		})
+	}
+
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].firstLSN < segments[j].firstLSN
+	})
+
+	return segments, nil
+}
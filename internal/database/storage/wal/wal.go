@@ -0,0 +1,480 @@
+package wal
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/config"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrClosed             = errors.New("wal is closed")
+	ErrInvalidFlushPolicy = errors.New("invalid flush policy")
+	ErrOutOfOrder         = errors.New("wal record out of order")
+	ErrCompacted          = errors.New("wal position already compacted")
+)
+
+type FlushPolicy string
+
+const (
+	FlushAlways FlushPolicy = "always"
+	FlushBatch  FlushPolicy = "batch"
+	FlushOS     FlushPolicy = "os"
+)
+
+const (
+	defaultMaxSegmentSize = 10 << 20
+	defaultFlushPolicy    = FlushBatch
+	defaultFlushInterval  = 10 * time.Millisecond
+)
+
+type WAL struct {
+	dir            string
+	maxSegmentSize int64
+	flushPolicy    FlushPolicy
+	flushInterval  time.Duration
+	logger         *zap.Logger
+
+	mtx         sync.Mutex
+	cond        *sync.Cond
+	segment     *os.File
+	segmentSize int64
+	lastLSN     uint64
+	syncedLSN   uint64
+	syncing     bool
+	err         error
+	closed      bool
+
+	discardedBytes int64
+	notify         chan struct{}
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+func NewWAL(cfg *config.WALConfig, logger *zap.Logger) (*WAL, error) {
+	if cfg == nil {
+		return nil, errors.New("wal config is nil")
+	}
+
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	//nolint:exhaustruct
+	w := &WAL{
+		dir:            cfg.DataDirectory,
+		maxSegmentSize: cfg.MaxSegmentSize,
+		flushPolicy:    FlushPolicy(cfg.FlushPolicy),
+		flushInterval:  cfg.FlushInterval,
+		logger:         logger,
+		done:           make(chan struct{}),
+		notify:         make(chan struct{}),
+	}
+	w.cond = sync.NewCond(&w.mtx)
+
+	if w.maxSegmentSize <= 0 {
+		w.maxSegmentSize = defaultMaxSegmentSize
+	}
+	if w.flushPolicy == "" {
+		w.flushPolicy = defaultFlushPolicy
+	}
+	if w.flushInterval <= 0 {
+		w.flushInterval = defaultFlushInterval
+	}
+
+	switch w.flushPolicy {
+	case FlushAlways, FlushBatch, FlushOS:
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrInvalidFlushPolicy, w.flushPolicy)
+	}
+
+	//nolint:gosec
+	if err := os.MkdirAll(w.dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create wal directory: %w", err)
+	}
+
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+
+	if w.flushPolicy == FlushBatch {
+		w.wg.Add(1)
+		go w.flushLoop()
+	}
+
+	return w, nil
+}
+
+func (w *WAL) open() error {
+	segments, err := listSegments(w.dir)
+	if err != nil {
+		return err
+	}
+
+	if len(segments) == 0 {
+		return w.openSegment(1)
+	}
+
+	last := segments[len(segments)-1]
+	lastLSN := last.firstLSN - 1
+	offset, _, err := scanSegment(last.path, func(record Record) error {
+		lastLSN = record.LSN
+		return nil
+	})
+	if err != nil && !errors.Is(err, ErrTornRecord) {
+		return fmt.Errorf("failed to open wal segment %s: %w", last.path, err)
+	}
+
+	info, statErr := os.Stat(last.path)
+	if statErr != nil {
+		return fmt.Errorf("failed to stat wal segment: %w", statErr)
+	}
+
+	if info.Size() > offset {
+		w.logger.Warn(
+			"truncating torn wal record",
+			zap.String("segment", last.path),
+			zap.Int64("offset", offset),
+			zap.Int64("discarded_bytes", info.Size()-offset),
+			zap.Error(err),
+		)
+		if err := os.Truncate(last.path, offset); err != nil {
+			return fmt.Errorf("failed to truncate wal segment: %w", err)
+		}
+		w.discardedBytes = info.Size() - offset
+	}
+
+	//nolint:gosec
+	file, err := os.OpenFile(last.path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open wal segment: %w", err)
+	}
+
+	w.segment = file
+	w.segmentSize = offset
+	w.lastLSN = lastLSN
+	w.syncedLSN = lastLSN
+
+	return nil
+}
+
+func (w *WAL) openSegment(firstLSN uint64) error {
+	path := filepath.Join(w.dir, segmentName(firstLSN))
+
+	//nolint:gosec
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open wal segment: %w", err)
+	}
+
+	if err := syncDir(w.dir); err != nil {
+		//nolint:errcheck
+		file.Close()
+		return err
+	}
+
+	w.segment = file
+	w.segmentSize = 0
+
+	return nil
+}
+
+func (w *WAL) Append(op Operation, args ...string) (uint64, error) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	record := Record{
+		LSN:       w.lastLSN + 1,
+		Operation: op,
+		Args:      args,
+	}
+
+	if err := w.append(record); err != nil {
+		return 0, err
+	}
+
+	return record.LSN, nil
+}
+
+// AppendRecord writes a record that already carries its LSN, as received from
+// a replication leader. The LSN must directly follow the last one in the log.
+func (w *WAL) AppendRecord(record Record) error {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	if record.LSN != w.lastLSN+1 {
+		return fmt.Errorf("%w: got lsn %d, expected %d", ErrOutOfOrder, record.LSN, w.lastLSN+1)
+	}
+
+	return w.append(record)
+}
+
+func (w *WAL) append(record Record) error {
+	if w.closed {
+		return ErrClosed
+	}
+	if w.err != nil {
+		return w.err
+	}
+
+	frame := encodeRecord(record)
+
+	if w.segmentSize > 0 && w.segmentSize+int64(len(frame)) > w.maxSegmentSize {
+		if err := w.rotate(record.LSN); err != nil {
+			w.err = err
+			return err
+		}
+	}
+
+	if _, err := w.segment.Write(frame); err != nil {
+		w.err = fmt.Errorf("failed to write wal record: %w", err)
+		return w.err
+	}
+
+	w.segmentSize += int64(len(frame))
+	w.lastLSN = record.LSN
+
+	close(w.notify)
+	w.notify = make(chan struct{})
+
+	return nil
+}
+
+// Notify returns a channel that is closed once the log contains lsn.
+func (w *WAL) Notify(lsn uint64) <-chan struct{} {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	if w.lastLSN >= lsn {
+		ch := make(chan struct{})
+		close(ch)
+		return ch
+	}
+
+	return w.notify
+}
+
+// Reset discards every segment and restarts the log so that the next record
+// gets nextLSN. It is used after the state was replaced from a snapshot.
+func (w *WAL) Reset(nextLSN uint64) error {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	if w.closed {
+		return ErrClosed
+	}
+
+	for w.syncing {
+		w.cond.Wait()
+	}
+
+	if err := w.segment.Close(); err != nil {
+		return fmt.Errorf("failed to close wal segment: %w", err)
+	}
+
+	segments, err := listSegments(w.dir)
+	if err != nil {
+		return err
+	}
+	for _, s := range segments {
+		if err := os.Remove(s.path); err != nil {
+			return fmt.Errorf("failed to remove wal segment: %w", err)
+		}
+	}
+
+	if err := w.openSegment(nextLSN); err != nil {
+		w.err = err
+		return err
+	}
+
+	w.err = nil
+	w.lastLSN = nextLSN - 1
+	w.syncedLSN = w.lastLSN
+	w.cond.Broadcast()
+
+	return nil
+}
+
+func (w *WAL) rotate(firstLSN uint64) error {
+	for w.syncing {
+		w.cond.Wait()
+	}
+
+	if err := w.segment.Sync(); err != nil {
+		return fmt.Errorf("failed to sync wal segment: %w", err)
+	}
+	if err := w.segment.Close(); err != nil {
+		return fmt.Errorf("failed to close wal segment: %w", err)
+	}
+
+	w.syncedLSN = w.lastLSN
+	w.cond.Broadcast()
+
+	return w.openSegment(firstLSN)
+}
+
+// Sync blocks until the record with the given LSN is durable according to
+// the configured flush policy.
+func (w *WAL) Sync(lsn uint64) error {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	switch w.flushPolicy {
+	case FlushOS:
+		return w.err
+	case FlushAlways:
+		for w.syncedLSN < lsn && w.err == nil {
+			if w.syncing {
+				w.cond.Wait()
+				continue
+			}
+			w.flush()
+		}
+	case FlushBatch:
+		for w.syncedLSN < lsn && w.err == nil && !w.closed {
+			w.cond.Wait()
+		}
+	}
+
+	if w.syncedLSN < lsn && w.err == nil {
+		return ErrClosed
+	}
+
+	return w.err
+}
+
+// flush must be called with mtx held; the lock is released while fsync runs
+// so that appends can continue filling the next batch.
+func (w *WAL) flush() {
+	if w.syncing || w.segment == nil || w.syncedLSN == w.lastLSN {
+		return
+	}
+
+	w.syncing = true
+	target := w.lastLSN
+	segment := w.segment
+
+	w.mtx.Unlock()
+	err := segment.Sync()
+	w.mtx.Lock()
+
+	w.syncing = false
+	if err != nil {
+		w.err = fmt.Errorf("failed to sync wal segment: %w", err)
+		w.logger.Error("failed to sync wal", zap.Error(err))
+	} else if target > w.syncedLSN {
+		w.syncedLSN = target
+	}
+
+	w.cond.Broadcast()
+}
+
+func (w *WAL) flushLoop() {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(w.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			w.mtx.Lock()
+			w.flush()
+			w.mtx.Unlock()
+		}
+	}
+}
+
+func (w *WAL) LastLSN() uint64 {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	return w.lastLSN
+}
+
+func (w *WAL) Close() error {
+	w.mtx.Lock()
+	if w.closed {
+		w.mtx.Unlock()
+		return nil
+	}
+	w.closed = true
+	w.mtx.Unlock()
+
+	close(w.done)
+	w.wg.Wait()
+
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	for w.syncing {
+		w.cond.Wait()
+	}
+
+	var err error
+	if w.err == nil {
+		if err = w.segment.Sync(); err == nil {
+			w.syncedLSN = w.lastLSN
+		}
+	}
+	w.cond.Broadcast()
+
+	return errors.Join(err, w.segment.Close())
+}
+
+func scanSegment(path string, fn func(Record) error) (int64, int, error) {
+	//nolint:gosec
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to open wal segment: %w", err)
+	}
+	//nolint:errcheck
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+
+	var offset int64
+	var count int
+	for {
+		record, n, err := readRecord(reader)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return offset, count, nil
+			}
+			return offset, count, err
+		}
+
+		if err := fn(record); err != nil {
+			return offset, count, err
+		}
+
+		offset += int64(n)
+		count++
+	}
+}
+
+func syncDir(dir string) error {
+	//nolint:gosec
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open wal directory: %w", err)
+	}
+	//nolint:errcheck
+	defer d.Close()
+
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("failed to sync wal directory: %w", err)
+	}
+
+	return nil
+}
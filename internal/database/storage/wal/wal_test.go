@@ -0,0 +1,462 @@
+//nolint:exhaustruct
+package wal
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/crunchydeer30/key-value-database/internal/config"
+	"go.uber.org/zap"
+)
+
+func newTestWAL(t *testing.T, cfg *config.WALConfig) *WAL {
+	t.Helper()
+
+	w, err := NewWAL(cfg, zap.NewNop())
+	if err != nil {
+		t.Fatalf("failed to create wal: %v", err)
+	}
+
+	return w
+}
+
+func readAll(t *testing.T, dir string) []Record {
+	t.Helper()
+
+	segments, err := listSegments(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var records []Record
+	for _, s := range segments {
+		_, _, err := scanSegment(s.path, func(record Record) error {
+			records = append(records, record)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("failed to scan segment %s: %v", s.path, err)
+		}
+	}
+
+	return records
+}
+
+func TestWAL_AppendAndReopen(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.WALConfig{DataDirectory: dir, FlushPolicy: string(FlushAlways)}
+
+	w := newTestWAL(t, cfg)
+	for _, args := range [][]string{{"key1", "value1"}, {"key2", "value 2"}} {
+		lsn, err := w.Append(OperationSet, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Sync(lsn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := w.Append(OperationDel, "key1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	w = newTestWAL(t, cfg)
+	//nolint:errcheck
+	defer w.Close()
+
+	if w.LastLSN() != 3 {
+		t.Fatalf("expected last lsn 3 after reopen, got %d", w.LastLSN())
+	}
+
+	lsn, err := w.Append(OperationSet, "key3", "value3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lsn != 4 {
+		t.Errorf("expected lsn 4, got %d", lsn)
+	}
+	if err := w.Sync(lsn); err != nil {
+		t.Fatal(err)
+	}
+
+	records := readAll(t, dir)
+	if len(records) != 4 {
+		t.Fatalf("expected 4 records, got %d", len(records))
+	}
+
+	for i, record := range records {
+		if record.LSN != uint64(i+1) {
+			t.Errorf("record %d: expected lsn %d, got %d", i, i+1, record.LSN)
+		}
+	}
+
+	if records[1].Args[1] != "value 2" {
+		t.Errorf("expected value %q, got %q", "value 2", records[1].Args[1])
+	}
+	if records[2].Operation != OperationDel || len(records[2].Args) != 1 {
+		t.Errorf("expected DEL record with one arg, got %+v", records[2])
+	}
+}
+
+func TestWAL_SegmentRotation(t *testing.T) {
+	dir := t.TempDir()
+	w := newTestWAL(t, &config.WALConfig{
+		DataDirectory:  dir,
+		MaxSegmentSize: 64,
+		FlushPolicy:    string(FlushOS),
+	})
+
+	for range 10 {
+		if _, err := w.Append(OperationSet, "key", "some value that fills the segment"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	segments, err := listSegments(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 10 {
+		t.Fatalf("expected 10 segments, got %d", len(segments))
+	}
+
+	for i, s := range segments {
+		if s.firstLSN != uint64(i+1) {
+			t.Errorf("segment %d: expected first lsn %d, got %d", i, i+1, s.firstLSN)
+		}
+	}
+
+	if records := readAll(t, dir); len(records) != 10 {
+		t.Errorf("expected 10 records, got %d", len(records))
+	}
+}
+
+func TestWAL_FlushPolicies(t *testing.T) {
+	for _, policy := range []FlushPolicy{FlushAlways, FlushBatch, FlushOS} {
+		t.Run(string(policy), func(t *testing.T) {
+			dir := t.TempDir()
+			w := newTestWAL(t, &config.WALConfig{
+				DataDirectory: dir,
+				FlushPolicy:   string(policy),
+				FlushInterval: time.Millisecond,
+			})
+
+			var wg sync.WaitGroup
+			errs := make(chan error, 50)
+			for range 50 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					lsn, err := w.Append(OperationSet, "key", "value")
+					if err == nil {
+						err = w.Sync(lsn)
+					}
+					errs <- err
+				}()
+			}
+			wg.Wait()
+			close(errs)
+
+			for err := range errs {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if records := readAll(t, dir); len(records) != 50 {
+				t.Errorf("expected 50 records, got %d", len(records))
+			}
+		})
+	}
+}
+
+func TestWAL_AppendAfterClose(t *testing.T) {
+	w := newTestWAL(t, &config.WALConfig{DataDirectory: t.TempDir()})
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := w.Append(OperationSet, "key", "value"); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected error %v, got %v", ErrClosed, err)
+	}
+}
+
+func TestWAL_InvalidFlushPolicy(t *testing.T) {
+	_, err := NewWAL(&config.WALConfig{DataDirectory: t.TempDir(), FlushPolicy: "never"}, nil)
+	if !errors.Is(err, ErrInvalidFlushPolicy) {
+		t.Errorf("expected error %v, got %v", ErrInvalidFlushPolicy, err)
+	}
+}
+
+func corruptedRecord() []byte {
+	frame := encodeRecord(Record{LSN: 2, Operation: OperationDel, Args: []string{"key"}})
+	frame[len(frame)-1] ^= 0xff
+	return frame
+}
+
+func TestWAL_TruncatesTornTail(t *testing.T) {
+	for name, garbage := range map[string][]byte{
+		"partial header":    {0, 0, 0, 42, 1, 2},
+		"partial payload":   {0, 0, 0, 42, 1, 2, 3, 4, 5, 6},
+		"checksum mismatch": corruptedRecord(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			cfg := &config.WALConfig{DataDirectory: dir, FlushPolicy: string(FlushOS)}
+
+			w := newTestWAL(t, cfg)
+			if _, err := w.Append(OperationSet, "key", "value"); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			segments, err := listSegments(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			info, err := os.Stat(segments[0].path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			validSize := info.Size()
+
+			//nolint:gosec
+			f, err := os.OpenFile(segments[0].path, os.O_APPEND|os.O_WRONLY, 0o644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := f.Write(garbage); err != nil {
+				t.Fatal(err)
+			}
+			if err := f.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			w = newTestWAL(t, cfg)
+			//nolint:errcheck
+			defer w.Close()
+
+			if w.LastLSN() != 1 {
+				t.Errorf("expected last lsn 1, got %d", w.LastLSN())
+			}
+
+			var records []Record
+			stats, err := w.Replay(1, func(record Record) error {
+				records = append(records, record)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("unexpected replay error: %v", err)
+			}
+
+			if stats.RecordsApplied != 1 || len(records) != 1 {
+				t.Errorf("expected 1 record applied, got %d", stats.RecordsApplied)
+			}
+			if stats.BytesDiscarded != int64(len(garbage)) {
+				t.Errorf("expected %d bytes discarded, got %d", len(garbage), stats.BytesDiscarded)
+			}
+
+			info, err = os.Stat(segments[0].path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Size() != validSize {
+				t.Errorf("expected segment size %d after truncation, got %d", validSize, info.Size())
+			}
+
+			lsn, err := w.Append(OperationDel, "key")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if lsn != 2 {
+				t.Errorf("expected lsn 2, got %d", lsn)
+			}
+		})
+	}
+}
+
+func TestWAL_FailsOnCorruptionBeforeTail(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.WALConfig{DataDirectory: dir, FlushPolicy: string(FlushOS)}
+
+	w := newTestWAL(t, cfg)
+	if _, err := w.Append(OperationSet, "key", "value"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	segments, err := listSegments(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//nolint:gosec
+	f, err := os.OpenFile(segments[0].path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := encodeRecord(Record{LSN: 3, Operation: OperationDel, Args: []string{"key"}})
+	if _, err := f.Write(append(corruptedRecord(), valid...)); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(segments[0].path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewWAL(cfg, zap.NewNop()); !errors.Is(err, ErrCorruptedRecord) {
+		t.Fatalf("expected error %v, got %v", ErrCorruptedRecord, err)
+	}
+
+	after, err := os.Stat(segments[0].path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Size() != info.Size() {
+		t.Errorf("expected segment to be left at %d bytes, got %d", info.Size(), after.Size())
+	}
+}
+
+func TestWAL_Replay(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.WALConfig{DataDirectory: dir, MaxSegmentSize: 64, FlushPolicy: string(FlushOS)}
+
+	w := newTestWAL(t, cfg)
+	for range 5 {
+		if _, err := w.Append(OperationSet, "key", "some value that fills the segment"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	w = newTestWAL(t, cfg)
+	//nolint:errcheck
+	defer w.Close()
+
+	var lsns []uint64
+	stats, err := w.Replay(3, func(record Record) error {
+		lsns = append(lsns, record.LSN)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(lsns) != 3 || lsns[0] != 3 || lsns[2] != 5 {
+		t.Errorf("expected lsns [3 4 5], got %v", lsns)
+	}
+	if stats.SegmentsRead != 3 {
+		t.Errorf("expected 3 segments read, got %d", stats.SegmentsRead)
+	}
+}
+
+func TestWAL_ReplayMissingSegment(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.WALConfig{DataDirectory: dir, MaxSegmentSize: 64, FlushPolicy: string(FlushOS)}
+
+	w := newTestWAL(t, cfg)
+	for range 3 {
+		if _, err := w.Append(OperationSet, "key", "some value that fills the segment"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	segments, err := listSegments(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(segments[1].path); err != nil {
+		t.Fatal(err)
+	}
+
+	w = newTestWAL(t, cfg)
+	//nolint:errcheck
+	defer w.Close()
+
+	_, err = w.Replay(1, func(Record) error { return nil })
+	if !errors.Is(err, ErrCorruptedRecord) {
+		t.Errorf("expected error %v, got %v", ErrCorruptedRecord, err)
+	}
+}
+
+func TestReader_FollowsLogAcrossSegments(t *testing.T) {
+	dir := t.TempDir()
+	w := newTestWAL(t, &config.WALConfig{DataDirectory: dir, MaxSegmentSize: 64, FlushPolicy: string(FlushOS)})
+	//nolint:errcheck
+	defer w.Close()
+
+	for range 3 {
+		if _, err := w.Append(OperationSet, "key", "some value that fills the segment"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reader := w.NewReader(2)
+	records, err := reader.Read(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].LSN != 2 || records[1].LSN != 3 {
+		t.Fatalf("expected records [2 3], got %+v", records)
+	}
+
+	records, err = reader.Read(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 0 {
+		t.Fatalf("expected no new records, got %d", len(records))
+	}
+
+	select {
+	case <-w.Notify(4):
+		t.Fatal("expected notify channel to block until lsn 4 is written")
+	default:
+	}
+
+	if _, err := w.Append(OperationDel, "key"); err != nil {
+		t.Fatal(err)
+	}
+	<-w.Notify(4)
+
+	records, err = reader.Read(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].LSN != 4 {
+		t.Fatalf("expected record 4, got %+v", records)
+	}
+
+	if _, err := w.RemoveSegmentsBefore(4); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.NewReader(1).Read(10); !errors.Is(err, ErrCompacted) {
+		t.Errorf("expected error %v, got %v", ErrCompacted, err)
+	}
+}
@@ -0,0 +1,260 @@
+package storage
+
+import "math/rand/v2"
+
+// A node is promoted to the next level with probability 1/4, like in the
+// skiplist of the ordered engine.
+const (
+	zsetMaxLevel    = 32
+	zsetLevelFactor = 4
+)
+
+// ScoredMember is a member of a sorted set along with its score.
+type ScoredMember struct {
+	Member string
+	Score  float64
+}
+
+type zsetNode struct {
+	ScoredMember
+	next []zsetLink
+}
+
+// zsetLink points to the next node on a level. span counts the nodes it skips
+// on the bottom level, the target included, which is what ranks are made of.
+type zsetLink struct {
+	node *zsetNode
+	span int
+}
+
+// zset is a sorted set: a skiplist ordered by score, then by member, and a
+// map from members to scores. Together they find, insert, remove and rank a
+// member in O(log n). It is also the object sorted sets are kept as, and size
+// tracks the length of the encoded set as members change.
+type zset struct {
+	scores map[string]float64
+	head   *zsetNode
+	level  int
+	size   int
+}
+
+func newZSet() *zset {
+	return &zset{
+		scores: make(map[string]float64),
+		head:   &zsetNode{ScoredMember: ScoredMember{Member: "", Score: 0}, next: make([]zsetLink, zsetMaxLevel)},
+		level:  1,
+		size:   0,
+	}
+}
+
+func (z *zset) Encode() []byte {
+	buf := make([]byte, 0, z.size)
+	for n := z.head.next[0].node; n != nil; n = n.next[0].node {
+		buf = appendElement(buf, n.Member)
+		buf = appendElement(buf, FormatFloat(n.Score))
+	}
+
+	return buf
+}
+
+func (z *zset) Size() int {
+	return z.size
+}
+
+func zsetRandomLevel() int {
+	level := 1
+	for level < zsetMaxLevel && rand.IntN(zsetLevelFactor) == 0 {
+		level++
+	}
+
+	return level
+}
+
+// before reports whether n sorts before the given score and member.
+func (n *zsetNode) before(score float64, member string) bool {
+	return n.Score < score || n.Score == score && n.Member < member
+}
+
+func (z *zset) len() int {
+	return len(z.scores)
+}
+
+func (z *zset) score(member string) (float64, bool) {
+	score, ok := z.scores[member]
+	return score, ok
+}
+
+// add sets the score of member and reports whether it is new.
+func (z *zset) add(member string, score float64) bool {
+	old, ok := z.scores[member]
+	if ok {
+		if old == score {
+			return false
+		}
+		z.unlink(member, old)
+		z.size -= encodedLen(FormatFloat(old))
+	} else {
+		z.size += encodedLen(member)
+	}
+
+	z.scores[member] = score
+	z.link(member, score)
+	z.size += encodedLen(FormatFloat(score))
+
+	return !ok
+}
+
+// remove deletes member and reports whether it was there.
+func (z *zset) remove(member string) bool {
+	score, ok := z.scores[member]
+	if !ok {
+		return false
+	}
+
+	delete(z.scores, member)
+	z.unlink(member, score)
+	z.size -= encodedLen(member) + encodedLen(FormatFloat(score))
+
+	return true
+}
+
+func (z *zset) link(member string, score float64) {
+	var update [zsetMaxLevel]*zsetNode
+	var rank [zsetMaxLevel]int
+
+	n := z.head
+	for level := z.level - 1; level >= 0; level-- {
+		if level < z.level-1 {
+			rank[level] = rank[level+1]
+		}
+		for next := n.next[level]; next.node != nil && next.node.before(score, member); next = n.next[level] {
+			rank[level] += next.span
+			n = next.node
+		}
+		update[level] = n
+	}
+
+	level := zsetRandomLevel()
+	for ; z.level < level; z.level++ {
+		update[z.level] = z.head
+		z.head.next[z.level].span = len(z.scores) - 1
+	}
+
+	node := &zsetNode{ScoredMember: ScoredMember{Member: member, Score: score}, next: make([]zsetLink, level)}
+	for i := range level {
+		prev := &update[i].next[i]
+		node.next[i] = zsetLink{node: prev.node, span: prev.span - (rank[0] - rank[i])}
+		*prev = zsetLink{node: node, span: rank[0] - rank[i] + 1}
+	}
+
+	for i := level; i < z.level; i++ {
+		update[i].next[i].span++
+	}
+}
+
+func (z *zset) unlink(member string, score float64) {
+	var update [zsetMaxLevel]*zsetNode
+
+	n := z.head
+	for level := z.level - 1; level >= 0; level-- {
+		for next := n.next[level]; next.node != nil && next.node.before(score, member); next = n.next[level] {
+			n = next.node
+		}
+		update[level] = n
+	}
+
+	node := n.next[0].node
+	for i := range z.level {
+		prev := &update[i].next[i]
+		if prev.node == node {
+			prev.span += node.next[i].span - 1
+			prev.node = node.next[i].node
+		} else {
+			prev.span--
+		}
+	}
+
+	for z.level > 1 && z.head.next[z.level-1].node == nil {
+		z.level--
+	}
+}
+
+// rank returns the 0-based position of member in the set.
+func (z *zset) rank(member string) (int, bool) {
+	score, ok := z.scores[member]
+	if !ok {
+		return 0, false
+	}
+
+	rank := 0
+	n := z.head
+	for level := z.level - 1; level >= 0; level-- {
+		for next := n.next[level]; next.node != nil && !(score < next.node.Score || score == next.node.Score && member < next.node.Member); next = n.next[level] {
+			rank += next.span
+			n = next.node
+		}
+	}
+
+	return rank - 1, true
+}
+
+// byRank returns the node at a 0-based position, which must be in range.
+func (z *zset) byRank(rank int) *zsetNode {
+	traversed := 0
+	n := z.head
+	for level := z.level - 1; level >= 0; level-- {
+		for next := n.next[level]; next.node != nil && traversed+next.span <= rank+1; next = n.next[level] {
+			traversed += next.span
+			n = next.node
+		}
+		if traversed == rank+1 {
+			return n
+		}
+	}
+
+	return nil
+}
+
+// rangeByRank returns the members between start and stop, both inclusive.
+// Negative positions count from the end.
+func (z *zset) rangeByRank(start, stop int) []ScoredMember {
+	from, to, ok := listBounds(start, stop, z.len())
+	if !ok {
+		return nil
+	}
+
+	members := make([]ScoredMember, 0, to-from+1)
+	for n := z.byRank(from); n != nil && len(members) < to-from+1; n = n.next[0].node {
+		members = append(members, n.ScoredMember)
+	}
+
+	return members
+}
+
+// rangeByScore returns the members with scores between minScore and maxScore,
+// both inclusive.
+func (z *zset) rangeByScore(minScore, maxScore float64) []ScoredMember {
+	n := z.head
+	for level := z.level - 1; level >= 0; level-- {
+		for next := n.next[level]; next.node != nil && next.node.Score < minScore; next = n.next[level] {
+			n = next.node
+		}
+	}
+
+	var members []ScoredMember
+	for n = n.next[0].node; n != nil && n.Score <= maxScore; n = n.next[0].node {
+		members = append(members, n.ScoredMember)
+	}
+
+	return members
+}
+
+// all returns every member in order.
+func (z *zset) all() []ScoredMember {
+	members := make([]ScoredMember, 0, z.len())
+	for n := z.head.next[0].node; n != nil; n = n.next[0].node {
+		members = append(members, n.ScoredMember)
+	}
+
+	return members
+}
@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"cmp"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestZSet_MatchesSortedSlice(t *testing.T) {
+	z := newZSet()
+	scores := make(map[string]float64)
+	rng := rand.New(rand.NewPCG(1, 2))
+
+	sorted := func() []ScoredMember {
+		members := make([]ScoredMember, 0, len(scores))
+		for member, score := range scores {
+			members = append(members, ScoredMember{Member: member, Score: score})
+		}
+		slices.SortFunc(members, func(a, b ScoredMember) int {
+			return cmp.Or(cmp.Compare(a.Score, b.Score), strings.Compare(a.Member, b.Member))
+		})
+		return members
+	}
+
+	for i := range 5000 {
+		member := "m" + strconv.Itoa(rng.IntN(300))
+		switch rng.IntN(3) {
+		case 0, 1:
+			score := float64(rng.IntN(50))
+			_, exists := scores[member]
+			if added := z.add(member, score); added == exists {
+				t.Fatalf("step %d: add(%s) reported %v", i, member, added)
+			}
+			scores[member] = score
+		default:
+			_, exists := scores[member]
+			if removed := z.remove(member); removed != exists {
+				t.Fatalf("step %d: remove(%s) reported %v", i, member, removed)
+			}
+			delete(scores, member)
+		}
+
+		if i%250 != 0 {
+			continue
+		}
+
+		want := sorted()
+		if got := z.all(); !slices.Equal(got, want) {
+			t.Fatalf("step %d: expected %v, got %v", i, want, got)
+		}
+		if encoded := z.Encode(); len(encoded) != z.Size() {
+			t.Fatalf("step %d: expected %d encoded bytes, got %d", i, z.Size(), len(encoded))
+		}
+		for rank, member := range want {
+			if got, ok := z.rank(member.Member); !ok || got != rank {
+				t.Fatalf("step %d: expected rank %d for %s, got %d", i, rank, member.Member, got)
+			}
+		}
+		if len(want) > 10 {
+			if got := z.rangeByRank(3, -4); !slices.Equal(got, want[3:len(want)-3]) {
+				t.Fatalf("step %d: expected range %v, got %v", i, want[3:len(want)-3], got)
+			}
+		}
+
+		var byScore []ScoredMember
+		for _, member := range want {
+			if member.Score >= 10 && member.Score <= 20 {
+				byScore = append(byScore, member)
+			}
+		}
+		if got := z.rangeByScore(10, 20); !slices.Equal(got, byScore) {
+			t.Fatalf("step %d: expected %v, got %v", i, byScore, got)
+		}
+	}
+}
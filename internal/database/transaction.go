@@ -0,0 +1,164 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/compute"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage"
+	"go.uber.org/zap"
+)
+
+const replyQueued = "queued"
+
+var (
+	ErrNestedMulti         = errors.New("MULTI calls can not be nested")
+	ErrExecWithoutMulti    = errors.New("EXEC without MULTI")
+	ErrDiscardWithoutMulti = errors.New("DISCARD without MULTI")
+	ErrTransactionAborted  = errors.New("transaction discarded because of previous errors")
+)
+
+// transaction holds the queries queued between MULTI and EXEC. A query that
+// fails to parse aborts the transaction, and EXEC then runs none of them.
+type transaction struct {
+	queries []*compute.Query
+	aborted bool
+}
+
+func (s *Session) handleMultiQuery() string {
+	if s.tx != nil {
+		return fmt.Sprintf("error: %s", ErrNestedMulti.Error())
+	}
+
+	s.tx = &transaction{queries: nil, aborted: false}
+	return "ok"
+}
+
+func (s *Session) handleDiscardQuery() string {
+	if s.tx == nil {
+		return fmt.Sprintf("error: %s", ErrDiscardWithoutMulti.Error())
+	}
+
+	s.tx = nil
+	s.watches = nil
+	return "ok"
+}
+
+// handleExecQuery runs the queued queries one after the other while holding
+// every key they touch, so that no other query sees or changes those keys
+// halfway through. The reply is the array of their replies. A query that
+// fails does not stop the ones after it; its error is its result. The writes
+// are made on a batch of each database they touch and logged, or proposed in
+// cluster mode, as one record per database once every query has run, so that
+// recovery applies all of them or none. If a watched key has changed,
+// nothing runs and the reply is nil.
+func (s *Session) handleExecQuery(query *compute.Query) string {
+	tx := s.tx
+	if tx == nil {
+		return fmt.Sprintf("error: %s", ErrExecWithoutMulti.Error())
+	}
+	s.tx = nil
+
+	watched := s.watchedKeys()
+	defer func() { s.watches = nil }()
+
+	if tx.aborted {
+		return fmt.Sprintf("error: %s", ErrTransactionAborted.Error())
+	}
+
+	writes := slices.ContainsFunc(tx.queries, func(query *compute.Query) bool {
+		return isWrite(query.Command)
+	})
+	if writes && s.db.cluster != nil && !s.db.cluster.IsLeader() {
+		return s.db.redirect()
+	}
+
+	unlock := s.db.lock(tx.queries, watched, false)
+	defer unlock()
+
+	changed, err := s.watchesChanged()
+	if err != nil {
+		s.db.logger.Error("failed to check watched keys", zap.Error(err))
+		return fmt.Sprintf("error: %s", err.Error())
+	}
+	if changed {
+		return replyNil
+	}
+
+	if writes {
+		s.batches = &batches{of: make(map[*storage.Storage]*storage.Storage), parents: nil}
+		defer func() { s.batches = nil }()
+	}
+
+	results := make([]string, 0, len(tx.queries))
+	for _, query := range tx.queries {
+		results = append(results, s.execute(query))
+	}
+
+	if writes {
+		if err := s.batches.commit(s.db.writeOptions(query)); err != nil {
+			return s.db.writeFailure(err, "failed to commit transaction")
+		}
+	}
+
+	return compute.ArrayReply(results...)
+}
+
+// batches holds the batch of every database a transaction uses, in the order
+// it first used them. SWAPDB and the databases a transaction does not use are
+// left out of them.
+type batches struct {
+	of      map[*storage.Storage]*storage.Storage
+	parents []*storage.Storage
+}
+
+// get returns the batch of db, beginning it on first use.
+func (b *batches) get(db *storage.Storage) (*storage.Storage, error) {
+	if batch, ok := b.of[db]; ok {
+		return batch, nil
+	}
+
+	batch, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	b.of[db] = batch
+	b.parents = append(b.parents, db)
+
+	return batch, nil
+}
+
+// commit commits every batch, one database after the other.
+func (b *batches) commit(opts []storage.WriteOption) error {
+	for _, db := range b.parents {
+		if err := b.of[db].Commit(opts...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// lock locks keys along with the keys of queries, or every key if one of the
+// queries may touch any. Queries outside of transactions lock their keys
+// shared, which only keeps them from running in the middle of a transaction.
+func (d *Database) lock(queries []*compute.Query, keys []string, shared bool) func() {
+	for _, query := range queries {
+		queryKeys, ok := query.Keys()
+		if !ok {
+			if shared {
+				return d.locks.RLockAll()
+			}
+			return d.locks.LockAll()
+		}
+		keys = append(keys, queryKeys...)
+	}
+
+	if shared {
+		return d.locks.RLock(keys)
+	}
+
+	return d.locks.Lock(keys)
+}
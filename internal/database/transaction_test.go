@@ -0,0 +1,106 @@
+package database
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/compute"
+)
+
+func TestDatabase_Transactions(t *testing.T) {
+	db := newTestDatabase(t)
+	session, other := db.NewSession(), db.NewSession()
+
+	steps := []struct {
+		session *Session
+		query   string
+		want    string
+	}{
+		{session, "EXEC", "error: EXEC without MULTI"},
+		{session, "DISCARD", "error: DISCARD without MULTI"},
+		{session, "MULTI", "ok"},
+		{session, "MULTI", "error: MULTI calls can not be nested"},
+		{session, "SET name alice", "queued"},
+		{session, "RPUSH queue a b", "queued"},
+		{session, "LPUSH name x", "queued"},
+		{session, "GET name", "queued"},
+		{other, "GET name", `record with key "name" not found`},
+		{session, "EXEC", compute.ArrayReply("ok", "2", "error: WRONGTYPE operation against a key holding the wrong kind of value", "alice")},
+		{session, "EXEC", "error: EXEC without MULTI"},
+		{session, "MULTI", "ok"},
+		{session, "SET name bob", "queued"},
+		{session, "DISCARD", "ok"},
+		{session, "GET name", "alice"},
+		{session, "MULTI", "ok"},
+		{session, "SET name bob", "queued"},
+		{session, "SET name", "invalid query: invalid number of args"},
+		{session, "EXEC", "error: transaction discarded because of previous errors"},
+		{session, "GET name", "alice"},
+		{session, "MULTI", "ok"},
+		{session, "EXEC", compute.ArrayReply()},
+	}
+
+	for _, step := range steps {
+		if got := step.session.HandleQueryString(step.query); got != step.want {
+			t.Fatalf("%s: expected %q, got %q", step.query, step.want, got)
+		}
+	}
+}
+
+func TestDatabase_TransactionsAreIsolated(t *testing.T) {
+	db := newTestDatabase(t)
+	db.HandleQueryString("SET credit 0")
+	db.HandleQueryString("SET debit 0")
+
+	run := func(session *Session, queries ...string) string {
+		for _, query := range append([]string{"MULTI"}, queries...) {
+			session.HandleQueryString(query)
+		}
+		return session.HandleQueryString("EXEC")
+	}
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			session := db.NewSession()
+			for range 500 {
+				run(session, "INCR credit", "DECR debit")
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	session := db.NewSession()
+	for {
+		reply := run(session, "GET credit", "GET debit")
+
+		var sum int
+		for _, result := range decodeReply(t, reply) {
+			n, err := strconv.Atoi(result.Text)
+			if err != nil {
+				t.Fatalf("unexpected reply %q", reply)
+			}
+			sum += n
+		}
+		if sum != 0 {
+			t.Fatalf("transaction observed a partial transaction: %q", reply)
+		}
+
+		select {
+		case <-done:
+			if got := db.HandleQueryString("GET credit"); got != "2000" {
+				t.Errorf("expected 2000, got %q", got)
+			}
+			return
+		default:
+		}
+	}
+}
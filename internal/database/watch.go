@@ -0,0 +1,113 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/crunchydeer30/key-value-database/internal/database/compute"
+	"github.com/crunchydeer30/key-value-database/internal/database/storage"
+	"go.uber.org/zap"
+)
+
+var ErrWatchInsideMulti = errors.New("WATCH inside MULTI is not allowed")
+
+// watch remembers the version a key had when the session watched it, along
+// with the database the key was watched in. EXEC runs nothing if the key has
+// changed since, or if the database has been swapped away. Deletions change
+// versions too, so a key created and deleted again in between is seen as
+// changed.
+type watch struct {
+	index   int
+	storage *storage.Storage
+	key     string
+	version uint64
+}
+
+func (s *Session) handleWatchQuery(query *compute.Query) string {
+	if s.tx != nil {
+		return fmt.Sprintf("error: %s", ErrWatchInsideMulti.Error())
+	}
+
+	selected, err := s.db.dbs.get(s.selected)
+	if err != nil {
+		return fmt.Sprintf("error: %s", err.Error())
+	}
+
+	unlock := s.db.lock([]*compute.Query{query}, nil, true)
+	defer unlock()
+
+	watches := make([]watch, 0, len(query.Args))
+	for _, key := range query.Args {
+		version, err := selected.Version(key)
+		if err != nil {
+			s.db.logger.Error("failed to get version", zap.String("key", key), zap.Error(err))
+			return fmt.Sprintf("error: %s", err.Error())
+		}
+		watches = append(watches, watch{index: s.selected, storage: selected, key: key, version: version})
+	}
+
+	s.watches = append(s.watches, watches...)
+	return "ok"
+}
+
+func (s *Session) watchedKeys() []string {
+	keys := make([]string, 0, len(s.watches))
+	for _, w := range s.watches {
+		keys = append(keys, w.key)
+	}
+
+	return keys
+}
+
+// watchesChanged reports whether any watched key has changed. The keys must
+// be locked.
+func (s *Session) watchesChanged() (bool, error) {
+	for _, w := range s.watches {
+		current, err := s.db.dbs.get(w.index)
+		if err != nil {
+			return false, err
+		}
+		if current != w.storage {
+			return true, nil
+		}
+
+		version, err := current.Version(w.key)
+		if err != nil {
+			return false, err
+		}
+		if version != w.version {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (d *Database) handleVersionQuery(query *compute.Query) string {
+	key := query.Args[0]
+
+	version, err := d.storage.Version(key)
+	if err != nil {
+		return d.readFailure(err, "failed to get version", zap.String("key", key))
+	}
+
+	return strconv.FormatUint(version, 10)
+}
+
+// handleCASQuery replaces the string at a key if it still holds the expected
+// value. It replies 1 if the value was replaced and 0 otherwise.
+func (d *Database) handleCASQuery(query *compute.Query) string {
+	key, expected, value := query.Args[0], query.Args[1], query.Args[2]
+
+	swapped, err := d.storage.CompareAndSet(key, expected, value, d.writeOptions(query)...)
+	if err != nil {
+		return d.writeFailure(err, "failed to compare and set value", zap.String("key", key))
+	}
+
+	if swapped {
+		return replyTrue
+	}
+
+	return replyFalse
+}
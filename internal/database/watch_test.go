@@ -0,0 +1,114 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/crunchydeer30/key-value-database/internal/config"
+	"github.com/crunchydeer30/key-value-database/internal/database/compute"
+	"go.uber.org/zap"
+)
+
+func TestDatabase_Watch(t *testing.T) {
+	db := newTestDatabase(t)
+	session, other := db.NewSession(), db.NewSession()
+
+	steps := []struct {
+		session *Session
+		query   string
+		want    string
+	}{
+		{session, "VERSION balance", "0"},
+		{session, "SET balance 10", "ok"},
+		{session, "VERSION balance", "2"},
+		{session, "CAS balance 5 0", "0"},
+		{session, "VERSION balance", "2"},
+		{session, "CAS balance 10 20", "1"},
+		{session, "VERSION balance", "3"},
+		{session, "CAS missing 10 20", "0"},
+		{session, "RPUSH queue a", "1"},
+		{session, "CAS queue a b", "error: WRONGTYPE operation against a key holding the wrong kind of value"},
+
+		{session, "WATCH balance", "ok"},
+		{session, "MULTI", "ok"},
+		{session, "WATCH queue", "error: WATCH inside MULTI is not allowed"},
+		{session, "SET balance 30", "queued"},
+		{session, "EXEC", compute.ArrayReply("ok")},
+
+		{session, "WATCH balance", "ok"},
+		{other, "SET balance 40", "ok"},
+		{session, "MULTI", "ok"},
+		{session, "SET balance 50", "queued"},
+		{session, "EXEC", replyNil},
+		{session, "GET balance", "40"},
+
+		{session, "WATCH balance", "ok"},
+		{other, "SET balance 40", "ok"},
+		{session, "UNWATCH", "ok"},
+		{session, "MULTI", "ok"},
+		{session, "SET balance 50", "queued"},
+		{session, "EXEC", compute.ArrayReply("ok")},
+
+		{session, "WATCH balance", "ok"},
+		{session, "MULTI", "ok"},
+		{other, "DEL balance", "1"},
+		{session, "EXEC", replyNil},
+
+		{session, "WATCH created", "ok"},
+		{other, "SET created 1", "ok"},
+		{other, "DEL created", "1"},
+		{session, "MULTI", "ok"},
+		{session, "SET created 2", "queued"},
+		{session, "EXEC", replyNil},
+
+		{session, "WATCH missing", "ok"},
+		{other, "DEL missing", "0"},
+		{session, "MULTI", "ok"},
+		{session, "SET missing 1", "queued"},
+		{session, "EXEC", compute.ArrayReply("ok")},
+
+		{session, "WATCH balance", "ok"},
+		{other, "SET balance 60", "ok"},
+		{session, "MULTI", "ok"},
+		{session, "DISCARD", "ok"},
+		{session, "MULTI", "ok"},
+		{session, "SET balance 70", "queued"},
+		{session, "EXEC", compute.ArrayReply("ok")},
+	}
+
+	for _, step := range steps {
+		if got := step.session.HandleQueryString(step.query); got != step.want {
+			t.Fatalf("%s: expected %q, got %q", step.query, step.want, got)
+		}
+	}
+}
+
+func TestDatabase_WatchSwappedDatabase(t *testing.T) {
+	//nolint:exhaustruct
+	db, err := NewDatabase(&config.Config{Engine: config.EngineConfig{Type: "in_memory"}, Databases: 2}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	//nolint:errcheck
+	defer db.Close()
+
+	session, other := db.NewSession(), db.NewSession()
+
+	steps := []struct {
+		session *Session
+		query   string
+		want    string
+	}{
+		{session, "WATCH balance", "ok"},
+		{other, "SWAPDB 0 1", "ok"},
+		{session, "MULTI", "ok"},
+		{session, "SET balance 10", "queued"},
+		{session, "EXEC", replyNil},
+		{session, "GET balance", `record with key "balance" not found`},
+	}
+
+	for _, step := range steps {
+		if got := step.session.HandleQueryString(step.query); got != step.want {
+			t.Fatalf("%s: expected %q, got %q", step.query, step.want, got)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package network
 
 import (
+	"time"
+
 	"go.uber.org/zap"
 )
 
@@ -23,3 +25,11 @@ func WithMaxMessageSize(max uint32) TCPServerOption {
 		s.maxMessageSize = max
 	}
 }
+
+type TCPClientOption func(*TCPClient)
+
+func WithTimeout(timeout time.Duration) TCPClientOption {
+	return func(c *TCPClient) {
+		c.timeout = timeout
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"time"
 )
 
 type TCPClient struct {
@@ -13,9 +14,10 @@ type TCPClient struct {
 	conn    net.Conn
 	reader  *bufio.Reader
 	writer  *bufio.Writer
+	timeout time.Duration
 }
 
-func NewTCPClient(address string) (*TCPClient, error) {
+func NewTCPClient(address string, opts ...TCPClientOption) (*TCPClient, error) {
 	conn, err := net.Dial("tcp", address)
 	if err != nil {
 		return nil, fmt.Errorf("failed to dial %s: %w", address, err)
@@ -24,17 +26,30 @@ func NewTCPClient(address string) (*TCPClient, error) {
 	reader := bufio.NewReader(conn)
 	writer := bufio.NewWriter(conn)
 
-	return &TCPClient{
+	c := &TCPClient{
 		address: address,
 		conn:    conn,
 		reader:  reader,
 		writer:  writer,
-	}, nil
+		timeout: 0,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c, nil
 }
 
 func (c *TCPClient) Send(data []byte) ([]byte, error) {
 	packet := BuildPacket(data)
 
+	if c.timeout > 0 {
+		if err := c.conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+			return nil, fmt.Errorf("failed to set deadline: %w", err)
+		}
+	}
+
 	if _, err := c.writer.Write(packet); err != nil {
 		return nil, fmt.Errorf("failed to write request: %w", err)
 	}
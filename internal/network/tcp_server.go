@@ -18,12 +18,19 @@ type TCPServer struct {
 	maxConnections int
 	maxMessageSize uint32
 	logger         *zap.Logger
-	handler        Handler
+	newHandler     func() Handler
 }
 
 type Handler func([]byte) []byte
 
 func NewTCPServer(addr string, handler Handler, opts ...TCPServerOption) (*TCPServer, error) {
+	return NewSessionTCPServer(addr, func() Handler { return handler }, opts...)
+}
+
+// NewSessionTCPServer is NewTCPServer for handlers that keep state per
+// connection: newHandler is called once for every accepted connection and its
+// handler serves all the requests of that connection.
+func NewSessionTCPServer(addr string, newHandler func() Handler, opts ...TCPServerOption) (*TCPServer, error) {
 	listener, err := net.Listen("tcp", addr)
 	if err != nil {
 		return nil, fmt.Errorf("failed to listen on address %s: %w", addr, err)
@@ -32,7 +39,7 @@ func NewTCPServer(addr string, handler Handler, opts ...TCPServerOption) (*TCPSe
 	//nolint:exhaustruct
 	s := &TCPServer{
 		listener:       listener,
-		handler:        handler,
+		newHandler:     newHandler,
 		logger:         zap.NewNop(),
 		maxMessageSize: 4096,
 	}
@@ -54,6 +61,9 @@ func (s *TCPServer) Serve() {
 	for {
 		conn, err := s.listener.Accept()
 		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
 			s.logger.Error("failed to accept connection", zap.Error(err))
 			continue
 		}
@@ -86,6 +96,7 @@ func (s *TCPServer) Serve() {
 
 func (s *TCPServer) handle(conn net.Conn) {
 	r := bufio.NewReader(conn)
+	handler := s.newHandler()
 
 	for {
 		payload, err := ParsePacket(r)
@@ -97,7 +108,7 @@ func (s *TCPServer) handle(conn net.Conn) {
 			return
 		}
 
-		result := s.handler(payload)
+		result := handler(payload)
 
 		responsePacket := make([]byte, 4+len(result))
 		//nolint:gosec
@@ -111,6 +122,10 @@ func (s *TCPServer) handle(conn net.Conn) {
 	}
 }
 
+func (s *TCPServer) Addr() string {
+	return s.listener.Addr().String()
+}
+
 func (s *TCPServer) Close() error {
 	return s.listener.Close()
 }
@@ -2,6 +2,7 @@ package network
 
 import (
 	"bytes"
+	"fmt"
 	"net"
 	"testing"
 	"time"
@@ -126,3 +127,36 @@ func TestHandle_MalformedPacket(t *testing.T) {
 		t.Errorf("expected no response for malformed packet, got %d bytes", conn.writeBuf.Len())
 	}
 }
+
+func TestHandle_SessionPerConnection(t *testing.T) {
+	newHandler := func() Handler {
+		var count int
+		return func(payload []byte) []byte {
+			count++
+			return fmt.Appendf(nil, "%s %d", payload, count)
+		}
+	}
+
+	server, err := NewSessionTCPServer("0.0.0.0:0", newHandler)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	//nolint:errcheck
+	defer server.Close()
+
+	for range 2 {
+		conn := newMockConn(append(BuildPacket([]byte("a")), BuildPacket([]byte("b"))...))
+		server.handle(conn)
+
+		reader := bytes.NewReader(conn.writeBuf.Bytes())
+		for _, expected := range []string{"a 1", "b 2"} {
+			response, err := ParsePacket(reader)
+			if err != nil {
+				t.Fatalf("failed to parse response packet: %v", err)
+			}
+			if string(response) != expected {
+				t.Fatalf("expected %s, got %s", expected, response)
+			}
+		}
+	}
+}